@@ -0,0 +1,22 @@
+-- 并发限制，使用有序集合记录进行中的请求，超过租约时间的记录视为已结束
+-- KEYS[1]: 限流器唯一标识
+-- ARGV[1]: 最大并发数
+-- ARGV[2]: 请求唯一标识
+-- ARGV[3]: 租约时间 (毫秒)
+-- 返回: 1 允许, 0 拒绝
+
+local key = KEYS[1]
+local limit = tonumber(ARGV[1])
+local member = ARGV[2]
+local ttl = tonumber(ARGV[3])
+
+local now = redis.call('TIME')
+local nowInMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', nowInMs - ttl)
+if redis.call('ZCARD', key) >= limit then
+    return 0
+end
+redis.call('ZADD', key, nowInMs, member)
+redis.call('PEXPIRE', key, ttl)
+return 1
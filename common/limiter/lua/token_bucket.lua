@@ -0,0 +1,47 @@
+-- 按量令牌桶（TPM 等），支持小数速率、强制扣减（允许欠账）和退还
+-- KEYS[1]: 限流器唯一标识
+-- ARGV[1]: 请求令牌数，负数表示退还
+-- ARGV[2]: 令牌生成速率 (每秒，可为小数)
+-- ARGV[3]: 桶容量
+-- ARGV[4]: 是否强制扣减 (1/0)，强制扣减时令牌数可以为负
+-- 返回: {是否允许, 需要等待的毫秒数}
+
+local key = KEYS[1]
+local requested = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local capacity = tonumber(ARGV[3])
+local force = tonumber(ARGV[4]) == 1
+
+local now = redis.call('TIME')
+local nowInMs = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+local bucket = redis.call('HMGET', key, 'tokens', 'last_time')
+local tokens = tonumber(bucket[1])
+local last_time = tonumber(bucket[2])
+
+if not tokens or not last_time then
+    tokens = capacity
+else
+    local elapsed = math.max(0, nowInMs - last_time)
+    tokens = math.min(capacity, tokens + elapsed * rate / 1000)
+end
+
+local allowed = 0
+local wait_ms = 0
+if requested <= 0 then
+    tokens = math.min(capacity, tokens - requested)
+    allowed = 1
+elseif force or tokens >= requested then
+    tokens = tokens - requested
+    allowed = 1
+else
+    -- 超过桶容量的请求由调用方提前拒绝，这里只会等待补足差额
+    local need = requested - tokens
+    wait_ms = math.ceil(need / rate * 1000)
+end
+
+redis.call('HSET', key, 'tokens', tostring(tokens), 'last_time', nowInMs)
+-- 桶从空到满所需时间后自动过期
+redis.call('PEXPIRE', key, math.ceil((capacity - math.min(tokens, 0)) / rate * 1000) + 60000)
+
+return {allowed, wait_ms}
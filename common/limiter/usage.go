@@ -0,0 +1,221 @@
+package limiter
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//go:embed lua/token_bucket.lua
+var tokenBucketScriptSource string
+
+//go:embed lua/concurrency.lua
+var concurrencyScriptSource string
+
+// ErrRequestExceedsCapacity 单次请求的令牌数超过桶容量，等待多久都无法放行
+var ErrRequestExceedsCapacity = errors.New("requested tokens exceed bucket capacity")
+
+var (
+	tokenBucketScript = redis.NewScript(tokenBucketScriptSource)
+	concurrencyScript = redis.NewScript(concurrencyScriptSource)
+)
+
+// UsageLimiter 按量（如 TPM）及并发限流器
+type UsageLimiter interface {
+	// TakeTokens 从容量为 capacity、每 window 补满一次的令牌桶中扣减 requested 个令牌。
+	// requested 为负数时表示退还；force 为 true 时无论余量都扣减（允许欠账）。
+	// 拒绝时返回需要等待的时间；非强制扣减且 requested 超过 capacity 时返回 ErrRequestExceedsCapacity。
+	TakeTokens(ctx context.Context, key string, requested int64, capacity int64, window time.Duration, force bool) (bool, time.Duration, error)
+	// AcquireConcurrency 占用一个并发名额，leaseTTL 为名额最长占用时间，防止进程异常退出后名额无法释放
+	AcquireConcurrency(ctx context.Context, key string, leaseId string, limit int64, leaseTTL time.Duration) (bool, error)
+	// ReleaseConcurrency 释放并发名额
+	ReleaseConcurrency(ctx context.Context, key string, leaseId string) error
+}
+
+func tokenBucketRate(capacity int64, window time.Duration) float64 {
+	if window <= 0 {
+		window = time.Minute
+	}
+	return float64(capacity) / window.Seconds()
+}
+
+// ---------------------------------------------------------------------------
+// Redis 实现
+// ---------------------------------------------------------------------------
+
+type redisUsageLimiter struct {
+	client *redis.Client
+}
+
+// NewRedisUsageLimiter 返回基于 Redis Lua 脚本的 UsageLimiter，适用于多实例部署
+func NewRedisUsageLimiter(client *redis.Client) UsageLimiter {
+	return &redisUsageLimiter{client: client}
+}
+
+func (l *redisUsageLimiter) TakeTokens(ctx context.Context, key string, requested int64, capacity int64, window time.Duration, force bool) (bool, time.Duration, error) {
+	if capacity <= 0 {
+		return true, 0, nil
+	}
+	if !force && requested > capacity {
+		return false, 0, ErrRequestExceedsCapacity
+	}
+	forceArg := 0
+	if force {
+		forceArg = 1
+	}
+	result, err := tokenBucketScript.Run(ctx, l.client, []string{key},
+		requested, tokenBucketRate(capacity, window), capacity, forceArg).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("token bucket failed: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("token bucket returned unexpected result: %v", result)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+func (l *redisUsageLimiter) AcquireConcurrency(ctx context.Context, key string, leaseId string, limit int64, leaseTTL time.Duration) (bool, error) {
+	if limit <= 0 {
+		return true, nil
+	}
+	result, err := concurrencyScript.Run(ctx, l.client, []string{key}, limit, leaseId, leaseTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("concurrency limit failed: %w", err)
+	}
+	return result == 1, nil
+}
+
+func (l *redisUsageLimiter) ReleaseConcurrency(ctx context.Context, key string, leaseId string) error {
+	return l.client.ZRem(ctx, key, leaseId).Err()
+}
+
+// ---------------------------------------------------------------------------
+// 内存实现（未启用 Redis 时使用，仅对单实例有效）
+// ---------------------------------------------------------------------------
+
+type memoryBucket struct {
+	tokens   float64
+	lastTime time.Time
+}
+
+type memoryUsageLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	leases  map[string]map[string]time.Time
+	now     func() time.Time
+}
+
+var (
+	memoryUsageLimiterInstance *memoryUsageLimiter
+	memoryUsageLimiterOnce     sync.Once
+)
+
+// NewMemoryUsageLimiter 返回进程内共享的 UsageLimiter
+func NewMemoryUsageLimiter() UsageLimiter {
+	memoryUsageLimiterOnce.Do(func() {
+		memoryUsageLimiterInstance = newMemoryUsageLimiter(time.Now)
+	})
+	return memoryUsageLimiterInstance
+}
+
+func newMemoryUsageLimiter(now func() time.Time) *memoryUsageLimiter {
+	return &memoryUsageLimiter{
+		buckets: make(map[string]*memoryBucket),
+		leases:  make(map[string]map[string]time.Time),
+		now:     now,
+	}
+}
+
+func (l *memoryUsageLimiter) TakeTokens(_ context.Context, key string, requested int64, capacity int64, window time.Duration, force bool) (bool, time.Duration, error) {
+	if capacity <= 0 {
+		return true, 0, nil
+	}
+	if !force && requested > capacity {
+		return false, 0, ErrRequestExceedsCapacity
+	}
+	rate := tokenBucketRate(capacity, window)
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cleanupLocked(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(capacity), lastTime: now}
+		l.buckets[key] = bucket
+	} else {
+		elapsed := max(now.Sub(bucket.lastTime).Seconds(), 0)
+		bucket.tokens = math.Min(float64(capacity), bucket.tokens+elapsed*rate)
+		bucket.lastTime = now
+	}
+
+	req := float64(requested)
+	if req <= 0 {
+		bucket.tokens = math.Min(float64(capacity), bucket.tokens-req)
+		return true, 0, nil
+	}
+	if force || bucket.tokens >= req {
+		bucket.tokens -= req
+		return true, 0, nil
+	}
+	need := req - bucket.tokens
+	return false, time.Duration(math.Ceil(need/rate*1000)) * time.Millisecond, nil
+}
+
+// cleanupLocked 清理长时间未使用的令牌桶（已补满的桶与新建桶等价）
+func (l *memoryUsageLimiter) cleanupLocked(now time.Time) {
+	if len(l.buckets) < 10_000 {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastTime) > time.Hour {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *memoryUsageLimiter) AcquireConcurrency(_ context.Context, key string, leaseId string, limit int64, leaseTTL time.Duration) (bool, error) {
+	if limit <= 0 {
+		return true, nil
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	leases, ok := l.leases[key]
+	if !ok {
+		leases = make(map[string]time.Time)
+		l.leases[key] = leases
+	}
+	for id, expireAt := range leases {
+		if !now.Before(expireAt) {
+			delete(leases, id)
+		}
+	}
+	if int64(len(leases)) >= limit {
+		return false, nil
+	}
+	leases[leaseId] = now.Add(leaseTTL)
+	return true, nil
+}
+
+func (l *memoryUsageLimiter) ReleaseConcurrency(_ context.Context, key string, leaseId string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if leases, ok := l.leases[key]; ok {
+		delete(leases, leaseId)
+		if len(leases) == 0 {
+			delete(l.leases, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryUsageLimiter_TakeTokens(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newMemoryUsageLimiter(func() time.Time { return now })
+	ctx := context.Background()
+
+	allowed, _, err := l.TakeTokens(ctx, "tpm", 800, 1000, time.Minute, false)
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	// 200 tokens left, need 300 more -> wait 300 / (1000/60s) = 18s
+	allowed, wait, err := l.TakeTokens(ctx, "tpm", 500, 1000, time.Minute, false)
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.Equal(t, 18*time.Second, wait)
+
+	// settling actual usage above the estimate puts the bucket into debt
+	allowed, _, _ = l.TakeTokens(ctx, "tpm", 700, 1000, time.Minute, true)
+	require.True(t, allowed)
+	allowed, _, _ = l.TakeTokens(ctx, "tpm", 1, 1000, time.Minute, false)
+	require.False(t, allowed)
+
+	// refunds are capped at capacity
+	allowed, _, _ = l.TakeTokens(ctx, "tpm", -5000, 1000, time.Minute, true)
+	require.True(t, allowed)
+	allowed, _, _ = l.TakeTokens(ctx, "tpm", 1000, 1000, time.Minute, false)
+	require.True(t, allowed)
+
+	// bucket refills over time
+	now = now.Add(30 * time.Second)
+	allowed, _, _ = l.TakeTokens(ctx, "tpm", 500, 1000, time.Minute, false)
+	require.True(t, allowed)
+}
+
+func TestMemoryUsageLimiter_Concurrency(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newMemoryUsageLimiter(func() time.Time { return now })
+	ctx := context.Background()
+
+	ok, _ := l.AcquireConcurrency(ctx, "c", "a", 2, time.Minute)
+	require.True(t, ok)
+	ok, _ = l.AcquireConcurrency(ctx, "c", "b", 2, time.Minute)
+	require.True(t, ok)
+	ok, _ = l.AcquireConcurrency(ctx, "c", "c", 2, time.Minute)
+	require.False(t, ok)
+
+	require.NoError(t, l.ReleaseConcurrency(ctx, "c", "a"))
+	ok, _ = l.AcquireConcurrency(ctx, "c", "c", 2, time.Minute)
+	require.True(t, ok)
+
+	// expired leases are reclaimed
+	now = now.Add(2 * time.Minute)
+	ok, _ = l.AcquireConcurrency(ctx, "c", "d", 2, time.Minute)
+	require.True(t, ok)
+	ok, _ = l.AcquireConcurrency(ctx, "c", "e", 2, time.Minute)
+	require.True(t, ok)
+}
+
+func TestMemoryUsageLimiter_RequestExceedsCapacity(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	l := newMemoryUsageLimiter(func() time.Time { return now })
+	ctx := context.Background()
+
+	allowed, wait, err := l.TakeTokens(ctx, "tpm", 1500, 1000, time.Minute, false)
+	require.ErrorIs(t, err, ErrRequestExceedsCapacity)
+	require.False(t, allowed)
+	require.Zero(t, wait)
+
+	// forced settlement above capacity is still allowed
+	allowed, _, err = l.TakeTokens(ctx, "tpm", 1500, 1000, time.Minute, true)
+	require.NoError(t, err)
+	require.True(t, allowed)
+}
@@ -68,3 +68,21 @@ func (l *InMemoryRateLimiter) Request(key string, maxRequestNum int, duration in
 	}
 	return true
 }
+
+// Count 返回 key 在最近 duration 秒内记录的请求数，duration 单位为秒
+func (l *InMemoryRateLimiter) Count(key string, duration int64) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	queue, ok := l.store[key]
+	if !ok {
+		return 0
+	}
+	now := time.Now().Unix()
+	count := 0
+	for _, t := range *queue {
+		if now-t < duration {
+			count++
+		}
+	}
+	return count
+}
@@ -19,6 +19,10 @@ const (
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
 	ContextKeyTokenCrossGroupRetry   ContextKey = "token_cross_group_retry"
+	ContextKeyTokenTpmLimit          ContextKey = "token_tpm_limit"
+	ContextKeyTokenConcurrencyLimit  ContextKey = "token_concurrency_limit"
+	ContextKeyTokenOrganizationId    ContextKey = "token_organization_id"
+	ContextKeyTokenResponseCache     ContextKey = "token_response_cache"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -52,6 +56,36 @@ const (
 	ContextKeyUsingGroup  ContextKey = "group"
 	ContextKeyUserName    ContextKey = "username"
 
+	ContextKeyUserTpmLimit         ContextKey = "user_tpm_limit"
+	ContextKeyUserConcurrencyLimit ContextKey = "user_concurrency_limit"
+
+	// ContextKeyUsageLimitLease 当前请求占用的 TPM / 并发限流租约
+	ContextKeyUsageLimitLease ContextKey = "usage_limit_lease"
+	// ContextKeyResponseCache 当前请求的网关响应缓存状态
+	ContextKeyResponseCache ContextKey = "response_cache"
+	// ContextKeyOutputFilter 当前请求的模型输出内容过滤器
+	ContextKeyOutputFilter ContextKey = "output_filter"
+	// ContextKeyPIIRedactor 当前渠道的请求脱敏器，用于在响应中还原占位符
+	ContextKeyPIIRedactor ContextKey = "pii_redactor"
+	// ContextKeyBodyCapture 当前请求的请求 / 响应内容留存状态
+	ContextKeyBodyCapture ContextKey = "body_capture"
+	// ContextKeyModelFallback 当前请求的模型备用链切换记录
+	ContextKeyModelFallback ContextKey = "model_fallback"
+	// ContextKeyHedgeAttempt 对冲请求中当前上下文对应的尝试
+	ContextKeyHedgeAttempt ContextKey = "hedge_attempt"
+	// ContextKeyStreamFailover 流式输出中断后换渠道续写的状态
+	ContextKeyStreamFailover ContextKey = "stream_failover"
+	// ContextKeyGuardrailDecisions 转发前内容审核规则的命中结果
+	ContextKeyGuardrailDecisions ContextKey = "guardrail_decisions"
+	// ContextKeyGuardrailRedactions 内容审核规则对请求文本的改写，透传请求体时同样执行
+	ContextKeyGuardrailRedactions ContextKey = "guardrail_redactions"
+	// ContextKeyOpenAIBatchInput 分发时解析的批处理输入文件摘要（service.OpenAIBatchInputSummary）
+	ContextKeyOpenAIBatchInput ContextKey = "openai_batch_input"
+	// ContextKeyResponsesFinalResponse 上游 Responses API 返回的最终响应 JSON，用于本地保存
+	ContextKeyResponsesFinalResponse ContextKey = "responses_final_response"
+	// ContextKeyResponsesStoreHook 最终响应写回客户端前同步执行的本地保存（func([]byte)）
+	ContextKeyResponsesStoreHook ContextKey = "responses_store_hook"
+
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
@@ -5,4 +5,8 @@ type MultiKeyMode string
 const (
 	MultiKeyModeRandom  MultiKeyMode = "random"  // 随机
 	MultiKeyModePolling MultiKeyMode = "polling" // 轮询
+
+	MultiKeyModeLeastRecentlyUsed MultiKeyMode = "least_recently_used" // 最久未使用
+	MultiKeyModeLeastTokensToday  MultiKeyMode = "least_tokens_today"  // 今日用量最少
+	MultiKeyModeWeighted          MultiKeyMode = "weighted"            // 按权重随机
 )
@@ -0,0 +1,286 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/tidwall/gjson"
+)
+
+// 单次对比最多的渠道数
+const maxCompareChannels = 20
+
+type channelCompareRequest struct {
+	ChannelIds []int `json:"channel_ids"`
+	// Format 请求体格式：openai（默认）、claude、responses
+	Format  string          `json:"format"`
+	Request json.RawMessage `json:"request"`
+}
+
+// channelCompareResult 单个渠道的对比结果
+type channelCompareResult struct {
+	ChannelId     int        `json:"channel_id"`
+	ChannelName   string     `json:"channel_name"`
+	ChannelType   int        `json:"channel_type"`
+	UpstreamModel string     `json:"upstream_model"`
+	Success       bool       `json:"success"`
+	StatusCode    int        `json:"status_code"`
+	Error         string     `json:"error,omitempty"`
+	ErrorCode     string     `json:"error_code,omitempty"`
+	LatencyMs     int64      `json:"latency_ms"`
+	TTFTMs        int64      `json:"ttft_ms"`
+	Usage         *dto.Usage `json:"usage,omitempty"`
+	Quota         int        `json:"quota"`
+	Output        string     `json:"output"`
+
+	startTime time.Time
+}
+
+func (r *channelCompareResult) done() channelCompareResult {
+	r.LatencyMs = time.Since(r.startTime).Milliseconds()
+	return *r
+}
+
+func (r *channelCompareResult) fail(statusCode int, err *types.NewAPIError) channelCompareResult {
+	r.StatusCode = statusCode
+	r.Error = err.Error()
+	r.ErrorCode = string(err.GetErrorCode())
+	return r.done()
+}
+
+func compareRelayFormat(format string) (types.RelayFormat, string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "openai":
+		return types.RelayFormatOpenAI, "/v1/chat/completions", nil
+	case "claude":
+		return types.RelayFormatClaude, "/v1/messages", nil
+	case "responses":
+		return types.RelayFormatOpenAIResponses, "/v1/responses", nil
+	}
+	return "", "", fmt.Errorf("unsupported format: %s", format)
+}
+
+// compareChannel 按真实的适配器流程把请求发给单个渠道，只计算额度，不扣费也不记录消费日志
+func compareChannel(channel *model.Channel, relayFormat types.RelayFormat, requestPath string, body []byte) channelCompareResult {
+	tik := time.Now()
+	result := &channelCompareResult{
+		ChannelId:   channel.Id,
+		ChannelName: channel.Name,
+		ChannelType: channel.Type,
+		startTime:   tik,
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: requestPath},
+		Body:   io.NopCloser(bytes.NewReader(body)),
+		Header: make(http.Header),
+	}
+	c.Request.Header.Set("Content-Type", "application/json")
+	common.SetContextKey(c, constant.ContextKeyRequestStartTime, tik)
+
+	cache, err := model.GetUserCache(1)
+	if err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeQueryDataError))
+	}
+	cache.WriteContext(c)
+	c.Set("id", 1)
+	c.Set("channel", channel.Type)
+	c.Set("base_url", channel.GetBaseURL())
+	group, _ := model.GetUserGroup(1, false)
+	c.Set("group", group)
+
+	request, err := helper.GetAndValidateRequest(c, relayFormat)
+	if err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeInvalidRequest))
+	}
+	modelName := gjson.GetBytes(body, "model").String()
+	if newAPIError := middleware.SetupContextForSelectedChannel(c, channel, modelName); newAPIError != nil {
+		return result.fail(0, newAPIError)
+	}
+
+	info, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeGenRelayInfoFailed))
+	}
+	info.IsChannelTest = true
+	info.InitChannelMeta(c)
+
+	if err = helper.ModelMappedHelper(c, info, request); err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeChannelModelMappedError))
+	}
+	request.SetModelName(info.UpstreamModelName)
+	result.UpstreamModel = info.UpstreamModelName
+
+	meta := request.GetTokenCountMeta()
+	tokens, err := service.EstimateRequestToken(c, meta, info)
+	if err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeCountTokenFailed))
+	}
+	info.SetEstimatePromptTokens(tokens)
+	priceData, err := helper.ModelPriceHelper(c, info, tokens, meta)
+	if err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeModelPriceError))
+	}
+
+	apiType, _ := common.ChannelType2APIType(channel.Type)
+	adaptor := relay.GetAdaptor(apiType)
+	if adaptor == nil {
+		return result.fail(0, types.NewError(fmt.Errorf("invalid api type: %d, adaptor is nil", apiType), types.ErrorCodeInvalidApiType))
+	}
+	adaptor.Init(info)
+
+	var convertedRequest any
+	switch req := request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		convertedRequest, err = adaptor.ConvertOpenAIRequest(c, info, req)
+	case *dto.ClaudeRequest:
+		convertedRequest, err = adaptor.ConvertClaudeRequest(c, info, req)
+	case *dto.OpenAIResponsesRequest:
+		convertedRequest, err = adaptor.ConvertOpenAIResponsesRequest(c, info, *req)
+	default:
+		err = errors.New("invalid compare request type")
+	}
+	if err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeConvertRequestFailed))
+	}
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeJsonMarshalFailed))
+	}
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled)
+	if err != nil {
+		return result.fail(0, types.NewError(err, types.ErrorCodeConvertRequestFailed))
+	}
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
+		if err != nil {
+			if fixedErr, ok := relaycommon.AsParamOverrideReturnError(err); ok {
+				return result.fail(0, relaycommon.NewAPIErrorFromParamOverride(fixedErr))
+			}
+			return result.fail(0, types.NewError(err, types.ErrorCodeChannelParamOverrideInvalid))
+		}
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(jsonData))
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return result.fail(0, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError))
+	}
+	var httpResp *http.Response
+	if resp != nil {
+		httpResp = resp.(*http.Response)
+		if httpResp.StatusCode != http.StatusOK {
+			return result.fail(httpResp.StatusCode, service.RelayErrorHandler(c.Request.Context(), httpResp, true))
+		}
+	}
+	statusCode := http.StatusOK
+	if httpResp != nil {
+		statusCode = httpResp.StatusCode
+	}
+	usageA, respErr := adaptor.DoResponse(c, httpResp, info)
+	if respErr != nil {
+		return result.fail(statusCode, respErr)
+	}
+	if info.IsStream && info.HasSendResponse() {
+		result.TTFTMs = info.FirstResponseTime.Sub(info.StartTime).Milliseconds()
+	}
+	respBody := w.Body.Bytes()
+	result.Output = service.ExtractOutputText(respBody, info.IsStream)
+	if bodyErr := detectErrorFromTestResponseBody(respBody); bodyErr != nil {
+		return result.fail(statusCode, types.NewOpenAIError(bodyErr, types.ErrorCodeBadResponseBody, http.StatusInternalServerError))
+	}
+	usage, usageErr := coerceTestUsage(usageA, info.IsStream, info.GetEstimatePromptTokens())
+	if usageErr != nil {
+		return result.fail(statusCode, types.NewOpenAIError(usageErr, types.ErrorCodeBadResponseBody, http.StatusInternalServerError))
+	}
+
+	result.Success = true
+	result.StatusCode = statusCode
+	result.Usage = usage
+	result.Quota = calcChannelTestQuota(priceData, usage)
+	return result.done()
+}
+
+// CompareChannels 将同一请求并发发送到多个渠道，返回各渠道的状态、耗时、首字时间、用量、额度与输出文本
+func CompareChannels(c *gin.Context) {
+	var req channelCompareRequest
+	if err := common.DecodeJson(c.Request.Body, &req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	req.ChannelIds = lo.Uniq(req.ChannelIds)
+	if len(req.ChannelIds) == 0 || len(req.ChannelIds) > maxCompareChannels {
+		common.ApiErrorMsg(c, fmt.Sprintf("channel_ids must contain 1 to %d channels", maxCompareChannels))
+		return
+	}
+	if len(req.Request) == 0 || !gjson.ValidBytes(req.Request) || !gjson.GetBytes(req.Request, "model").Exists() {
+		common.ApiErrorMsg(c, "request must be a JSON object with a model")
+		return
+	}
+	relayFormat, requestPath, err := compareRelayFormat(req.Format)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+
+	channels := make([]*model.Channel, 0, len(req.ChannelIds))
+	for _, channelId := range req.ChannelIds {
+		channel, err := model.CacheGetChannel(channelId)
+		if err != nil {
+			channel, err = model.GetChannelById(channelId, true)
+			if err != nil {
+				common.ApiErrorMsg(c, fmt.Sprintf("channel %d not found", channelId))
+				return
+			}
+		}
+		channels = append(channels, channel)
+	}
+
+	results := make([]channelCompareResult, len(channels))
+	var wg sync.WaitGroup
+	for i, channel := range channels {
+		wg.Add(1)
+		go func(i int, channel *model.Channel) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					common.SysError(fmt.Sprintf("channel compare panic: channel_id=%d, %v", channel.Id, r))
+					results[i] = channelCompareResult{ChannelId: channel.Id, ChannelName: channel.Name, ChannelType: channel.Type, Error: fmt.Sprintf("panic: %v", r)}
+				}
+			}()
+			results[i] = compareChannel(channel, relayFormat, requestPath, req.Request)
+		}(i, channel)
+	}
+	wg.Wait()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    results,
+	})
+}
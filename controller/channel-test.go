@@ -469,16 +469,7 @@ func testChannel(channel *model.Channel, testModel string, endpointType string,
 	}
 	info.SetEstimatePromptTokens(usage.PromptTokens)
 
-	quota := 0
-	if !priceData.UsePrice {
-		quota = usage.PromptTokens + int(math.Round(float64(usage.CompletionTokens)*priceData.CompletionRatio))
-		quota = int(math.Round(float64(quota) * priceData.ModelRatio))
-		if priceData.ModelRatio != 0 && quota <= 0 {
-			quota = 1
-		}
-	} else {
-		quota = int(priceData.ModelPrice * common.QuotaPerUnit)
-	}
+	quota := calcChannelTestQuota(priceData, usage)
 	tok := time.Now()
 	milliseconds := tok.Sub(tik).Milliseconds()
 	consumedTime := float64(milliseconds) / 1000.0
@@ -505,6 +496,19 @@ func testChannel(channel *model.Channel, testModel string, endpointType string,
 	}
 }
 
+// calcChannelTestQuota 按模型倍率或价格计算测试请求的额度，不计分组倍率
+func calcChannelTestQuota(priceData types.PriceData, usage *dto.Usage) int {
+	if priceData.UsePrice {
+		return int(priceData.ModelPrice * common.QuotaPerUnit)
+	}
+	quota := usage.PromptTokens + int(math.Round(float64(usage.CompletionTokens)*priceData.CompletionRatio))
+	quota = int(math.Round(float64(quota) * priceData.ModelRatio))
+	if priceData.ModelRatio != 0 && quota <= 0 {
+		quota = 1
+	}
+	return quota
+}
+
 func coerceTestUsage(usageAny any, isStream bool, estimatePromptTokens int) (*dto.Usage, error) {
 	switch u := usageAny.(type) {
 	case *dto.Usage:
@@ -66,6 +66,7 @@ func clearChannelInfo(channel *model.Channel) {
 		channel.ChannelInfo.MultiKeyDisabledReason = nil
 		channel.ChannelInfo.MultiKeyDisabledTime = nil
 	}
+	channel.ScheduleStatus = channel.GetScheduleStatus(time.Now())
 }
 
 func GetAllChannels(c *gin.Context) {
@@ -438,6 +439,9 @@ func validateChannel(channel *model.Channel, isAdd bool) error {
 	if err := channel.ValidateSettings(); err != nil {
 		return fmt.Errorf("渠道额外设置[channel setting] 格式错误：%s", err.Error())
 	}
+	if err := channel.ValidateSchedule(); err != nil {
+		return fmt.Errorf("渠道可用时段格式错误：%s", err.Error())
+	}
 
 	// 如果是添加操作，检查 channel 和 key 是否为空
 	if isAdd {
@@ -1210,11 +1214,14 @@ func CopyChannel(c *gin.Context) {
 // MultiKeyManageRequest represents the request for multi-key management operations
 type MultiKeyManageRequest struct {
 	ChannelId int    `json:"channel_id"`
-	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status"
-	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, and delete_key actions
+	Action    string `json:"action"`              // "disable_key", "enable_key", "delete_key", "delete_disabled_keys", "get_key_status", "reset_breaker", "set_key_limits", "reset_key_usage"
+	KeyIndex  *int   `json:"key_index,omitempty"` // for disable_key, enable_key, delete_key, reset_breaker, set_key_limits and reset_key_usage actions
 	Page      int    `json:"page,omitempty"`      // for get_key_status pagination
 	PageSize  int    `json:"page_size,omitempty"` // for get_key_status pagination
 	Status    *int   `json:"status,omitempty"`    // for get_key_status filtering: 1=enabled, 2=manual_disabled, 3=auto_disabled, nil=all
+	// for set_key_limits: weight <= 0 resets to the default weight 1, daily_token_budget <= 0 removes the budget
+	Weight           *int   `json:"weight,omitempty"`
+	DailyTokenBudget *int64 `json:"daily_token_budget,omitempty"`
 }
 
 // MultiKeyStatusResponse represents the response for key status query
@@ -1228,6 +1235,10 @@ type MultiKeyStatusResponse struct {
 	EnabledCount        int `json:"enabled_count"`
 	ManualDisabledCount int `json:"manual_disabled_count"`
 	AutoDisabledCount   int `json:"auto_disabled_count"`
+	// ChannelBreaker is the channel-level circuit breaker state
+	ChannelBreaker service.CircuitBreakerSnapshot `json:"channel_breaker"`
+	// MultiKeyMode is the key selection mode of the channel
+	MultiKeyMode constant.MultiKeyMode `json:"multi_key_mode"`
 }
 
 type KeyStatus struct {
@@ -1236,6 +1247,15 @@ type KeyStatus struct {
 	DisabledTime int64  `json:"disabled_time,omitempty"`
 	Reason       string `json:"reason,omitempty"`
 	KeyPreview   string `json:"key_preview"` // first 10 chars of key for identification
+	// Breaker is the circuit breaker state of the key, only filled for keys on the current page
+	Breaker *service.CircuitBreakerSnapshot `json:"breaker,omitempty"`
+	// RateLimit is the upstream rate-limit state of the key, only filled for keys on the current page
+	RateLimit *service.UpstreamRateLimitSnapshot `json:"rate_limit,omitempty"`
+	// Weight is used by the weighted mode, DailyTokenBudget 0 means unlimited
+	Weight           int                 `json:"weight"`
+	DailyTokenBudget int64               `json:"daily_token_budget"`
+	Usage            model.MultiKeyUsage `json:"usage"`
+	BudgetExhausted  bool                `json:"budget_exhausted"`
 }
 
 // ManageMultiKeys handles multi-key management operations
@@ -1268,6 +1288,9 @@ func ManageMultiKeys(c *gin.Context) {
 	lock.Lock()
 	defer lock.Unlock()
 
+	// key用量计数以缓存中的实时数据为准，展示与保存时都使用最新的计数
+	channel.ChannelInfo.MultiKeyUsage = model.GetMultiKeyUsageSnapshot(channel)
+
 	switch request.Action {
 	case "get_key_status":
 		keys := channel.GetKeys()
@@ -1324,11 +1347,15 @@ func ManageMultiKeys(c *gin.Context) {
 			}
 
 			allKeyStatusList = append(allKeyStatusList, KeyStatus{
-				Index:        i,
-				Status:       status,
-				DisabledTime: disabledTime,
-				Reason:       reason,
-				KeyPreview:   keyPreview,
+				Index:            i,
+				Status:           status,
+				DisabledTime:     disabledTime,
+				Reason:           reason,
+				KeyPreview:       keyPreview,
+				Weight:           channel.ChannelInfo.GetKeyWeight(i),
+				DailyTokenBudget: channel.ChannelInfo.MultiKeyDailyTokenBudgets[i],
+				Usage:            channel.ChannelInfo.GetKeyUsage(i),
+				BudgetExhausted:  channel.ChannelInfo.IsKeyBudgetExhausted(i),
 			})
 		}
 
@@ -1366,6 +1393,12 @@ func ManageMultiKeys(c *gin.Context) {
 		if start < filteredTotal {
 			pageKeyStatusList = filteredKeyStatusList[start:end]
 		}
+		for i := range pageKeyStatusList {
+			breaker := service.GetCircuitBreakerSnapshot(channel.Id, pageKeyStatusList[i].Index)
+			pageKeyStatusList[i].Breaker = &breaker
+			rateLimit := service.GetUpstreamRateLimitSnapshot(channel.Id, pageKeyStatusList[i].Index)
+			pageKeyStatusList[i].RateLimit = &rateLimit
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
@@ -1379,6 +1412,8 @@ func ManageMultiKeys(c *gin.Context) {
 				EnabledCount:        enabledCount,        // Overall statistics
 				ManualDisabledCount: manualDisabledCount, // Overall statistics
 				AutoDisabledCount:   autoDisabledCount,   // Overall statistics
+				ChannelBreaker:      service.GetChannelCircuitBreakerSnapshot(channel.Id),
+				MultiKeyMode:        channel.ChannelInfo.MultiKeyMode,
 			},
 		})
 		return
@@ -1563,6 +1598,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
 
+		indexMap := make(map[int]int)
 		newIndex := 0
 		for i, key := range keys {
 			// 跳过要删除的密钥
@@ -1571,6 +1607,7 @@ func ManageMultiKeys(c *gin.Context) {
 			}
 
 			remainingKeys = append(remainingKeys, key)
+			indexMap[i] = newIndex
 
 			// 保留其他密钥的状态信息，重新索引
 			if channel.ChannelInfo.MultiKeyStatusList != nil {
@@ -1605,14 +1642,20 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.RemapKeyIndexes(indexMap)
 
 		err = channel.Update()
 		if err != nil {
 			common.ApiError(c, err)
 			return
 		}
+		if err := model.RemapChannelKeyUsages(channel.Id, indexMap); err != nil {
+			common.SysLog(fmt.Sprintf("failed to remap multi-key usage: channel_id=%d, error=%v", channel.Id, err))
+		}
 
 		model.InitChannelCache()
+		// 删除密钥后索引会重排，清空该渠道的熔断状态避免错位
+		_, _ = service.ResetCircuitBreaker(channel.Id, nil)
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": "密钥已删除",
@@ -1626,6 +1669,7 @@ func ManageMultiKeys(c *gin.Context) {
 		var newStatusList = make(map[int]int)
 		var newDisabledTime = make(map[int]int64)
 		var newDisabledReason = make(map[int]string)
+		indexMap := make(map[int]int)
 
 		newIndex := 0
 		for i, key := range keys {
@@ -1641,6 +1685,7 @@ func ManageMultiKeys(c *gin.Context) {
 				deletedCount++
 			} else {
 				remainingKeys = append(remainingKeys, key)
+				indexMap[i] = newIndex
 				// 保留非自动禁用密钥的状态信息，重新索引
 				if status != 1 {
 					newStatusList[newIndex] = status
@@ -1673,14 +1718,19 @@ func ManageMultiKeys(c *gin.Context) {
 		channel.ChannelInfo.MultiKeyStatusList = newStatusList
 		channel.ChannelInfo.MultiKeyDisabledTime = newDisabledTime
 		channel.ChannelInfo.MultiKeyDisabledReason = newDisabledReason
+		channel.ChannelInfo.RemapKeyIndexes(indexMap)
 
 		err = channel.Update()
 		if err != nil {
 			common.ApiError(c, err)
 			return
 		}
+		if err := model.RemapChannelKeyUsages(channel.Id, indexMap); err != nil {
+			common.SysLog(fmt.Sprintf("failed to remap multi-key usage: channel_id=%d, error=%v", channel.Id, err))
+		}
 
 		model.InitChannelCache()
+		_, _ = service.ResetCircuitBreaker(channel.Id, nil)
 		c.JSON(http.StatusOK, gin.H{
 			"success": true,
 			"message": fmt.Sprintf("已删除 %d 个自动禁用的密钥", deletedCount),
@@ -1688,6 +1738,103 @@ func ManageMultiKeys(c *gin.Context) {
 		})
 		return
 
+	case "reset_breaker":
+		if request.KeyIndex != nil && (*request.KeyIndex < 0 || *request.KeyIndex >= channel.ChannelInfo.MultiKeySize) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥索引超出范围",
+			})
+			return
+		}
+		deleted, err := service.ResetCircuitBreaker(channel.Id, request.KeyIndex)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "熔断状态已重置",
+			"data":    deleted,
+		})
+		return
+
+	case "set_key_limits":
+		if request.KeyIndex == nil || *request.KeyIndex < 0 || *request.KeyIndex >= channel.ChannelInfo.MultiKeySize {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥索引超出范围",
+			})
+			return
+		}
+		if request.Weight == nil && request.DailyTokenBudget == nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "未指定要设置的权重或每日预算",
+			})
+			return
+		}
+
+		keyIndex := *request.KeyIndex
+		if request.Weight != nil {
+			if channel.ChannelInfo.MultiKeyWeights == nil {
+				channel.ChannelInfo.MultiKeyWeights = make(map[int]int)
+			}
+			if *request.Weight > 0 {
+				channel.ChannelInfo.MultiKeyWeights[keyIndex] = *request.Weight
+			} else {
+				delete(channel.ChannelInfo.MultiKeyWeights, keyIndex)
+			}
+		}
+		if request.DailyTokenBudget != nil {
+			if channel.ChannelInfo.MultiKeyDailyTokenBudgets == nil {
+				channel.ChannelInfo.MultiKeyDailyTokenBudgets = make(map[int]int64)
+			}
+			if *request.DailyTokenBudget > 0 {
+				channel.ChannelInfo.MultiKeyDailyTokenBudgets[keyIndex] = *request.DailyTokenBudget
+			} else {
+				delete(channel.ChannelInfo.MultiKeyDailyTokenBudgets, keyIndex)
+			}
+		}
+
+		err = channel.Update()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		model.InitChannelCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "密钥限制已更新",
+		})
+		return
+
+	case "reset_key_usage":
+		if request.KeyIndex != nil && (*request.KeyIndex < 0 || *request.KeyIndex >= channel.ChannelInfo.MultiKeySize) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "密钥索引超出范围",
+			})
+			return
+		}
+		if err := model.ResetMultiKeyUsage(channel, request.KeyIndex); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		err = channel.Update()
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+
+		model.InitChannelCache()
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "密钥用量已重置",
+		})
+		return
+
 	default:
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
@@ -1697,6 +1844,88 @@ func ManageMultiKeys(c *gin.Context) {
 	}
 }
 
+// GetChannelCircuitBreaker 获取渠道级熔断器状态
+func GetChannelCircuitBreaker(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    service.GetChannelCircuitBreakerSnapshot(id),
+	})
+}
+
+// ResetChannelCircuitBreaker 重置渠道级及其所有 key 的熔断器
+func ResetChannelCircuitBreaker(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	deleted, err := service.ResetCircuitBreaker(id, nil)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    deleted,
+	})
+}
+
+// GetChannelUpstreamRateLimit 获取渠道各 key 最近一次上游返回的限流状态
+func GetChannelUpstreamRateLimit(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, true)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	keyCount := 1
+	if channel.ChannelInfo.IsMultiKey {
+		keyCount = len(channel.GetKeys())
+	}
+	snapshots := make([]service.UpstreamRateLimitSnapshot, 0, keyCount)
+	for i := 0; i < keyCount; i++ {
+		snapshots = append(snapshots, service.GetUpstreamRateLimitSnapshot(id, i))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    snapshots,
+	})
+}
+
+// GetChannelSchedule 获取渠道可用时段的当前状态与下一次切换时间
+func GetChannelSchedule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	channel, err := model.GetChannelById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"schedule": channel.GetSchedule(),
+			"status":   channel.GetScheduleStatus(time.Now()),
+		},
+	})
+}
+
 // OllamaPullModel 拉取 Ollama 模型
 func OllamaPullModel(c *gin.Context) {
 	var req struct {
@@ -0,0 +1,240 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	conversationItemsDefaultLimit = 20
+	conversationItemsMaxLimit     = 100
+)
+
+type conversationCreateRequest struct {
+	Items    []map[string]any `json:"items"`
+	Metadata json.RawMessage  `json:"metadata"`
+}
+
+type conversationUpdateRequest struct {
+	Metadata json.RawMessage `json:"metadata"`
+}
+
+type conversationItemsCreateRequest struct {
+	Items []map[string]any `json:"items"`
+}
+
+func conversationEnabled(c *gin.Context) bool {
+	if !operation_setting.GetConversationSetting().Enabled {
+		RelayNotImplemented(c)
+		return false
+	}
+	return true
+}
+
+func getUserConversation(c *gin.Context) (*model.Conversation, bool) {
+	conversationId := c.Param("id")
+	conversation, err := service.GetConversation(c.GetInt("id"), conversationId)
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, "failed to query conversation")
+		return nil, false
+	}
+	if conversation == nil {
+		openAIBatchError(c, http.StatusNotFound, fmt.Sprintf("Conversation with id '%s' not found.", conversationId))
+		return nil, false
+	}
+	return conversation, true
+}
+
+// RelayConversationCreate POST /v1/conversations
+func RelayConversationCreate(c *gin.Context) {
+	if !conversationEnabled(c) {
+		return
+	}
+	var req conversationCreateRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		openAIBatchError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Items) > service.ConversationMaxItemsPerRequest {
+		openAIBatchError(c, http.StatusBadRequest, fmt.Sprintf("items must contain at most %d items", service.ConversationMaxItemsPerRequest))
+		return
+	}
+	conversation, err := service.CreateConversation(c.GetInt("id"), req.Metadata, req.Items)
+	if err != nil {
+		openAIBatchError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, service.ConversationObject(conversation))
+}
+
+// RelayConversationRetrieve GET /v1/conversations/:id
+func RelayConversationRetrieve(c *gin.Context) {
+	if !conversationEnabled(c) {
+		return
+	}
+	conversation, ok := getUserConversation(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, service.ConversationObject(conversation))
+}
+
+// RelayConversationUpdate POST /v1/conversations/:id，仅支持更新 metadata
+func RelayConversationUpdate(c *gin.Context) {
+	if !conversationEnabled(c) {
+		return
+	}
+	conversation, ok := getUserConversation(c)
+	if !ok {
+		return
+	}
+	var req conversationUpdateRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		openAIBatchError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if common.GetJsonType(req.Metadata) != "object" {
+		openAIBatchError(c, http.StatusBadRequest, "metadata must be an object")
+		return
+	}
+	conversation.Metadata = string(req.Metadata)
+	conversation.UpdatedAt = common.GetTimestamp()
+	if err := model.UpdateConversationMetadata(conversation); err != nil {
+		common.SysError("update conversation error: " + err.Error())
+		openAIBatchError(c, http.StatusInternalServerError, "failed to update conversation")
+		return
+	}
+	c.JSON(http.StatusOK, service.ConversationObject(conversation))
+}
+
+// RelayConversationDelete DELETE /v1/conversations/:id，同时删除全部会话项
+func RelayConversationDelete(c *gin.Context) {
+	if !conversationEnabled(c) {
+		return
+	}
+	conversation, ok := getUserConversation(c)
+	if !ok {
+		return
+	}
+	if err := model.DeleteConversation(conversation); err != nil {
+		common.SysError("delete conversation error: " + err.Error())
+		openAIBatchError(c, http.StatusInternalServerError, "failed to delete conversation")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      conversation.ConversationId,
+		"object":  "conversation.deleted",
+		"deleted": true,
+	})
+}
+
+// RelayConversationItemsList GET /v1/conversations/:id/items
+func RelayConversationItemsList(c *gin.Context) {
+	if !conversationEnabled(c) {
+		return
+	}
+	conversation, ok := getUserConversation(c)
+	if !ok {
+		return
+	}
+	limit := conversationItemsDefaultLimit
+	if v := c.Query("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > conversationItemsMaxLimit {
+			openAIBatchError(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", conversationItemsMaxLimit))
+			return
+		}
+		limit = parsed
+	}
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		openAIBatchError(c, http.StatusBadRequest, "order must be 'asc' or 'desc'")
+		return
+	}
+	items, hasMore, err := model.GetConversationItems(conversation.ConversationId, c.Query("after"), limit, order == "desc")
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, "failed to query conversation items")
+		return
+	}
+	c.JSON(http.StatusOK, service.ConversationItemsList(items, hasMore))
+}
+
+// RelayConversationItemsCreate POST /v1/conversations/:id/items
+func RelayConversationItemsCreate(c *gin.Context) {
+	if !conversationEnabled(c) {
+		return
+	}
+	conversation, ok := getUserConversation(c)
+	if !ok {
+		return
+	}
+	var req conversationItemsCreateRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		openAIBatchError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Items) == 0 || len(req.Items) > service.ConversationMaxItemsPerRequest {
+		openAIBatchError(c, http.StatusBadRequest, fmt.Sprintf("items must contain between 1 and %d items", service.ConversationMaxItemsPerRequest))
+		return
+	}
+	items, err := service.AppendConversationItems(conversation, req.Items)
+	if err != nil {
+		openAIBatchError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, service.ConversationItemsList(items, false))
+}
+
+// RelayConversationItemRetrieve GET /v1/conversations/:id/items/:item_id
+func RelayConversationItemRetrieve(c *gin.Context) {
+	if !conversationEnabled(c) {
+		return
+	}
+	conversation, ok := getUserConversation(c)
+	if !ok {
+		return
+	}
+	itemId := c.Param("item_id")
+	item, err := model.GetConversationItem(conversation.ConversationId, itemId)
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, "failed to query conversation item")
+		return
+	}
+	if item == nil {
+		openAIBatchError(c, http.StatusNotFound, fmt.Sprintf("Item with id '%s' not found.", itemId))
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(item.Content))
+}
+
+// RelayConversationItemDelete DELETE /v1/conversations/:id/items/:item_id，返回更新后的会话
+func RelayConversationItemDelete(c *gin.Context) {
+	if !conversationEnabled(c) {
+		return
+	}
+	conversation, ok := getUserConversation(c)
+	if !ok {
+		return
+	}
+	itemId := c.Param("item_id")
+	deleted, err := model.DeleteConversationItem(conversation, itemId, common.GetTimestamp())
+	if err != nil {
+		common.SysError("delete conversation item error: " + err.Error())
+		openAIBatchError(c, http.StatusInternalServerError, "failed to delete conversation item")
+		return
+	}
+	if !deleted {
+		openAIBatchError(c, http.StatusNotFound, fmt.Sprintf("Item with id '%s' not found.", itemId))
+		return
+	}
+	c.JSON(http.StatusOK, service.ConversationObject(conversation))
+}
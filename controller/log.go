@@ -1,11 +1,14 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -162,6 +165,10 @@ func DeleteHistoryLogs(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	// 清理历史日志时一并清理过期会话
+	if _, err := service.CleanupExpiredConversations(c.Request.Context()); err != nil {
+		logger.LogWarn(c, fmt.Sprintf("conversation cleanup failed: %v", err))
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
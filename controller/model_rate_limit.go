@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserModelRequestRateLimit 获取用户当前的模型请求速率限制计数器状态，可通过 group 参数指定分组，默认为用户分组
+func GetUserModelRequestRateLimit(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	user, err := model.GetUserById(id, false)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	myRole := c.GetInt("role")
+	if myRole <= user.Role && myRole != common.RoleRootUser {
+		common.ApiErrorI18n(c, i18n.MsgUserNoPermissionSameLevel)
+		return
+	}
+	group := c.Query("group")
+	if group == "" {
+		group = user.Group
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data": gin.H{
+			"enabled":          setting.ModelRequestRateLimitEnabled,
+			"duration_minutes": setting.ModelRequestRateLimitDurationMinutes,
+			"group":            group,
+			"counters":         middleware.GetModelRequestRateLimitStatus(id, group),
+		},
+	})
+}
@@ -0,0 +1,462 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAIBatchError 返回 OpenAI 格式的错误
+func openAIBatchError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{
+		"error": types.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+		},
+	})
+}
+
+func openAIBatchEnabled(c *gin.Context) bool {
+	if !operation_setting.GetBatchSetting().Enabled {
+		RelayNotImplemented(c)
+		return false
+	}
+	return true
+}
+
+// proxyOpenAIBatchRequest 将请求转发到固定的渠道并原样返回上游响应，返回上游状态码
+func proxyOpenAIBatchRequest(c *gin.Context, channel *model.Channel, key string, method string, path string, body io.Reader, contentType string) int {
+	resp, err := service.DoOpenAIBatchRequest(c.Request.Context(), channel, key, method, path, body, contentType)
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("openai batch proxy %s %s failed: %s", method, path, err.Error()))
+		openAIBatchError(c, http.StatusBadGateway, "upstream request failed")
+		return http.StatusBadGateway
+	}
+	defer resp.Body.Close()
+	for _, header := range []string{"Content-Type", "Content-Disposition", "Content-Length"} {
+		if v := resp.Header.Get(header); v != "" {
+			c.Header(header, v)
+		}
+	}
+	c.Status(resp.StatusCode)
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		logger.LogError(c, fmt.Sprintf("openai batch proxy copy response failed: %s", err.Error()))
+	}
+	return resp.StatusCode
+}
+
+// getPinnedRelayFile 获取用户的文件及其绑定的渠道
+func getPinnedRelayFile(c *gin.Context, fileId string) (*model.RelayFile, *model.Channel, bool) {
+	file, err := model.GetRelayFile(c.GetInt("id"), fileId)
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, "failed to query file")
+		return nil, nil, false
+	}
+	if file == nil {
+		openAIBatchError(c, http.StatusNotFound, fmt.Sprintf("No such File object: %s", fileId))
+		return nil, nil, false
+	}
+	channel, err := model.CacheGetChannel(file.ChannelId)
+	if err != nil {
+		openAIBatchError(c, http.StatusServiceUnavailable, "the channel of this file is unavailable")
+		return nil, nil, false
+	}
+	return file, channel, true
+}
+
+// getPinnedBatchTask 获取用户的批处理任务及其绑定的渠道
+func getPinnedBatchTask(c *gin.Context, batchId string) (*model.Task, *model.Channel, bool) {
+	task, exist, err := model.GetByTaskId(c.GetInt("id"), batchId)
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, "failed to query batch")
+		return nil, nil, false
+	}
+	if !exist || task.Platform != constant.TaskPlatformOpenAIBatch {
+		openAIBatchError(c, http.StatusNotFound, fmt.Sprintf("No such Batch object: %s", batchId))
+		return nil, nil, false
+	}
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		openAIBatchError(c, http.StatusServiceUnavailable, "the channel of this batch is unavailable")
+		return nil, nil, false
+	}
+	return task, channel, true
+}
+
+// RelayFileUpload POST /v1/files，上传到分发选中的渠道并记录文件与渠道的绑定关系
+func RelayFileUpload(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	channelType := common.GetContextKeyInt(c, constant.ContextKeyChannelType)
+	if !service.IsOpenAIBatchChannel(channelType) {
+		openAIBatchError(c, http.StatusBadRequest, "the selected channel does not support the Files API")
+		return
+	}
+	channel, err := model.CacheGetChannel(common.GetContextKeyInt(c, constant.ContextKeyChannelId))
+	if err != nil {
+		openAIBatchError(c, http.StatusServiceUnavailable, "failed to get channel")
+		return
+	}
+
+	form, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		openAIBatchError(c, http.StatusBadRequest, "invalid multipart form: "+err.Error())
+		return
+	}
+	purpose := ""
+	if values := form.Value["purpose"]; len(values) > 0 {
+		purpose = values[0]
+	}
+	files := form.File["file"]
+	if purpose == "" || len(files) == 0 {
+		openAIBatchError(c, http.StatusBadRequest, "file and purpose are required")
+		return
+	}
+	fileHeader := files[0]
+	// 批处理输入文件的模型与预估用量以文件内容为准，分发时已解析
+	var batchInput service.OpenAIBatchInputSummary
+	if purpose == "batch" {
+		summary, ok := common.GetContextKeyType[service.OpenAIBatchInputSummary](c, constant.ContextKeyOpenAIBatchInput)
+		if !ok {
+			openAIBatchError(c, http.StatusBadRequest, "invalid batch input file")
+			return
+		}
+		batchInput = summary
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		openAIBatchError(c, http.StatusBadRequest, "failed to read file")
+		return
+	}
+	defer src.Close()
+
+	// 重新构建表单，去掉网关自用的 model 字段
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("purpose", purpose)
+	part, err := writer.CreateFormFile("file", fileHeader.Filename)
+	if err == nil {
+		_, err = io.Copy(part, src)
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, "failed to build upstream request")
+		return
+	}
+
+	key := common.GetContextKeyString(c, constant.ContextKeyChannelKey)
+	resp, err := service.DoOpenAIBatchRequest(c.Request.Context(), channel, key, http.MethodPost, "/v1/files", &body, writer.FormDataContentType())
+	if err != nil {
+		logger.LogError(c, "upload file to upstream failed: "+err.Error())
+		openAIBatchError(c, http.StatusBadGateway, "upstream request failed")
+		return
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		openAIBatchError(c, http.StatusBadGateway, "failed to read upstream response")
+		return
+	}
+	if resp.StatusCode == http.StatusOK {
+		var file dto.OpenAIFile
+		if err := common.Unmarshal(responseBody, &file); err != nil || file.ID == "" {
+			openAIBatchError(c, http.StatusBadGateway, "invalid upstream response")
+			return
+		}
+		record := &model.RelayFile{
+			FileId:       file.ID,
+			UserId:       c.GetInt("id"),
+			ChannelId:    channel.Id,
+			KeyIndex:     common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex),
+			ModelName:    batchInput.Model,
+			Purpose:      file.Purpose,
+			Filename:     file.Filename,
+			Bytes:        file.Bytes,
+			CreatedAt:    file.CreatedAt,
+			Requests:     batchInput.Requests,
+			PromptTokens: batchInput.PromptTokens,
+		}
+		if record.CreatedAt == 0 {
+			record.CreatedAt = time.Now().Unix()
+		}
+		if err := record.Insert(); err != nil {
+			common.SysError("insert relay file error: " + err.Error())
+		}
+	}
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), responseBody)
+}
+
+// RelayFileList GET /v1/files，列出用户通过网关上传的文件
+func RelayFileList(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 10000 {
+		limit = 10000
+	}
+	files, err := model.GetUserRelayFiles(c.GetInt("id"), c.Query("purpose"), limit)
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, "failed to query files")
+		return
+	}
+	data := make([]dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, dto.OpenAIFile{
+			ID:        file.FileId,
+			Object:    "file",
+			Bytes:     file.Bytes,
+			CreatedAt: file.CreatedAt,
+			Filename:  file.Filename,
+			Purpose:   file.Purpose,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": false,
+	})
+}
+
+// RelayFileRetrieve GET /v1/files/:id
+func RelayFileRetrieve(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	file, channel, ok := getPinnedRelayFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	proxyOpenAIBatchRequest(c, channel, service.OpenAIBatchChannelKey(channel, file.KeyIndex), http.MethodGet, "/v1/files/"+file.FileId, nil, "")
+}
+
+// RelayFileContent GET /v1/files/:id/content
+func RelayFileContent(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	file, channel, ok := getPinnedRelayFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	proxyOpenAIBatchRequest(c, channel, service.OpenAIBatchChannelKey(channel, file.KeyIndex), http.MethodGet, "/v1/files/"+file.FileId+"/content", nil, "")
+}
+
+// RelayFileDelete DELETE /v1/files/:id，上游删除成功后同步删除本地记录
+func RelayFileDelete(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	file, channel, ok := getPinnedRelayFile(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	status := proxyOpenAIBatchRequest(c, channel, service.OpenAIBatchChannelKey(channel, file.KeyIndex), http.MethodDelete, "/v1/files/"+file.FileId, nil, "")
+	if status == http.StatusOK || status == http.StatusNotFound {
+		if err := model.DeleteRelayFile(file.UserId, file.FileId); err != nil {
+			common.SysError("delete relay file error: " + err.Error())
+		}
+	}
+}
+
+// RelayBatchCreate POST /v1/batches，批处理固定提交到输入文件所在的渠道，
+// 创建时按输入文件估算的输入 token 数预扣费，完成后由任务轮询按实际用量结算。
+func RelayBatchCreate(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	var req dto.OpenAIBatchCreateRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		openAIBatchError(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if req.InputFileID == "" || req.Endpoint == "" {
+		openAIBatchError(c, http.StatusBadRequest, "input_file_id and endpoint are required")
+		return
+	}
+	file, channel, ok := getPinnedRelayFile(c, req.InputFileID)
+	if !ok {
+		return
+	}
+	if channel.Status != common.ChannelStatusEnabled {
+		openAIBatchError(c, http.StatusServiceUnavailable, "the channel of this file is disabled")
+		return
+	}
+	if file.Purpose != "batch" || file.ModelName == "" || file.Requests == 0 {
+		openAIBatchError(c, http.StatusBadRequest, "the input file is not a batch input file, please upload it again with purpose=batch")
+		return
+	}
+
+	relayInfo, err := relaycommon.GenRelayInfo(c, types.RelayFormatTask, nil, nil)
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	relayInfo.OriginModelName = file.ModelName
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, 0, &types.TokenCountMeta{})
+	if err != nil {
+		openAIBatchError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	billingContext := &model.TaskBillingContext{
+		ModelPrice: priceData.ModelPrice,
+		GroupRatio: priceData.GroupRatioInfo.GroupRatio,
+		ModelRatio: priceData.ModelRatio,
+		OtherRatios: map[string]float64{
+			service.OpenAIBatchRatioKey:           operation_setting.GetBatchSetting().GetBillingRatio(),
+			service.OpenAIBatchCompletionRatioKey: priceData.CompletionRatio,
+		},
+		OriginModelName: file.ModelName,
+		PerCallBilling:  priceData.UsePrice,
+	}
+	quota := service.CalculateOpenAIBatchQuota(billingContext, service.OpenAIBatchUsage{
+		Requests:     file.Requests,
+		PromptTokens: file.PromptTokens,
+	})
+	if apiErr := service.PreConsumeBilling(c, quota, relayInfo); apiErr != nil {
+		c.JSON(apiErr.StatusCode, gin.H{"error": apiErr.ToOpenAIError()})
+		return
+	}
+
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		relayInfo.Billing.Refund(c)
+		openAIBatchError(c, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	requestBody, err := storage.Bytes()
+	if err != nil {
+		relayInfo.Billing.Refund(c)
+		openAIBatchError(c, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+	key := service.OpenAIBatchChannelKey(channel, file.KeyIndex)
+	resp, err := service.DoOpenAIBatchRequest(c.Request.Context(), channel, key, http.MethodPost, "/v1/batches", bytes.NewReader(requestBody), "application/json")
+	if err != nil {
+		relayInfo.Billing.Refund(c)
+		logger.LogError(c, "create batch upstream failed: "+err.Error())
+		openAIBatchError(c, http.StatusBadGateway, "upstream request failed")
+		return
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		relayInfo.Billing.Refund(c)
+		openAIBatchError(c, http.StatusBadGateway, "failed to read upstream response")
+		return
+	}
+	var batch dto.OpenAIBatch
+	if resp.StatusCode != http.StatusOK || common.Unmarshal(responseBody, &batch) != nil || batch.ID == "" {
+		relayInfo.Billing.Refund(c)
+		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), responseBody)
+		return
+	}
+	if err := service.SettleBilling(c, relayInfo, quota); err != nil {
+		common.SysError("settle batch billing error: " + err.Error())
+	}
+	relayInfo.Action = constant.TaskActionBatch
+	relayInfo.PriceData.Quota = quota
+	service.LogTaskConsumption(c, relayInfo)
+
+	task := model.InitTask(constant.TaskPlatformOpenAIBatch, relayInfo)
+	task.TaskID = batch.ID
+	task.ChannelId = channel.Id
+	task.Action = constant.TaskActionBatch
+	task.Properties.Input = req.Endpoint
+	task.Properties.OriginModelName = file.ModelName
+	if status := service.OpenAIBatchTaskStatus(batch.Status); status != "" {
+		task.Status = status
+	}
+	if channel.ChannelInfo.IsMultiKey {
+		task.PrivateData.Key = key
+	}
+	task.PrivateData.BillingSource = relayInfo.BillingSource
+	task.PrivateData.SubscriptionId = relayInfo.SubscriptionId
+	if relayInfo.BillingSource == service.BillingSourceOrganization {
+		task.PrivateData.OrganizationId = relayInfo.OrganizationId
+	}
+	task.PrivateData.TokenId = relayInfo.TokenId
+	task.PrivateData.BillingContext = billingContext
+	task.Quota = quota
+	task.Data = responseBody
+	if err := task.Insert(); err != nil {
+		common.SysError("insert batch task error: " + err.Error())
+	}
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), responseBody)
+}
+
+// RelayBatchList GET /v1/batches，返回本地记录的批处理对象（由任务轮询保持同步）
+func RelayBatchList(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	tasks := model.TaskGetAllUserTask(c.GetInt("id"), 0, limit+1, model.SyncTaskQueryParams{
+		Platform: constant.TaskPlatformOpenAIBatch,
+	})
+	hasMore := len(tasks) > limit
+	if hasMore {
+		tasks = tasks[:limit]
+	}
+	data := make([]any, 0, len(tasks))
+	for _, task := range tasks {
+		data = append(data, task.Data)
+	}
+	result := gin.H{
+		"object":   "list",
+		"data":     data,
+		"has_more": hasMore,
+	}
+	if len(tasks) > 0 {
+		result["first_id"] = tasks[0].TaskID
+		result["last_id"] = tasks[len(tasks)-1].TaskID
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// RelayBatchRetrieve GET /v1/batches/:id
+func RelayBatchRetrieve(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	task, channel, ok := getPinnedBatchTask(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	proxyOpenAIBatchRequest(c, channel, service.OpenAIBatchTaskKey(channel, task), http.MethodGet, "/v1/batches/"+task.GetUpstreamTaskID(), nil, "")
+}
+
+// RelayBatchCancel POST /v1/batches/:id/cancel，取消后的状态与已完成部分的结算由任务轮询处理
+func RelayBatchCancel(c *gin.Context) {
+	if !openAIBatchEnabled(c) {
+		return
+	}
+	task, channel, ok := getPinnedBatchTask(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	proxyOpenAIBatchRequest(c, channel, service.OpenAIBatchTaskKey(channel, task), http.MethodPost, "/v1/batches/"+task.GetUpstreamTaskID()+"/cancel", nil, "")
+}
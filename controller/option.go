@@ -242,6 +242,33 @@ func UpdateOption(c *gin.Context) {
 			})
 			return
 		}
+	case "ModelRequestUsageLimitGroup":
+		err = setting.CheckModelRequestUsageLimitGroup(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "ModelRequestRateLimitModelRules":
+		err = setting.CheckModelRequestRateLimitModelRules(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	case "guardrail_setting.rules":
+		err = operation_setting.CheckGuardrailRules(option.Value.(string))
+		if err != nil {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
 	case "AutomaticDisableStatusCodes":
 		_, err = operation_setting.ParseHTTPStatusCodeRanges(option.Value.(string))
 		if err != nil {
@@ -0,0 +1,417 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type OrganizationRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type OrganizationMemberRequest struct {
+	UserId     int    `json:"user_id"`
+	Username   string `json:"username"`
+	Role       string `json:"role"`
+	QuotaLimit int    `json:"quota_limit"`
+	ResetUsed  bool   `json:"reset_used"`
+}
+
+type OrganizationTransferRequest struct {
+	Quota int `json:"quota"`
+}
+
+type AdminUpdateOrganizationRequest struct {
+	Status int `json:"status"`
+	Quota  int `json:"quota"`
+}
+
+// getOrganizationMembership 解析路径中的组织 ID，并校验当前用户是该组织成员
+func getOrganizationMembership(c *gin.Context) (*model.Organization, *model.OrganizationMember, bool) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return nil, nil, false
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	member, err := model.GetOrganizationMember(orgId, c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return nil, nil, false
+	}
+	return org, member, true
+}
+
+// ---- User APIs ----
+
+func GetSelfOrganizations(c *gin.Context) {
+	orgs, err := model.GetUserOrganizations(c.GetInt("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, orgs)
+}
+
+func CreateOrganization(c *gin.Context) {
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "组织名称过长")
+		return
+	}
+	org := &model.Organization{
+		Name:        req.Name,
+		Description: req.Description,
+		OwnerId:     c.GetInt("id"),
+	}
+	if err := model.CreateOrganization(org); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func GetOrganization(c *gin.Context) {
+	org, member, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	common.ApiSuccess(c, model.OrganizationSummary{
+		Organization:     *org,
+		Role:             member.Role,
+		MemberQuotaLimit: member.QuotaLimit,
+		MemberUsedQuota:  member.UsedQuota,
+	})
+}
+
+func UpdateOrganization(c *gin.Context) {
+	org, member, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	if !member.CanManage() {
+		common.ApiErrorMsg(c, "无权管理该组织")
+		return
+	}
+	var req OrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if len(req.Name) > 64 {
+		common.ApiErrorMsg(c, "组织名称过长")
+		return
+	}
+	org.Name = req.Name
+	org.Description = req.Description
+	if err := model.UpdateOrganization(org); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, org)
+}
+
+func DeleteOrganization(c *gin.Context) {
+	org, member, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	if member.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以删除组织")
+		return
+	}
+	if err := model.DeleteOrganization(org.Id); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+func GetOrganizationMembers(c *gin.Context) {
+	org, _, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	members, err := model.GetOrganizationMembers(org.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, members)
+}
+
+func AddOrganizationMember(c *gin.Context) {
+	org, operator, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	if !operator.CanManage() {
+		common.ApiErrorMsg(c, "无权管理该组织")
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.OrganizationRoleMember
+	}
+	if req.Role == model.OrganizationRoleAdmin && operator.Role != model.OrganizationRoleOwner {
+		common.ApiErrorMsg(c, "只有组织所有者可以设置管理员")
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员消费上限不能为负数")
+		return
+	}
+	userId := req.UserId
+	if userId == 0 {
+		username := strings.TrimSpace(req.Username)
+		if username == "" {
+			common.ApiErrorMsg(c, "请输入用户名")
+			return
+		}
+		id, err := model.GetUserIdByUsername(username)
+		if err != nil {
+			organizationUserLookupError(c, err)
+			return
+		}
+		userId = id
+	} else if _, err := model.GetUserById(userId, false); err != nil {
+		organizationUserLookupError(c, err)
+		return
+	}
+	member := &model.OrganizationMember{
+		OrganizationId: org.Id,
+		UserId:         userId,
+		Role:           req.Role,
+		QuotaLimit:     req.QuotaLimit,
+	}
+	if err := model.AddOrganizationMember(member); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(c.GetInt("id"), model.LogTypeManage, "将用户 "+strconv.Itoa(userId)+" 加入组织 "+org.Name)
+	common.ApiSuccess(c, member)
+}
+
+// organizationUserLookupError 添加成员时用户不存在返回 404，避免留下指向不存在用户的成员记录
+func organizationUserLookupError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": "用户不存在",
+		})
+		return
+	}
+	common.ApiError(c, err)
+}
+
+func UpdateOrganizationMember(c *gin.Context) {
+	org, operator, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	if !operator.CanManage() {
+		common.ApiErrorMsg(c, "无权管理该组织")
+		return
+	}
+	var req OrganizationMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if req.QuotaLimit < 0 {
+		common.ApiErrorMsg(c, "成员消费上限不能为负数")
+		return
+	}
+	member, err := model.GetOrganizationMember(org.Id, req.UserId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Role == "" {
+		req.Role = member.Role
+	}
+	if !model.IsValidOrganizationRole(req.Role) {
+		common.ApiErrorMsg(c, "无效的成员角色")
+		return
+	}
+	if (member.Role == model.OrganizationRoleOwner) != (req.Role == model.OrganizationRoleOwner) {
+		common.ApiErrorMsg(c, "不能修改组织所有者的角色")
+		return
+	}
+	if operator.Role != model.OrganizationRoleOwner {
+		// 管理员只能管理普通成员，且不能授予管理员角色
+		if member.Role != model.OrganizationRoleMember || req.Role != model.OrganizationRoleMember {
+			common.ApiErrorMsg(c, "只有组织所有者可以管理管理员")
+			return
+		}
+	}
+	member.Role = req.Role
+	member.QuotaLimit = req.QuotaLimit
+	if err := model.UpdateOrganizationMember(member, req.ResetUsed); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, member)
+}
+
+// RemoveOrganizationMember 移除成员；普通成员可以通过移除自己退出组织
+func RemoveOrganizationMember(c *gin.Context) {
+	org, operator, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	userId, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	if userId == operator.UserId {
+		if operator.Role == model.OrganizationRoleOwner {
+			common.ApiErrorMsg(c, "组织所有者不能退出组织")
+			return
+		}
+	} else {
+		if !operator.CanManage() {
+			common.ApiErrorMsg(c, "无权管理该组织")
+			return
+		}
+		target, err := model.GetOrganizationMember(org.Id, userId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if target.Role == model.OrganizationRoleOwner ||
+			(target.Role == model.OrganizationRoleAdmin && operator.Role != model.OrganizationRoleOwner) {
+			common.ApiErrorMsg(c, "无权移除该成员")
+			return
+		}
+	}
+	if err := model.RemoveOrganizationMember(org.Id, userId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// TransferQuotaToOrganization 将个人额度转入组织钱包
+func TransferQuotaToOrganization(c *gin.Context) {
+	org, _, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	var req OrganizationTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	userId := c.GetInt("id")
+	if err := model.TransferUserQuotaToOrganization(userId, org.Id, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	model.RecordLog(userId, model.LogTypeManage, "向组织 "+org.Name+" 转入额度 "+logger.LogQuota(req.Quota))
+	common.ApiSuccess(c, nil)
+}
+
+// GetOrganizationLogs 查询组织钱包的消费日志：所有者和管理员可查看全部成员，普通成员只能查看自己的日志
+func GetOrganizationLogs(c *gin.Context) {
+	org, member, ok := getOrganizationMembership(c)
+	if !ok {
+		return
+	}
+	pageInfo := common.GetPageQuery(c)
+	logType, _ := strconv.Atoi(c.Query("type"))
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	modelName := c.Query("model_name")
+	username := c.Query("username")
+	userId := 0
+	if !member.CanManage() {
+		userId = member.UserId
+		username = ""
+	}
+	logs, total, err := model.GetOrganizationLogs(org.Id, userId, logType, startTimestamp, endTimestamp, modelName, username, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(logs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// ---- Admin APIs ----
+
+func AdminListOrganizations(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	orgs, total, err := model.GetAllOrganizations(pageInfo)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(orgs)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func AdminUpdateOrganization(c *gin.Context) {
+	orgId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	var req AdminUpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiErrorMsg(c, "参数错误")
+		return
+	}
+	org, err := model.GetOrganizationById(orgId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.AdminUpdateOrganization(org.Id, req.Status, req.Quota); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if req.Quota != org.Quota {
+		model.RecordLog(org.OwnerId, model.LogTypeManage, "管理员将组织 "+org.Name+" 的额度从 "+logger.LogQuota(org.Quota)+" 修改为 "+logger.LogQuota(req.Quota))
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// validateTokenOrganization 校验令牌绑定的组织：用户必须是该组织成员
+func validateTokenOrganization(userId int, orgId int) error {
+	if orgId == 0 {
+		return nil
+	}
+	if orgId < 0 {
+		return errors.New("无效的组织")
+	}
+	if _, err := model.GetOrganizationMember(orgId, userId); err != nil {
+		return errors.New("组织不存在或您不是该组织成员")
+	}
+	return nil
+}
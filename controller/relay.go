@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -15,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/middleware"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
 	"github.com/QuantumNous/new-api/relay"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
@@ -26,6 +28,8 @@ import (
 
 	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/samber/lo"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -76,6 +80,10 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	)
 
 	if relayFormat == types.RelayFormatOpenAIRealtime {
+		if bridge, ok := operation_setting.GetRealtimeBridgeSetting().GetModel(c.Query("model")); ok {
+			relayRealtimeBridge(c, bridge)
+			return
+		}
 		var err error
 		ws, err = upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
@@ -103,6 +111,8 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 				})
 			}
 		}
+		// 错误响应写出后再保存，留存内容包含返回给客户端的错误
+		service.SaveBodyCapture(c)
 	}()
 
 	request, err := helper.GetAndValidateRequest(c, relayFormat)
@@ -141,6 +151,19 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}
 
+	if relayFormat != types.RelayFormatOpenAIRealtime {
+		if newAPIError = service.ApplyGuardrails(c, relayInfo, request); newAPIError != nil {
+			return
+		}
+	}
+
+	service.SetupOutputSensitiveFilter(c, relayInfo)
+
+	if relayFormat != types.RelayFormatOpenAIRealtime {
+		service.SetupBodyCapture(c, relayInfo)
+		service.SetupStreamFailover(c, relayInfo)
+	}
+
 	tokens, err := service.EstimateRequestToken(c, meta, relayInfo)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeCountTokenFailed)
@@ -149,6 +172,25 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetEstimatePromptTokens(tokens)
 
+	usageLimitLease, usageLimitErr := service.AcquireUsageLimit(c, tokens)
+	if usageLimitErr != nil {
+		newAPIError = usageLimitErr
+		return
+	}
+	defer usageLimitLease.Release()
+
+	// 缓存命中同样占用并发名额并按缓存用量计入 TPM
+	if service.ShouldUseResponseCache(c, relayInfo) {
+		if entry, hit := service.LookupResponseCache(c, relayInfo); hit {
+			if newAPIError = service.ChargeResponseCacheHit(c, relayInfo, entry); newAPIError != nil {
+				return
+			}
+			service.SettleUsageLimit(c, entry.PromptTokens+entry.CompletionTokens)
+			writeResponseCacheEntry(c, entry)
+			return
+		}
+	}
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError, types.ErrOptionWithStatusCode(http.StatusBadRequest))
@@ -177,6 +219,32 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
+	newAPIError = relayWithRetry(c, relayInfo, relayFormat)
+	for newAPIError != nil {
+		fallbackModel, ok := service.NextFallbackModel(c, relayInfo, newAPIError, isRetryExhausted(c, newAPIError))
+		if !ok {
+			break
+		}
+		logger.LogInfo(c, fmt.Sprintf("模型 %s 的渠道均失败，切换备用模型 %s", relayInfo.OriginModelName, fallbackModel))
+		if fallbackErr := switchFallbackModel(c, relayInfo, fallbackModel, tokens, meta); fallbackErr != nil {
+			logger.LogError(c, fmt.Sprintf("switch to fallback model %s failed: %s", fallbackModel, fallbackErr.Error()))
+			break
+		}
+		newAPIError = relayWithRetry(c, relayInfo, relayFormat)
+	}
+	if newAPIError == nil {
+		return
+	}
+
+	useChannel := c.GetStringSlice("use_channel")
+	if len(useChannel) > 1 {
+		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
+		logger.LogInfo(c, retryLogStr)
+	}
+}
+
+// relayWithRetry 在当前模型的可用渠道间转发并按需重试，成功时返回 nil
+func relayWithRetry(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat) (newAPIError *types.NewAPIError) {
 	retryParam := &service.RetryParam{
 		Ctx:        c,
 		TokenGroup: relayInfo.TokenGroup,
@@ -208,20 +276,28 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 		c.Request.Body = io.NopCloser(bodyStorage)
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
+		if relayInfo.RetryIndex == 0 && service.ShouldHedge(c, relayInfo) {
+			// 对冲请求自行统计各次尝试，返回最终结果对应的渠道
+			channel, newAPIError = relayHedged(c, relayInfo, relayFormat, channel)
+		} else {
+			attemptStartTime := time.Now()
+			newAPIError = doRelay(c, relayInfo, relayFormat)
+			observeChannelAttempt(c, channel.Id, relayInfo, attemptStartTime, newAPIError)
+		}
+
+		if newAPIError != nil && service.IsStreamFailoverPending(c) {
+			// 已写出部分内容的流式输出不能重试，改为换渠道续写
+			relayStreamFailover(c, relayInfo, relayFormat, channel, newAPIError)
+			newAPIError = nil
 		}
 
 		if newAPIError == nil {
 			relayInfo.LastError = nil
-			return
+			// 命中输出屏蔽词的响应不写入缓存，避免回放时绕过违规记录
+			if !service.RecordOutputSensitiveViolation(c, relayInfo) {
+				service.StoreResponseCache(c, relayInfo)
+			}
+			return nil
 		}
 
 		newAPIError = service.NormalizeViolationFeeError(newAPIError)
@@ -229,18 +305,111 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 
+		if service.ShouldSkipRetryForFallback(c, relayInfo, newAPIError) {
+			break
+		}
 		if !shouldRetry(c, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
 			break
 		}
 	}
+	return newAPIError
+}
 
-	useChannel := c.GetStringSlice("use_channel")
-	if len(useChannel) > 1 {
-		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
-		logger.LogInfo(c, retryLogStr)
+// doRelay 按请求格式向当前选定的渠道转发一次
+func doRelay(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		return relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		return relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		return geminiRelayHandler(c, relayInfo)
+	default:
+		return relayHandler(c, relayInfo)
 	}
 }
 
+// 每个优先级下随机选择其他渠道的次数
+const alternateChannelPicks = 3
+
+// selectAlternateChannel 选择一个不在 exclude 中的可用渠道，从最高优先级开始逐级查找，没有时返回 nil
+func selectAlternateChannel(c *gin.Context, info *relaycommon.RelayInfo, exclude []int) *model.Channel {
+	retryParam := &service.RetryParam{
+		Ctx:        c,
+		TokenGroup: info.TokenGroup,
+		ModelName:  info.OriginModelName,
+	}
+	for retry := 0; retry <= common.RetryTimes; retry++ {
+		for pick := 0; pick < alternateChannelPicks; pick++ {
+			retryParam.SetRetry(retry)
+			candidate, _, err := service.CacheGetRandomSatisfiedChannel(retryParam)
+			if err != nil || candidate == nil {
+				return nil
+			}
+			if !lo.Contains(exclude, candidate.Id) {
+				return candidate
+			}
+		}
+	}
+	return nil
+}
+
+// isRetryExhausted 判断失败是否因为当前模型的渠道已重试用尽（而不是不可重试的错误）
+func isRetryExhausted(c *gin.Context, err *types.NewAPIError) bool {
+	return err.GetErrorCode() == types.ErrorCodeGetChannelFailed || shouldRetry(c, err, 1)
+}
+
+// switchFallbackModel 切换到备用模型：退还原模型的预扣费，按备用模型重新定价并预扣费
+func switchFallbackModel(c *gin.Context, relayInfo *relaycommon.RelayInfo, fallbackModel string, tokens int, meta *types.TokenCountMeta) *types.NewAPIError {
+	if relayInfo.Billing != nil {
+		relayInfo.Billing.Refund(c)
+		relayInfo.Billing = nil
+	}
+	relayInfo.OriginModelName = fallbackModel
+	common.SetContextKey(c, constant.ContextKeyOriginalModel, fallbackModel)
+	if relayInfo.Request != nil {
+		relayInfo.Request.SetModelName(fallbackModel)
+	}
+	// 透传请求体时直接转发原始请求体，需要同步改写其中的模型名
+	if err := rewriteBodyModel(c, fallbackModel); err != nil {
+		return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithStatusCode(http.StatusBadRequest))
+	}
+	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeModelPriceError, types.ErrOptionWithStatusCode(http.StatusBadRequest))
+	}
+	if priceData.FreeModel {
+		return nil
+	}
+	return service.PreConsumeBilling(c, priceData.QuotaToPreConsume, relayInfo)
+}
+
+// rewriteBodyModel 将 JSON 请求体中的 model 字段改写为 modelName，请求体没有 model 字段时保持不变
+func rewriteBodyModel(c *gin.Context, modelName string) error {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return err
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return err
+	}
+	if !gjson.GetBytes(body, "model").Exists() {
+		return nil
+	}
+	body, err = sjson.SetBytes(body, "model", modelName)
+	if err != nil {
+		return err
+	}
+	newStorage, err := common.CreateBodyStorage(body)
+	if err != nil {
+		return err
+	}
+	storage.Close()
+	c.Set(common.KeyBodyStorage, newStorage)
+	return nil
+}
+
 var upgrader = websocket.Upgrader{
 	Subprotocols: []string{"realtime"}, // WS 握手支持的协议，如果有使用 Sec-WebSocket-Protocol，则必须在此声明对应的 Protocol TODO add other protocol
 	CheckOrigin: func(r *http.Request) bool {
@@ -248,12 +417,58 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// writeResponseCacheEntry 回放缓存的响应，流式响应按 SSE 事件逐条写出
+func writeResponseCacheEntry(c *gin.Context, entry *service.ResponseCacheEntry) {
+	c.Header(service.ResponseCacheHeader, "hit")
+	if !entry.IsStream {
+		c.Data(entry.StatusCode, entry.ContentType, entry.Body)
+		return
+	}
+	helper.SetEventStreamHeaders(c)
+	c.Status(entry.StatusCode)
+	for _, event := range bytes.SplitAfter(entry.Body, []byte("\n\n")) {
+		if len(event) == 0 {
+			continue
+		}
+		if _, err := c.Writer.Write(event); err != nil {
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
 func addUsedChannel(c *gin.Context, channelId int) {
 	useChannel := c.GetStringSlice("use_channel")
 	useChannel = append(useChannel, fmt.Sprintf("%d", channelId))
 	c.Set("use_channel", useChannel)
 }
 
+// observeChannelAttempt 将本次尝试的结果计入渠道熔断器和滚动统计，供渠道选择使用
+func observeChannelAttempt(c *gin.Context, channelId int, info *relaycommon.RelayInfo, attemptStartTime time.Time, relayErr *types.NewAPIError) {
+	if info.ChannelMeta == nil {
+		return
+	}
+	service.ObserveCircuitBreakerResult(channelId,
+		common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey),
+		common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex),
+		relayErr)
+	if info.RetryIndex > 0 {
+		metrics.IncRelayRetry(info.OriginModelName, info.UsingGroup)
+	}
+	if info.RelayFormat == types.RelayFormatOpenAIRealtime {
+		metrics.ObserveRelayAttempt(info.OriginModelName, channelId, info.UsingGroup, relayErr == nil, time.Since(attemptStartTime), 0)
+		return
+	}
+	ttft := time.Since(attemptStartTime)
+	var streamTTFT time.Duration
+	if info.IsStream && info.FirstResponseTime.After(attemptStartTime) {
+		ttft = info.FirstResponseTime.Sub(attemptStartTime)
+		streamTTFT = ttft
+	}
+	metrics.ObserveRelayAttempt(info.OriginModelName, channelId, info.UsingGroup, relayErr == nil, time.Since(attemptStartTime), streamTTFT)
+	service.ObserveChannelResult(channelId, info.OriginModelName, relayErr, ttft)
+}
+
 func fastTokenCountMetaForPricing(request dto.Request) *types.TokenCountMeta {
 	if request == nil {
 		return &types.TokenCountMeta{}
@@ -574,6 +789,9 @@ func RelayTask(c *gin.Context) {
 		task.PrivateData.UpstreamTaskID = result.UpstreamTaskID
 		task.PrivateData.BillingSource = relayInfo.BillingSource
 		task.PrivateData.SubscriptionId = relayInfo.SubscriptionId
+		if relayInfo.BillingSource == service.BillingSourceOrganization {
+			task.PrivateData.OrganizationId = relayInfo.OrganizationId
+		}
 		task.PrivateData.TokenId = relayInfo.TokenId
 		task.PrivateData.BillingContext = &model.TaskBillingContext{
 			ModelPrice:      relayInfo.PriceData.ModelPrice,
@@ -0,0 +1,216 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// hedgeRun 一次对冲尝试的执行状态，每次尝试使用独立的 gin 上下文与 RelayInfo
+type hedgeRun struct {
+	c       *gin.Context
+	info    *relaycommon.RelayInfo
+	channel *model.Channel
+	attempt *service.HedgeAttempt
+	start   time.Time
+	err     *types.NewAPIError
+	done    chan struct{}
+}
+
+func startHedgeRun(c *gin.Context, info *relaycommon.RelayInfo, channel *model.Channel, group *service.HedgeGroup, relayFormat types.RelayFormat) *hedgeRun {
+	run := &hedgeRun{
+		c:       c,
+		info:    info,
+		channel: channel,
+		attempt: group.Attach(c, channel.Id),
+		start:   time.Now(),
+		done:    make(chan struct{}),
+	}
+	// 每次尝试使用独立的输出过滤器，避免并发写入同一份流式状态
+	service.SetupOutputSensitiveFilter(c, info)
+	go func() {
+		defer close(run.done)
+		defer func() {
+			if r := recover(); r != nil {
+				common.SysError(fmt.Sprintf("hedged relay panic: channel_id=%d, %v", channel.Id, r))
+				run.err = types.NewError(fmt.Errorf("hedged relay panic: %v", r), types.ErrorCodeDoRequestFailed)
+			}
+		}()
+		run.err = doRelay(c, info, relayFormat)
+	}()
+	return run
+}
+
+// cancelled 未胜出而被取消的尝试，其失败不计入渠道错误
+func (r *hedgeRun) cancelled() bool {
+	return r.attempt.Role() == service.HedgeRoleLoser && r.c.Request.Context().Err() != nil
+}
+
+// relayHedged 向主渠道转发，若在设定时间内没有写出首字节，则向另一个渠道发出相同的请求，先写出响应的一方胜出，另一方被取消。
+// 返回最终结果对应的渠道与错误，其余尝试的统计、错误处理与日志在此完成。
+func relayHedged(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, channel *model.Channel) (*model.Channel, *types.NewAPIError) {
+	// 对冲请求从转发前的状态复制，不能在主请求开始后再复制
+	hedgeInfo, err := relayInfo.Clone()
+	if err != nil {
+		logger.LogError(c, "clone relay info for hedging failed: "+err.Error())
+		attemptStartTime := time.Now()
+		newAPIError := doRelay(c, relayInfo, relayFormat)
+		observeChannelAttempt(c, channel.Id, relayInfo, attemptStartTime, newAPIError)
+		return channel, newAPIError
+	}
+	// 对冲请求使用独立的计费会话，预扣费记录按请求 ID 区分
+	hedgeInfo.RequestId = relayInfo.RequestId + "-hedge"
+
+	group := service.NewHedgeGroup(c.Writer)
+	primary := startHedgeRun(c.Copy(), relayInfo, channel, group, relayFormat)
+	runs := []*hedgeRun{primary}
+
+	timer := time.NewTimer(time.Duration(operation_setting.GetHedgeSetting().DelayMs) * time.Millisecond)
+	defer timer.Stop()
+	select {
+	case <-primary.done:
+	case <-group.Won():
+	case <-timer.C:
+		if secondary := startSecondaryHedgeRun(c, hedgeInfo, channel.Id, group, relayFormat); secondary != nil {
+			runs = append(runs, secondary)
+			logger.LogInfo(c, fmt.Sprintf("渠道 #%d 在 %dms 内无响应，发出对冲请求到渠道 #%d", channel.Id, operation_setting.GetHedgeSetting().DelayMs, secondary.channel.Id))
+		}
+	}
+	// 胜出者写完响应后返回，未胜出的尝试已被取消，等待其退出后统一记录
+	for _, run := range runs {
+		<-run.done
+	}
+
+	result := primary
+	if winner := group.Winner(); winner != nil {
+		for _, run := range runs {
+			if run.attempt == winner {
+				result = run
+			}
+		}
+	} else if primary.err != nil && len(runs) > 1 && runs[1].err == nil {
+		result = runs[1]
+	}
+
+	for _, run := range runs {
+		if run == result {
+			continue
+		}
+		finishHedgeLoser(c, run)
+	}
+
+	// 将最终结果的上下文（渠道信息、输出过滤器等）同步回主请求，对冲状态与请求体存储只属于各自的尝试
+	for key, value := range result.c.Keys {
+		if key == string(constant.ContextKeyHedgeAttempt) || key == common.KeyBodyStorage {
+			continue
+		}
+		c.Set(key, value)
+	}
+	if result.info != relayInfo {
+		*relayInfo = *result.info
+	}
+	observeChannelAttempt(result.c, result.channel.Id, result.info, result.start, result.err)
+	return result.channel, result.err
+}
+
+// startSecondaryHedgeRun 从 CacheGetRandomSatisfiedChannel 选择另一个渠道发出对冲请求，没有其他可用渠道时返回 nil
+func startSecondaryHedgeRun(c *gin.Context, info *relaycommon.RelayInfo, primaryChannelId int, group *service.HedgeGroup, relayFormat types.RelayFormat) *hedgeRun {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil
+	}
+	data, err := storage.Bytes()
+	if err != nil {
+		return nil
+	}
+	hedgeStorage, err := common.CreateBodyStorage(data)
+	if err != nil {
+		return nil
+	}
+
+	hc := c.Copy()
+	hc.Set(common.KeyBodyStorage, hedgeStorage)
+	request := *c.Request
+	request.Body = io.NopCloser(hedgeStorage)
+	hc.Request = &request
+
+	channel := selectAlternateChannel(hc, info, []int{primaryChannelId})
+	if channel == nil {
+		hedgeStorage.Close()
+		return nil
+	}
+	if newAPIError := middleware.SetupContextForSelectedChannel(hc, channel, info.OriginModelName); newAPIError != nil {
+		hedgeStorage.Close()
+		return nil
+	}
+	info.PriceData.GroupRatioInfo = helper.HandleGroupRatio(hc, info)
+	if !info.PriceData.FreeModel {
+		if newAPIError := service.PreConsumeBilling(hc, info.PriceData.QuotaToPreConsume, info); newAPIError != nil {
+			logger.LogWarn(c, "pre-consume for hedged request failed: "+newAPIError.Error())
+			hedgeStorage.Close()
+			return nil
+		}
+	}
+	addUsedChannel(c, channel.Id)
+
+	run := startHedgeRun(hc, info, channel, group, relayFormat)
+	go func() {
+		<-run.done
+		hedgeStorage.Close()
+	}()
+	return run
+}
+
+// finishHedgeLoser 处理未作为最终结果的尝试：被取消的尝试按对冲设置结算并记录日志，真正失败的尝试退还预扣费并按渠道错误处理
+func finishHedgeLoser(c *gin.Context, run *hedgeRun) {
+	if run.err == nil {
+		// 已完成的尝试在结算时按对冲设置计费并写入消费日志
+		return
+	}
+	if run.cancelled() {
+		other := map[string]interface{}{
+			"request_path": c.Request.URL.Path,
+		}
+		if hedge := run.attempt.LogInfo(); hedge != nil {
+			other["hedge"] = hedge
+		}
+		useTimeSeconds := int(time.Since(run.start).Seconds())
+		tokenName := run.c.GetString("token_name")
+		if quota := service.SettleHedgeLoser(run.c, run.info); quota > 0 {
+			model.RecordConsumeLog(run.c, run.info.UserId, model.RecordConsumeLogParams{
+				ChannelId:      run.channel.Id,
+				ModelName:      run.info.OriginModelName,
+				TokenName:      tokenName,
+				Quota:          quota,
+				Content:        "对冲请求未胜出，已取消，按预估额度计费",
+				TokenId:        run.info.TokenId,
+				UseTimeSeconds: useTimeSeconds,
+				IsStream:       run.info.IsStream,
+				Group:          run.info.UsingGroup,
+				Other:          other,
+			})
+			return
+		}
+		model.RecordErrorLog(run.c, run.info.UserId, run.channel.Id, run.info.OriginModelName, tokenName, "对冲请求未胜出，已取消",
+			run.info.TokenId, useTimeSeconds, run.info.IsStream, run.info.UsingGroup, other)
+		return
+	}
+	if run.info.Billing != nil {
+		run.info.Billing.Refund(run.c)
+	}
+	observeChannelAttempt(run.c, run.channel.Id, run.info, run.start, run.err)
+	processChannelError(run.c, *types.NewChannelError(run.channel.Id, run.channel.Type, run.channel.Name, run.channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(run.c, constant.ContextKeyChannelKey), run.channel.GetAutoBan()), run.err)
+}
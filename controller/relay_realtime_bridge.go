@@ -0,0 +1,352 @@
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+)
+
+// relayRealtimeBridge 在网关中终结 Realtime 协议，依次调用语音识别、对话与语音合成渠道
+func relayRealtimeBridge(c *gin.Context, bridge operation_setting.RealtimeBridgeModel) {
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		helper.WssError(c, ws, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry()).ToOpenAIError())
+		return
+	}
+	defer ws.Close()
+
+	info := relaycommon.GenRelayInfoWs(c, ws)
+	stages := &realtimeBridgeStages{c: c, info: info, bridge: bridge}
+	session := service.NewRealtimeBridgeSession(info.OriginModelName, bridge, stages, func(event map[string]any) error {
+		return helper.WssObject(c, ws, event)
+	})
+	if err := session.Start(); err != nil {
+		return
+	}
+	for {
+		_, message, err := ws.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.LogError(c, "realtime bridge read error: "+err.Error())
+			}
+			return
+		}
+		if err := session.HandleEvent(message); err != nil {
+			logger.LogError(c, "realtime bridge session closed: "+err.Error())
+			return
+		}
+	}
+}
+
+// realtimeBridgeStages 在各阶段模型的渠道上执行请求，每个阶段单独选择渠道并通过 PreWssConsumeQuota / PostWssConsumeQuota 计费
+type realtimeBridgeStages struct {
+	c      *gin.Context
+	info   *relaycommon.RelayInfo
+	bridge operation_setting.RealtimeBridgeModel
+}
+
+// realtimeBridgeStageRequest 一次阶段请求：relayFormat 与 path 决定渠道上的请求类型，body 为客户端请求体
+type realtimeBridgeStageRequest struct {
+	modelName   string
+	relayFormat types.RelayFormat
+	path        string
+	request     dto.Request
+	body        []byte
+	contentType string
+	run         func(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Usage, *types.NewAPIError)
+}
+
+// realtimeBridgeStageResult 阶段成功时的渠道输出与计费所需的上下文
+type realtimeBridgeStageResult struct {
+	c           *gin.Context
+	info        *relaycommon.RelayInfo
+	body        []byte
+	contentType string
+	usage       *dto.Usage
+}
+
+// setStageRequest 将阶段请求设置为 sc 的当前请求，请求体每次转发都会被读取，需要在每次尝试前重新设置
+func (s *realtimeBridgeStages) setStageRequest(sc *gin.Context, req *realtimeBridgeStageRequest) (common.BodyStorage, error) {
+	storage, err := common.CreateBodyStorage(req.body)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(s.c.Request.Context(), http.MethodPost, req.path, bytes.NewReader(req.body))
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
+	request.Header = s.c.Request.Header.Clone()
+	request.Header.Set("Content-Type", req.contentType)
+	sc.Request = request
+	sc.Set(common.KeyBodyStorage, storage)
+	return storage, nil
+}
+
+// prepareStage 与普通请求一致，在转发前执行内容审核，并按预估 token 数占用并发与 TPM 额度
+func (s *realtimeBridgeStages) prepareStage(sc *gin.Context, req *realtimeBridgeStageRequest) (*service.UsageLimitLease, int, error) {
+	storage, err := s.setStageRequest(sc, req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer storage.Close()
+
+	info, err := relaycommon.GenRelayInfo(sc, req.relayFormat, req.request, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if newAPIError := service.ApplyGuardrails(sc, info, req.request); newAPIError != nil {
+		return nil, 0, newAPIError
+	}
+	tokens, err := service.EstimateRequestToken(sc, req.request.GetTokenCountMeta(), info)
+	if err != nil {
+		return nil, 0, err
+	}
+	lease, newAPIError := service.AcquireUsageLimit(sc, tokens)
+	if newAPIError != nil {
+		return nil, 0, newAPIError
+	}
+	return lease, tokens, nil
+}
+
+// selectStageChannel 选择阶段使用的渠道，令牌指定了渠道时与普通请求一样只使用该渠道
+func (s *realtimeBridgeStages) selectStageChannel(retryParam *service.RetryParam, modelName string) (*model.Channel, error) {
+	if channelId, ok := common.GetContextKey(s.c, constant.ContextKeyTokenSpecificChannelId); ok {
+		id, err := strconv.Atoi(channelId.(string))
+		if err != nil {
+			return nil, errors.New(i18n.T(s.c, i18n.MsgDistributorInvalidChannelId))
+		}
+		channel, err := model.GetChannelById(id, true)
+		if err != nil {
+			return nil, errors.New(i18n.T(s.c, i18n.MsgDistributorInvalidChannelId))
+		}
+		if channel.Status != common.ChannelStatusEnabled {
+			return nil, errors.New(i18n.T(s.c, i18n.MsgDistributorChannelDisabled))
+		}
+		return channel, nil
+	}
+	channel, selectGroup, err := service.CacheGetRandomSatisfiedChannel(retryParam)
+	if err != nil {
+		return nil, fmt.Errorf("获取分组 %s 下模型 %s 的可用渠道失败: %w", selectGroup, modelName, err)
+	}
+	if channel == nil {
+		return nil, fmt.Errorf("分组 %s 下模型 %s 的可用渠道不存在", selectGroup, modelName)
+	}
+	return channel, nil
+}
+
+// runStage 按模型选择渠道执行阶段请求，失败时按重试设置更换渠道
+func (s *realtimeBridgeStages) runStage(req *realtimeBridgeStageRequest) (*realtimeBridgeStageResult, error) {
+	userQuota, err := model.GetUserQuota(s.info.UserId, false)
+	if err != nil {
+		return nil, err
+	}
+	if userQuota <= 0 {
+		return nil, service.ErrRealtimeBridgeQuota
+	}
+
+	sc := s.c.Copy()
+	lease, estimatedTokens, err := s.prepareStage(sc, req)
+	if err != nil {
+		return nil, err
+	}
+	defer lease.Release()
+
+	retryParam := &service.RetryParam{
+		Ctx:        sc,
+		TokenGroup: s.info.TokenGroup,
+		ModelName:  req.modelName,
+		Retry:      common.GetPointer(0),
+	}
+
+	var newAPIError *types.NewAPIError
+	var usage *dto.Usage
+	for ; retryParam.GetRetry() <= common.RetryTimes; retryParam.IncreaseRetry() {
+		channel, err := s.selectStageChannel(retryParam, req.modelName)
+		if err != nil {
+			return nil, err
+		}
+		if newAPIError = middleware.SetupContextForSelectedChannel(sc, channel, req.modelName); newAPIError != nil {
+			return nil, newAPIError
+		}
+		addUsedChannel(sc, channel.Id)
+
+		storage, err := s.setStageRequest(sc, req)
+		if err != nil {
+			return nil, err
+		}
+		writer := service.NewRealtimeStageWriter(s.c.Writer)
+		sc.Writer = writer
+
+		info, err := relaycommon.GenRelayInfo(sc, req.relayFormat, req.request, nil)
+		if err != nil {
+			storage.Close()
+			return nil, err
+		}
+		info.StartTime = time.Now()
+		if _, err := helper.ModelPriceHelper(sc, info, 0, &types.TokenCountMeta{}); err != nil {
+			storage.Close()
+			return nil, err
+		}
+
+		attemptStartTime := time.Now()
+		usage, newAPIError = req.run(sc, info)
+		storage.Close()
+		observeChannelAttempt(sc, channel.Id, info, attemptStartTime, newAPIError)
+		if newAPIError == nil {
+			// 语音阶段的用量可能不含 token 数，此时按预估结算
+			settledTokens := estimatedTokens
+			if usage != nil && usage.TotalTokens > 0 {
+				settledTokens = usage.TotalTokens
+			}
+			service.SettleUsageLimit(sc, settledTokens)
+			return &realtimeBridgeStageResult{c: sc, info: info, body: writer.Body(), contentType: writer.Header().Get("Content-Type"), usage: usage}, nil
+		}
+
+		processChannelError(sc, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(sc, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
+		if !shouldRetry(sc, newAPIError, common.RetryTimes-retryParam.GetRetry()) {
+			break
+		}
+	}
+	if newAPIError == nil {
+		return nil, errors.New("no channel attempted")
+	}
+	return nil, newAPIError
+}
+
+// bill 按 Realtime 用量扣费并记录消费日志，额度不足时返回 ErrRealtimeBridgeQuota
+func (s *realtimeBridgeStages) bill(stage string, result *realtimeBridgeStageResult, usage *dto.RealtimeUsage) error {
+	if err := service.PreWssConsumeQuota(result.c, result.info, usage); err != nil {
+		logger.LogError(s.c, fmt.Sprintf("realtime bridge %s consume quota failed: %s", stage, err.Error()))
+		return fmt.Errorf("%w: %s", service.ErrRealtimeBridgeQuota, err.Error())
+	}
+	service.PostWssConsumeQuota(result.c, result.info, result.info.OriginModelName, usage, "实时语音桥接阶段 "+stage)
+	return nil
+}
+
+func (s *realtimeBridgeStages) Transcribe(audio []byte) (string, *dto.RealtimeUsage, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	_ = writer.WriteField("model", s.bridge.TranscriptionModel)
+	_ = writer.WriteField("response_format", "json")
+	part, err := writer.CreateFormFile("file", "audio.wav")
+	if err != nil {
+		return "", nil, err
+	}
+	sampleRate := s.bridge.TranscriptionSampleRate
+	if sampleRate <= 0 {
+		sampleRate = service.RealtimeBridgeSampleRate
+	}
+	if _, err := part.Write(service.PCM16ToWav(service.ResamplePCM16(audio, sampleRate), sampleRate)); err != nil {
+		return "", nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return "", nil, err
+	}
+
+	result, err := s.runStage(&realtimeBridgeStageRequest{
+		modelName:   s.bridge.TranscriptionModel,
+		relayFormat: types.RelayFormatOpenAIAudio,
+		path:        "/v1/audio/transcriptions",
+		request:     &dto.AudioRequest{Model: s.bridge.TranscriptionModel, ResponseFormat: "json"},
+		body:        body.Bytes(),
+		contentType: writer.FormDataContentType(),
+		run:         relay.RealtimeBridgeAudioHelper,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	transcript := strings.TrimSpace(gjson.GetBytes(result.body, "text").String())
+	usage := service.RealtimeTranscriptionUsage(audio, transcript, result.info.OriginModelName)
+	if err := s.bill("transcription", result, usage); err != nil {
+		return "", nil, err
+	}
+	return transcript, usage, nil
+}
+
+func (s *realtimeBridgeStages) Chat(request *dto.GeneralOpenAIRequest) (string, *dto.RealtimeUsage, error) {
+	body, err := common.Marshal(request)
+	if err != nil {
+		return "", nil, err
+	}
+	result, err := s.runStage(&realtimeBridgeStageRequest{
+		modelName:   request.Model,
+		relayFormat: types.RelayFormatOpenAI,
+		path:        "/v1/chat/completions",
+		request:     request,
+		body:        body,
+		contentType: "application/json",
+		run:         relay.RealtimeBridgeChatHelper,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	text := gjson.GetBytes(result.body, "choices.0.message.content").String()
+	if text == "" {
+		return "", nil, errors.New("chat model returned an empty reply")
+	}
+	usage := service.RealtimeChatUsage(result.usage)
+	if err := s.bill("chat", result, usage); err != nil {
+		return "", nil, err
+	}
+	return text, usage, nil
+}
+
+func (s *realtimeBridgeStages) Speak(text string, voice string) ([]byte, *dto.RealtimeUsage, error) {
+	request := &dto.AudioRequest{
+		Model:          s.bridge.SpeechModel,
+		Input:          text,
+		Voice:          voice,
+		ResponseFormat: "pcm",
+	}
+	body, err := common.Marshal(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := s.runStage(&realtimeBridgeStageRequest{
+		modelName:   s.bridge.SpeechModel,
+		relayFormat: types.RelayFormatOpenAIAudio,
+		path:        "/v1/audio/speech",
+		request:     request,
+		body:        body,
+		contentType: "application/json",
+		run:         relay.RealtimeBridgeAudioHelper,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// 请求的是 pcm，但部分渠道只能返回 WAV 或其他采样率，统一转换为 24kHz pcm16；无法转换的音频不计费
+	audio, err := service.SpeechToPCM16(result.body, result.contentType)
+	if err != nil {
+		logger.LogError(s.c, fmt.Sprintf("realtime bridge speech model %s: %s", s.bridge.SpeechModel, err.Error()))
+		return nil, nil, err
+	}
+	usage := service.RealtimeSpeechUsage(text, audio, result.info.OriginModelName)
+	if err := s.bill("speech", result, usage); err != nil {
+		return nil, nil, err
+	}
+	return audio, usage, nil
+}
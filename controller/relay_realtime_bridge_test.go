@@ -0,0 +1,37 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/i18n"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealtimeBridgeStageRespectsPinnedChannel(t *testing.T) {
+	require.NoError(t, i18n.Init())
+	db := setupTokenControllerTestDB(t)
+	require.NoError(t, db.AutoMigrate(&model.Channel{}))
+	require.NoError(t, db.Create(&model.Channel{Id: 7, Name: "pinned", Key: "sk-test", Status: common.ChannelStatusEnabled}).Error)
+	require.NoError(t, db.Create(&model.Channel{Id: 8, Name: "disabled", Key: "sk-test", Status: common.ChannelStatusManuallyDisabled}).Error)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/realtime", nil)
+	stages := &realtimeBridgeStages{c: c}
+	retryParam := &service.RetryParam{Ctx: c, ModelName: "whisper-1", Retry: common.GetPointer(0)}
+
+	common.SetContextKey(c, constant.ContextKeyTokenSpecificChannelId, "7")
+	channel, err := stages.selectStageChannel(retryParam, "whisper-1")
+	require.NoError(t, err)
+	require.Equal(t, 7, channel.Id)
+
+	common.SetContextKey(c, constant.ContextKeyTokenSpecificChannelId, "8")
+	_, err = stages.selectStageChannel(retryParam, "whisper-1")
+	require.Error(t, err)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// relayStreamFailover 流式输出在结束前中断后，换一个渠道带着已写出的文本续写，续写内容拼接到同一个 SSE 流中。
+// 续写再次中断时继续换渠道，直到完成、没有其他渠道或达到续写次数上限；续写在写出数据之前失败时也换渠道重试，最多 RetryTimes 次。
+// 无法续写时按已写出的内容结算，客户端收到的流正常结束。
+func relayStreamFailover(c *gin.Context, relayInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, channel *model.Channel, relayErr *types.NewAPIError) {
+	// 续写前就失败的渠道，不计入中断记录，但同样不再选择
+	var failedChannels []int
+	for {
+		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), relayErr)
+		if !service.IsStreamFailoverPending(c) || len(failedChannels) > common.RetryTimes {
+			break
+		}
+		next := selectAlternateChannel(c, relayInfo, append(service.GetStreamFailoverChannels(c), failedChannels...))
+		if next == nil {
+			logger.LogWarn(c, "没有其他可用渠道续写中断的流式输出")
+			break
+		}
+		if newAPIError := middleware.SetupContextForSelectedChannel(c, next, relayInfo.OriginModelName); newAPIError != nil {
+			logger.LogError(c, fmt.Sprintf("setup channel #%d for stream failover failed: %s", next.Id, newAPIError.Error()))
+			break
+		}
+		relayInfo.PriceData.GroupRatioInfo = helper.HandleGroupRatio(c, relayInfo)
+		bodyStorage, err := common.GetBodyStorage(c)
+		if err != nil {
+			break
+		}
+		c.Request.Body = io.NopCloser(bodyStorage)
+		addUsedChannel(c, next.Id)
+		logger.LogInfo(c, fmt.Sprintf("渠道 #%d 的流式输出中断，由渠道 #%d 续写", channel.Id, next.Id))
+
+		channel = next
+		relayInfo.RetryIndex++
+		interruptions := len(service.GetStreamFailoverChannels(c))
+		attemptStartTime := time.Now()
+		relayErr = doRelay(c, relayInfo, relayFormat)
+		observeChannelAttempt(c, channel.Id, relayInfo, attemptStartTime, relayErr)
+		if relayErr == nil {
+			return
+		}
+		if len(service.GetStreamFailoverChannels(c)) == interruptions {
+			failedChannels = append(failedChannels, channel.Id)
+		}
+	}
+	service.SettleInterruptedStream(c)
+}
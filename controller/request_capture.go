@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetRequestCapture 按请求 ID 查询留存的请求与响应内容
+func GetRequestCapture(c *gin.Context) {
+	requestId := c.Param("request_id")
+	if requestId == "" {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "request id is required",
+		})
+		return
+	}
+	captures, err := model.GetRequestCapturesByRequestId(requestId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if len(captures) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "request capture not found",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    captures,
+	})
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getStoredResponse(c *gin.Context) (*model.StoredResponse, bool) {
+	responseId := c.Param("id")
+	response, err := model.GetStoredResponse(c.GetInt("id"), responseId)
+	if err != nil {
+		openAIBatchError(c, http.StatusInternalServerError, "failed to query response")
+		return nil, false
+	}
+	if response == nil {
+		openAIBatchError(c, http.StatusNotFound, fmt.Sprintf("Response with id '%s' not found.", responseId))
+		return nil, false
+	}
+	return response, true
+}
+
+// RelayResponseRetrieve GET /v1/responses/:id，返回网关本地保存的响应
+func RelayResponseRetrieve(c *gin.Context) {
+	response, ok := getStoredResponse(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(response.Response))
+}
+
+// RelayResponseDelete DELETE /v1/responses/:id，仅删除本地保存的响应
+func RelayResponseDelete(c *gin.Context) {
+	response, ok := getStoredResponse(c)
+	if !ok {
+		return
+	}
+	if _, err := model.DeleteStoredResponse(response.UserId, response.ResponseId); err != nil {
+		common.SysError("delete stored response error: " + err.Error())
+		openAIBatchError(c, http.StatusInternalServerError, "failed to delete response")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      response.ResponseId,
+		"object":  "response",
+		"deleted": true,
+	})
+}
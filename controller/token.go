@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/i18n"
@@ -106,13 +107,32 @@ func GetTokenStatus(c *gin.Context) {
 	if expiredAt == -1 {
 		expiredAt = 0
 	}
-	c.JSON(http.StatusOK, gin.H{
+	resp := gin.H{
 		"object":          "credit_summary",
 		"total_granted":   token.RemainQuota,
 		"total_used":      0, // not supported currently
 		"total_available": token.RemainQuota,
 		"expires_at":      expiredAt * 1000,
-	})
+	}
+	fillTokenPeriodQuota(resp, token)
+	c.JSON(http.StatusOK, resp)
+}
+
+// fillTokenPeriodQuota 填充令牌当前周期的消费上限、已消费额度及重置时间（unix 秒）
+func fillTokenPeriodQuota(data gin.H, token *model.Token) {
+	data["quota_period"] = token.QuotaPeriod
+	data["period_quota_limit"] = token.PeriodQuotaLimit
+	if !token.HasPeriodQuotaLimit() {
+		data["period_used"] = 0
+		data["period_available"] = 0
+		data["period_reset_at"] = 0
+		return
+	}
+	now := time.Now()
+	used := token.GetPeriodUsedQuota(now)
+	data["period_used"] = used
+	data["period_available"] = max(token.PeriodQuotaLimit-used, 0)
+	data["period_reset_at"] = model.TokenQuotaPeriodEnd(token.QuotaPeriod, now).Unix()
 }
 
 func GetTokenUsage(c *gin.Context) {
@@ -147,20 +167,29 @@ func GetTokenUsage(c *gin.Context) {
 		expiredAt = 0
 	}
 
+	data := gin.H{
+		"object":               "token_usage",
+		"name":                 token.Name,
+		"total_granted":        token.RemainQuota + token.UsedQuota,
+		"total_used":           token.UsedQuota,
+		"total_available":      token.RemainQuota,
+		"unlimited_quota":      token.UnlimitedQuota,
+		"model_limits":         token.GetModelLimitsMap(),
+		"model_limits_enabled": token.ModelLimitsEnabled,
+		"expires_at":           expiredAt,
+	}
+	if token.HasPeriodQuotaLimit() {
+		// 周期消费只在数据库中实时更新，缓存中的值可能已过期
+		if fresh, err := model.GetTokenById(token.Id); err == nil {
+			token = fresh
+		}
+	}
+	fillTokenPeriodQuota(data, token)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    true,
 		"message": "ok",
-		"data": gin.H{
-			"object":               "token_usage",
-			"name":                 token.Name,
-			"total_granted":        token.RemainQuota + token.UsedQuota,
-			"total_used":           token.UsedQuota,
-			"total_available":      token.RemainQuota,
-			"unlimited_quota":      token.UnlimitedQuota,
-			"model_limits":         token.GetModelLimitsMap(),
-			"model_limits_enabled": token.ModelLimitsEnabled,
-			"expires_at":           expiredAt,
-		},
+		"data":    data,
 	})
 }
 
@@ -175,6 +204,24 @@ func AddToken(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
 	}
+	if token.TpmLimit < 0 || token.ConcurrencyLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "TPM 限制和并发限制不能为负数",
+		})
+		return
+	}
+	if err := validateTokenOrganization(c.GetInt("id"), token.OrganizationId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !model.IsValidTokenQuotaPeriod(token.QuotaPeriod) || token.PeriodQuotaLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "周期消费上限设置无效",
+		})
+		return
+	}
 	// 非无限额度时，检查额度值是否超出有效范围
 	if !token.UnlimitedQuota {
 		if token.RemainQuota < 0 {
@@ -208,19 +255,25 @@ func AddToken(c *gin.Context) {
 		return
 	}
 	cleanToken := model.Token{
-		UserId:             c.GetInt("id"),
-		Name:               token.Name,
-		Key:                key,
-		CreatedTime:        common.GetTimestamp(),
-		AccessedTime:       common.GetTimestamp(),
-		ExpiredTime:        token.ExpiredTime,
-		RemainQuota:        token.RemainQuota,
-		UnlimitedQuota:     token.UnlimitedQuota,
-		ModelLimitsEnabled: token.ModelLimitsEnabled,
-		ModelLimits:        token.ModelLimits,
-		AllowIps:           token.AllowIps,
-		Group:              token.Group,
-		CrossGroupRetry:    token.CrossGroupRetry,
+		UserId:               c.GetInt("id"),
+		Name:                 token.Name,
+		Key:                  key,
+		CreatedTime:          common.GetTimestamp(),
+		AccessedTime:         common.GetTimestamp(),
+		ExpiredTime:          token.ExpiredTime,
+		RemainQuota:          token.RemainQuota,
+		UnlimitedQuota:       token.UnlimitedQuota,
+		ModelLimitsEnabled:   token.ModelLimitsEnabled,
+		ModelLimits:          token.ModelLimits,
+		AllowIps:             token.AllowIps,
+		Group:                token.Group,
+		CrossGroupRetry:      token.CrossGroupRetry,
+		TpmLimit:             token.TpmLimit,
+		ConcurrencyLimit:     token.ConcurrencyLimit,
+		QuotaPeriod:          token.QuotaPeriod,
+		PeriodQuotaLimit:     token.PeriodQuotaLimit,
+		OrganizationId:       token.OrganizationId,
+		ResponseCacheEnabled: token.ResponseCacheEnabled,
 	}
 	err = cleanToken.Insert()
 	if err != nil {
@@ -260,6 +313,24 @@ func UpdateToken(c *gin.Context) {
 		common.ApiErrorI18n(c, i18n.MsgTokenNameTooLong)
 		return
 	}
+	if token.TpmLimit < 0 || token.ConcurrencyLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "TPM 限制和并发限制不能为负数",
+		})
+		return
+	}
+	if err := validateTokenOrganization(c.GetInt("id"), token.OrganizationId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if !model.IsValidTokenQuotaPeriod(token.QuotaPeriod) || token.PeriodQuotaLimit < 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "周期消费上限设置无效",
+		})
+		return
+	}
 	if !token.UnlimitedQuota {
 		if token.RemainQuota < 0 {
 			common.ApiErrorI18n(c, i18n.MsgTokenQuotaNegative)
@@ -286,6 +357,7 @@ func UpdateToken(c *gin.Context) {
 			return
 		}
 	}
+	periodChanged := false
 	if statusOnly != "" {
 		cleanToken.Status = token.Status
 	} else {
@@ -299,12 +371,29 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
 		cleanToken.CrossGroupRetry = token.CrossGroupRetry
+		cleanToken.TpmLimit = token.TpmLimit
+		cleanToken.ConcurrencyLimit = token.ConcurrencyLimit
+		if cleanToken.QuotaPeriod != token.QuotaPeriod {
+			periodChanged = true
+		}
+		cleanToken.QuotaPeriod = token.QuotaPeriod
+		cleanToken.PeriodQuotaLimit = token.PeriodQuotaLimit
+		cleanToken.OrganizationId = token.OrganizationId
+		cleanToken.ResponseCacheEnabled = token.ResponseCacheEnabled
 	}
 	err = cleanToken.Update()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if periodChanged {
+		// 周期变更后重新开始计算消费
+		if err := model.ResetTokenPeriodQuota(cleanToken.Id); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		cleanToken.PeriodUsedQuota = 0
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -0,0 +1,193 @@
+package dto
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+)
+
+// ChannelSchedule 渠道可用时段，启用后渠道仅在时段内参与选择
+type ChannelSchedule struct {
+	Enabled  bool                    `json:"enabled"`
+	Timezone string                  `json:"timezone,omitempty"` // IANA 时区，如 Asia/Shanghai，为空时使用服务器时区
+	Windows  []ChannelScheduleWindow `json:"windows,omitempty"`
+
+	// 由 Compile 预先解析的时区与分钟区间
+	compiled  bool
+	location  *time.Location
+	intervals [][2]int
+}
+
+// ChannelScheduleWindow 单个可用时段，End 不晚于 Start 时表示跨越午夜，Start 与 End 相同表示全天
+type ChannelScheduleWindow struct {
+	Weekdays []int  `json:"weekdays,omitempty"` // 0 为周日，1-6 为周一至周六，为空表示每天
+	Start    string `json:"start"`              // HH:MM
+	End      string `json:"end"`                // HH:MM，允许 24:00
+}
+
+// ChannelScheduleStatus 渠道当前是否处于可用时段以及下一次切换时间
+type ChannelScheduleStatus struct {
+	Active             bool  `json:"active"`
+	NextTransitionTime int64 `json:"next_transition_time,omitempty"` // 下一次切换的 Unix 时间，0 表示不会切换
+}
+
+func parseScheduleClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	if hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// Compile 预先解析时区与时段对应的分钟区间，渠道缓存载入时调用，判断是否可用时只需比较分钟数
+func (s *ChannelSchedule) Compile() *ChannelSchedule {
+	if s == nil {
+		return nil
+	}
+	s.location = s.Location()
+	s.intervals = s.windowIntervals()
+	s.compiled = true
+	return s
+}
+
+// Location 返回时段所用的时区，时区无效时使用服务器时区
+func (s *ChannelSchedule) Location() *time.Location {
+	if s.compiled {
+		return s.location
+	}
+	if s.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Validate 校验时区、星期与时间格式
+func (s *ChannelSchedule) Validate() error {
+	if s == nil || !s.Enabled {
+		return nil
+	}
+	if s.Timezone != "" {
+		if _, err := time.LoadLocation(s.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone %q", s.Timezone)
+		}
+	}
+	if len(s.Windows) == 0 {
+		return errors.New("schedule requires at least one window")
+	}
+	for _, window := range s.Windows {
+		for _, weekday := range window.Weekdays {
+			if weekday < 0 || weekday > 6 {
+				return fmt.Errorf("invalid weekday %d, expected 0-6", weekday)
+			}
+		}
+		if _, err := parseScheduleClock(window.Start); err != nil {
+			return err
+		}
+		if _, err := parseScheduleClock(window.End); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// weekIntervals 返回一周内的分钟区间，已 Compile 时直接使用预先解析的结果
+func (s *ChannelSchedule) weekIntervals() [][2]int {
+	if s.compiled {
+		return s.intervals
+	}
+	return s.windowIntervals()
+}
+
+// windowIntervals 将时段展开为一周内的分钟区间 [start, start+duration)，起点可能跨越周末回绕
+func (s *ChannelSchedule) windowIntervals() [][2]int {
+	var result [][2]int
+	for _, window := range s.Windows {
+		start, err := parseScheduleClock(window.Start)
+		if err != nil {
+			continue
+		}
+		end, err := parseScheduleClock(window.End)
+		if err != nil {
+			continue
+		}
+		duration := end - start
+		if duration <= 0 {
+			duration += minutesPerDay
+		}
+		weekdays := window.Weekdays
+		if len(weekdays) == 0 {
+			weekdays = []int{0, 1, 2, 3, 4, 5, 6}
+		}
+		for _, weekday := range weekdays {
+			result = append(result, [2]int{weekday*minutesPerDay + start, duration})
+		}
+	}
+	return result
+}
+
+func activeAtMinute(intervals [][2]int, minute int) bool {
+	for _, interval := range intervals {
+		if ((minute-interval[0])%minutesPerWeek+minutesPerWeek)%minutesPerWeek < interval[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func minuteOfWeek(t time.Time) int {
+	return int(t.Weekday())*minutesPerDay + t.Hour()*60 + t.Minute()
+}
+
+// IsActive 判断给定时间是否处于可用时段内，未启用时始终可用
+func (s *ChannelSchedule) IsActive(now time.Time) bool {
+	if s == nil || !s.Enabled {
+		return true
+	}
+	return activeAtMinute(s.weekIntervals(), minuteOfWeek(now.In(s.Location())))
+}
+
+// Status 返回当前状态与下一次切换时间，时段覆盖全周或为空时不会切换
+func (s *ChannelSchedule) Status(now time.Time) ChannelScheduleStatus {
+	if s == nil || !s.Enabled {
+		return ChannelScheduleStatus{Active: true}
+	}
+	intervals := s.weekIntervals()
+	local := now.In(s.Location())
+	current := minuteOfWeek(local)
+	status := ChannelScheduleStatus{Active: activeAtMinute(intervals, current)}
+
+	// 状态只会在区间的起点或终点改变，按距离当前的分钟数依次检查
+	var offsets []int
+	for _, interval := range intervals {
+		for _, boundary := range []int{interval[0], interval[0] + interval[1]} {
+			offset := ((boundary-current)%minutesPerWeek + minutesPerWeek) % minutesPerWeek
+			if offset == 0 {
+				offset = minutesPerWeek
+			}
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Ints(offsets)
+	for _, offset := range offsets {
+		if activeAtMinute(intervals, current+offset) != status.Active {
+			// 按本地时钟计算，夏令时切换时仍落在设定的整点
+			next := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute()+offset, 0, 0, local.Location())
+			status.NextTransitionTime = next.Unix()
+			break
+		}
+	}
+	return status
+}
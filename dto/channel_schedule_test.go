@@ -0,0 +1,75 @@
+package dto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelSchedule_OvernightWindow(t *testing.T) {
+	schedule := &ChannelSchedule{
+		Enabled:  true,
+		Timezone: "Asia/Shanghai",
+		Windows:  []ChannelScheduleWindow{{Weekdays: []int{1, 2, 3, 4, 5}, Start: "22:00", End: "06:00"}},
+	}
+	require.NoError(t, schedule.Validate())
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	require.NoError(t, err)
+
+	// 2026-10-16 为周五
+	friday := time.Date(2026, 10, 16, 23, 30, 0, 0, loc)
+	assert.True(t, schedule.IsActive(friday))
+	assert.True(t, schedule.IsActive(friday.Add(6*time.Hour)))   // 周六 05:30 仍属周五的时段
+	assert.False(t, schedule.IsActive(friday.Add(7*time.Hour)))  // 周六 06:30
+	assert.False(t, schedule.IsActive(friday.Add(24*time.Hour))) // 周六 23:30
+	assert.True(t, schedule.IsActive(friday.In(time.UTC)))
+
+	status := schedule.Status(friday)
+	assert.True(t, status.Active)
+	assert.Equal(t, time.Date(2026, 10, 17, 6, 0, 0, 0, loc).Unix(), status.NextTransitionTime)
+
+	// 周六白天的下一次开放在周一 22:00
+	status = schedule.Status(time.Date(2026, 10, 17, 12, 0, 0, 0, loc))
+	assert.False(t, status.Active)
+	assert.Equal(t, time.Date(2026, 10, 19, 22, 0, 0, 0, loc).Unix(), status.NextTransitionTime)
+}
+
+func TestChannelSchedule_AlwaysActiveAndValidation(t *testing.T) {
+	var disabled *ChannelSchedule
+	assert.True(t, disabled.IsActive(time.Now()))
+
+	allDay := &ChannelSchedule{Enabled: true, Windows: []ChannelScheduleWindow{{Start: "00:00", End: "24:00"}}}
+	status := allDay.Status(time.Now())
+	assert.True(t, status.Active)
+	assert.Zero(t, status.NextTransitionTime)
+
+	invalid := []*ChannelSchedule{
+		{Enabled: true},
+		{Enabled: true, Timezone: "Mars/Base", Windows: []ChannelScheduleWindow{{Start: "09:00", End: "18:00"}}},
+		{Enabled: true, Windows: []ChannelScheduleWindow{{Weekdays: []int{7}, Start: "09:00", End: "18:00"}}},
+		{Enabled: true, Windows: []ChannelScheduleWindow{{Start: "9:00", End: "18:00"}}},
+		{Enabled: true, Windows: []ChannelScheduleWindow{{Start: "09:00", End: "24:30"}}},
+	}
+	for _, schedule := range invalid {
+		assert.Error(t, schedule.Validate())
+	}
+}
+
+func TestChannelSchedule_CompileMatchesUncompiled(t *testing.T) {
+	schedule := &ChannelSchedule{
+		Enabled:  true,
+		Timezone: "Asia/Shanghai",
+		Windows:  []ChannelScheduleWindow{{Weekdays: []int{0, 6}, Start: "09:00", End: "18:00"}},
+	}
+	compiled := (&ChannelSchedule{Enabled: schedule.Enabled, Timezone: schedule.Timezone, Windows: schedule.Windows}).Compile()
+	assert.Equal(t, schedule.Location().String(), compiled.Location().String())
+
+	start := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	for minute := 0; minute < 2*minutesPerDay; minute += 30 {
+		now := start.Add(time.Duration(minute) * time.Minute)
+		assert.Equal(t, schedule.IsActive(now), compiled.IsActive(now), now.String())
+	}
+	assert.Equal(t, schedule.Status(start), compiled.Status(start))
+}
@@ -0,0 +1,77 @@
+package dto
+
+import "encoding/json"
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+type OpenAIFile struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+}
+
+type OpenAIBatchCreateRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+type OpenAIBatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type OpenAIBatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    *int   `json:"line,omitempty"`
+}
+
+// OpenAIBatch 上游返回的批处理对象（只解析网关需要的字段，原始内容原样返回给用户）
+type OpenAIBatch struct {
+	ID            string                   `json:"id"`
+	Endpoint      string                   `json:"endpoint"`
+	InputFileID   string                   `json:"input_file_id"`
+	Status        string                   `json:"status"`
+	OutputFileID  string                   `json:"output_file_id,omitempty"`
+	ErrorFileID   string                   `json:"error_file_id,omitempty"`
+	CreatedAt     int64                    `json:"created_at"`
+	CompletedAt   int64                    `json:"completed_at,omitempty"`
+	FailedAt      int64                    `json:"failed_at,omitempty"`
+	ExpiredAt     int64                    `json:"expired_at,omitempty"`
+	CancelledAt   int64                    `json:"cancelled_at,omitempty"`
+	RequestCounts OpenAIBatchRequestCounts `json:"request_counts"`
+	Errors        *struct {
+		Data []OpenAIBatchError `json:"data"`
+	} `json:"errors,omitempty"`
+}
+
+// FinishedAt 返回批处理到达终态的时间，上游未返回时使用创建时间
+func (b *OpenAIBatch) FinishedAt() int64 {
+	return max(b.CompletedAt, b.FailedAt, b.ExpiredAt, b.CancelledAt, b.CreatedAt)
+}
+
+// OpenAIBatchOutputLine 批处理输出文件中的一行
+type OpenAIBatchOutputLine struct {
+	ID       string `json:"id"`
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		RequestID  string          `json:"request_id"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+}
@@ -0,0 +1,18 @@
+package dto
+
+type OpenAIModerationRequest struct {
+	Model string `json:"model,omitempty"`
+	Input any    `json:"input"`
+}
+
+type OpenAIModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+type OpenAIModerationResponse struct {
+	ID      string                   `json:"id"`
+	Model   string                   `json:"model"`
+	Results []OpenAIModerationResult `json:"results"`
+}
@@ -88,6 +88,8 @@ func main() {
 		}()
 
 		go model.SyncChannelCache(common.SyncFrequency)
+	} else {
+		go model.SyncMultiKeyUsage(common.SyncFrequency)
 	}
 
 	// 热更新配置
@@ -112,6 +114,15 @@ func main() {
 	// Subscription quota reset task (daily/weekly/monthly/custom)
 	service.StartSubscriptionQuotaResetTask()
 
+	// Request/response body capture retention cleanup
+	service.StartBodyCaptureCleanupTask()
+
+	// Stored Responses API response retention cleanup
+	service.StartStoredResponseCleanupTask()
+
+	// Conversations API expired conversation cleanup
+	service.StartConversationCleanupTask()
+
 	// Wire task polling adaptor factory (breaks service -> relay import cycle)
 	service.GetTaskAdaptorFunc = func(platform constant.TaskPlatform) service.TaskPollingAdaptor {
 		a := relay.GetTaskAdaptor(platform)
@@ -121,6 +132,9 @@ func main() {
 		return a
 	}
 
+	// Channel schedule task, toggles abilities by channel availability windows
+	service.StartChannelScheduleTask()
+
 	// Channel upstream model update check task
 	controller.StartChannelUpstreamModelUpdateTask()
 
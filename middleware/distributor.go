@@ -16,6 +16,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -262,6 +263,13 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 		if _, ok := c.Get("relay_mode"); !ok {
 			c.Set("relay_mode", relayMode)
 		}
+	} else if c.Request.URL.Path == "/v1/files" && c.Request.Method == http.MethodPost {
+		// 文件上传没有 model 字段，按表单中的 model 或批处理文件首行的 model 选择渠道
+		modelName, err := getFileUploadModel(c)
+		if err != nil {
+			return nil, false, err
+		}
+		modelRequest.Model = modelName
 	} else if strings.HasPrefix(c.Request.URL.Path, "/v1beta/models/") || strings.HasPrefix(c.Request.URL.Path, "/v1/models/") {
 		// Gemini API 路径处理: /v1beta/models/gemini-2.0-flash:generateContent
 		relayMode := relayconstant.RelayModeGemini
@@ -280,6 +288,10 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/realtime") {
 		//wss://api.openai.com/v1/realtime?model=gpt-4o-realtime-preview-2024-10-01
 		modelRequest.Model = c.Query("model")
+		if _, ok := operation_setting.GetRealtimeBridgeSetting().GetModel(modelRequest.Model); ok {
+			// 桥接模式由网关终结 Realtime 协议，各阶段分别选择渠道
+			shouldSelectChannel = false
+		}
 	}
 	if strings.HasPrefix(c.Request.URL.Path, "/v1/moderations") {
 		if modelRequest.Model == "" {
@@ -367,7 +379,12 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	common.SetContextKey(c, constant.ContextKeyChannelModelMapping, channel.GetModelMapping())
 	common.SetContextKey(c, constant.ContextKeyChannelStatusCodeMapping, channel.GetStatusCodeMapping())
 
-	key, index, newAPIError := channel.GetNextEnabledKey()
+	// 多 Key 渠道的熔断与限流状态在获取渠道轮询锁之前批量读取
+	var keyFilter func(keyIndex int) bool
+	if channel.ChannelInfo.IsMultiKey {
+		keyFilter = service.ChannelKeyFilter(channel.Id, len(channel.GetKeys()))
+	}
+	key, index, newAPIError := channel.GetNextEnabledKeyWithFilter(keyFilter)
 	if newAPIError != nil {
 		return newAPIError
 	}
@@ -406,6 +423,41 @@ func SetupContextForSelectedChannel(c *gin.Context, channel *model.Channel, mode
 	return nil
 }
 
+// getFileUploadModel 获取文件上传请求用于选择渠道的模型：
+// purpose=batch 时以 JSONL 中各行请求体的模型为准（必须一致），表单中的 model 字段只能与之相同；
+// 其他用途使用表单中的 model 字段
+func getFileUploadModel(c *gin.Context) (string, error) {
+	form, err := common.ParseMultipartFormReusable(c)
+	if err != nil {
+		return "", err
+	}
+	formModel := ""
+	if values := form.Value["model"]; len(values) > 0 {
+		formModel = values[0]
+	}
+	if purposes := form.Value["purpose"]; len(purposes) == 0 || purposes[0] != "batch" {
+		return formModel, nil
+	}
+	files := form.File["file"]
+	if len(files) == 0 {
+		return formModel, nil
+	}
+	file, err := files[0].Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	summary, err := service.ScanOpenAIBatchInput(file)
+	if err != nil {
+		return "", err
+	}
+	if formModel != "" && formModel != summary.Model {
+		return "", fmt.Errorf("model %s does not match the model %s used in the batch input file", formModel, summary.Model)
+	}
+	common.SetContextKey(c, constant.ContextKeyOpenAIBatchInput, summary)
+	return summary.Model, nil
+}
+
 // extractModelNameFromGeminiPath 从 Gemini API URL 路径中提取模型名
 // 输入格式: /v1beta/models/gemini-2.0-flash:generateContent
 // 输出: gemini-2.0-flash
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsAuth 校验 /metrics 的 Bearer Token，未开启时返回 404，未配置 Token 时返回 401
+func MetricsAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		setting := operation_setting.GetMetricsSetting()
+		if !setting.Enabled {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		// 未配置 Token 时拒绝抓取，避免无鉴权暴露渠道与分组的用量数据
+		token := strings.TrimSpace(strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer "))
+		if setting.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(setting.Token)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
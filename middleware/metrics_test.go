@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsAuth_RequiresToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	setting := operation_setting.GetMetricsSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+
+	scrape := func(authorization string) int {
+		w := httptest.NewRecorder()
+		_, engine := gin.CreateTestContext(w)
+		engine.GET("/metrics", MetricsAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	setting.Enabled, setting.Token = false, "secret"
+	require.Equal(t, http.StatusNotFound, scrape("Bearer secret"))
+
+	// 开启但未配置 Token 时不能无鉴权访问
+	setting.Enabled, setting.Token = true, ""
+	require.Equal(t, http.StatusUnauthorized, scrape(""))
+
+	setting.Token = "secret"
+	require.Equal(t, http.StatusUnauthorized, scrape("Bearer wrong"))
+	require.Equal(t, http.StatusOK, scrape("Bearer secret"))
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -74,36 +75,69 @@ func recordRedisRequest(ctx context.Context, rdb *redis.Client, key string, maxC
 	rdb.Expire(ctx, key, time.Duration(setting.ModelRequestRateLimitDurationMinutes)*time.Minute)
 }
 
+// modelRateLimitScope 一组独立的请求计数器：默认为分组/全局计数器，命中模型规则时为该规则的计数器
+type modelRateLimitScope struct {
+	keyPrefix       string // 计数器 key 前缀，默认计数器为空，保持与旧版本一致
+	totalMaxCount   int
+	successMaxCount int
+	target          string // 提示信息中的限制对象，默认计数器为空
+}
+
+func newModelRateLimitRuleScope(rule setting.ModelRateLimitRule) modelRateLimitScope {
+	return modelRateLimitScope{
+		keyPrefix:       "rule:" + rule.Key() + ":",
+		totalMaxCount:   rule.TotalCount,
+		successMaxCount: rule.SuccessCount,
+		target:          fmt.Sprintf("模型 %s ", rule.Model),
+	}
+}
+
+func (s modelRateLimitScope) redisSuccessKey(userId string) string {
+	return fmt.Sprintf("rateLimit:%s:%s%s", ModelRequestRateLimitSuccessCountMark, s.keyPrefix, userId)
+}
+
+func (s modelRateLimitScope) redisTotalKey(userId string) string {
+	return fmt.Sprintf("rateLimit:%s%s", s.keyPrefix, userId)
+}
+
+func (s modelRateLimitScope) memoryTotalKey(userId string) string {
+	return ModelRequestRateLimitCountMark + s.keyPrefix + userId
+}
+
+func (s modelRateLimitScope) memorySuccessKey(userId string) string {
+	return ModelRequestRateLimitSuccessCountMark + s.keyPrefix + userId
+}
+
 // Redis限流处理器
-func redisRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) gin.HandlerFunc {
+func redisRateLimitHandler(duration int64, scope modelRateLimitScope) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userId := strconv.Itoa(c.GetInt("id"))
 		ctx := context.Background()
 		rdb := common.RDB
 
 		// 1. 检查成功请求数限制
-		successKey := fmt.Sprintf("rateLimit:%s:%s", ModelRequestRateLimitSuccessCountMark, userId)
-		allowed, err := checkRedisRateLimit(ctx, rdb, successKey, successMaxCount, duration)
+		successKey := scope.redisSuccessKey(userId)
+		allowed, err := checkRedisRateLimit(ctx, rdb, successKey, scope.successMaxCount, duration)
 		if err != nil {
 			fmt.Println("检查成功请求数限制失败:", err.Error())
 			abortWithOpenAiMessage(c, http.StatusInternalServerError, "rate_limit_check_failed")
 			return
 		}
 		if !allowed {
-			abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到请求数限制：%d分钟内最多请求%d次", setting.ModelRequestRateLimitDurationMinutes, successMaxCount))
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到%s请求数限制：%d分钟内最多请求%d次", scope.target, setting.ModelRequestRateLimitDurationMinutes, scope.successMaxCount))
 			return
 		}
 
 		//2.检查总请求数限制并记录总请求（当totalMaxCount为0时会自动跳过，使用令牌桶限流器
-		if totalMaxCount > 0 {
-			totalKey := fmt.Sprintf("rateLimit:%s", userId)
+		if scope.totalMaxCount > 0 {
+			totalKey := scope.redisTotalKey(userId)
 			// 初始化
 			tb := limiter.New(ctx, rdb)
 			allowed, err = tb.Allow(
 				ctx,
 				totalKey,
-				limiter.WithCapacity(int64(totalMaxCount)*duration),
-				limiter.WithRate(int64(totalMaxCount)),
+				limiter.WithCapacity(int64(scope.totalMaxCount)*duration),
+				limiter.WithRate(int64(scope.totalMaxCount)),
 				limiter.WithRequested(duration),
 			)
 
@@ -114,7 +148,8 @@ func redisRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) g
 			}
 
 			if !allowed {
-				abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", setting.ModelRequestRateLimitDurationMinutes, totalMaxCount))
+				abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到%s总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", scope.target, setting.ModelRequestRateLimitDurationMinutes, scope.totalMaxCount))
+				return
 			}
 		}
 
@@ -123,46 +158,60 @@ func redisRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) g
 
 		// 5. 如果请求成功，记录成功请求
 		if c.Writer.Status() < 400 {
-			recordRedisRequest(ctx, rdb, successKey, successMaxCount)
+			recordRedisRequest(ctx, rdb, successKey, scope.successMaxCount)
 		}
 	}
 }
 
-// 内存限流处理器
-func memoryRateLimitHandler(duration int64, totalMaxCount, successMaxCount int) gin.HandlerFunc {
+// 内存限流处理器，与 Redis 处理器语义一致：成功请求数只统计完成的请求，0 表示不限制
+func memoryRateLimitHandler(duration int64, scope modelRateLimitScope) gin.HandlerFunc {
 	inMemoryRateLimiter.Init(time.Duration(setting.ModelRequestRateLimitDurationMinutes) * time.Minute)
 
 	return func(c *gin.Context) {
 		userId := strconv.Itoa(c.GetInt("id"))
-		totalKey := ModelRequestRateLimitCountMark + userId
-		successKey := ModelRequestRateLimitSuccessCountMark + userId
+		totalKey := scope.memoryTotalKey(userId)
+		successKey := scope.memorySuccessKey(userId)
 
-		// 1. 检查总请求数限制（当totalMaxCount为0时跳过）
-		if totalMaxCount > 0 && !inMemoryRateLimiter.Request(totalKey, totalMaxCount, duration) {
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
+		// 1. 检查成功请求数限制（当successMaxCount为0时跳过），只读取计数，不记录本次请求
+		if scope.successMaxCount > 0 && inMemoryRateLimiter.Count(successKey, duration) >= scope.successMaxCount {
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到%s请求数限制：%d分钟内最多请求%d次", scope.target, setting.ModelRequestRateLimitDurationMinutes, scope.successMaxCount))
 			return
 		}
 
-		// 2. 检查成功请求数限制
-		// 使用一个临时key来检查限制，这样可以避免实际记录
-		checkKey := successKey + "_check"
-		if !inMemoryRateLimiter.Request(checkKey, successMaxCount, duration) {
-			c.Status(http.StatusTooManyRequests)
-			c.Abort()
+		// 2. 检查总请求数限制并记录总请求（当totalMaxCount为0时跳过）
+		if scope.totalMaxCount > 0 && !inMemoryRateLimiter.Request(totalKey, scope.totalMaxCount, duration) {
+			abortWithOpenAiMessage(c, http.StatusTooManyRequests, fmt.Sprintf("您已达到%s总请求数限制：%d分钟内最多请求%d次，包括失败次数，请检查您的请求是否正确", scope.target, setting.ModelRequestRateLimitDurationMinutes, scope.totalMaxCount))
 			return
 		}
 
 		// 3. 处理请求
 		c.Next()
 
-		// 4. 如果请求成功，记录到实际的成功请求计数中
-		if c.Writer.Status() < 400 {
-			inMemoryRateLimiter.Request(successKey, successMaxCount, duration)
+		// 4. 如果请求成功，记录到成功请求计数中
+		if scope.successMaxCount > 0 && c.Writer.Status() < 400 {
+			inMemoryRateLimiter.Request(successKey, scope.successMaxCount, duration)
 		}
 	}
 }
 
+// getRateLimitGroup 返回限流使用的分组：优先令牌分组，其次用户分组
+func getRateLimitGroup(c *gin.Context) string {
+	group := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
+	if group == "" {
+		group = common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	}
+	return group
+}
+
+// getRateLimitModelName 解析请求的模型名，仅在配置了模型规则时调用；解析失败时返回空，由后续 Distribute 报错
+func getRateLimitModelName(c *gin.Context) string {
+	modelRequest, _, err := getModelRequest(c)
+	if err != nil || modelRequest == nil {
+		return ""
+	}
+	return modelRequest.Model
+}
+
 // ModelRequestRateLimit 模型请求限流中间件
 func ModelRequestRateLimit() func(c *gin.Context) {
 	return func(c *gin.Context) {
@@ -174,27 +223,127 @@ func ModelRequestRateLimit() func(c *gin.Context) {
 
 		// 计算限流参数
 		duration := int64(setting.ModelRequestRateLimitDurationMinutes * 60)
-		totalMaxCount := setting.ModelRequestRateLimitCount
-		successMaxCount := setting.ModelRequestRateLimitSuccessCount
+		scope := modelRateLimitScope{
+			totalMaxCount:   setting.ModelRequestRateLimitCount,
+			successMaxCount: setting.ModelRequestRateLimitSuccessCount,
+		}
 
 		// 获取分组
-		group := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
-		if group == "" {
-			group = common.GetContextKeyString(c, constant.ContextKeyUserGroup)
-		}
+		group := getRateLimitGroup(c)
 
 		//获取分组的限流配置
 		groupTotalCount, groupSuccessCount, found := setting.GetGroupRateLimit(group)
 		if found {
-			totalMaxCount = groupTotalCount
-			successMaxCount = groupSuccessCount
+			scope.totalMaxCount = groupTotalCount
+			scope.successMaxCount = groupSuccessCount
+		}
+
+		// 命中模型规则时使用规则的独立计数器
+		if setting.HasModelRateLimitRules() {
+			if modelName := getRateLimitModelName(c); modelName != "" {
+				if rule, ok := setting.GetModelRateLimitRule(group, modelName); ok {
+					scope = newModelRateLimitRuleScope(rule)
+				}
+			}
 		}
 
 		// 根据存储类型选择并执行限流处理器
 		if common.RedisEnabled {
-			redisRateLimitHandler(duration, totalMaxCount, successMaxCount)(c)
+			redisRateLimitHandler(duration, scope)(c)
 		} else {
-			memoryRateLimitHandler(duration, totalMaxCount, successMaxCount)(c)
+			memoryRateLimitHandler(duration, scope)(c)
+		}
+	}
+}
+
+// ModelRequestRateLimitStatus 用户在某组计数器上的当前状态
+type ModelRequestRateLimitStatus struct {
+	Rule            *setting.ModelRateLimitRule `json:"rule,omitempty"` // 为空表示分组/全局计数器
+	TotalMaxCount   int                         `json:"total_max_count"`
+	SuccessMaxCount int                         `json:"success_max_count"`
+	TotalUsed       int                         `json:"total_used"`   // 周期内的请求次数（包括失败），总请求数不限制时为 0
+	SuccessUsed     int                         `json:"success_used"` // 周期内的请求完成次数
+}
+
+func redisSuccessUsed(ctx context.Context, rdb *redis.Client, key string, duration int64) int {
+	values, err := rdb.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		return 0
+	}
+	// 与 checkRedisRateLimit 保持一致，按同一格式解析当前时间后再比较
+	now, err := time.Parse(timeFormat, time.Now().Format(timeFormat))
+	if err != nil {
+		return 0
+	}
+	used := 0
+	for _, value := range values {
+		t, err := time.Parse(timeFormat, value)
+		if err != nil {
+			continue
+		}
+		if int64(now.Sub(t).Seconds()) < duration {
+			used++
+		}
+	}
+	return used
+}
+
+// redisTotalUsed 根据令牌桶剩余令牌估算周期内的请求次数
+func redisTotalUsed(ctx context.Context, rdb *redis.Client, key string, totalMaxCount int, duration int64) int {
+	if totalMaxCount <= 0 || duration <= 0 {
+		return 0
+	}
+	values, err := rdb.HMGet(ctx, key, "tokens", "last_time").Result()
+	if err != nil || len(values) != 2 || values[0] == nil || values[1] == nil {
+		return 0
+	}
+	tokens, err1 := strconv.ParseFloat(fmt.Sprint(values[0]), 64)
+	lastTime, err2 := strconv.ParseInt(fmt.Sprint(values[1]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0
+	}
+	capacity := float64(int64(totalMaxCount) * duration)
+	elapsed := max(time.Now().Unix()-lastTime, 0)
+	tokens = min(capacity, tokens+float64(elapsed*int64(totalMaxCount)))
+	return int(math.Ceil((capacity - tokens) / float64(duration)))
+}
+
+func getModelRateLimitScopeStatus(userId int, scope modelRateLimitScope, duration int64) ModelRequestRateLimitStatus {
+	status := ModelRequestRateLimitStatus{
+		TotalMaxCount:   scope.totalMaxCount,
+		SuccessMaxCount: scope.successMaxCount,
+	}
+	id := strconv.Itoa(userId)
+	if common.RedisEnabled {
+		ctx := context.Background()
+		status.SuccessUsed = redisSuccessUsed(ctx, common.RDB, scope.redisSuccessKey(id), duration)
+		status.TotalUsed = redisTotalUsed(ctx, common.RDB, scope.redisTotalKey(id), scope.totalMaxCount, duration)
+		return status
+	}
+	status.SuccessUsed = inMemoryRateLimiter.Count(scope.memorySuccessKey(id), duration)
+	status.TotalUsed = inMemoryRateLimiter.Count(scope.memoryTotalKey(id), duration)
+	return status
+}
+
+// GetModelRequestRateLimitStatus 返回用户在指定分组下的分组/全局计数器以及适用于该分组的所有模型规则计数器状态
+func GetModelRequestRateLimitStatus(userId int, group string) []ModelRequestRateLimitStatus {
+	duration := int64(setting.ModelRequestRateLimitDurationMinutes * 60)
+	scope := modelRateLimitScope{
+		totalMaxCount:   setting.ModelRequestRateLimitCount,
+		successMaxCount: setting.ModelRequestRateLimitSuccessCount,
+	}
+	if groupTotalCount, groupSuccessCount, found := setting.GetGroupRateLimit(group); found {
+		scope.totalMaxCount = groupTotalCount
+		scope.successMaxCount = groupSuccessCount
+	}
+	result := []ModelRequestRateLimitStatus{getModelRateLimitScopeStatus(userId, scope, duration)}
+	for _, rule := range setting.GetModelRateLimitRules() {
+		if rule.Group != "" && rule.Group != "*" && rule.Group != group {
+			continue
 		}
+		status := getModelRateLimitScopeStatus(userId, newModelRateLimitRuleScope(rule), duration)
+		status.Rule = &rule
+		result = append(result, status)
 	}
+	return result
 }
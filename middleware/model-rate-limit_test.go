@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func runMemoryRateLimit(t *testing.T, scope modelRateLimitScope, userId int, status int) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, engine := gin.CreateTestContext(w)
+	engine.Use(func(c *gin.Context) { c.Set("id", userId) }, memoryRateLimitHandler(60, scope))
+	engine.POST("/v1/chat/completions", func(c *gin.Context) { c.Status(status) })
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	engine.HandleContext(c)
+	return w.Code
+}
+
+func TestMemoryRateLimitHandler_ZeroMeansUnlimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	scope := modelRateLimitScope{keyPrefix: "test-zero:", totalMaxCount: 0, successMaxCount: 0}
+	for i := 0; i < 20; i++ {
+		require.Equal(t, http.StatusOK, runMemoryRateLimit(t, scope, 1001, http.StatusOK))
+	}
+}
+
+func TestMemoryRateLimitHandler_SuccessCountIgnoresFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	scope := modelRateLimitScope{keyPrefix: "test-success:", successMaxCount: 2}
+
+	// failed requests do not consume the success quota, same as the Redis handler
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusBadRequest, runMemoryRateLimit(t, scope, 1002, http.StatusBadRequest))
+	}
+	require.Equal(t, http.StatusOK, runMemoryRateLimit(t, scope, 1002, http.StatusOK))
+	require.Equal(t, http.StatusOK, runMemoryRateLimit(t, scope, 1002, http.StatusOK))
+	require.Equal(t, http.StatusTooManyRequests, runMemoryRateLimit(t, scope, 1002, http.StatusOK))
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -54,7 +56,10 @@ type Channel struct {
 	OtherSettings string `json:"settings" gorm:"column:settings"` // 其他设置，存储azure版本等不需要检索的信息，详见dto.ChannelOtherSettings
 
 	// cache info
-	Keys []string `json:"-" gorm:"-"`
+	Keys     []string             `json:"-" gorm:"-"`
+	schedule *dto.ChannelSchedule `gorm:"-"` // 同步缓存时解析的可用时段
+
+	ScheduleStatus *dto.ChannelScheduleStatus `json:"schedule_status,omitempty" gorm:"-"` // 仅用于渠道列表展示
 }
 
 type ChannelInfo struct {
@@ -65,6 +70,10 @@ type ChannelInfo struct {
 	MultiKeyDisabledTime   map[int]int64         `json:"multi_key_disabled_time,omitempty"`   // key禁用时间列表，key index -> time
 	MultiKeyPollingIndex   int                   `json:"multi_key_polling_index"`             // 多Key模式下轮询的key索引
 	MultiKeyMode           constant.MultiKeyMode `json:"multi_key_mode"`
+	// 以下按 key index 记录，缺省时权重为 1、不限每日 token
+	MultiKeyWeights           map[int]int           `json:"multi_key_weights,omitempty"`             // key权重，weighted 模式使用
+	MultiKeyDailyTokenBudgets map[int]int64         `json:"multi_key_daily_token_budgets,omitempty"` // key每日token预算，用尽后当天不再选择
+	MultiKeyUsage             map[int]MultiKeyUsage `json:"-"`                                       // key用量计数，存放在 channel_key_usages 中
 }
 
 // Value implements driver.Valuer interface
@@ -103,6 +112,13 @@ func (channel *Channel) GetKeys() []string {
 }
 
 func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
+	return channel.GetNextEnabledKeyWithFilter(nil)
+}
+
+// GetNextEnabledKeyWithFilter selects the next enabled key like GetNextEnabledKey, skipping keys for which
+// keyFilter returns false (e.g. keys whose circuit breaker is open). If the filter rejects every enabled key,
+// the filter is ignored so that the channel still serves traffic.
+func (channel *Channel) GetNextEnabledKeyWithFilter(keyFilter func(keyIndex int) bool) (string, int, *types.NewAPIError) {
 	// If not in multi-key mode, return the original key string directly.
 	if !channel.ChannelInfo.IsMultiKey {
 		return channel.Key, 0, nil
@@ -115,6 +131,25 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		return "", 0, types.NewError(errors.New("no keys available"), types.ErrorCodeChannelNoAvailableKey)
 	}
 
+	tracksUsage := channel.ChannelInfo.tracksKeyUsage()
+	if tracksUsage && !common.MemoryCacheEnabled {
+		// 非内存缓存模式下用量计数不在 channel_info 中，在加锁前从数据库读取
+		channel.ChannelInfo.MultiKeyUsage = GetMultiKeyUsageSnapshot(channel)
+	}
+
+	idx, err := channel.selectEnabledKey(len(keys), keyFilter)
+	if err != nil {
+		return "", 0, err
+	}
+	if tracksUsage {
+		// 用量增量暂存在内存中定期写入数据库，不在轮询锁内访问数据库
+		recordMultiKeyUsage(channel.Id, idx, 0, 1, time.Now())
+	}
+	return keys[idx], idx, nil
+}
+
+// selectEnabledKey 在渠道的轮询锁内按多Key模式选择一个可用key，需要时在缓存中记录key被选中的时间与今日请求数
+func (channel *Channel) selectEnabledKey(keyCount int, keyFilter func(keyIndex int) bool) (int, *types.NewAPIError) {
 	lock := GetChannelPollingLock(channel.Id)
 	lock.Lock()
 	defer lock.Unlock()
@@ -132,8 +167,8 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	}
 
 	// Collect indexes of enabled keys
-	enabledIdx := make([]int, 0, len(keys))
-	for i := range keys {
+	enabledIdx := make([]int, 0, keyCount)
+	for i := 0; i < keyCount; i++ {
 		if getStatus(i) == common.ChannelStatusEnabled {
 			enabledIdx = append(enabledIdx, i)
 		}
@@ -142,20 +177,54 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	// properly handle a channel with no available keys (e.g. mark channel disabled).
 	// Returning the first key here caused requests to keep using an already-disabled key.
 	if len(enabledIdx) == 0 {
-		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
+		return 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
+	}
+	// 今日token预算已用尽的key不再选择，与熔断过滤不同，全部用尽时不放宽
+	withinBudgetIdx := make([]int, 0, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		if !channel.ChannelInfo.IsKeyBudgetExhausted(idx) {
+			withinBudgetIdx = append(withinBudgetIdx, idx)
+		}
+	}
+	if len(withinBudgetIdx) == 0 {
+		return 0, types.NewError(errors.New("all enabled keys have exhausted their daily token budget"), types.ErrorCodeChannelNoAvailableKey)
+	}
+	enabledIdx = withinBudgetIdx
+	if keyFilter != nil {
+		filteredIdx := make([]int, 0, len(enabledIdx))
+		for _, idx := range enabledIdx {
+			if keyFilter(idx) {
+				filteredIdx = append(filteredIdx, idx)
+			}
+		}
+		if len(filteredIdx) > 0 {
+			enabledIdx = filteredIdx
+		}
+	}
+	isSelectable := func(idx int) bool {
+		return slices.Contains(enabledIdx, idx)
+	}
+	// 记录key被选中的时间与今日请求数，供 least_recently_used 等模式使用
+	useKey := func(idx int) (int, *types.NewAPIError) {
+		if channel.ChannelInfo.tracksKeyUsage() {
+			channel.ChannelInfo.markKeyUsed(idx, time.Now())
+		}
+		return idx, nil
 	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
 		// Randomly pick one enabled key
 		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
-		return keys[selectedIdx], selectedIdx, nil
+		return useKey(selectedIdx)
+	case constant.MultiKeyModeLeastRecentlyUsed, constant.MultiKeyModeLeastTokensToday, constant.MultiKeyModeWeighted:
+		return useKey(channel.ChannelInfo.selectKeyByUsage(enabledIdx))
 	case constant.MultiKeyModePolling:
 		// Use channel-specific lock to ensure thread-safe polling
 
 		channelInfo, err := CacheGetChannelInfo(channel.Id)
 		if err != nil {
-			return "", 0, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
+			return 0, types.NewError(err, types.ErrorCodeGetChannelFailed, types.ErrOptionWithSkipRetry())
 		}
 		//println("before polling index:", channel.ChannelInfo.MultiKeyPollingIndex)
 		defer func() {
@@ -170,22 +239,22 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}()
 		// Start from the saved polling index and look for the next enabled key
 		start := channelInfo.MultiKeyPollingIndex
-		if start < 0 || start >= len(keys) {
+		if start < 0 || start >= keyCount {
 			start = 0
 		}
-		for i := 0; i < len(keys); i++ {
-			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+		for i := 0; i < keyCount; i++ {
+			idx := (start + i) % keyCount
+			if isSelectable(idx) {
 				// update polling index for next call (point to the next position)
-				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
-				return keys[idx], idx, nil
+				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % keyCount
+				return useKey(idx)
 			}
 		}
 		// Fallback – should not happen, but return first enabled key
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		return useKey(enabledIdx[0])
 	default:
 		// Unknown mode, default to first enabled key (or original key string)
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		return useKey(enabledIdx[0])
 	}
 }
 
@@ -1006,3 +1075,10 @@ func CountChannelsGroupByType() (map[int64]int64, error) {
 	}
 	return counts, nil
 }
+
+// GetChannelStatusList 只查询渠道的 id、名称、类型和状态（用于监控指标）
+func GetChannelStatusList() ([]*Channel, error) {
+	var channels []*Channel
+	err := DB.Model(&Channel{}).Select("id", "name", "type", "status").Find(&channels).Error
+	return channels, err
+}
@@ -17,6 +17,7 @@ import (
 var group2model2channels map[string]map[string][]int // enabled channel
 var channelsIDM map[int]*Channel                     // all channels include disabled
 var channelSyncLock sync.RWMutex
+var hasScheduledChannels bool // 是否存在设置了可用时段的渠道
 
 func InitChannelCache() {
 	if !common.MemoryCacheEnabled {
@@ -64,8 +65,20 @@ func InitChannelCache() {
 		}
 	}
 
+	// 多Key的用量计数存放在 channel_key_usages 中，替换缓存前载入
+	loadMultiKeyUsage(newChannelId2channel)
+
+	newHasScheduledChannels := false
+	for _, channel := range newChannelId2channel {
+		channel.schedule = channel.GetSchedule()
+		if channel.schedule != nil {
+			newHasScheduledChannels = true
+		}
+	}
+
 	channelSyncLock.Lock()
 	group2model2channels = newGroup2model2channels
+	hasScheduledChannels = newHasScheduledChannels
 	//channelsIDM = newChannelId2channel
 	for i, channel := range newChannelId2channel {
 		if channel.ChannelInfo.IsMultiKey {
@@ -102,6 +115,112 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	channelSyncLock.RLock()
 	defer channelSyncLock.RUnlock()
 
+	targetChannels, err := getPriorityTierChannels(group, model, retry)
+	if err != nil || len(targetChannels) == 0 {
+		return nil, err
+	}
+	if len(targetChannels) == 1 {
+		return targetChannels[0], nil
+	}
+
+	sumWeight := 0
+	for _, channel := range targetChannels {
+		sumWeight += channel.GetWeight()
+	}
+
+	// smoothing factor and adjustment
+	smoothingFactor := 1
+	smoothingAdjustment := 0
+
+	if sumWeight == 0 {
+		// when all channels have weight 0, set sumWeight to the number of channels and set smoothing adjustment to 100
+		// each channel's effective weight = 100
+		sumWeight = len(targetChannels) * 100
+		smoothingAdjustment = 100
+	} else if sumWeight/len(targetChannels) < 10 {
+		// when the average weight is less than 10, set smoothing factor to 100
+		smoothingFactor = 100
+	}
+
+	// Calculate the total weight of all channels up to endIdx
+	totalWeight := sumWeight * smoothingFactor
+
+	// Generate a random value in the range [0, totalWeight)
+	randomWeight := rand.Intn(totalWeight)
+
+	// Find a channel based on its weight
+	for _, channel := range targetChannels {
+		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
+		if randomWeight < 0 {
+			return channel, nil
+		}
+	}
+	// return null if no channel is not found
+	return nil, errors.New("channel not found")
+}
+
+// ChannelWeightFunc returns the factor applied to a channel's smoothed static weight within its priority tier.
+type ChannelWeightFunc func(channel *Channel) float64
+
+// GetRandomSatisfiedChannelWeighted works like GetRandomSatisfiedChannel, but multiplies each channel's
+// static weight (smoothed the same way as GetRandomSatisfiedChannel) by the factor returned from weightFunc.
+// When the memory cache is disabled it falls back to the database selection.
+func GetRandomSatisfiedChannelWeighted(group string, model string, retry int, weightFunc ChannelWeightFunc) (*Channel, error) {
+	if weightFunc == nil || !common.MemoryCacheEnabled {
+		return GetRandomSatisfiedChannel(group, model, retry)
+	}
+
+	channelSyncLock.RLock()
+	targetChannels, err := getPriorityTierChannels(group, model, retry)
+	channelSyncLock.RUnlock()
+	if err != nil || len(targetChannels) == 0 {
+		return nil, err
+	}
+	if len(targetChannels) == 1 {
+		return targetChannels[0], nil
+	}
+
+	sumWeight := 0
+	for _, channel := range targetChannels {
+		sumWeight += channel.GetWeight()
+	}
+	// same smoothing as GetRandomSatisfiedChannel, so weight 0 channels keep their baseline share
+	smoothingFactor := 1
+	smoothingAdjustment := 0
+	if sumWeight == 0 {
+		smoothingAdjustment = 100
+	} else if sumWeight/len(targetChannels) < 10 {
+		smoothingFactor = 100
+	}
+
+	weights := make([]float64, len(targetChannels))
+	totalWeight := 0.0
+	for i, channel := range targetChannels {
+		factor := weightFunc(channel)
+		if factor < 0 {
+			factor = 0
+		}
+		w := float64(channel.GetWeight()*smoothingFactor+smoothingAdjustment) * factor
+		weights[i] = w
+		totalWeight += w
+	}
+	if totalWeight <= 0 {
+		return targetChannels[rand.Intn(len(targetChannels))], nil
+	}
+
+	randomWeight := rand.Float64() * totalWeight
+	for i, channel := range targetChannels {
+		randomWeight -= weights[i]
+		if randomWeight < 0 {
+			return channel, nil
+		}
+	}
+	return targetChannels[len(targetChannels)-1], nil
+}
+
+// getPriorityTierChannels returns the enabled channels of the priority tier selected by retry.
+// The caller must hold channelSyncLock.
+func getPriorityTierChannels(group string, model string, retry int) ([]*Channel, error) {
 	// First, try to find channels with the exact model name.
 	channels := group2model2channels[group][model]
 
@@ -111,13 +230,16 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 		channels = group2model2channels[group][normalizedModel]
 	}
 
+	// 不在可用时段内的渠道不参与选择
+	channels = filterScheduledChannels(channels, time.Now())
+
 	if len(channels) == 0 {
 		return nil, nil
 	}
 
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
-			return channel, nil
+			return []*Channel{channel}, nil
 		}
 		return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channels[0])
 	}
@@ -142,12 +264,10 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	targetPriority := int64(sortedUniquePriorities[retry])
 
 	// get the priority for the given retry number
-	var sumWeight = 0
 	var targetChannels []*Channel
 	for _, channelId := range channels {
 		if channel, ok := channelsIDM[channelId]; ok {
 			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
 				targetChannels = append(targetChannels, channel)
 			}
 		} else {
@@ -158,36 +278,7 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	if len(targetChannels) == 0 {
 		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
 	}
-
-	// smoothing factor and adjustment
-	smoothingFactor := 1
-	smoothingAdjustment := 0
-
-	if sumWeight == 0 {
-		// when all channels have weight 0, set sumWeight to the number of channels and set smoothing adjustment to 100
-		// each channel's effective weight = 100
-		sumWeight = len(targetChannels) * 100
-		smoothingAdjustment = 100
-	} else if sumWeight/len(targetChannels) < 10 {
-		// when the average weight is less than 10, set smoothing factor to 100
-		smoothingFactor = 100
-	}
-
-	// Calculate the total weight of all channels up to endIdx
-	totalWeight := sumWeight * smoothingFactor
-
-	// Generate a random value in the range [0, totalWeight)
-	randomWeight := rand.Intn(totalWeight)
-
-	// Find a channel based on its weight
-	for _, channel := range targetChannels {
-		randomWeight -= channel.GetWeight()*smoothingFactor + smoothingAdjustment
-		if randomWeight < 0 {
-			return channel, nil
-		}
-	}
-	// return null if no channel is not found
-	return nil, errors.New("channel not found")
+	return targetChannels, nil
 }
 
 func CacheGetChannel(id int) (*Channel, error) {
@@ -251,11 +342,16 @@ func CacheUpdateChannel(channel *Channel) {
 	if !common.MemoryCacheEnabled {
 		return
 	}
-	channelSyncLock.Lock()
-	defer channelSyncLock.Unlock()
 	if channel == nil {
 		return
 	}
+	// 在加锁前解析可用时段，选择渠道时只比较分钟数
+	channel.schedule = channel.GetSchedule()
+	channelSyncLock.Lock()
+	defer channelSyncLock.Unlock()
+	if channel.schedule != nil {
+		hasScheduledChannels = true
+	}
 
 	println("CacheUpdateChannel:", channel.Id, channel.Name, channel.Status, channel.ChannelInfo.MultiKeyPollingIndex)
 
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRandomSatisfiedChannelWeighted_KeepsZeroWeightBaseline(t *testing.T) {
+	oldGroups, oldChannels, oldScheduled, oldMemoryCache := group2model2channels, channelsIDM, hasScheduledChannels, common.MemoryCacheEnabled
+	t.Cleanup(func() {
+		group2model2channels, channelsIDM, hasScheduledChannels, common.MemoryCacheEnabled = oldGroups, oldChannels, oldScheduled, oldMemoryCache
+	})
+
+	group2model2channels = map[string]map[string][]int{"default": {"gpt-4o": {1, 2}}}
+	channelsIDM = map[int]*Channel{
+		1: {Id: 1, Weight: common.GetPointer[uint](20)},
+		2: {Id: 2, Weight: common.GetPointer[uint](0)},
+	}
+	hasScheduledChannels = false
+	common.MemoryCacheEnabled = true
+
+	// 平均权重不低于 10 时权重为 0 的渠道没有流量，加权后同样如此
+	healthy := func(channel *Channel) float64 { return 1 }
+	for i := 0; i < 100; i++ {
+		channel, err := GetRandomSatisfiedChannelWeighted("default", "gpt-4o", 0, healthy)
+		require.NoError(t, err)
+		require.Equal(t, 1, channel.Id)
+	}
+
+	// 所有渠道权重为 0 时平均分配，系数仍然生效
+	channelsIDM[1].Weight = common.GetPointer[uint](0)
+	onlySecond := func(channel *Channel) float64 {
+		if channel.Id == 2 {
+			return 1
+		}
+		return 0
+	}
+	for i := 0; i < 100; i++ {
+		channel, err := GetRandomSatisfiedChannelWeighted("default", "gpt-4o", 0, onlySecond)
+		require.NoError(t, err)
+		require.Equal(t, 2, channel.Id)
+	}
+}
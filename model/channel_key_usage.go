@@ -0,0 +1,214 @@
+package model
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ChannelKeyUsage 多Key渠道单个key的今日用量，与 channel_info 分开存放，只按增量累加，日期变化后归零
+type ChannelKeyUsage struct {
+	ChannelId     int    `json:"channel_id" gorm:"primaryKey;autoIncrement:false"`
+	KeyIndex      int    `json:"key_index" gorm:"primaryKey;autoIncrement:false"`
+	UsageDate     string `json:"usage_date" gorm:"type:varchar(10)"`
+	TokensToday   int64  `json:"tokens_today" gorm:"default:0"`
+	RequestsToday int64  `json:"requests_today" gorm:"default:0"`
+	LastUsedTime  int64  `json:"last_used_time" gorm:"default:0"`
+}
+
+// multiKeyUsageDeltaKey 尚未写入数据库的用量增量
+type multiKeyUsageDeltaKey struct {
+	channelId int
+	keyIndex  int
+	date      string
+}
+
+type multiKeyUsageDelta struct {
+	tokens   int64
+	requests int64
+	lastUsed int64
+}
+
+var (
+	multiKeyUsageDeltas    = make(map[multiKeyUsageDeltaKey]*multiKeyUsageDelta)
+	multiKeyUsageDeltaLock sync.Mutex
+)
+
+// increaseChannelKeyUsage 累加key的用量。usage_date 最后赋值，保证 MySQL 按顺序求值时 CASE 使用的是原日期；
+// 已记录更新日期的行不会被旧日期的增量覆盖。
+func increaseChannelKeyUsage(channelId int, keyIndex int, date string, tokens int64, requests int64, lastUsed int64) error {
+	update := func() (int64, error) {
+		result := DB.Exec(`UPDATE channel_key_usages SET
+			tokens_today = CASE WHEN usage_date = ? THEN tokens_today + ? ELSE ? END,
+			requests_today = CASE WHEN usage_date = ? THEN requests_today + ? ELSE ? END,
+			last_used_time = CASE WHEN last_used_time < ? THEN ? ELSE last_used_time END,
+			usage_date = ?
+			WHERE channel_id = ? AND key_index = ? AND usage_date <= ?`,
+			date, tokens, tokens,
+			date, requests, requests,
+			lastUsed, lastUsed,
+			date,
+			channelId, keyIndex, date)
+		return result.RowsAffected, result.Error
+	}
+	affected, err := update()
+	if err != nil || affected > 0 {
+		return err
+	}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&ChannelKeyUsage{
+		ChannelId:     channelId,
+		KeyIndex:      keyIndex,
+		UsageDate:     date,
+		TokensToday:   tokens,
+		RequestsToday: requests,
+		LastUsedTime:  lastUsed,
+	})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return result.Error
+	}
+	// 并发创建时其他请求已插入该行
+	_, err = update()
+	return err
+}
+
+// recordMultiKeyUsage 暂存key的用量增量：内存缓存模式下随缓存同步写入数据库，否则由 SyncMultiKeyUsage 定期写入
+func recordMultiKeyUsage(channelId int, keyIndex int, tokens int64, requests int64, now time.Time) {
+	date := multiKeyUsageDate(now)
+	multiKeyUsageDeltaLock.Lock()
+	defer multiKeyUsageDeltaLock.Unlock()
+	key := multiKeyUsageDeltaKey{channelId: channelId, keyIndex: keyIndex, date: date}
+	delta, ok := multiKeyUsageDeltas[key]
+	if !ok {
+		delta = &multiKeyUsageDelta{}
+		multiKeyUsageDeltas[key] = delta
+	}
+	delta.tokens += tokens
+	delta.requests += requests
+	if now.UnixMilli() > delta.lastUsed {
+		delta.lastUsed = now.UnixMilli()
+	}
+}
+
+// dropMultiKeyUsageDeltas 丢弃渠道尚未写入的用量增量，keyIndex 为 nil 时丢弃全部key
+func dropMultiKeyUsageDeltas(channelId int, keyIndex *int) {
+	multiKeyUsageDeltaLock.Lock()
+	defer multiKeyUsageDeltaLock.Unlock()
+	for key := range multiKeyUsageDeltas {
+		if key.channelId == channelId && (keyIndex == nil || key.keyIndex == *keyIndex) {
+			delete(multiKeyUsageDeltas, key)
+		}
+	}
+}
+
+// flushMultiKeyUsage 将暂存的今日用量增量写入数据库，跨天的增量不再影响今日计数，直接丢弃
+func flushMultiKeyUsage() {
+	multiKeyUsageDeltaLock.Lock()
+	deltas := multiKeyUsageDeltas
+	multiKeyUsageDeltas = make(map[multiKeyUsageDeltaKey]*multiKeyUsageDelta)
+	multiKeyUsageDeltaLock.Unlock()
+
+	today := multiKeyUsageDate(time.Now())
+	for key, delta := range deltas {
+		if key.date != today {
+			continue
+		}
+		if err := increaseChannelKeyUsage(key.channelId, key.keyIndex, key.date, delta.tokens, delta.requests, delta.lastUsed); err != nil {
+			common.SysLog(fmt.Sprintf("failed to save multi-key usage: channel_id=%d, error=%v", key.channelId, err))
+		}
+	}
+}
+
+// SyncMultiKeyUsage 非内存缓存模式下定期将暂存的用量增量写入数据库
+func SyncMultiKeyUsage(frequency int) {
+	for {
+		time.Sleep(time.Duration(frequency) * time.Second)
+		flushMultiKeyUsage()
+	}
+}
+
+// applyMultiKeyUsageDeltas 将本节点尚未写入的今日增量加到从数据库读取的用量上
+func applyMultiKeyUsageDeltas(channelId int, usages map[int]MultiKeyUsage) map[int]MultiKeyUsage {
+	today := multiKeyUsageDate(time.Now())
+	multiKeyUsageDeltaLock.Lock()
+	defer multiKeyUsageDeltaLock.Unlock()
+	for key, delta := range multiKeyUsageDeltas {
+		if key.channelId != channelId || key.date != today {
+			continue
+		}
+		if usages == nil {
+			usages = make(map[int]MultiKeyUsage)
+		}
+		usage := usages[key.keyIndex].today(today)
+		usage.TokensToday += delta.tokens
+		usage.RequestsToday += delta.requests
+		if delta.lastUsed > usage.LastUsedTime {
+			usage.LastUsedTime = delta.lastUsed
+		}
+		usages[key.keyIndex] = usage
+	}
+	return usages
+}
+
+// getChannelKeyUsages 查询渠道今日的key用量，channelIds 为空时查询全部渠道，返回 channel id -> key index -> 用量
+func getChannelKeyUsages(channelIds ...int) (map[int]map[int]MultiKeyUsage, error) {
+	var rows []*ChannelKeyUsage
+	query := DB.Where("usage_date = ?", multiKeyUsageDate(time.Now()))
+	if len(channelIds) > 0 {
+		query = query.Where("channel_id IN ?", channelIds)
+	}
+	if err := query.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	usages := make(map[int]map[int]MultiKeyUsage)
+	for _, row := range rows {
+		if usages[row.ChannelId] == nil {
+			usages[row.ChannelId] = make(map[int]MultiKeyUsage)
+		}
+		usages[row.ChannelId][row.KeyIndex] = MultiKeyUsage{
+			LastUsedTime:  row.LastUsedTime,
+			UsageDate:     row.UsageDate,
+			TokensToday:   row.TokensToday,
+			RequestsToday: row.RequestsToday,
+		}
+	}
+	return usages, nil
+}
+
+// deleteChannelKeyUsages 删除渠道的key用量，keyIndex 为 nil 时删除全部key
+func deleteChannelKeyUsages(channelId int, keyIndex *int) error {
+	query := DB.Where("channel_id = ?", channelId)
+	if keyIndex != nil {
+		query = query.Where("key_index = ?", *keyIndex)
+	}
+	return query.Delete(&ChannelKeyUsage{}).Error
+}
+
+// RemapChannelKeyUsages 删除key后按 旧index -> 新index 的映射重排数据库中的用量，未出现在映射中的key被删除
+func RemapChannelKeyUsages(channelId int, indexMap map[int]int) error {
+	flushMultiKeyUsage()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var rows []*ChannelKeyUsage
+		if err := tx.Where("channel_id = ?", channelId).Find(&rows).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("channel_id = ?", channelId).Delete(&ChannelKeyUsage{}).Error; err != nil {
+			return err
+		}
+		remapped := make([]*ChannelKeyUsage, 0, len(rows))
+		for _, row := range rows {
+			if newIdx, ok := indexMap[row.KeyIndex]; ok {
+				row.KeyIndex = newIdx
+				remapped = append(remapped, row)
+			}
+		}
+		if len(remapped) == 0 {
+			return nil
+		}
+		return tx.Create(&remapped).Error
+	})
+}
@@ -0,0 +1,244 @@
+package model
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+)
+
+// multiKeyUsageLock 保护缓存渠道的 MultiKeyUsage。选择key时已持有渠道的轮询锁，加锁顺序为 轮询锁 -> 本锁，
+// 同步缓存时可能已持有轮询锁（如管理多Key时），只加本锁
+var multiKeyUsageLock sync.Mutex
+
+// MultiKeyUsage 单个key的用量计数，今日计数在日期变化后归零
+type MultiKeyUsage struct {
+	LastUsedTime  int64  `json:"last_used_time"` // 最近一次被选中的时间（毫秒）
+	UsageDate     string `json:"usage_date"`     // 今日计数对应的日期
+	TokensToday   int64  `json:"tokens_today"`
+	RequestsToday int64  `json:"requests_today"`
+}
+
+func multiKeyUsageDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// today 返回按日期归零后的计数
+func (u MultiKeyUsage) today(date string) MultiKeyUsage {
+	if u.UsageDate != date {
+		u.UsageDate = date
+		u.TokensToday = 0
+		u.RequestsToday = 0
+	}
+	return u
+}
+
+// GetKeyWeight 返回key的权重，未设置或不合法时为 1
+func (info *ChannelInfo) GetKeyWeight(keyIndex int) int {
+	if weight, ok := info.MultiKeyWeights[keyIndex]; ok && weight > 0 {
+		return weight
+	}
+	return 1
+}
+
+// tracksKeyUsage 是否需要记录key的用量：按用量选择key的模式，或设置了今日token预算
+func (info *ChannelInfo) tracksKeyUsage() bool {
+	return len(info.MultiKeyDailyTokenBudgets) > 0 ||
+		info.MultiKeyMode == constant.MultiKeyModeLeastRecentlyUsed || info.MultiKeyMode == constant.MultiKeyModeLeastTokensToday
+}
+
+func (info *ChannelInfo) keyUsage(keyIndex int) MultiKeyUsage {
+	return info.MultiKeyUsage[keyIndex].today(multiKeyUsageDate(time.Now()))
+}
+
+func (info *ChannelInfo) keyBudgetExhausted(keyIndex int) bool {
+	budget := info.MultiKeyDailyTokenBudgets[keyIndex]
+	return budget > 0 && info.keyUsage(keyIndex).TokensToday >= budget
+}
+
+// GetKeyUsage 返回key今日的用量计数
+func (info *ChannelInfo) GetKeyUsage(keyIndex int) MultiKeyUsage {
+	multiKeyUsageLock.Lock()
+	defer multiKeyUsageLock.Unlock()
+	return info.keyUsage(keyIndex)
+}
+
+// IsKeyBudgetExhausted 判断key今日的token预算是否已用尽
+func (info *ChannelInfo) IsKeyBudgetExhausted(keyIndex int) bool {
+	multiKeyUsageLock.Lock()
+	defer multiKeyUsageLock.Unlock()
+	return info.keyBudgetExhausted(keyIndex)
+}
+
+func (info *ChannelInfo) markKeyUsed(keyIndex int, now time.Time) {
+	multiKeyUsageLock.Lock()
+	defer multiKeyUsageLock.Unlock()
+	if info.MultiKeyUsage == nil {
+		info.MultiKeyUsage = make(map[int]MultiKeyUsage)
+	}
+	usage := info.MultiKeyUsage[keyIndex].today(multiKeyUsageDate(now))
+	usage.LastUsedTime = now.UnixMilli()
+	usage.RequestsToday++
+	info.MultiKeyUsage[keyIndex] = usage
+}
+
+func (info *ChannelInfo) addKeyTokens(keyIndex int, tokens int, now time.Time) {
+	multiKeyUsageLock.Lock()
+	defer multiKeyUsageLock.Unlock()
+	if info.MultiKeyUsage == nil {
+		info.MultiKeyUsage = make(map[int]MultiKeyUsage)
+	}
+	usage := info.MultiKeyUsage[keyIndex].today(multiKeyUsageDate(now))
+	usage.TokensToday += int64(tokens)
+	info.MultiKeyUsage[keyIndex] = usage
+}
+
+// selectKeyByUsage 按 least_recently_used / least_tokens_today / weighted 模式从候选key中选择一个
+func (info *ChannelInfo) selectKeyByUsage(candidates []int) int {
+	multiKeyUsageLock.Lock()
+	defer multiKeyUsageLock.Unlock()
+	switch info.MultiKeyMode {
+	case constant.MultiKeyModeLeastRecentlyUsed:
+		selected := candidates[0]
+		for _, idx := range candidates[1:] {
+			if info.MultiKeyUsage[idx].LastUsedTime < info.MultiKeyUsage[selected].LastUsedTime {
+				selected = idx
+			}
+		}
+		return selected
+	case constant.MultiKeyModeLeastTokensToday:
+		selected := candidates[0]
+		for _, idx := range candidates[1:] {
+			current, best := info.keyUsage(idx), info.keyUsage(selected)
+			// 用量相同时优先选择最久未使用的key，避免集中到同一个key
+			if current.TokensToday < best.TokensToday ||
+				(current.TokensToday == best.TokensToday && current.LastUsedTime < best.LastUsedTime) {
+				selected = idx
+			}
+		}
+		return selected
+	default:
+		total := 0
+		for _, idx := range candidates {
+			total += info.GetKeyWeight(idx)
+		}
+		r := rand.Intn(total)
+		for _, idx := range candidates {
+			r -= info.GetKeyWeight(idx)
+			if r < 0 {
+				return idx
+			}
+		}
+		return candidates[len(candidates)-1]
+	}
+}
+
+// RemapKeyIndexes 删除key后按 旧index -> 新index 的映射重排权重、预算与用量，未出现在映射中的key被丢弃
+func (info *ChannelInfo) RemapKeyIndexes(indexMap map[int]int) {
+	if info.MultiKeyWeights != nil {
+		weights := make(map[int]int)
+		for oldIdx, weight := range info.MultiKeyWeights {
+			if newIdx, ok := indexMap[oldIdx]; ok {
+				weights[newIdx] = weight
+			}
+		}
+		info.MultiKeyWeights = weights
+	}
+	if info.MultiKeyDailyTokenBudgets != nil {
+		budgets := make(map[int]int64)
+		for oldIdx, budget := range info.MultiKeyDailyTokenBudgets {
+			if newIdx, ok := indexMap[oldIdx]; ok {
+				budgets[newIdx] = budget
+			}
+		}
+		info.MultiKeyDailyTokenBudgets = budgets
+	}
+	if info.MultiKeyUsage != nil {
+		usages := make(map[int]MultiKeyUsage)
+		for oldIdx, usage := range info.MultiKeyUsage {
+			if newIdx, ok := indexMap[oldIdx]; ok {
+				usages[newIdx] = usage
+			}
+		}
+		info.MultiKeyUsage = usages
+	}
+}
+
+// RecordMultiKeyTokenUsage 累加key今日的token用量，增量定期写入 channel_key_usages，不会写回 channel_info。
+// 内存缓存模式下同时更新缓存中的计数，不需要记录用量的渠道直接跳过。
+func RecordMultiKeyTokenUsage(channelId int, keyIndex int, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	now := time.Now()
+	if common.MemoryCacheEnabled {
+		channel, err := CacheGetChannel(channelId)
+		if err != nil || !channel.ChannelInfo.IsMultiKey || !channel.ChannelInfo.tracksKeyUsage() {
+			return
+		}
+		channel.ChannelInfo.addKeyTokens(keyIndex, tokens, now)
+	}
+	recordMultiKeyUsage(channelId, keyIndex, int64(tokens), 0, now)
+}
+
+// ResetMultiKeyUsage 清空key的用量计数，keyIndex 为 nil 时清空全部key
+func ResetMultiKeyUsage(channel *Channel, keyIndex *int) error {
+	dropMultiKeyUsageDeltas(channel.Id, keyIndex)
+	if err := deleteChannelKeyUsages(channel.Id, keyIndex); err != nil {
+		return err
+	}
+	multiKeyUsageLock.Lock()
+	defer multiKeyUsageLock.Unlock()
+	reset := func(info *ChannelInfo) {
+		if keyIndex == nil {
+			info.MultiKeyUsage = nil
+		} else {
+			delete(info.MultiKeyUsage, *keyIndex)
+		}
+	}
+	reset(&channel.ChannelInfo)
+	if common.MemoryCacheEnabled {
+		if cached, err := CacheGetChannel(channel.Id); err == nil && cached != channel {
+			reset(&cached.ChannelInfo)
+		}
+	}
+	return nil
+}
+
+// GetMultiKeyUsageSnapshot 返回key的用量计数，内存缓存模式下以缓存中的实时计数为准，
+// 否则从数据库读取并加上本节点尚未写入的增量
+func GetMultiKeyUsageSnapshot(channel *Channel) map[int]MultiKeyUsage {
+	if !common.MemoryCacheEnabled {
+		usages, err := getChannelKeyUsages(channel.Id)
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to load multi-key usage: channel_id=%d, error=%v", channel.Id, err))
+			return nil
+		}
+		return applyMultiKeyUsageDeltas(channel.Id, usages[channel.Id])
+	}
+	multiKeyUsageLock.Lock()
+	defer multiKeyUsageLock.Unlock()
+	if cached, err := CacheGetChannel(channel.Id); err == nil {
+		return maps.Clone(cached.ChannelInfo.MultiKeyUsage)
+	}
+	return maps.Clone(channel.ChannelInfo.MultiKeyUsage)
+}
+
+// loadMultiKeyUsage 同步缓存时先写入暂存的用量增量，再从数据库读取各节点累计的今日用量
+func loadMultiKeyUsage(newChannels map[int]*Channel) {
+	flushMultiKeyUsage()
+	usages, err := getChannelKeyUsages()
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to load multi-key usage: %v", err))
+		return
+	}
+	for id, channel := range newChannels {
+		if channel.ChannelInfo.IsMultiKey {
+			channel.ChannelInfo.MultiKeyUsage = usages[id]
+		}
+	}
+}
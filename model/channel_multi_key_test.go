@@ -0,0 +1,169 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMultiKeyTestChannel(mode constant.MultiKeyMode) *Channel {
+	return &Channel{
+		Id:  9001,
+		Key: "key-0\nkey-1\nkey-2",
+		ChannelInfo: ChannelInfo{
+			IsMultiKey:   true,
+			MultiKeySize: 3,
+			MultiKeyMode: mode,
+		},
+	}
+}
+
+func withMemoryCache(t *testing.T) {
+	t.Helper()
+	original := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = true
+	t.Cleanup(func() { common.MemoryCacheEnabled = original })
+}
+
+func TestMultiKey_LeastRecentlyUsedRotatesKeys(t *testing.T) {
+	withMemoryCache(t)
+	channel := newMultiKeyTestChannel(constant.MultiKeyModeLeastRecentlyUsed)
+
+	seen := make(map[int]bool)
+	for i := 0; i < 3; i++ {
+		_, idx, err := channel.GetNextEnabledKey()
+		require.Nil(t, err)
+		seen[idx] = true
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Len(t, seen, 3)
+	assert.EqualValues(t, 1, channel.ChannelInfo.GetKeyUsage(0).RequestsToday)
+}
+
+func TestMultiKey_LeastTokensTodayAndBudget(t *testing.T) {
+	withMemoryCache(t)
+	channel := newMultiKeyTestChannel(constant.MultiKeyModeLeastTokensToday)
+	now := time.Now()
+	channel.ChannelInfo.addKeyTokens(0, 500, now)
+	channel.ChannelInfo.addKeyTokens(1, 100, now)
+	channel.ChannelInfo.addKeyTokens(2, 300, now)
+
+	_, idx, err := channel.GetNextEnabledKey()
+	require.Nil(t, err)
+	assert.Equal(t, 1, idx)
+
+	// 用尽预算的key即使用量最少也不再选择
+	channel.ChannelInfo.MultiKeyDailyTokenBudgets = map[int]int64{1: 100}
+	_, idx, err = channel.GetNextEnabledKey()
+	require.Nil(t, err)
+	assert.Equal(t, 2, idx)
+
+	channel.ChannelInfo.MultiKeyDailyTokenBudgets = map[int]int64{0: 100, 1: 100, 2: 100}
+	_, _, err = channel.GetNextEnabledKey()
+	require.NotNil(t, err)
+	assert.Equal(t, types.ErrorCodeChannelNoAvailableKey, err.GetErrorCode())
+
+	// 昨天的用量不计入今日
+	channel.ChannelInfo.MultiKeyUsage[0] = MultiKeyUsage{UsageDate: "2000-01-01", TokensToday: 1000}
+	assert.False(t, channel.ChannelInfo.IsKeyBudgetExhausted(0))
+}
+
+func TestMultiKey_WeightedSkipsDisabledKeys(t *testing.T) {
+	withMemoryCache(t)
+	channel := newMultiKeyTestChannel(constant.MultiKeyModeWeighted)
+	channel.ChannelInfo.MultiKeyWeights = map[int]int{0: 100, 2: 1}
+	channel.ChannelInfo.MultiKeyStatusList = map[int]int{0: common.ChannelStatusManuallyDisabled}
+
+	for i := 0; i < 20; i++ {
+		_, idx, err := channel.GetNextEnabledKey()
+		require.Nil(t, err)
+		assert.NotEqual(t, 0, idx)
+	}
+}
+
+func TestChannelInfo_RemapKeyIndexes(t *testing.T) {
+	info := ChannelInfo{
+		MultiKeyWeights:           map[int]int{0: 3, 2: 5},
+		MultiKeyDailyTokenBudgets: map[int]int64{1: 100, 2: 200},
+		MultiKeyUsage:             map[int]MultiKeyUsage{2: {TokensToday: 7}},
+	}
+	// 删除 index 1 后，index 2 变为 1
+	info.RemapKeyIndexes(map[int]int{0: 0, 2: 1})
+
+	assert.Equal(t, map[int]int{0: 3, 1: 5}, info.MultiKeyWeights)
+	assert.Equal(t, map[int]int64{1: 200}, info.MultiKeyDailyTokenBudgets)
+	assert.EqualValues(t, 7, info.MultiKeyUsage[1].TokensToday)
+}
+
+func TestMultiKey_UsageStoredSeparatelyFromChannelInfo(t *testing.T) {
+	withMemoryCache(t)
+	channel := newMultiKeyTestChannel(constant.MultiKeyModeLeastTokensToday)
+	dropMultiKeyUsageDeltas(channel.Id, nil)
+	t.Cleanup(func() { _ = deleteChannelKeyUsages(channel.Id, nil) })
+
+	now := time.Now()
+	recordMultiKeyUsage(channel.Id, 1, 100, 1, now)
+	recordMultiKeyUsage(channel.Id, 1, 50, 1, now)
+	flushMultiKeyUsage()
+	// 另一个节点写入的增量同样累加
+	require.NoError(t, increaseChannelKeyUsage(channel.Id, 1, multiKeyUsageDate(now), 25, 1, now.UnixMilli()))
+	// 旧日期的增量不会覆盖今日计数
+	require.NoError(t, increaseChannelKeyUsage(channel.Id, 1, "2000-01-01", 1000, 1, 0))
+
+	usages, err := getChannelKeyUsages(channel.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 175, usages[channel.Id][1].TokensToday)
+	assert.EqualValues(t, 3, usages[channel.Id][1].RequestsToday)
+
+	channel.ChannelInfo.MultiKeyUsage = usages[channel.Id]
+	data, err := common.Marshal(channel.ChannelInfo)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "multi_key_usage")
+
+	require.NoError(t, RemapChannelKeyUsages(channel.Id, map[int]int{1: 0}))
+	usages, err = getChannelKeyUsages(channel.Id)
+	require.NoError(t, err)
+	assert.EqualValues(t, 175, usages[channel.Id][0].TokensToday)
+	assert.NotContains(t, usages[channel.Id], 1)
+}
+
+func TestMultiKey_UsageBatchedWithoutMemoryCache(t *testing.T) {
+	original := common.MemoryCacheEnabled
+	common.MemoryCacheEnabled = false
+	t.Cleanup(func() { common.MemoryCacheEnabled = original })
+
+	channel := newMultiKeyTestChannel(constant.MultiKeyModeLeastTokensToday)
+	dropMultiKeyUsageDeltas(channel.Id, nil)
+	t.Cleanup(func() { _ = deleteChannelKeyUsages(channel.Id, nil) })
+
+	_, idx, err := channel.GetNextEnabledKey()
+	require.Nil(t, err)
+	RecordMultiKeyTokenUsage(channel.Id, idx, 40)
+
+	// 增量暂存在内存中，尚未写入数据库，但读取用量时已计入
+	usages, dbErr := getChannelKeyUsages(channel.Id)
+	require.NoError(t, dbErr)
+	assert.Empty(t, usages[channel.Id])
+	snapshot := GetMultiKeyUsageSnapshot(channel)
+	assert.EqualValues(t, 40, snapshot[idx].TokensToday)
+	assert.EqualValues(t, 1, snapshot[idx].RequestsToday)
+
+	flushMultiKeyUsage()
+	usages, dbErr = getChannelKeyUsages(channel.Id)
+	require.NoError(t, dbErr)
+	assert.EqualValues(t, 40, usages[channel.Id][idx].TokensToday)
+
+	// 不按用量选择且没有预算的渠道不记录请求数
+	random := newMultiKeyTestChannel(constant.MultiKeyModeRandom)
+	random.Id = 9002
+	dropMultiKeyUsageDeltas(random.Id, nil)
+	_, _, err = random.GetNextEnabledKey()
+	require.Nil(t, err)
+	assert.Empty(t, applyMultiKeyUsageDeltas(random.Id, nil))
+}
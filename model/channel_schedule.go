@@ -0,0 +1,101 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+func parseChannelSchedule(otherSettings string) *dto.ChannelSchedule {
+	if otherSettings == "" {
+		return nil
+	}
+	setting := dto.ChannelOtherSettings{}
+	if err := common.UnmarshalJsonStr(otherSettings, &setting); err != nil {
+		return nil
+	}
+	if setting.Schedule == nil || !setting.Schedule.Enabled {
+		return nil
+	}
+	return setting.Schedule.Compile()
+}
+
+// GetSchedule 返回渠道的可用时段，未设置或未启用时返回 nil
+func (channel *Channel) GetSchedule() *dto.ChannelSchedule {
+	return parseChannelSchedule(channel.OtherSettings)
+}
+
+// ValidateSchedule 校验可用时段设置，保存渠道前调用
+func (channel *Channel) ValidateSchedule() error {
+	if channel.OtherSettings == "" {
+		return nil
+	}
+	setting := dto.ChannelOtherSettings{}
+	if err := common.UnmarshalJsonStr(channel.OtherSettings, &setting); err != nil {
+		return err
+	}
+	return setting.Schedule.Validate()
+}
+
+// GetScheduleStatus 返回可用时段的当前状态与下一次切换时间，未设置时返回 nil
+func (channel *Channel) GetScheduleStatus(now time.Time) *dto.ChannelScheduleStatus {
+	schedule := channel.GetSchedule()
+	if schedule == nil {
+		return nil
+	}
+	status := schedule.Status(now)
+	return &status
+}
+
+// abilityEnabled 渠道启用且处于可用时段内时，其 abilities 才启用
+func (channel *Channel) abilityEnabled() bool {
+	return channel.Status == common.ChannelStatusEnabled && channel.GetSchedule().IsActive(time.Now())
+}
+
+// filterScheduledChannels 内存缓存模式下过滤掉不在可用时段内的渠道，需持有 channelSyncLock
+func filterScheduledChannels(channelIds []int, now time.Time) []int {
+	if !hasScheduledChannels {
+		return channelIds
+	}
+	filtered := make([]int, 0, len(channelIds))
+	for _, channelId := range channelIds {
+		if channel, ok := channelsIDM[channelId]; ok && !channel.schedule.IsActive(now) {
+			continue
+		}
+		filtered = append(filtered, channelId)
+	}
+	return filtered
+}
+
+// SyncChannelScheduleAbilities 按可用时段启用或禁用已启用渠道的 abilities，返回发生切换的渠道数
+func SyncChannelScheduleAbilities(now time.Time) (int, error) {
+	var channels []*Channel
+	err := DB.Select("id", "name", "status", "settings").
+		Where("status = ? AND settings LIKE ?", common.ChannelStatusEnabled, "%\"schedule\"%").
+		Find(&channels).Error
+	if err != nil {
+		return 0, err
+	}
+	switched := 0
+	for _, channel := range channels {
+		schedule := channel.GetSchedule()
+		if schedule == nil {
+			continue
+		}
+		active := schedule.IsActive(now)
+		result := DB.Model(&Ability{}).
+			Where("channel_id = ? AND enabled = ?", channel.Id, !active).
+			Select("enabled").Update("enabled", active)
+		if result.Error != nil {
+			common.SysError(fmt.Sprintf("failed to sync channel schedule: channel_id=%d, error=%v", channel.Id, result.Error))
+			continue
+		}
+		if result.RowsAffected > 0 {
+			switched++
+			common.SysLog(fmt.Sprintf("channel #%d (%s) schedule switched, active=%t", channel.Id, channel.Name, active))
+		}
+	}
+	return switched, nil
+}
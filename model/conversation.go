@@ -0,0 +1,235 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// Conversation 网关本地保存的 Conversations API 会话，归属于调用令牌的用户
+type Conversation struct {
+	Id             int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	ConversationId string `json:"conversation_id" gorm:"type:varchar(191);uniqueIndex"`
+	UserId         int    `json:"user_id" gorm:"index"`
+	Metadata       string `json:"metadata" gorm:"type:text"`
+	ItemCount      int    `json:"item_count"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt      int64  `json:"updated_at" gorm:"bigint;index"` // 最后一次更新时间，过期清理以此为准
+}
+
+func (Conversation) TableName() string {
+	return "conversations"
+}
+
+// ConversationItem 会话项，Content 为完整的会话项 JSON，按自增 Id 排序
+type ConversationItem struct {
+	Id             int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	ItemId         string    `json:"item_id" gorm:"type:varchar(191);index"`
+	ConversationId string    `json:"conversation_id" gorm:"type:varchar(191);index"`
+	Type           string    `json:"type" gorm:"type:varchar(64)"`
+	Content        LargeText `json:"content"`
+	CreatedAt      int64     `json:"created_at" gorm:"bigint"`
+}
+
+func (ConversationItem) TableName() string {
+	return "conversation_items"
+}
+
+// CreateConversation 创建会话及其初始会话项
+func CreateConversation(conversation *Conversation, items []*ConversationItem) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		conversation.ItemCount = len(items)
+		if err := tx.Create(conversation).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		for _, item := range items {
+			item.ConversationId = conversation.ConversationId
+		}
+		return tx.Create(&items).Error
+	})
+}
+
+// GetConversation 获取用户的会话，不存在时返回 (nil, nil)
+func GetConversation(userId int, conversationId string) (*Conversation, error) {
+	if conversationId == "" {
+		return nil, nil
+	}
+	var conversation Conversation
+	err := DB.Where("user_id = ? AND conversation_id = ?", userId, conversationId).First(&conversation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+func UpdateConversationMetadata(conversation *Conversation) error {
+	return DB.Model(conversation).Updates(map[string]any{
+		"metadata":   conversation.Metadata,
+		"updated_at": conversation.UpdatedAt,
+	}).Error
+}
+
+func DeleteConversation(conversation *Conversation) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("conversation_id = ?", conversation.ConversationId).Delete(&ConversationItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(conversation).Error
+	})
+}
+
+// AddConversationItems 追加会话项，会话项总数超过 maxItems 时删除最早的会话项
+func AddConversationItems(conversation *Conversation, items []*ConversationItem, maxItems int, updatedAt int64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if len(items) > 0 {
+			for _, item := range items {
+				item.ConversationId = conversation.ConversationId
+			}
+			if err := tx.Create(&items).Error; err != nil {
+				return err
+			}
+		}
+		var count int64
+		if err := tx.Model(&ConversationItem{}).Where("conversation_id = ?", conversation.ConversationId).Count(&count).Error; err != nil {
+			return err
+		}
+		if maxItems > 0 && count > int64(maxItems) {
+			var overflowIds []int
+			err := tx.Model(&ConversationItem{}).Where("conversation_id = ?", conversation.ConversationId).
+				Order("id asc").Limit(int(count)-maxItems).Pluck("id", &overflowIds).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("id IN ?", overflowIds).Delete(&ConversationItem{}).Error; err != nil {
+				return err
+			}
+			count = int64(maxItems)
+		}
+		conversation.ItemCount = int(count)
+		conversation.UpdatedAt = updatedAt
+		return tx.Model(conversation).Updates(map[string]any{
+			"item_count": conversation.ItemCount,
+			"updated_at": conversation.UpdatedAt,
+		}).Error
+	})
+}
+
+// GetConversationItems 分页获取会话项，after 为上一页最后一个会话项的 ID，desc 为 true 时按时间倒序
+func GetConversationItems(conversationId string, after string, limit int, desc bool) ([]*ConversationItem, bool, error) {
+	query := DB.Where("conversation_id = ?", conversationId)
+	if after != "" {
+		cursor, err := GetConversationItem(conversationId, after)
+		if err != nil {
+			return nil, false, err
+		}
+		if cursor == nil {
+			return []*ConversationItem{}, false, nil
+		}
+		if desc {
+			query = query.Where("id < ?", cursor.Id)
+		} else {
+			query = query.Where("id > ?", cursor.Id)
+		}
+	}
+	if desc {
+		query = query.Order("id desc")
+	} else {
+		query = query.Order("id asc")
+	}
+	var items []*ConversationItem
+	if err := query.Limit(limit + 1).Find(&items).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(items) > limit
+	if hasMore {
+		items = items[:limit]
+	}
+	return items, hasMore, nil
+}
+
+// GetAllConversationItems 按时间顺序获取会话的全部会话项
+func GetAllConversationItems(conversationId string) ([]*ConversationItem, error) {
+	var items []*ConversationItem
+	err := DB.Where("conversation_id = ?", conversationId).Order("id asc").Find(&items).Error
+	return items, err
+}
+
+// GetConversationItem 获取会话项，不存在时返回 (nil, nil)
+func GetConversationItem(conversationId string, itemId string) (*ConversationItem, error) {
+	var item ConversationItem
+	err := DB.Where("conversation_id = ? AND item_id = ?", conversationId, itemId).First(&item).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// DeleteConversationItem 删除会话项并更新会话项计数，会话项不存在时返回 false
+func DeleteConversationItem(conversation *Conversation, itemId string, updatedAt int64) (bool, error) {
+	deleted := false
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("conversation_id = ? AND item_id = ?", conversation.ConversationId, itemId).Delete(&ConversationItem{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		deleted = true
+		conversation.ItemCount = max(conversation.ItemCount-int(result.RowsAffected), 0)
+		conversation.UpdatedAt = updatedAt
+		return tx.Model(conversation).Updates(map[string]any{
+			"item_count": conversation.ItemCount,
+			"updated_at": conversation.UpdatedAt,
+		}).Error
+	})
+	return deleted, err
+}
+
+// DeleteExpiredConversations 删除最后更新时间早于 targetTimestamp 的会话及其会话项
+func DeleteExpiredConversations(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	var total int64 = 0
+
+	for {
+		if nil != ctx.Err() {
+			return total, ctx.Err()
+		}
+
+		var conversationIds []string
+		err := DB.Model(&Conversation{}).Where("updated_at < ?", targetTimestamp).Limit(limit).Pluck("conversation_id", &conversationIds).Error
+		if nil != err {
+			return total, err
+		}
+		if len(conversationIds) == 0 {
+			break
+		}
+
+		err = DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("conversation_id IN ?", conversationIds).Delete(&ConversationItem{}).Error; err != nil {
+				return err
+			}
+			return tx.Where("conversation_id IN ?", conversationIds).Delete(&Conversation{}).Error
+		})
+		if nil != err {
+			return total, err
+		}
+
+		total += int64(len(conversationIds))
+
+		if len(conversationIds) < limit {
+			break
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// LargeText 可能超过 64KB 的文本列。MySQL 的 text 最大只有 64KB，使用 longtext；
+// PostgreSQL 与 SQLite 的 text 没有长度限制。
+type LargeText string
+
+func (LargeText) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "mysql" {
+		return "longtext"
+	}
+	return "text"
+}
@@ -264,6 +264,7 @@ func migrateDB() error {
 		&Redemption{},
 		&Ability{},
 		&Log{},
+		&RequestCapture{},
 		&Midjourney{},
 		&TopUp{},
 		&QuotaData{},
@@ -280,6 +281,13 @@ func migrateDB() error {
 		&SubscriptionPreConsumeRecord{},
 		&CustomOAuthProvider{},
 		&UserOAuthBinding{},
+		&Organization{},
+		&OrganizationMember{},
+		&RelayFile{},
+		&ChannelKeyUsage{},
+		&StoredResponse{},
+		&Conversation{},
+		&ConversationItem{},
 	)
 	if err != nil {
 		return err
@@ -312,6 +320,7 @@ func migrateDBFast() error {
 		{&Redemption{}, "Redemption"},
 		{&Ability{}, "Ability"},
 		{&Log{}, "Log"},
+		{&RequestCapture{}, "RequestCapture"},
 		{&Midjourney{}, "Midjourney"},
 		{&TopUp{}, "TopUp"},
 		{&QuotaData{}, "QuotaData"},
@@ -328,6 +337,13 @@ func migrateDBFast() error {
 		{&SubscriptionPreConsumeRecord{}, "SubscriptionPreConsumeRecord"},
 		{&CustomOAuthProvider{}, "CustomOAuthProvider"},
 		{&UserOAuthBinding{}, "UserOAuthBinding"},
+		{&Organization{}, "Organization"},
+		{&OrganizationMember{}, "OrganizationMember"},
+		{&RelayFile{}, "RelayFile"},
+		{&ChannelKeyUsage{}, "ChannelKeyUsage"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&Conversation{}, "Conversation"},
+		{&ConversationItem{}, "ConversationItem"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -367,7 +383,7 @@ func migrateDBFast() error {
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &RequestCapture{}); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,428 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	OrganizationRoleOwner  = "owner"
+	OrganizationRoleAdmin  = "admin"
+	OrganizationRoleMember = "member"
+)
+
+const (
+	OrganizationStatusEnabled  = 1
+	OrganizationStatusDisabled = 2
+)
+
+var (
+	ErrOrganizationNotFound            = errors.New("组织不存在")
+	ErrOrganizationDisabled            = errors.New("组织已被禁用")
+	ErrOrganizationNotMember           = errors.New("用户不是该组织成员")
+	ErrOrganizationQuotaInsufficient   = errors.New("组织额度不足")
+	ErrOrganizationMemberLimitExceeded = errors.New("成员在组织内的消费已达上限")
+)
+
+// Organization 组织，成员共享同一个钱包额度
+type Organization struct {
+	Id          int    `json:"id"`
+	Name        string `json:"name" gorm:"type:varchar(64);index"`
+	Description string `json:"description" gorm:"type:varchar(255);default:''"`
+	OwnerId     int    `json:"owner_id" gorm:"index"`
+	Quota       int    `json:"quota" gorm:"type:int;default:0"`
+	UsedQuota   int    `json:"used_quota" gorm:"type:int;default:0"`
+	Status      int    `json:"status" gorm:"type:int;default:1"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt   int64  `json:"updated_at" gorm:"bigint"`
+}
+
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	o.CreatedAt = now
+	o.UpdatedAt = now
+	return nil
+}
+
+func (o *Organization) BeforeUpdate(tx *gorm.DB) error {
+	o.UpdatedAt = common.GetTimestamp()
+	return nil
+}
+
+// OrganizationMember 组织成员，QuotaLimit 为成员在组织钱包中的累计消费上限，0 表示不限制
+type OrganizationMember struct {
+	Id             int    `json:"id"`
+	OrganizationId int    `json:"organization_id" gorm:"uniqueIndex:idx_org_member_user,priority:1"`
+	UserId         int    `json:"user_id" gorm:"uniqueIndex:idx_org_member_user,priority:2;index"`
+	Role           string `json:"role" gorm:"type:varchar(16);default:'member'"`
+	QuotaLimit     int    `json:"quota_limit" gorm:"type:int;default:0"`
+	UsedQuota      int    `json:"used_quota" gorm:"type:int;default:0"`
+	CreatedAt      int64  `json:"created_at" gorm:"bigint"`
+	UpdatedAt      int64  `json:"updated_at" gorm:"bigint"`
+	Username       string `json:"username" gorm:"->;-:migration"`
+}
+
+func (m *OrganizationMember) BeforeCreate(tx *gorm.DB) error {
+	now := common.GetTimestamp()
+	m.CreatedAt = now
+	m.UpdatedAt = now
+	return nil
+}
+
+func (m *OrganizationMember) BeforeUpdate(tx *gorm.DB) error {
+	m.UpdatedAt = common.GetTimestamp()
+	return nil
+}
+
+// CanManage 是否可以管理成员（owner/admin）
+func (m *OrganizationMember) CanManage() bool {
+	return m.Role == OrganizationRoleOwner || m.Role == OrganizationRoleAdmin
+}
+
+// OrganizationSummary 用户所在组织及其在组织内的角色和消费
+type OrganizationSummary struct {
+	Organization
+	Role             string `json:"role"`
+	MemberQuotaLimit int    `json:"member_quota_limit"`
+	MemberUsedQuota  int    `json:"member_used_quota"`
+}
+
+func IsValidOrganizationRole(role string) bool {
+	switch role {
+	case OrganizationRoleOwner, OrganizationRoleAdmin, OrganizationRoleMember:
+		return true
+	default:
+		return false
+	}
+}
+
+// CreateOrganization 创建组织并将创建者设为 owner
+func CreateOrganization(org *Organization) error {
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" {
+		return errors.New("组织名称不能为空")
+	}
+	org.Quota = 0
+	org.UsedQuota = 0
+	org.Status = OrganizationStatusEnabled
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&OrganizationMember{
+			OrganizationId: org.Id,
+			UserId:         org.OwnerId,
+			Role:           OrganizationRoleOwner,
+		}).Error
+	})
+}
+
+func GetOrganizationById(id int) (*Organization, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var org Organization
+	err := DB.First(&org, "id = ?", id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrganizationNotFound
+	}
+	return &org, err
+}
+
+func GetAllOrganizations(pageInfo *common.PageInfo) (orgs []*Organization, total int64, err error) {
+	err = DB.Model(&Organization{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = DB.Order("id desc").Limit(pageInfo.GetPageSize()).Offset(pageInfo.GetStartIdx()).Find(&orgs).Error
+	return orgs, total, err
+}
+
+// GetUserOrganizations 返回用户所在的全部组织
+func GetUserOrganizations(userId int) ([]*OrganizationSummary, error) {
+	var summaries []*OrganizationSummary
+	err := DB.Table("organizations").
+		Select("organizations.*, organization_members.role AS role, organization_members.quota_limit AS member_quota_limit, organization_members.used_quota AS member_used_quota").
+		Joins("JOIN organization_members ON organization_members.organization_id = organizations.id").
+		Where("organization_members.user_id = ?", userId).
+		Order("organizations.id desc").
+		Scan(&summaries).Error
+	return summaries, err
+}
+
+func GetOrganizationMember(orgId int, userId int) (*OrganizationMember, error) {
+	var member OrganizationMember
+	err := DB.First(&member, "organization_id = ? AND user_id = ?", orgId, userId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrganizationNotMember
+	}
+	return &member, err
+}
+
+func GetOrganizationMembers(orgId int) ([]*OrganizationMember, error) {
+	var members []*OrganizationMember
+	err := DB.Table("organization_members").
+		Select("organization_members.*, users.username AS username").
+		Joins("LEFT JOIN users ON users.id = organization_members.user_id").
+		Where("organization_members.organization_id = ?", orgId).
+		Order("organization_members.id asc").
+		Scan(&members).Error
+	return members, err
+}
+
+// GetOrganizationMemberUserIds 返回组织全部成员的用户 ID
+func GetOrganizationMemberUserIds(orgId int) ([]int, error) {
+	var userIds []int
+	err := DB.Model(&OrganizationMember{}).Where("organization_id = ?", orgId).Pluck("user_id", &userIds).Error
+	return userIds, err
+}
+
+func AddOrganizationMember(member *OrganizationMember) error {
+	if !IsValidOrganizationRole(member.Role) || member.Role == OrganizationRoleOwner {
+		return errors.New("无效的成员角色")
+	}
+	var count int64
+	if err := DB.Model(&OrganizationMember{}).Where("organization_id = ? AND user_id = ?", member.OrganizationId, member.UserId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("用户已是该组织成员")
+	}
+	member.UsedQuota = 0
+	return DB.Create(member).Error
+}
+
+// UpdateOrganizationMember 更新成员角色和消费上限，resetUsed 为 true 时清空成员已消费额度
+func UpdateOrganizationMember(member *OrganizationMember, resetUsed bool) error {
+	updates := map[string]interface{}{
+		"role":        member.Role,
+		"quota_limit": member.QuotaLimit,
+		"updated_at":  common.GetTimestamp(),
+	}
+	if resetUsed {
+		updates["used_quota"] = 0
+	}
+	return DB.Model(&OrganizationMember{}).Where("id = ?", member.Id).Updates(updates).Error
+}
+
+// RemoveOrganizationMember 移除成员，成员绑定到该组织的令牌将解除绑定
+func RemoveOrganizationMember(orgId int, userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("organization_id = ? AND user_id = ?", orgId, userId).Delete(&OrganizationMember{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationNotMember
+		}
+		return unbindOrganizationTokensTx(tx, orgId, userId)
+	})
+}
+
+// UpdateOrganization 更新组织的名称和描述
+func UpdateOrganization(org *Organization) error {
+	org.Name = strings.TrimSpace(org.Name)
+	if org.Name == "" {
+		return errors.New("组织名称不能为空")
+	}
+	return DB.Model(org).Select("name", "description").Updates(org).Error
+}
+
+// AdminUpdateOrganization 管理员更新组织状态和钱包额度
+func AdminUpdateOrganization(orgId int, status int, quota int) error {
+	if status != OrganizationStatusEnabled && status != OrganizationStatusDisabled {
+		return errors.New("无效的组织状态")
+	}
+	if quota < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+		"status":     status,
+		"quota":      quota,
+		"updated_at": common.GetTimestamp(),
+	}).Error
+}
+
+// DeleteOrganization 删除组织，剩余额度退回 owner 钱包，成员令牌解除绑定
+func DeleteOrganization(orgId int) error {
+	var ownerId, refund int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var org Organization
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&org, "id = ?", orgId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrganizationNotFound
+			}
+			return err
+		}
+		if org.Quota > 0 {
+			if err := tx.Model(&User{}).Where("id = ?", org.OwnerId).Update("quota", gorm.Expr("quota + ?", org.Quota)).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("organization_id = ?", orgId).Delete(&OrganizationMember{}).Error; err != nil {
+			return err
+		}
+		if err := unbindOrganizationTokensTx(tx, orgId, 0); err != nil {
+			return err
+		}
+		ownerId, refund = org.OwnerId, org.Quota
+		return tx.Delete(&Organization{}, orgId).Error
+	})
+	if err != nil {
+		return err
+	}
+	if refund > 0 {
+		_ = invalidateUserCache(ownerId)
+		RecordLog(ownerId, LogTypeManage, "组织已删除，剩余额度 "+logger.LogQuota(refund)+" 退回个人钱包")
+	}
+	return nil
+}
+
+// TransferUserQuotaToOrganization 将用户个人额度转入组织钱包
+func TransferUserQuotaToOrganization(userId int, orgId int, quota int) error {
+	if quota <= 0 {
+		return errors.New("转入额度必须大于 0")
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ? AND quota >= ?", userId, quota).
+			Update("quota", gorm.Expr("quota - ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("个人额度不足")
+		}
+		result = tx.Model(&Organization{}).Where("id = ?", orgId).
+			Update("quota", gorm.Expr("quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_ = invalidateUserCache(userId)
+	return nil
+}
+
+func unbindOrganizationTokensTx(tx *gorm.DB, orgId int, userId int) error {
+	query := tx.Where("organization_id = ?", orgId)
+	if userId > 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	var tokens []Token
+	if err := query.Find(&tokens).Error; err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, token.Id)
+	}
+	if err := tx.Model(&Token{}).Where("id IN ?", ids).Update("organization_id", 0).Error; err != nil {
+		return err
+	}
+	if common.RedisEnabled {
+		for _, token := range tokens {
+			_ = cacheDeleteToken(token.Key)
+		}
+	}
+	return nil
+}
+
+// PreConsumeOrganizationQuota 从组织钱包预扣 amount 额度，并计入成员的组织内消费
+func PreConsumeOrganizationQuota(orgId int, userId int, amount int) error {
+	if amount < 0 {
+		return errors.New("quota 不能为负数！")
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var org Organization
+		if err := tx.First(&org, "id = ?", orgId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrganizationNotFound
+			}
+			return err
+		}
+		if org.Status != OrganizationStatusEnabled {
+			return ErrOrganizationDisabled
+		}
+		var member OrganizationMember
+		if err := tx.First(&member, "organization_id = ? AND user_id = ?", orgId, userId).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOrganizationNotMember
+			}
+			return err
+		}
+		if member.QuotaLimit > 0 {
+			query := tx.Model(&OrganizationMember{}).Where("id = ?", member.Id)
+			if amount > 0 {
+				query = query.Where("used_quota + ? <= quota_limit", amount)
+			} else {
+				query = query.Where("used_quota < quota_limit")
+			}
+			result := query.Update("used_quota", gorm.Expr("used_quota + ?", amount))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrOrganizationMemberLimitExceeded
+			}
+		} else if amount > 0 {
+			if err := tx.Model(&OrganizationMember{}).Where("id = ?", member.Id).
+				Update("used_quota", gorm.Expr("used_quota + ?", amount)).Error; err != nil {
+				return err
+			}
+		}
+		query := tx.Model(&Organization{}).Where("id = ?", orgId)
+		if amount > 0 {
+			query = query.Where("quota >= ?", amount)
+		} else {
+			query = query.Where("quota > 0")
+		}
+		result := query.Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", amount),
+			"used_quota": gorm.Expr("used_quota + ?", amount),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrOrganizationQuotaInsufficient
+		}
+		return nil
+	})
+}
+
+// AdjustOrganizationQuota 按差额调整组织钱包和成员消费，delta 为正数时补扣（不检查余额和上限），为负数时退还
+func AdjustOrganizationQuota(orgId int, userId int, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&Organization{}).Where("id = ?", orgId).Updates(map[string]interface{}{
+			"quota":      gorm.Expr("quota - ?", delta),
+			"used_quota": gorm.Expr("used_quota + ?", delta),
+		}).Error; err != nil {
+			return err
+		}
+		memberUsed := gorm.Expr("used_quota + ?", delta)
+		if delta < 0 {
+			memberUsed = gorm.Expr("CASE WHEN used_quota > ? THEN used_quota - ? ELSE 0 END", -delta, -delta)
+		}
+		return tx.Model(&OrganizationMember{}).
+			Where("organization_id = ? AND user_id = ?", orgId, userId).
+			Update("used_quota", memberUsed).Error
+	})
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrganizationQuota_PreConsumeAndAdjust(t *testing.T) {
+	truncateTables(t)
+
+	org := &Organization{Name: "team", OwnerId: 1}
+	require.NoError(t, CreateOrganization(org))
+	require.NoError(t, DB.Model(&Organization{}).Where("id = ?", org.Id).Update("quota", 1000).Error)
+	require.NoError(t, AddOrganizationMember(&OrganizationMember{OrganizationId: org.Id, UserId: 2, Role: OrganizationRoleMember, QuotaLimit: 300}))
+
+	// non-members cannot spend from the wallet
+	assert.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, 3, 10), ErrOrganizationNotMember)
+
+	// member limit is enforced independently of the shared balance
+	require.NoError(t, PreConsumeOrganizationQuota(org.Id, 2, 200))
+	assert.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, 2, 200), ErrOrganizationMemberLimitExceeded)
+
+	// owner has no limit but is bounded by the wallet balance
+	require.NoError(t, PreConsumeOrganizationQuota(org.Id, 1, 700))
+	assert.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, 1, 200), ErrOrganizationQuotaInsufficient)
+
+	// settle the member request below its reservation
+	require.NoError(t, AdjustOrganizationQuota(org.Id, 2, -50))
+
+	fresh, err := GetOrganizationById(org.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 150, fresh.Quota)
+	assert.Equal(t, 850, fresh.UsedQuota)
+
+	member, err := GetOrganizationMember(org.Id, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 150, member.UsedQuota)
+
+	require.NoError(t, DB.Model(&Organization{}).Where("id = ?", org.Id).Update("status", OrganizationStatusDisabled).Error)
+	assert.ErrorIs(t, PreConsumeOrganizationQuota(org.Id, 1, 10), ErrOrganizationDisabled)
+}
+
+func TestOrganization_RemoveMemberUnbindsTokens(t *testing.T) {
+	truncateTables(t)
+
+	org := &Organization{Name: "team", OwnerId: 1}
+	require.NoError(t, CreateOrganization(org))
+	require.NoError(t, AddOrganizationMember(&OrganizationMember{OrganizationId: org.Id, UserId: 2, Role: OrganizationRoleMember}))
+	token := &Token{UserId: 2, Key: "org-member-token", Name: "org", OrganizationId: org.Id}
+	require.NoError(t, DB.Create(token).Error)
+
+	require.NoError(t, RemoveOrganizationMember(org.Id, 2))
+
+	fresh, err := GetTokenById(token.Id)
+	require.NoError(t, err)
+	assert.Zero(t, fresh.OrganizationId)
+	assert.ErrorIs(t, RemoveOrganizationMember(org.Id, 2), ErrOrganizationNotMember)
+}
+
+func TestDeleteOrganization_RefundsOwner(t *testing.T) {
+	truncateTables(t)
+
+	owner := &User{Id: 1, Username: "owner", Quota: 100}
+	require.NoError(t, DB.Create(owner).Error)
+	org := &Organization{Name: "team", OwnerId: owner.Id}
+	require.NoError(t, CreateOrganization(org))
+	require.NoError(t, DB.Model(&Organization{}).Where("id = ?", org.Id).Update("quota", 500).Error)
+
+	require.NoError(t, DeleteOrganization(org.Id))
+
+	quota, err := GetUserQuota(owner.Id, true)
+	require.NoError(t, err)
+	assert.Equal(t, 600, quota)
+	assert.ErrorIs(t, DeleteOrganization(org.Id), ErrOrganizationNotFound)
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// RelayFile 记录通过网关上传（或由批处理产生）的上游文件，
+// 文件只存在于上传时所用的渠道与密钥下，后续访问都固定转发到该渠道。
+type RelayFile struct {
+	Id        int    `json:"id" gorm:"primaryKey;autoIncrement"`
+	FileId    string `json:"file_id" gorm:"type:varchar(191);uniqueIndex"` // 上游文件 ID
+	UserId    int    `json:"user_id" gorm:"index"`
+	ChannelId int    `json:"channel_id" gorm:"index"`
+	KeyIndex  int    `json:"key_index"`                           // 多密钥渠道中上传所用密钥的下标
+	ModelName string `json:"model_name" gorm:"type:varchar(255)"` // 批处理输入文件中所有请求使用的模型
+	Purpose   string `json:"purpose" gorm:"type:varchar(64);index"`
+	Filename  string `json:"filename" gorm:"type:varchar(255)"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	// 批处理输入文件的请求数与估算的输入 token 数，创建批处理时据此预扣费
+	Requests     int `json:"requests"`
+	PromptTokens int `json:"prompt_tokens"`
+}
+
+func (RelayFile) TableName() string {
+	return "relay_files"
+}
+
+func (file *RelayFile) Insert() error {
+	return DB.Create(file).Error
+}
+
+// GetRelayFile 获取用户的文件记录，不存在时返回 (nil, nil)
+func GetRelayFile(userId int, fileId string) (*RelayFile, error) {
+	if fileId == "" {
+		return nil, nil
+	}
+	var file RelayFile
+	err := DB.Where("user_id = ? AND file_id = ?", userId, fileId).First(&file).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// GetUserRelayFiles 按创建时间倒序列出用户的文件，purpose 为空时不过滤
+func GetUserRelayFiles(userId int, purpose string, limit int) ([]*RelayFile, error) {
+	var files []*RelayFile
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	err := query.Order("id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func DeleteRelayFile(userId int, fileId string) error {
+	return DB.Where("user_id = ? AND file_id = ?", userId, fileId).Delete(&RelayFile{}).Error
+}
+
+// EnsureRelayFile 登记批处理产生的输出/错误文件，已存在时忽略
+func EnsureRelayFile(file *RelayFile) error {
+	if file.FileId == "" {
+		return nil
+	}
+	var count int64
+	if err := DB.Model(&RelayFile{}).Where("file_id = ?", file.FileId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return DB.Create(file).Error
+}
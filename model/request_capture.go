@@ -0,0 +1,56 @@
+package model
+
+import (
+	"context"
+)
+
+// RequestCapture 留存的请求与响应内容，与日志一样存放在 LOG_DB
+type RequestCapture struct {
+	Id                int       `json:"id"`
+	RequestId         string    `json:"request_id" gorm:"type:varchar(64);index"`
+	UserId            int       `json:"user_id" gorm:"index"`
+	TokenId           int       `json:"token_id"`
+	ChannelId         int       `json:"channel_id"`
+	ModelName         string    `json:"model_name"`
+	RequestPath       string    `json:"request_path"`
+	IsStream          bool      `json:"is_stream"`
+	StatusCode        int       `json:"status_code"`
+	RequestBody       LargeText `json:"request_body"`
+	ResponseBody      LargeText `json:"response_body"`
+	RequestTruncated  bool      `json:"request_truncated"`
+	ResponseTruncated bool      `json:"response_truncated"`
+	CreatedAt         int64     `json:"created_at" gorm:"bigint;index"`
+}
+
+func (capture *RequestCapture) Insert() error {
+	return LOG_DB.Create(capture).Error
+}
+
+func GetRequestCapturesByRequestId(requestId string) ([]*RequestCapture, error) {
+	var captures []*RequestCapture
+	err := LOG_DB.Where("request_id = ?", requestId).Order("id asc").Find(&captures).Error
+	return captures, err
+}
+
+func DeleteOldRequestCaptures(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	var total int64 = 0
+
+	for {
+		if nil != ctx.Err() {
+			return total, ctx.Err()
+		}
+
+		result := LOG_DB.Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&RequestCapture{})
+		if nil != result.Error {
+			return total, result.Error
+		}
+
+		total += result.RowsAffected
+
+		if result.RowsAffected < int64(limit) {
+			break
+		}
+	}
+
+	return total, nil
+}
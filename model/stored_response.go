@@ -0,0 +1,75 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// StoredResponse 网关本地保存的 Responses API 响应，
+// 用于在不支持服务端存储的上游上实现 previous_response_id 与 GET /v1/responses/{id}。
+type StoredResponse struct {
+	Id                 int       `json:"id" gorm:"primaryKey;autoIncrement"`
+	ResponseId         string    `json:"response_id" gorm:"type:varchar(191);uniqueIndex"`
+	UserId             int       `json:"user_id" gorm:"index"`
+	ChannelId          int       `json:"channel_id"`
+	ModelName          string    `json:"model_name" gorm:"type:varchar(255)"`
+	PreviousResponseId string    `json:"previous_response_id" gorm:"type:varchar(191)"`
+	Input              LargeText `json:"input"`    // 展开历史后的完整输入项 JSON
+	Output             LargeText `json:"output"`   // 输出项 JSON
+	Response           LargeText `json:"response"` // 返回给客户端的完整响应 JSON
+	CreatedAt          int64     `json:"created_at" gorm:"bigint;index"`
+}
+
+func (StoredResponse) TableName() string {
+	return "stored_responses"
+}
+
+func (response *StoredResponse) Insert() error {
+	return DB.Create(response).Error
+}
+
+// GetStoredResponse 获取用户保存的响应，不存在时返回 (nil, nil)
+func GetStoredResponse(userId int, responseId string) (*StoredResponse, error) {
+	if responseId == "" {
+		return nil, nil
+	}
+	var response StoredResponse
+	err := DB.Where("user_id = ? AND response_id = ?", userId, responseId).First(&response).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func DeleteStoredResponse(userId int, responseId string) (int64, error) {
+	result := DB.Where("user_id = ? AND response_id = ?", userId, responseId).Delete(&StoredResponse{})
+	return result.RowsAffected, result.Error
+}
+
+func DeleteOldStoredResponses(ctx context.Context, targetTimestamp int64, limit int) (int64, error) {
+	var total int64 = 0
+
+	for {
+		if nil != ctx.Err() {
+			return total, ctx.Err()
+		}
+
+		result := DB.Where("created_at < ?", targetTimestamp).Limit(limit).Delete(&StoredResponse{})
+		if nil != result.Error {
+			return total, result.Error
+		}
+
+		total += result.RowsAffected
+
+		if result.RowsAffected < int64(limit) {
+			break
+		}
+	}
+
+	return total, nil
+}
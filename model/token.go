@@ -12,23 +12,31 @@ import (
 )
 
 type Token struct {
-	Id                 int            `json:"id"`
-	UserId             int            `json:"user_id" gorm:"index"`
-	Key                string         `json:"key" gorm:"type:char(48);uniqueIndex"`
-	Status             int            `json:"status" gorm:"default:1"`
-	Name               string         `json:"name" gorm:"index" `
-	CreatedTime        int64          `json:"created_time" gorm:"bigint"`
-	AccessedTime       int64          `json:"accessed_time" gorm:"bigint"`
-	ExpiredTime        int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
-	RemainQuota        int            `json:"remain_quota" gorm:"default:0"`
-	UnlimitedQuota     bool           `json:"unlimited_quota"`
-	ModelLimitsEnabled bool           `json:"model_limits_enabled"`
-	ModelLimits        string         `json:"model_limits" gorm:"type:text"`
-	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
-	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
-	Group              string         `json:"group" gorm:"default:''"`
-	CrossGroupRetry    bool           `json:"cross_group_retry"` // 跨分组重试，仅auto分组有效
-	DeletedAt          gorm.DeletedAt `gorm:"index"`
+	Id                   int            `json:"id"`
+	UserId               int            `json:"user_id" gorm:"index"`
+	Key                  string         `json:"key" gorm:"type:char(48);uniqueIndex"`
+	Status               int            `json:"status" gorm:"default:1"`
+	Name                 string         `json:"name" gorm:"index" `
+	CreatedTime          int64          `json:"created_time" gorm:"bigint"`
+	AccessedTime         int64          `json:"accessed_time" gorm:"bigint"`
+	ExpiredTime          int64          `json:"expired_time" gorm:"bigint;default:-1"` // -1 means never expired
+	RemainQuota          int            `json:"remain_quota" gorm:"default:0"`
+	UnlimitedQuota       bool           `json:"unlimited_quota"`
+	ModelLimitsEnabled   bool           `json:"model_limits_enabled"`
+	ModelLimits          string         `json:"model_limits" gorm:"type:text"`
+	AllowIps             *string        `json:"allow_ips" gorm:"default:''"`
+	UsedQuota            int            `json:"used_quota" gorm:"default:0"` // used quota
+	Group                string         `json:"group" gorm:"default:''"`
+	CrossGroupRetry      bool           `json:"cross_group_retry"`                               // 跨分组重试，仅auto分组有效
+	TpmLimit             int            `json:"tpm_limit" gorm:"default:0"`                      // 每分钟 token 数限制，0 表示不限制
+	ConcurrencyLimit     int            `json:"concurrency_limit" gorm:"default:0"`              // 最大并发请求数，0 表示不限制
+	QuotaPeriod          string         `json:"quota_period" gorm:"type:varchar(16);default:''"` // 周期消费上限的周期：daily、weekly、monthly，为空表示不限制
+	PeriodQuotaLimit     int            `json:"period_quota_limit" gorm:"default:0"`             // 每个周期最多消费的额度，0 表示不限制
+	PeriodUsedQuota      int            `json:"period_used_quota" gorm:"default:0"`              // 当前周期已消费额度
+	PeriodStartTime      int64          `json:"period_start_time" gorm:"bigint;default:0"`       // 当前周期开始时间
+	OrganizationId       int            `json:"organization_id" gorm:"index;default:0"`          // 绑定的组织，非 0 时从组织钱包扣费
+	ResponseCacheEnabled bool           `json:"response_cache_enabled" gorm:"default:false"`     // 启用网关响应缓存
+	DeletedAt            gorm.DeletedAt `gorm:"index"`
 }
 
 func (token *Token) Clean() {
@@ -295,7 +303,7 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "cross_group_retry", "tpm_limit", "concurrency_limit", "quota_period", "period_quota_limit", "organization_id", "response_cache_enabled").Updates(token).Error
 	return err
 }
 
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	TokenQuotaPeriodDaily   = "daily"
+	TokenQuotaPeriodWeekly  = "weekly"
+	TokenQuotaPeriodMonthly = "monthly"
+)
+
+var ErrTokenPeriodQuotaExceeded = errors.New("token period quota exceeded")
+
+// IsValidTokenQuotaPeriod 判断周期是否合法，空字符串表示不限制
+func IsValidTokenQuotaPeriod(period string) bool {
+	switch period {
+	case "", TokenQuotaPeriodDaily, TokenQuotaPeriodWeekly, TokenQuotaPeriodMonthly:
+		return true
+	default:
+		return false
+	}
+}
+
+// TokenQuotaPeriodStart 返回 now 所在周期的开始时间（服务器本地时区，周以周一为起点）
+func TokenQuotaPeriodStart(period string, now time.Time) time.Time {
+	year, month, day := now.Date()
+	switch period {
+	case TokenQuotaPeriodDaily:
+		return time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	case TokenQuotaPeriodWeekly:
+		offset := (int(now.Weekday()) + 6) % 7
+		return time.Date(year, month, day-offset, 0, 0, 0, 0, now.Location())
+	case TokenQuotaPeriodMonthly:
+		return time.Date(year, month, 1, 0, 0, 0, 0, now.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+// TokenQuotaPeriodEnd 返回 now 所在周期的结束时间，即下一次重置时间
+func TokenQuotaPeriodEnd(period string, now time.Time) time.Time {
+	start := TokenQuotaPeriodStart(period, now)
+	switch period {
+	case TokenQuotaPeriodDaily:
+		return start.AddDate(0, 0, 1)
+	case TokenQuotaPeriodWeekly:
+		return start.AddDate(0, 0, 7)
+	case TokenQuotaPeriodMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return time.Time{}
+	}
+}
+
+// HasPeriodQuotaLimit 令牌是否设置了周期消费上限
+func (token *Token) HasPeriodQuotaLimit() bool {
+	return token.PeriodQuotaLimit > 0 && token.QuotaPeriod != ""
+}
+
+// GetPeriodUsedQuota 返回当前周期已消费额度，周期已切换时为 0
+func (token *Token) GetPeriodUsedQuota(now time.Time) int {
+	if !token.HasPeriodQuotaLimit() {
+		return 0
+	}
+	if token.PeriodStartTime < TokenQuotaPeriodStart(token.QuotaPeriod, now).Unix() {
+		return 0
+	}
+	return token.PeriodUsedQuota
+}
+
+// rollTokenQuotaPeriod 周期切换时重置已消费额度
+func rollTokenQuotaPeriod(tx *gorm.DB, tokenId int, periodStart int64) error {
+	return tx.Model(&Token{}).
+		Where("id = ? AND period_start_time < ?", tokenId, periodStart).
+		Updates(map[string]interface{}{
+			"period_used_quota": 0,
+			"period_start_time": periodStart,
+		}).Error
+}
+
+// ReserveTokenPeriodQuota 在当前周期内为令牌预留 quota 额度，超出周期上限时返回 ErrTokenPeriodQuotaExceeded。
+// 返回预留所在周期的开始时间，用于结算和退还。
+func ReserveTokenPeriodQuota(tokenId int, period string, limit int, quota int) (int64, error) {
+	if quota < 0 {
+		return 0, errors.New("quota 不能为负数！")
+	}
+	periodStart := TokenQuotaPeriodStart(period, time.Now()).Unix()
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := rollTokenQuotaPeriod(tx, tokenId, periodStart); err != nil {
+			return err
+		}
+		query := tx.Model(&Token{}).Where("id = ?", tokenId)
+		if quota > 0 {
+			query = query.Where("period_used_quota + ? <= ?", quota, limit)
+		} else {
+			query = query.Where("period_used_quota < ?", limit)
+		}
+		result := query.Update("period_used_quota", gorm.Expr("period_used_quota + ?", quota))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTokenPeriodQuotaExceeded
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return periodStart, nil
+}
+
+// AdjustTokenPeriodQuota 调整令牌周期已消费额度，delta 为负数时退还。
+// 退还只作用于预留时所在的周期，周期已切换时忽略；补扣计入当前周期，不检查上限。
+func AdjustTokenPeriodQuota(tokenId int, period string, reservedPeriodStart int64, delta int) error {
+	if delta == 0 {
+		return nil
+	}
+	if delta < 0 {
+		refund := -delta
+		return DB.Model(&Token{}).
+			Where("id = ? AND period_start_time = ?", tokenId, reservedPeriodStart).
+			Update("period_used_quota", gorm.Expr("CASE WHEN period_used_quota > ? THEN period_used_quota - ? ELSE 0 END", refund, refund)).Error
+	}
+	periodStart := TokenQuotaPeriodStart(period, time.Now()).Unix()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := rollTokenQuotaPeriod(tx, tokenId, periodStart); err != nil {
+			return err
+		}
+		return tx.Model(&Token{}).Where("id = ?", tokenId).
+			Update("period_used_quota", gorm.Expr("period_used_quota + ?", delta)).Error
+	})
+}
+
+// ResetTokenPeriodQuota 清空令牌当前周期的已消费额度
+func ResetTokenPeriodQuota(tokenId int) error {
+	return DB.Model(&Token{}).Where("id = ?", tokenId).
+		Update("period_used_quota", 0).Error
+}
+
+// FormatTokenQuotaPeriod 返回周期的中文描述，用于错误提示
+func FormatTokenQuotaPeriod(period string) string {
+	switch period {
+	case TokenQuotaPeriodDaily:
+		return "每日"
+	case TokenQuotaPeriodWeekly:
+		return "每周"
+	case TokenQuotaPeriodMonthly:
+		return "每月"
+	default:
+		return fmt.Sprintf("周期(%s)", period)
+	}
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenQuotaPeriodBoundaries(t *testing.T) {
+	// 2025-01-15 is a Wednesday
+	now := time.Date(2025, 1, 15, 13, 30, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), TokenQuotaPeriodStart(TokenQuotaPeriodDaily, now))
+	assert.Equal(t, time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC), TokenQuotaPeriodEnd(TokenQuotaPeriodDaily, now))
+
+	assert.Equal(t, time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC), TokenQuotaPeriodStart(TokenQuotaPeriodWeekly, now))
+	assert.Equal(t, time.Date(2025, 1, 20, 0, 0, 0, 0, time.UTC), TokenQuotaPeriodEnd(TokenQuotaPeriodWeekly, now))
+
+	sunday := time.Date(2025, 1, 19, 23, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2025, 1, 13, 0, 0, 0, 0, time.UTC), TokenQuotaPeriodStart(TokenQuotaPeriodWeekly, sunday))
+
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), TokenQuotaPeriodStart(TokenQuotaPeriodMonthly, now))
+	assert.Equal(t, time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), TokenQuotaPeriodEnd(TokenQuotaPeriodMonthly, now))
+
+	assert.True(t, TokenQuotaPeriodStart("", now).IsZero())
+}
+
+func TestReserveTokenPeriodQuota(t *testing.T) {
+	truncateTables(t)
+
+	token := &Token{UserId: 1, Key: "period-quota-key", Name: "period", QuotaPeriod: TokenQuotaPeriodDaily, PeriodQuotaLimit: 1000}
+	require.NoError(t, DB.Create(token).Error)
+
+	periodStart, err := ReserveTokenPeriodQuota(token.Id, token.QuotaPeriod, token.PeriodQuotaLimit, 600)
+	require.NoError(t, err)
+
+	_, err = ReserveTokenPeriodQuota(token.Id, token.QuotaPeriod, token.PeriodQuotaLimit, 500)
+	assert.ErrorIs(t, err, ErrTokenPeriodQuotaExceeded)
+
+	// settle below the reservation refunds the difference
+	require.NoError(t, AdjustTokenPeriodQuota(token.Id, token.QuotaPeriod, periodStart, -200))
+	_, err = ReserveTokenPeriodQuota(token.Id, token.QuotaPeriod, token.PeriodQuotaLimit, 500)
+	require.NoError(t, err)
+
+	fresh, err := GetTokenById(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 900, fresh.GetPeriodUsedQuota(time.Now()))
+
+	// usage recorded in an earlier period is reset on the next reservation
+	require.NoError(t, DB.Model(&Token{}).Where("id = ?", token.Id).Update("period_start_time", periodStart-86400).Error)
+	_, err = ReserveTokenPeriodQuota(token.Id, token.QuotaPeriod, token.PeriodQuotaLimit, 1000)
+	require.NoError(t, err)
+
+	// refunds for a period that has already rolled over are ignored
+	require.NoError(t, AdjustTokenPeriodQuota(token.Id, token.QuotaPeriod, periodStart-86400, -1000))
+	fresh, err = GetTokenById(token.Id)
+	require.NoError(t, err)
+	assert.Equal(t, 1000, fresh.PeriodUsedQuota)
+}
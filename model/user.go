@@ -50,6 +50,8 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	TpmLimit         int            `json:"tpm_limit" gorm:"type:int;default:0"`         // 每分钟 token 数限制，0 表示使用分组配置
+	ConcurrencyLimit int            `json:"concurrency_limit" gorm:"type:int;default:0"` // 最大并发请求数，0 表示使用分组配置
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -61,6 +63,9 @@ func (user *User) ToBaseUser() *UserBase {
 		Username: user.Username,
 		Setting:  user.Setting,
 		Email:    user.Email,
+
+		TpmLimit:         user.TpmLimit,
+		ConcurrencyLimit: user.ConcurrencyLimit,
 	}
 	return cache
 }
@@ -524,6 +529,9 @@ func (user *User) Edit(updatePassword bool) error {
 		"display_name": newUser.DisplayName,
 		"group":        newUser.Group,
 		"remark":       newUser.Remark,
+
+		"tpm_limit":         newUser.TpmLimit,
+		"concurrency_limit": newUser.ConcurrencyLimit,
 	}
 	if updatePassword {
 		updates["password"] = newUser.Password
@@ -996,6 +1004,13 @@ func updateUserRequestCount(id int, count int) {
 	}
 }
 
+// GetUserIdByUsername 根据用户名查询用户 ID
+func GetUserIdByUsername(username string) (int, error) {
+	var user User
+	err := DB.Select("id").Where("username = ?", username).First(&user).Error
+	return user.Id, err
+}
+
 // GetUsernameById gets username from Redis first, falls back to DB if needed
 func GetUsernameById(id int, fromDB bool) (username string, err error) {
 	defer func() {
@@ -40,6 +40,8 @@ type HybridCache[V any] struct {
 	memOnce sync.Once
 	memInit func() *hot.HotCache[string, V]
 	mem     *hot.HotCache[string, V]
+
+	stats *counters
 }
 
 func NewHybridCache[V any](cfg HybridCacheConfig[V]) *HybridCache[V] {
@@ -49,6 +51,7 @@ func NewHybridCache[V any](cfg HybridCacheConfig[V]) *HybridCache[V] {
 		redisCodec:   cfg.RedisCodec,
 		redisEnabled: cfg.RedisEnabled,
 		memInit:      cfg.Memory,
+		stats:        countersFor(cfg.Namespace),
 	}
 }
 
@@ -95,9 +98,11 @@ func (c *HybridCache[V]) Get(key string) (value V, found bool, err error) {
 				var zero V
 				return zero, false, decErr
 			}
+			c.stats.record(true)
 			return v, true, nil
 		}
 		if errors.Is(e, redis.Nil) {
+			c.stats.record(false)
 			var zero V
 			return zero, false, nil
 		}
@@ -105,7 +110,67 @@ func (c *HybridCache[V]) Get(key string) (value V, found bool, err error) {
 		return zero, false, e
 	}
 
-	return c.memCache().Get(full)
+	value, found, err = c.memCache().Get(full)
+	if err == nil {
+		c.stats.record(found)
+	}
+	return value, found, err
+}
+
+// GetMany returns values for the given raw keys in one round trip (MGET in Redis).
+// The returned map is keyed by the raw keys; missing keys are omitted.
+func (c *HybridCache[V]) GetMany(keys []string) (map[string]V, error) {
+	res := make(map[string]V, len(keys))
+	rawByFull := make(map[string]string, len(keys))
+	fullKeys := make([]string, 0, len(keys))
+	for _, k := range keys {
+		full := c.ns.FullKey(k)
+		if full == "" {
+			continue
+		}
+		rawByFull[full] = k
+		fullKeys = append(fullKeys, full)
+	}
+	if len(fullKeys) == 0 {
+		return res, nil
+	}
+
+	if c.redisOn() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultRedisOpTimeout)
+		defer cancel()
+
+		raws, err := c.redis.MGet(ctx, fullKeys...).Result()
+		if err != nil {
+			return res, err
+		}
+		for i, raw := range raws {
+			s, ok := raw.(string)
+			if !ok {
+				c.stats.record(false)
+				continue
+			}
+			v, decErr := c.redisCodec.Decode(s)
+			if decErr != nil {
+				return res, decErr
+			}
+			c.stats.record(true)
+			res[rawByFull[fullKeys[i]]] = v
+		}
+		return res, nil
+	}
+
+	values, missing, err := c.memCache().GetMany(fullKeys)
+	if err != nil {
+		return res, err
+	}
+	for full, v := range values {
+		c.stats.record(true)
+		res[rawByFull[full]] = v
+	}
+	for range missing {
+		c.stats.record(false)
+	}
+	return res, nil
 }
 
 func (c *HybridCache[V]) SetWithTTL(key string, v V, ttl time.Duration) error {
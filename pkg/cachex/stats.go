@@ -0,0 +1,59 @@
+package cachex
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of Get hit/miss counters for one namespace.
+type Stats struct {
+	Namespace string
+	Hits      uint64
+	Misses    uint64
+}
+
+type counters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// statsRegistry maps namespace -> *counters. Caches sharing a namespace share counters.
+var statsRegistry sync.Map
+
+func countersFor(ns Namespace) *counters {
+	if v, ok := statsRegistry.Load(string(ns)); ok {
+		return v.(*counters)
+	}
+	v, _ := statsRegistry.LoadOrStore(string(ns), &counters{})
+	return v.(*counters)
+}
+
+func (s *counters) record(found bool) {
+	if s == nil {
+		return
+	}
+	if found {
+		s.hits.Add(1)
+	} else {
+		s.misses.Add(1)
+	}
+}
+
+// AllStats returns hit/miss counters of every namespace created via NewHybridCache, sorted by namespace.
+func AllStats() []Stats {
+	result := make([]Stats, 0)
+	statsRegistry.Range(func(key, value any) bool {
+		c := value.(*counters)
+		result = append(result, Stats{
+			Namespace: key.(string),
+			Hits:      c.hits.Load(),
+			Misses:    c.misses.Load(),
+		})
+		return true
+	})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Namespace < result[j].Namespace
+	})
+	return result
+}
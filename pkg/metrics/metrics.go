@@ -0,0 +1,140 @@
+// Package metrics exposes relay, billing and channel health metrics in the Prometheus text format.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "new_api"
+
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300}
+
+var (
+	registry = prometheus.NewRegistry()
+
+	relayRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_requests_total",
+		Help:      "Upstream relay attempts by model, channel, group and result.",
+	}, []string{"model", "channel", "group", "status"})
+
+	relayDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_request_duration_seconds",
+		Help:      "Total duration of upstream relay attempts.",
+		Buckets:   latencyBuckets,
+	}, []string{"model", "channel", "group"})
+
+	relayTTFT = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "relay_ttft_seconds",
+		Help:      "Time to first token of successful streaming relay attempts.",
+		Buckets:   latencyBuckets,
+	}, []string{"model", "channel", "group"})
+
+	relayRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "relay_retries_total",
+		Help:      "Relay attempts that were retries of a failed attempt.",
+	}, []string{"model", "group"})
+
+	tokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "Billed tokens by model, channel, group and type (prompt or completion).",
+	}, []string{"model", "channel", "group", "type"})
+
+	quota = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_consumed_total",
+		Help:      "Consumed quota by model, channel and group.",
+	}, []string{"model", "channel", "group"})
+
+	cacheRequestsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "requests_total"),
+		"Hybrid cache lookups by namespace and result (hit or miss).",
+		[]string{"namespace", "result"}, nil,
+	)
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		relayRequests,
+		relayDuration,
+		relayTTFT,
+		relayRetries,
+		tokens,
+		quota,
+		cacheCollector{},
+	)
+}
+
+// Handler returns the HTTP handler serving all registered metrics.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRelayAttempt records one upstream attempt. ttft is only recorded when positive.
+func ObserveRelayAttempt(model string, channelId int, group string, success bool, duration time.Duration, ttft time.Duration) {
+	channel := strconv.Itoa(channelId)
+	status := "success"
+	if !success {
+		status = "error"
+	}
+	relayRequests.WithLabelValues(model, channel, group, status).Inc()
+	relayDuration.WithLabelValues(model, channel, group).Observe(duration.Seconds())
+	if ttft > 0 {
+		relayTTFT.WithLabelValues(model, channel, group).Observe(ttft.Seconds())
+	}
+}
+
+// IncRelayRetry records an attempt that retried a previously failed one.
+func IncRelayRetry(model string, group string) {
+	relayRetries.WithLabelValues(model, group).Inc()
+}
+
+// AddUsage records billed tokens and quota of a consume log.
+func AddUsage(model string, channelId int, group string, promptTokens int, completionTokens int, consumedQuota int) {
+	channel := strconv.Itoa(channelId)
+	if promptTokens > 0 {
+		tokens.WithLabelValues(model, channel, group, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		tokens.WithLabelValues(model, channel, group, "completion").Add(float64(completionTokens))
+	}
+	if consumedQuota > 0 {
+		quota.WithLabelValues(model, channel, group).Add(float64(consumedQuota))
+	}
+}
+
+// cacheCollector reads hit/miss counters from pkg/cachex at scrape time.
+type cacheCollector struct{}
+
+func (cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheRequestsDesc
+}
+
+func (cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range cachex.AllStats() {
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.Hits), s.Namespace, "hit")
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.Misses), s.Namespace, "miss")
+	}
+}
+
+// RegisterGaugeFunc registers a gauge whose value is read from fn at scrape time.
+func RegisterGaugeFunc(name string, help string, fn func() float64) {
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
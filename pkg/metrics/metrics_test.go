@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	"github.com/samber/hot"
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestMetricsHandler(t *testing.T) {
+	ObserveRelayAttempt("gpt-4o", 3, "default", true, 2*time.Second, 300*time.Millisecond)
+	ObserveRelayAttempt("gpt-4o", 3, "default", false, time.Second, 0)
+	IncRelayRetry("gpt-4o", "default")
+	AddUsage("gpt-4o", 3, "default", 100, 20, 500)
+
+	cache := cachex.NewHybridCache[int](cachex.HybridCacheConfig[int]{
+		Namespace: "metrics_test:v1",
+		Memory: func() *hot.HotCache[string, int] {
+			return hot.NewHotCache[string, int](hot.LRU, 10).Build()
+		},
+	})
+	require.NoError(t, cache.SetWithTTL("a", 1, time.Minute))
+	_, _, _ = cache.Get("a")
+	_, _, _ = cache.Get("b")
+
+	SetTaskQueueProvider(func() (map[string]int64, error) {
+		return map[string]int64{"suno": 2}, nil
+	})
+
+	body := scrape(t)
+	require.Contains(t, body, `new_api_relay_requests_total{channel="3",group="default",model="gpt-4o",status="success"} 1`)
+	require.Contains(t, body, `new_api_relay_requests_total{channel="3",group="default",model="gpt-4o",status="error"} 1`)
+	require.Contains(t, body, `new_api_relay_ttft_seconds_count{channel="3",group="default",model="gpt-4o"} 1`)
+	require.Contains(t, body, `new_api_relay_retries_total{group="default",model="gpt-4o"} 1`)
+	require.Contains(t, body, `new_api_tokens_total{channel="3",group="default",model="gpt-4o",type="prompt"} 100`)
+	require.Contains(t, body, `new_api_quota_consumed_total{channel="3",group="default",model="gpt-4o"} 500`)
+	require.Contains(t, body, `new_api_cache_requests_total{namespace="metrics_test:v1",result="hit"} 1`)
+	require.Contains(t, body, `new_api_cache_requests_total{namespace="metrics_test:v1",result="miss"} 1`)
+	require.Contains(t, body, `new_api_task_queue_depth{platform="suno"} 2`)
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ChannelState is the status of one channel at scrape time.
+type ChannelState struct {
+	Id     int
+	Name   string
+	Type   int
+	Status int
+	// StatusName is a readable status such as "enabled" or "auto_disabled".
+	StatusName string
+}
+
+var (
+	channelStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "channel", "status"),
+		"Channel status code (1 enabled, 2 manually disabled, 3 auto disabled).",
+		[]string{"channel_id", "channel_name", "channel_type"}, nil,
+	)
+	channelsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "channels"),
+		"Number of channels by status.",
+		[]string{"status"}, nil,
+	)
+	taskQueueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "task", "queue_depth"),
+		"Unfinished async tasks waiting for polling, by platform.",
+		[]string{"platform"}, nil,
+	)
+
+	providerMu           sync.RWMutex
+	channelStateProvider func() ([]ChannelState, error)
+	taskQueueProvider    func() (map[string]int64, error)
+	stateCollectorOnce   sync.Once
+)
+
+// SetChannelStateProvider sets the function used to read channel states at scrape time.
+func SetChannelStateProvider(fn func() ([]ChannelState, error)) {
+	providerMu.Lock()
+	channelStateProvider = fn
+	providerMu.Unlock()
+	registerStateCollector()
+}
+
+// SetTaskQueueProvider sets the function used to read the task polling queue depth at scrape time.
+func SetTaskQueueProvider(fn func() (map[string]int64, error)) {
+	providerMu.Lock()
+	taskQueueProvider = fn
+	providerMu.Unlock()
+	registerStateCollector()
+}
+
+func registerStateCollector() {
+	stateCollectorOnce.Do(func() {
+		registry.MustRegister(stateCollector{})
+	})
+}
+
+// stateCollector queries the providers on every scrape; provider errors drop the affected series.
+type stateCollector struct{}
+
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- channelStatusDesc
+	ch <- channelsDesc
+	ch <- taskQueueDesc
+}
+
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	providerMu.RLock()
+	channelFn, taskFn := channelStateProvider, taskQueueProvider
+	providerMu.RUnlock()
+
+	if channelFn != nil {
+		if states, err := channelFn(); err == nil {
+			counts := make(map[string]int)
+			for _, s := range states {
+				ch <- prometheus.MustNewConstMetric(channelStatusDesc, prometheus.GaugeValue, float64(s.Status),
+					strconv.Itoa(s.Id), s.Name, strconv.Itoa(s.Type))
+				counts[s.StatusName]++
+			}
+			for status, n := range counts {
+				ch <- prometheus.MustNewConstMetric(channelsDesc, prometheus.GaugeValue, float64(n), status)
+			}
+		}
+	}
+	if taskFn != nil {
+		if depth, err := taskFn(); err == nil {
+			for platform, n := range depth {
+				ch <- prometheus.MustNewConstMetric(taskQueueDesc, prometheus.GaugeValue, float64(n), platform)
+			}
+		}
+	}
+}
@@ -484,6 +484,10 @@ func DoRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	return doRequest(c, req, info)
 }
 func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http.Response, error) {
+	// 对冲请求未胜出时取消上下文，需要同时中断上游请求
+	if service.GetHedgeAttempt(c) != nil {
+		req = req.WithContext(c.Request.Context())
+	}
 	var client *http.Client
 	var err error
 	if info.ChannelSetting.Proxy != "" {
@@ -523,6 +527,13 @@ func doRequest(c *gin.Context, req *http.Request, info *common.RelayInfo) (*http
 	if resp == nil {
 		return nil, errors.New("resp is nil")
 	}
+	if info.ChannelMeta != nil {
+		keyIndex := 0
+		if info.ChannelIsMultiKey {
+			keyIndex = info.ChannelMultiKeyIndex
+		}
+		service.ObserveUpstreamRateLimitHeaders(info.ChannelId, keyIndex, resp)
+	}
 
 	_ = req.Body.Close()
 	_ = c.Request.Body.Close()
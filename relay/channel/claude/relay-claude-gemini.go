@@ -0,0 +1,525 @@
+package claude
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gemini generateContent 与 Claude Messages 的直接转换，用于 Gemini 格式的请求由 Claude 渠道处理。
+
+const claudeMinThinkingBudget = 1024
+
+// geminiFunctionDeclaration Gemini 函数声明，参数可通过 parameters（OpenAPI Schema）或 parametersJsonSchema 提供
+type geminiFunctionDeclaration struct {
+	Name                 string         `json:"name"`
+	Description          string         `json:"description,omitempty"`
+	Parameters           map[string]any `json:"parameters,omitempty"`
+	ParametersJsonSchema map[string]any `json:"parametersJsonSchema,omitempty"`
+}
+
+// normalizeGeminiSchema Gemini 的 OpenAPI Schema 类型为大写（OBJECT、STRING），转换为 JSON Schema 的小写类型
+func normalizeGeminiSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, value := range v {
+			if key == "type" {
+				if typeName, ok := value.(string); ok {
+					result[key] = strings.ToLower(typeName)
+					continue
+				}
+			}
+			result[key] = normalizeGeminiSchema(value)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = normalizeGeminiSchema(item)
+		}
+		return result
+	default:
+		return schema
+	}
+}
+
+func convertGeminiTools2Claude(request *dto.GeminiChatRequest) ([]any, error) {
+	var claudeTools []any
+	for _, tool := range request.GetTools() {
+		if tool.GoogleSearch != nil || tool.GoogleSearchRetrieval != nil {
+			claudeTools = append(claudeTools, &dto.ClaudeWebSearchTool{
+				Type: "web_search_20250305",
+				Name: "web_search",
+			})
+		}
+		if tool.FunctionDeclarations == nil {
+			continue
+		}
+		data, err := common.Marshal(tool.FunctionDeclarations)
+		if err != nil {
+			return nil, err
+		}
+		var declarations []geminiFunctionDeclaration
+		if err := common.Unmarshal(data, &declarations); err != nil {
+			return nil, fmt.Errorf("invalid functionDeclarations: %w", err)
+		}
+		for _, declaration := range declarations {
+			if declaration.Name == "" {
+				return nil, errors.New("function declaration name is required")
+			}
+			schema := declaration.ParametersJsonSchema
+			if schema == nil && declaration.Parameters != nil {
+				schema, _ = normalizeGeminiSchema(declaration.Parameters).(map[string]any)
+			}
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			claudeTools = append(claudeTools, &dto.Tool{
+				Name:        declaration.Name,
+				Description: declaration.Description,
+				InputSchema: schema,
+			})
+		}
+	}
+	return claudeTools, nil
+}
+
+func convertGeminiToolConfig2Claude(toolConfig *dto.ToolConfig) *dto.ClaudeToolChoice {
+	if toolConfig == nil || toolConfig.FunctionCallingConfig == nil {
+		return nil
+	}
+	switch strings.ToUpper(string(toolConfig.FunctionCallingConfig.Mode)) {
+	case "ANY", "VALIDATED":
+		if names := toolConfig.FunctionCallingConfig.AllowedFunctionNames; len(names) == 1 {
+			return &dto.ClaudeToolChoice{Type: "tool", Name: names[0]}
+		}
+		return &dto.ClaudeToolChoice{Type: "any"}
+	case "NONE":
+		return &dto.ClaudeToolChoice{Type: "none"}
+	case "AUTO":
+		return &dto.ClaudeToolChoice{Type: "auto"}
+	}
+	return nil
+}
+
+// geminiThinkingBudget 将 thinkingConfig 转换为 Claude 的思考预算，返回 0 表示不开启思考
+func geminiThinkingBudget(config *dto.GeminiThinkingConfig, maxTokens uint) int {
+	if config == nil {
+		return 0
+	}
+	defaultBudget := int(float64(maxTokens) * model_setting.GetClaudeSettings().ThinkingAdapterBudgetTokensPercentage)
+	if config.ThinkingBudget != nil {
+		switch budget := *config.ThinkingBudget; {
+		case budget == 0:
+			return 0
+		case budget < 0:
+			// -1 为动态思考
+			return defaultBudget
+		default:
+			return budget
+		}
+	}
+	switch strings.ToLower(config.ThinkingLevel) {
+	case "minimal", "low":
+		return 1280
+	case "medium":
+		return 2048
+	case "high":
+		return 4096
+	}
+	if config.IncludeThoughts {
+		return defaultBudget
+	}
+	return 0
+}
+
+func geminiMediaBlock(mimeType string, data string, url string) (*dto.ClaudeMediaMessage, error) {
+	mimeType = strings.ToLower(mimeType)
+	source := &dto.ClaudeMessageSource{Type: "base64", MediaType: mimeType, Data: data}
+	if url != "" {
+		source = &dto.ClaudeMessageSource{Type: "url", Url: url}
+	}
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return &dto.ClaudeMediaMessage{Type: "image", Source: source}, nil
+	case mimeType == "application/pdf":
+		return &dto.ClaudeMediaMessage{Type: "document", Source: source}, nil
+	case strings.HasPrefix(mimeType, "text/") && url == "":
+		text, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 data for %s: %w", mimeType, err)
+		}
+		return &dto.ClaudeMediaMessage{
+			Type:   "document",
+			Source: &dto.ClaudeMessageSource{Type: "text", MediaType: "text/plain", Data: string(text)},
+		}, nil
+	}
+	return nil, fmt.Errorf("mime type is not supported by Claude: '%s'", mimeType)
+}
+
+// geminiFunctionResponseContent functionResponse 只有 content 文本时直接作为结果文本，否则序列化为 JSON
+func geminiFunctionResponseContent(response map[string]any) (string, bool) {
+	if errValue, ok := response["error"]; ok && len(response) == 1 {
+		if text, ok := errValue.(string); ok {
+			return text, true
+		}
+		data, _ := common.Marshal(errValue)
+		return string(data), true
+	}
+	if text, ok := response["content"].(string); ok && len(response) == 1 {
+		return text, false
+	}
+	data, _ := common.Marshal(response)
+	return string(data), false
+}
+
+// ConvertGemini2ClaudeRequest 将 Gemini generateContent 请求直接转换为 Claude Messages 请求
+func ConvertGemini2ClaudeRequest(c *gin.Context, request *dto.GeminiChatRequest, info *relaycommon.RelayInfo) (*dto.ClaudeRequest, error) {
+	config := request.GenerationConfig
+	claudeRequest := &dto.ClaudeRequest{
+		Model:       info.UpstreamModelName,
+		Temperature: config.Temperature,
+		TopP:        config.TopP,
+	}
+	if info.IsStream {
+		claudeRequest.Stream = common.GetPointer(true)
+	}
+	if config.TopK != nil {
+		claudeRequest.TopK = common.GetPointer(int(*config.TopK))
+	}
+	if len(config.StopSequences) > 0 {
+		claudeRequest.StopSequences = config.StopSequences
+	}
+	if config.MaxOutputTokens != nil && *config.MaxOutputTokens > 0 {
+		claudeRequest.MaxTokens = common.GetPointer(*config.MaxOutputTokens)
+	} else {
+		claudeRequest.MaxTokens = common.GetPointer(uint(model_setting.GetClaudeSettings().GetDefaultMaxTokens(info.UpstreamModelName)))
+	}
+
+	if budget := geminiThinkingBudget(config.ThinkingConfig, *claudeRequest.MaxTokens); budget > 0 {
+		budget = max(budget, claudeMinThinkingBudget)
+		// Claude 要求 max_tokens 大于思考预算
+		if *claudeRequest.MaxTokens <= uint(budget) {
+			claudeRequest.MaxTokens = common.GetPointer(uint(budget + claudeMinThinkingBudget))
+		}
+		claudeRequest.Thinking = &dto.Thinking{Type: "enabled", BudgetTokens: common.GetPointer(budget)}
+		// https://docs.anthropic.com/en/docs/build-with-claude/extended-thinking#important-considerations-when-using-extended-thinking
+		claudeRequest.TopP = nil
+		claudeRequest.TopK = nil
+		claudeRequest.Temperature = common.GetPointer[float64](1.0)
+	}
+
+	tools, err := convertGeminiTools2Claude(request)
+	if err != nil {
+		return nil, err
+	}
+	if len(tools) > 0 {
+		claudeRequest.Tools = tools
+		if toolChoice := convertGeminiToolConfig2Claude(request.ToolConfig); toolChoice != nil {
+			claudeRequest.ToolChoice = toolChoice
+		}
+	}
+
+	if request.SystemInstructions != nil {
+		var systemTexts []string
+		for _, part := range request.SystemInstructions.Parts {
+			if part.Text != "" {
+				systemTexts = append(systemTexts, part.Text)
+			}
+		}
+		if len(systemTexts) > 0 {
+			claudeRequest.System = strings.Join(systemTexts, "\n")
+		}
+	}
+
+	// Gemini 的 functionResponse 可能不带 id，按函数名依次对应之前生成的 tool_use id
+	pendingToolIds := make(map[string][]string)
+	for _, content := range request.Contents {
+		role := "user"
+		if content.Role == "model" {
+			role = "assistant"
+		}
+		var toolResults, blocks []dto.ClaudeMediaMessage
+		// 流式输出的思考内容会被拆成多个 thought part，签名只在最后一个上，需要合并为一个 thinking 块
+		var thinking strings.Builder
+		thinkingSignature := ""
+		flushThinking := func() {
+			// 没有签名的思考内容无法回传给 Claude
+			if thinkingSignature != "" {
+				blocks = append(blocks, dto.ClaudeMediaMessage{
+					Type:      "thinking",
+					Thinking:  common.GetPointer(thinking.String()),
+					Signature: thinkingSignature,
+				})
+			}
+			thinking.Reset()
+			thinkingSignature = ""
+		}
+		for _, part := range content.Parts {
+			if !part.Thought || part.FunctionCall != nil || part.FunctionResponse != nil {
+				flushThinking()
+			}
+			switch {
+			case part.FunctionCall != nil:
+				id := part.FunctionCall.ID
+				if id == "" {
+					id = fmt.Sprintf("toolu_%s", common.GetUUID())
+				}
+				pendingToolIds[part.FunctionCall.FunctionName] = append(pendingToolIds[part.FunctionCall.FunctionName], id)
+				input := part.FunctionCall.Arguments
+				if input == nil {
+					input = map[string]any{}
+				}
+				blocks = append(blocks, dto.ClaudeMediaMessage{
+					Type:  "tool_use",
+					Id:    id,
+					Name:  part.FunctionCall.FunctionName,
+					Input: input,
+				})
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				var id string
+				if len(part.FunctionResponse.ID) > 0 {
+					_ = common.Unmarshal(part.FunctionResponse.ID, &id)
+				}
+				if ids := pendingToolIds[name]; len(ids) > 0 {
+					if id == "" {
+						id = ids[0]
+					}
+					pendingToolIds[name] = ids[1:]
+				}
+				if id == "" {
+					return nil, fmt.Errorf("functionResponse %s has no matching functionCall", name)
+				}
+				text, isError := geminiFunctionResponseContent(part.FunctionResponse.Response)
+				toolResults = append(toolResults, dto.ClaudeMediaMessage{
+					Type:      "tool_result",
+					ToolUseId: id,
+					Content:   text,
+					IsError:   isError,
+				})
+			case part.Thought:
+				thinking.WriteString(part.Text)
+				if signature := decodeGeminiThoughtSignature(part); signature != "" {
+					thinkingSignature = signature
+				}
+			case part.InlineData != nil:
+				block, err := geminiMediaBlock(part.InlineData.MimeType, part.InlineData.Data, "")
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, *block)
+			case part.FileData != nil:
+				block, err := geminiMediaBlock(part.FileData.MimeType, "", part.FileData.FileUri)
+				if err != nil {
+					return nil, err
+				}
+				blocks = append(blocks, *block)
+			case part.Text != "":
+				block := dto.ClaudeMediaMessage{Type: "text"}
+				block.SetText(part.Text)
+				blocks = append(blocks, block)
+			}
+		}
+		flushThinking()
+		// tool_result 必须位于 user 消息的开头
+		blocks = append(toolResults, blocks...)
+		if len(blocks) == 0 {
+			continue
+		}
+		claudeRequest.Messages = append(claudeRequest.Messages, dto.ClaudeMessage{Role: role, Content: blocks})
+	}
+	if len(claudeRequest.Messages) == 0 {
+		return nil, errors.New("contents is required")
+	}
+	return claudeRequest, nil
+}
+
+func decodeGeminiThoughtSignature(part dto.GeminiPart) string {
+	if len(part.ThoughtSignature) == 0 {
+		return ""
+	}
+	var signature string
+	if err := common.Unmarshal(part.ThoughtSignature, &signature); err != nil {
+		return ""
+	}
+	return signature
+}
+
+func encodeGeminiThoughtSignature(signature string) []byte {
+	data, _ := common.Marshal(signature)
+	return data
+}
+
+func finishReasonClaude2Gemini(stopReason string) string {
+	switch stopReason {
+	case "max_tokens", "model_context_window_exceeded":
+		return "MAX_TOKENS"
+	case "refusal":
+		return "SAFETY"
+	default:
+		return "STOP"
+	}
+}
+
+// buildGeminiUsageMetadata Claude 的 input_tokens 不包含缓存部分，Gemini 的 promptTokenCount 包含
+func buildGeminiUsageMetadata(usage *dto.Usage) dto.GeminiUsageMetadata {
+	if usage == nil {
+		return dto.GeminiUsageMetadata{}
+	}
+	promptTokens := usage.PromptTokens + usage.PromptTokensDetails.CachedTokens + cacheCreationTokensForOpenAIUsage(usage)
+	return dto.GeminiUsageMetadata{
+		PromptTokenCount:        promptTokens,
+		CandidatesTokenCount:    usage.CompletionTokens,
+		CachedContentTokenCount: usage.PromptTokensDetails.CachedTokens,
+		TotalTokenCount:         promptTokens + usage.CompletionTokens,
+	}
+}
+
+// ResponseClaude2Gemini 转换非流式响应，thinking 块转换为带签名的 thought part
+func ResponseClaude2Gemini(claudeResponse *dto.ClaudeResponse, usage *dto.Usage) *dto.GeminiChatResponse {
+	parts := make([]dto.GeminiPart, 0, len(claudeResponse.Content))
+	for _, block := range claudeResponse.Content {
+		switch block.Type {
+		case "thinking":
+			part := dto.GeminiPart{Thought: true}
+			if block.Thinking != nil {
+				part.Text = *block.Thinking
+			}
+			if block.Signature != "" {
+				part.ThoughtSignature = encodeGeminiThoughtSignature(block.Signature)
+			}
+			parts = append(parts, part)
+		case "text":
+			if block.GetText() != "" {
+				parts = append(parts, dto.GeminiPart{Text: block.GetText()})
+			}
+		case "tool_use":
+			args := block.Input
+			if args == nil {
+				args = map[string]any{}
+			}
+			parts = append(parts, dto.GeminiPart{FunctionCall: &dto.FunctionCall{
+				FunctionName: block.Name,
+				Arguments:    args,
+				ID:           block.Id,
+			}})
+		}
+	}
+	return &dto.GeminiChatResponse{
+		Candidates: []dto.GeminiChatCandidate{{
+			Content:      dto.GeminiChatContent{Role: "model", Parts: parts},
+			FinishReason: common.GetPointer(finishReasonClaude2Gemini(claudeResponse.StopReason)),
+		}},
+		UsageMetadata: buildGeminiUsageMetadata(usage),
+	}
+}
+
+// claudeGeminiStreamState 记录流式转换中当前的内容块，工具参数、思考内容与签名需要在块结束时一并输出
+type claudeGeminiStreamState struct {
+	blockType string
+	toolId    string
+	toolName  string
+	toolInput strings.Builder
+	thinking  strings.Builder
+	signature string
+	finished  bool
+}
+
+func geminiStreamChunk(parts []dto.GeminiPart) *dto.GeminiChatResponse {
+	return &dto.GeminiChatResponse{
+		Candidates: []dto.GeminiChatCandidate{{
+			Content: dto.GeminiChatContent{Role: "model", Parts: parts},
+		}},
+	}
+}
+
+// StreamResponseClaude2Gemini 将一个 Claude 流式事件转换为 Gemini 流式响应，无需输出时返回 nil
+func StreamResponseClaude2Gemini(claudeResponse *dto.ClaudeResponse, claudeInfo *ClaudeResponseInfo) *dto.GeminiChatResponse {
+	if claudeInfo.geminiState == nil {
+		claudeInfo.geminiState = &claudeGeminiStreamState{}
+	}
+	state := claudeInfo.geminiState
+	switch claudeResponse.Type {
+	case "content_block_start":
+		if claudeResponse.ContentBlock == nil {
+			return nil
+		}
+		state.blockType = claudeResponse.ContentBlock.Type
+		state.thinking.Reset()
+		state.signature = ""
+		if state.blockType == "tool_use" {
+			state.toolId = claudeResponse.ContentBlock.Id
+			state.toolName = claudeResponse.ContentBlock.Name
+			state.toolInput.Reset()
+		}
+	case "content_block_delta":
+		delta := claudeResponse.Delta
+		if delta == nil {
+			return nil
+		}
+		switch delta.Type {
+		case "text_delta":
+			if delta.GetText() != "" {
+				return geminiStreamChunk([]dto.GeminiPart{{Text: delta.GetText()}})
+			}
+		case "thinking_delta":
+			// 思考内容与签名放在同一个 part 中，客户端原样回传时才能还原出带签名的 thinking 块
+			if delta.Thinking != nil {
+				state.thinking.WriteString(*delta.Thinking)
+			}
+		case "signature_delta":
+			state.signature += delta.Signature
+		case "input_json_delta":
+			if delta.PartialJson != nil {
+				state.toolInput.WriteString(*delta.PartialJson)
+			}
+		}
+	case "content_block_stop":
+		blockType := state.blockType
+		state.blockType = ""
+		switch blockType {
+		case "thinking":
+			if state.thinking.Len() == 0 && state.signature == "" {
+				return nil
+			}
+			part := dto.GeminiPart{Text: state.thinking.String(), Thought: true}
+			if state.signature != "" {
+				part.ThoughtSignature = encodeGeminiThoughtSignature(state.signature)
+			}
+			return geminiStreamChunk([]dto.GeminiPart{part})
+		case "tool_use":
+			args := map[string]any{}
+			if input := state.toolInput.String(); input != "" {
+				if err := common.UnmarshalJsonStr(input, &args); err != nil {
+					common.SysLog("error unmarshalling tool input: " + err.Error())
+				}
+			}
+			return geminiStreamChunk([]dto.GeminiPart{{FunctionCall: &dto.FunctionCall{
+				FunctionName: state.toolName,
+				Arguments:    args,
+				ID:           state.toolId,
+			}}})
+		}
+	case "message_delta":
+		stopReason := ""
+		if claudeResponse.Delta != nil && claudeResponse.Delta.StopReason != nil {
+			stopReason = *claudeResponse.Delta.StopReason
+		}
+		state.finished = true
+		chunk := geminiStreamChunk(make([]dto.GeminiPart, 0))
+		chunk.Candidates[0].FinishReason = common.GetPointer(finishReasonClaude2Gemini(stopReason))
+		chunk.UsageMetadata = buildGeminiUsageMetadata(claudeInfo.Usage)
+		return chunk
+	}
+	return nil
+}
@@ -559,6 +559,8 @@ type ClaudeResponseInfo struct {
 	ResponseText strings.Builder
 	Usage        *dto.Usage
 	Done         bool
+
+	geminiState *claudeGeminiStreamState
 }
 
 func cacheCreationTokensForOpenAIUsage(usage *dto.Usage) int {
@@ -754,6 +756,11 @@ func FormatClaudeResponseInfo(claudeResponse *dto.ClaudeResponse, oaiResponse *d
 	return true
 }
 
+// isResponsesRequest 客户端请求为 Responses API，经 Chat Completions 转换后发往 Claude 渠道
+func isResponsesRequest(info *relaycommon.RelayInfo) bool {
+	return len(info.RequestConversionChain) > 0 && info.RequestConversionChain[0] == types.RelayFormatOpenAIResponses
+}
+
 func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claudeInfo *ClaudeResponseInfo, data string) *types.NewAPIError {
 	var claudeResponse dto.ClaudeResponse
 	err := common.UnmarshalJsonStr(data, &claudeResponse)
@@ -770,6 +777,11 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 	if claudeResponse.Delta != nil && claudeResponse.Delta.StopReason != nil {
 		maybeMarkClaudeRefusal(c, *claudeResponse.Delta.StopReason)
 	}
+	// 经 Chat Completions 转发的 Responses 请求需要生成 web_search_call 输出项，
+	// 流式响应的联网搜索次数在 message_delta 的 usage 中给出，与非流式保持一致计费
+	if isResponsesRequest(info) && claudeResponse.Type == "message_delta" && claudeResponse.Usage != nil && claudeResponse.Usage.ServerToolUse != nil && claudeResponse.Usage.ServerToolUse.WebSearchRequests > 0 {
+		c.Set("claude_web_search_requests", claudeResponse.Usage.ServerToolUse.WebSearchRequests)
+	}
 	if info.RelayFormat == types.RelayFormatClaude {
 		FormatClaudeResponseInfo(&claudeResponse, nil, claudeInfo)
 
@@ -797,6 +809,14 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		if err != nil {
 			logger.LogError(c, "send_stream_response_failed: "+err.Error())
 		}
+	} else if info.RelayFormat == types.RelayFormatGemini {
+		FormatClaudeResponseInfo(&claudeResponse, nil, claudeInfo)
+		if response := StreamResponseClaude2Gemini(&claudeResponse, claudeInfo); response != nil {
+			err = helper.ObjectData(c, response)
+			if err != nil {
+				logger.LogError(c, "send_stream_response_failed: "+err.Error())
+			}
+		}
 	}
 	return nil
 }
@@ -836,6 +856,16 @@ func HandleStreamFinalResponse(c *gin.Context, info *relaycommon.RelayInfo, clau
 			}
 		}
 		helper.Done(c)
+	} else if info.RelayFormat == types.RelayFormatGemini {
+		// 上游未返回 message_delta 时补发带用量的结束响应
+		if claudeInfo.geminiState == nil || !claudeInfo.geminiState.finished {
+			response := geminiStreamChunk(make([]dto.GeminiPart, 0))
+			response.Candidates[0].FinishReason = common.GetPointer(finishReasonClaude2Gemini(""))
+			response.UsageMetadata = buildGeminiUsageMetadata(claudeInfo.Usage)
+			if err := helper.ObjectData(c, response); err != nil {
+				common.SysLog("send final response failed: " + err.Error())
+			}
+		}
 	}
 }
 
@@ -896,6 +926,12 @@ func HandleClaudeResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		}
 	case types.RelayFormatClaude:
 		responseData = data
+	case types.RelayFormatGemini:
+		geminiResponse := ResponseClaude2Gemini(&claudeResponse, claudeInfo.Usage)
+		responseData, err = common.Marshal(geminiResponse)
+		if err != nil {
+			return types.NewError(err, types.ErrorCodeBadResponseBody)
+		}
 	}
 
 	if claudeResponse.Usage != nil && claudeResponse.Usage.ServerToolUse != nil && claudeResponse.Usage.ServerToolUse.WebSearchRequests > 0 {
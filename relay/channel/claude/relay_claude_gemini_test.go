@@ -0,0 +1,117 @@
+package claude
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertGemini2ClaudeRequest(t *testing.T) {
+	info := &relaycommon.RelayInfo{
+		IsStream: true,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			UpstreamModelName: "claude-sonnet-4-5",
+		},
+	}
+	imageData := base64.StdEncoding.EncodeToString([]byte("png"))
+
+	var request dto.GeminiChatRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"systemInstruction": {"parts": [{"text": "be brief"}]},
+		"generationConfig": {"maxOutputTokens": 2000, "temperature": 0.3, "thinkingConfig": {"thinkingBudget": 3000}},
+		"tools": [{"functionDeclarations": [{"name": "get_weather", "parameters": {"type": "OBJECT", "properties": {"city": {"type": "STRING"}}}}]}],
+		"toolConfig": {"functionCallingConfig": {"mode": "ANY", "allowedFunctionNames": ["get_weather"]}},
+		"contents": [
+			{"role": "user", "parts": [{"text": "weather here?"}, {"inlineData": {"mimeType": "image/png", "data": "`+imageData+`"}}]},
+			{"role": "model", "parts": [
+				{"text": "need ", "thought": true},
+				{"text": "a tool", "thought": true, "thoughtSignature": "sig"},
+				{"functionCall": {"name": "get_weather", "args": {"city": "Paris"}}}
+			]},
+			{"role": "user", "parts": [{"functionResponse": {"name": "get_weather", "response": {"temp": 20}}}]}
+		]
+	}`, &request))
+
+	claudeRequest, err := ConvertGemini2ClaudeRequest(nil, &request, info)
+	require.NoError(t, err)
+
+	require.Equal(t, "claude-sonnet-4-5", claudeRequest.Model)
+	require.True(t, *claudeRequest.Stream)
+	require.Equal(t, "be brief", claudeRequest.System)
+	require.NotNil(t, claudeRequest.Thinking)
+	require.Equal(t, 3000, *claudeRequest.Thinking.BudgetTokens)
+	require.Greater(t, *claudeRequest.MaxTokens, uint(3000))
+	require.Equal(t, 1.0, *claudeRequest.Temperature)
+
+	require.Len(t, claudeRequest.Tools, 1)
+	tool := claudeRequest.Tools.([]any)[0].(*dto.Tool)
+	require.Equal(t, "object", tool.InputSchema["type"])
+	require.Equal(t, "string", tool.InputSchema["properties"].(map[string]any)["city"].(map[string]any)["type"])
+	require.Equal(t, &dto.ClaudeToolChoice{Type: "tool", Name: "get_weather"}, claudeRequest.ToolChoice)
+
+	require.Len(t, claudeRequest.Messages, 3)
+	userBlocks := claudeRequest.Messages[0].Content.([]dto.ClaudeMediaMessage)
+	require.Equal(t, "image", userBlocks[1].Type)
+	require.Equal(t, "image/png", userBlocks[1].Source.MediaType)
+
+	modelBlocks := claudeRequest.Messages[1].Content.([]dto.ClaudeMediaMessage)
+	require.Len(t, modelBlocks, 2)
+	require.Equal(t, "thinking", modelBlocks[0].Type)
+	require.Equal(t, "need a tool", *modelBlocks[0].Thinking)
+	require.Equal(t, "sig", modelBlocks[0].Signature)
+	toolUse := modelBlocks[1]
+	require.Equal(t, "assistant", claudeRequest.Messages[1].Role)
+	require.Equal(t, "tool_use", toolUse.Type)
+	toolResult := claudeRequest.Messages[2].Content.([]dto.ClaudeMediaMessage)[0]
+	require.Equal(t, "tool_result", toolResult.Type)
+	require.Equal(t, toolUse.Id, toolResult.ToolUseId)
+	require.JSONEq(t, `{"temp": 20}`, toolResult.Content.(string))
+}
+
+func TestStreamResponseClaude2Gemini(t *testing.T) {
+	claudeInfo := &ClaudeResponseInfo{Usage: &dto.Usage{}}
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4-5","usage":{"input_tokens":10,"cache_read_input_tokens":30,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"hm"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"m"}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"signature_delta","signature":"sig"}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"get_weather","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"city\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"Paris\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":25}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	var chunks []*dto.GeminiChatResponse
+	for _, event := range events {
+		var claudeResponse dto.ClaudeResponse
+		require.NoError(t, common.UnmarshalJsonStr(event, &claudeResponse))
+		FormatClaudeResponseInfo(&claudeResponse, nil, claudeInfo)
+		if chunk := StreamResponseClaude2Gemini(&claudeResponse, claudeInfo); chunk != nil {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	require.Len(t, chunks, 3)
+	thought := chunks[0].Candidates[0].Content.Parts[0]
+	require.True(t, thought.Thought)
+	require.Equal(t, "hmm", thought.Text)
+	require.Equal(t, "sig", decodeGeminiThoughtSignature(thought))
+
+	call := chunks[1].Candidates[0].Content.Parts[0].FunctionCall
+	require.Equal(t, "toolu_1", call.ID)
+	require.Equal(t, map[string]any{"city": "Paris"}, call.Arguments)
+
+	final := chunks[2]
+	require.Equal(t, "STOP", *final.Candidates[0].FinishReason)
+	require.Equal(t, 40, final.UsageMetadata.PromptTokenCount)
+	require.Equal(t, 30, final.UsageMetadata.CachedContentTokenCount)
+	require.Equal(t, 25, final.UsageMetadata.CandidatesTokenCount)
+}
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -380,3 +382,10 @@ func TestRequestOpenAI2ClaudeMessage_ConvertsTextFileContentToText(t *testing.T)
 	require.NotNil(t, content[0].Text)
 	require.Equal(t, "alpha\nbeta", *content[0].Text)
 }
+
+func TestIsResponsesRequest(t *testing.T) {
+	require.True(t, isResponsesRequest(&relaycommon.RelayInfo{RequestConversionChain: []types.RelayFormat{types.RelayFormatOpenAIResponses, types.RelayFormatOpenAI}}))
+	require.False(t, isResponsesRequest(&relaycommon.RelayInfo{RequestConversionChain: []types.RelayFormat{types.RelayFormatOpenAI, types.RelayFormatOpenAIResponses}}))
+	require.False(t, isResponsesRequest(&relaycommon.RelayInfo{RequestConversionChain: []types.RelayFormat{types.RelayFormatClaude}}))
+	require.False(t, isResponsesRequest(&relaycommon.RelayInfo{}))
+}
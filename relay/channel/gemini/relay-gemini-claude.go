@@ -0,0 +1,714 @@
+package gemini
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Claude 与 Gemini 的直接转换，不经过 OpenAI 格式，以保留 thinking 签名、tool_use id、文档块与缓存用量。
+//
+// Gemini 的 thoughtSignature 可能挂在思考 part 上，也可能挂在其后的文本或函数调用 part 上：
+// 前者转换为带签名的 thinking 块，后者转换为 thinking 为空、仅带签名的 thinking 块并紧跟在对应内容之前。
+// 客户端原样回传后按相同规则还原到 Gemini 的 part 上。
+
+func geminiSafetySettings() []dto.GeminiChatSafetySettings {
+	safetySettings := make([]dto.GeminiChatSafetySettings, 0, len(SafetySettingList))
+	for _, category := range SafetySettingList {
+		safetySettings = append(safetySettings, dto.GeminiChatSafetySettings{
+			Category:  category,
+			Threshold: model_setting.GetGeminiSafetySetting(category),
+		})
+	}
+	return safetySettings
+}
+
+func encodeThoughtSignature(signature string) json.RawMessage {
+	return json.RawMessage(strconv.Quote(signature))
+}
+
+func decodeThoughtSignature(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var signature string
+	if err := common.Unmarshal(raw, &signature); err != nil {
+		return ""
+	}
+	return signature
+}
+
+// ConvertClaude2Gemini 将 Claude Messages 请求直接转换为 Gemini generateContent 请求
+func ConvertClaude2Gemini(c *gin.Context, claudeRequest *dto.ClaudeRequest, info *relaycommon.RelayInfo) (*dto.GeminiChatRequest, error) {
+	geminiRequest := dto.GeminiChatRequest{
+		Contents: make([]dto.GeminiChatContent, 0, len(claudeRequest.Messages)),
+		GenerationConfig: dto.GeminiChatGenerationConfig{
+			Temperature: claudeRequest.Temperature,
+			TopP:        claudeRequest.TopP,
+		},
+		SafetySettings: geminiSafetySettings(),
+	}
+	if claudeRequest.TopK != nil {
+		geminiRequest.GenerationConfig.TopK = common.GetPointer(float64(*claudeRequest.TopK))
+	}
+	if claudeRequest.MaxTokens != nil && *claudeRequest.MaxTokens > 0 {
+		geminiRequest.GenerationConfig.MaxOutputTokens = common.GetPointer(*claudeRequest.MaxTokens)
+	}
+	if stopSequences := claudeRequest.StopSequences; len(stopSequences) > 0 {
+		// Gemini supports up to 5 stop sequences
+		if len(stopSequences) > 5 {
+			stopSequences = stopSequences[:5]
+		}
+		geminiRequest.GenerationConfig.StopSequences = stopSequences
+	}
+	if model_setting.IsGeminiModelSupportImagine(info.UpstreamModelName) {
+		geminiRequest.GenerationConfig.ResponseModalities = []string{"TEXT", "IMAGE"}
+	}
+
+	if claudeRequest.Thinking != nil {
+		switch claudeRequest.Thinking.Type {
+		case "enabled":
+			geminiRequest.GenerationConfig.ThinkingConfig = &dto.GeminiThinkingConfig{IncludeThoughts: true}
+			if budget := claudeRequest.Thinking.GetBudgetTokens(); budget > 0 {
+				geminiRequest.GenerationConfig.ThinkingConfig.ThinkingBudget = common.GetPointer(clampThinkingBudget(info.UpstreamModelName, budget))
+			}
+		case "adaptive":
+			geminiRequest.GenerationConfig.ThinkingConfig = &dto.GeminiThinkingConfig{IncludeThoughts: true}
+		}
+	} else {
+		ThinkingAdaptor(&geminiRequest, info)
+	}
+
+	if err := convertClaudeTools2Gemini(claudeRequest, &geminiRequest); err != nil {
+		return nil, err
+	}
+
+	var systemParts []dto.GeminiPart
+	if claudeRequest.IsStringSystem() {
+		if system := claudeRequest.GetStringSystem(); system != "" {
+			systemParts = append(systemParts, dto.GeminiPart{Text: system})
+		}
+	} else {
+		for _, block := range claudeRequest.ParseSystem() {
+			if block.Type == dto.ContentTypeText && block.GetText() != "" {
+				systemParts = append(systemParts, dto.GeminiPart{Text: block.GetText()})
+			}
+		}
+	}
+	if len(systemParts) > 0 {
+		geminiRequest.SystemInstructions = &dto.GeminiChatContent{Parts: systemParts}
+	}
+
+	attachThoughtSignature := (info.ChannelType == constant.ChannelTypeGemini ||
+		info.ChannelType == constant.ChannelTypeVertexAi) &&
+		model_setting.GetGeminiSettings().FunctionCallThoughtSignatureEnabled
+
+	// Vertex 不接受 functionCall/functionResponse 的 id 字段
+	keepToolIDs := info.ChannelType != constant.ChannelTypeVertexAi
+
+	// tool_result 只携带 tool_use_id，Gemini 的 functionResponse 需要函数名
+	toolNames := make(map[string]string)
+	for _, message := range claudeRequest.Messages {
+		if message.IsStringContent() {
+			continue
+		}
+		blocks, _ := message.ParseContent()
+		for _, block := range blocks {
+			if block.Type == "tool_use" {
+				toolNames[block.Id] = block.Name
+			}
+		}
+	}
+
+	for _, message := range claudeRequest.Messages {
+		content := dto.GeminiChatContent{Role: "user"}
+		if message.Role == "assistant" {
+			content.Role = "model"
+		}
+		if message.IsStringContent() {
+			if text := message.GetStringContent(); text != "" {
+				content.Parts = append(content.Parts, dto.GeminiPart{Text: text})
+			}
+		} else {
+			blocks, err := message.ParseContent()
+			if err != nil {
+				return nil, fmt.Errorf("invalid content of %s message: %w", message.Role, err)
+			}
+			parts, err := convertClaudeBlocks2GeminiParts(c, blocks, toolNames, keepToolIDs)
+			if err != nil {
+				return nil, err
+			}
+			content.Parts = parts
+		}
+		if content.Role == "model" && attachThoughtSignature {
+			attachBypassThoughtSignature(content.Parts)
+		}
+		if len(content.Parts) > 0 {
+			geminiRequest.Contents = append(geminiRequest.Contents, content)
+		}
+	}
+	return &geminiRequest, nil
+}
+
+// attachBypassThoughtSignature 历史中的函数调用缺少签名时（如来自其他渠道的对话），使用占位签名避免 Gemini 拒绝请求
+func attachBypassThoughtSignature(parts []dto.GeminiPart) {
+	for i := range parts {
+		if parts[i].FunctionCall == nil {
+			continue
+		}
+		if len(parts[i].ThoughtSignature) == 0 {
+			parts[i].ThoughtSignature = encodeThoughtSignature(thoughtSignatureBypassValue)
+		}
+		return
+	}
+}
+
+func convertClaudeBlocks2GeminiParts(c *gin.Context, blocks []dto.ClaudeMediaMessage, toolNames map[string]string, keepToolIDs bool) ([]dto.GeminiPart, error) {
+	parts := make([]dto.GeminiPart, 0, len(blocks))
+	// 仅带签名的 thinking 块，签名属于其后的第一个非思考 part
+	pendingSignature := ""
+	appendPart := func(part dto.GeminiPart) {
+		if pendingSignature != "" && !part.Thought {
+			part.ThoughtSignature = encodeThoughtSignature(pendingSignature)
+			pendingSignature = ""
+		}
+		parts = append(parts, part)
+	}
+	for _, block := range blocks {
+		switch block.Type {
+		case dto.ContentTypeText:
+			if block.GetText() != "" {
+				appendPart(dto.GeminiPart{Text: block.GetText()})
+			}
+		case "thinking":
+			thinking := ""
+			if block.Thinking != nil {
+				thinking = *block.Thinking
+			}
+			if thinking == "" {
+				pendingSignature = block.Signature
+				continue
+			}
+			part := dto.GeminiPart{Text: thinking, Thought: true}
+			if block.Signature != "" {
+				part.ThoughtSignature = encodeThoughtSignature(block.Signature)
+			}
+			appendPart(part)
+		case "redacted_thinking":
+			// Gemini 无对应内容，丢弃
+		case "image", "document":
+			part, err := convertClaudeSource2GeminiPart(c, &block)
+			if err != nil {
+				return nil, err
+			}
+			if part != nil {
+				appendPart(*part)
+			}
+		case "tool_use":
+			args := block.Input
+			if args == nil {
+				args = map[string]any{}
+			}
+			call := &dto.FunctionCall{FunctionName: block.Name, Arguments: args}
+			if keepToolIDs {
+				call.ID = block.Id
+			}
+			appendPart(dto.GeminiPart{FunctionCall: call})
+		case "tool_result":
+			response, mediaParts, err := convertClaudeToolResult(c, &block)
+			if err != nil {
+				return nil, err
+			}
+			functionResponse := &dto.GeminiFunctionResponse{
+				Name:     toolNames[block.ToolUseId],
+				Response: response,
+			}
+			if keepToolIDs && block.ToolUseId != "" {
+				functionResponse.ID, err = common.Marshal(block.ToolUseId)
+				if err != nil {
+					return nil, err
+				}
+			}
+			appendPart(dto.GeminiPart{FunctionResponse: functionResponse})
+			for _, part := range mediaParts {
+				appendPart(part)
+			}
+		}
+	}
+	if pendingSignature != "" && len(parts) > 0 {
+		// 签名块之后没有内容，挂到最后一个 part 上，避免丢失
+		parts[len(parts)-1].ThoughtSignature = encodeThoughtSignature(pendingSignature)
+	}
+	return parts, nil
+}
+
+// convertClaudeSource2GeminiPart 转换 image / document 块，纯文本文档直接作为文本
+func convertClaudeSource2GeminiPart(c *gin.Context, block *dto.ClaudeMediaMessage) (*dto.GeminiPart, error) {
+	if block.Source == nil {
+		return nil, nil
+	}
+	switch block.Source.Type {
+	case "text":
+		text := common.Interface2String(block.Source.Data)
+		if text == "" {
+			return nil, nil
+		}
+		return &dto.GeminiPart{Text: text}, nil
+	case "content":
+		content := dto.ClaudeMediaMessage{Content: block.Source.Data}
+		text := content.GetStringContent()
+		if text == "" {
+			return nil, nil
+		}
+		return &dto.GeminiPart{Text: text}, nil
+	}
+	source := block.ToFileSource()
+	if source == nil {
+		return nil, nil
+	}
+	base64Data, mimeType, err := service.GetBase64Data(c, source, "formatting claude content for Gemini")
+	if err != nil {
+		return nil, fmt.Errorf("get file data from '%s' failed: %w", source.GetIdentifier(), err)
+	}
+	if _, ok := geminiSupportedMimeTypes[strings.ToLower(mimeType)]; !ok {
+		return nil, fmt.Errorf("mime type is not supported by Gemini: '%s', url: '%s', supported types are: %v", mimeType, source.GetIdentifier(), getSupportedMimeTypesList())
+	}
+	return &dto.GeminiPart{InlineData: &dto.GeminiInlineData{MimeType: mimeType, Data: base64Data}}, nil
+}
+
+// convertClaudeToolResult 转换 tool_result 内容，文本作为函数返回值，图片等媒体作为额外的 part
+func convertClaudeToolResult(c *gin.Context, block *dto.ClaudeMediaMessage) (map[string]any, []dto.GeminiPart, error) {
+	var text string
+	var mediaParts []dto.GeminiPart
+	if block.IsStringContent() {
+		text = block.GetStringContent()
+	} else {
+		var texts []string
+		for _, item := range block.ParseMediaContent() {
+			switch item.Type {
+			case dto.ContentTypeText:
+				texts = append(texts, item.GetText())
+			case "image", "document":
+				part, err := convertClaudeSource2GeminiPart(c, &item)
+				if err != nil {
+					return nil, nil, err
+				}
+				if part != nil {
+					mediaParts = append(mediaParts, *part)
+				}
+			}
+		}
+		text = strings.Join(texts, "\n")
+	}
+
+	key := "content"
+	if block.IsError {
+		key = "error"
+	}
+	var result any
+	if err := common.UnmarshalJsonStr(text, &result); err == nil {
+		if object, ok := result.(map[string]any); ok && !block.IsError {
+			return object, mediaParts, nil
+		}
+		return map[string]any{key: result}, mediaParts, nil
+	}
+	return map[string]any{key: text}, mediaParts, nil
+}
+
+func convertClaudeTools2Gemini(claudeRequest *dto.ClaudeRequest, geminiRequest *dto.GeminiChatRequest) error {
+	tools := claudeRequest.GetTools()
+	if len(tools) == 0 {
+		return nil
+	}
+	var functions []dto.FunctionRequest
+	var geminiTools []dto.GeminiChatTool
+	for _, item := range tools {
+		tool, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		toolType, _ := tool["type"].(string)
+		switch {
+		case strings.HasPrefix(toolType, "web_search"):
+			geminiTools = append(geminiTools, dto.GeminiChatTool{GoogleSearch: make(map[string]string)})
+			continue
+		case strings.HasPrefix(toolType, "code_execution"):
+			geminiTools = append(geminiTools, dto.GeminiChatTool{CodeExecution: make(map[string]string)})
+			continue
+		case toolType != "" && toolType != "custom":
+			// 其他 Claude 服务端工具（如 bash、text_editor）Gemini 无对应实现
+			return fmt.Errorf("claude tool type %s is not supported by Gemini", toolType)
+		}
+		name, _ := tool["name"].(string)
+		if name == "" {
+			return errors.New("tool name is required")
+		}
+		description, _ := tool["description"].(string)
+		var parameters any
+		if schema, ok := tool["input_schema"].(map[string]any); ok {
+			if props, hasProps := schema["properties"].(map[string]any); !hasProps || len(props) > 0 {
+				parameters = cleanFunctionParameters(schema)
+			}
+		}
+		functions = append(functions, dto.FunctionRequest{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		})
+	}
+	if len(functions) > 0 {
+		geminiTools = append(geminiTools, dto.GeminiChatTool{FunctionDeclarations: functions})
+	}
+	geminiRequest.SetTools(geminiTools)
+
+	if choice, ok := claudeRequest.ToolChoice.(map[string]any); ok {
+		config := &dto.ToolConfig{FunctionCallingConfig: &dto.FunctionCallingConfig{}}
+		switch choice["type"] {
+		case "any":
+			config.FunctionCallingConfig.Mode = "ANY"
+		case "tool":
+			config.FunctionCallingConfig.Mode = "ANY"
+			if name, ok := choice["name"].(string); ok && name != "" {
+				config.FunctionCallingConfig.AllowedFunctionNames = []string{name}
+			}
+		case "none":
+			config.FunctionCallingConfig.Mode = "NONE"
+		default:
+			config.FunctionCallingConfig.Mode = "AUTO"
+		}
+		geminiRequest.ToolConfig = config
+	}
+	return nil
+}
+
+func stopReasonGemini2Claude(finishReason string) string {
+	switch finishReason {
+	case "", "STOP":
+		return "end_turn"
+	case "MAX_TOKENS":
+		return "max_tokens"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// buildClaudeUsageFromGemini Gemini 的 promptTokenCount 包含缓存命中部分，Claude 的 input_tokens 不包含
+func buildClaudeUsageFromGemini(usage *dto.Usage) *dto.ClaudeUsage {
+	return &dto.ClaudeUsage{
+		InputTokens:          usage.PromptTokens - usage.PromptTokensDetails.CachedTokens,
+		CacheReadInputTokens: usage.PromptTokensDetails.CachedTokens,
+		OutputTokens:         usage.CompletionTokens,
+	}
+}
+
+func claudeMessageID(c *gin.Context) string {
+	return fmt.Sprintf("msg_%s", c.GetString(common.RequestIdKey))
+}
+
+func claudeToolUseID(call *dto.FunctionCall) string {
+	if call.ID != "" {
+		return call.ID
+	}
+	return fmt.Sprintf("toolu_%s", common.GetUUID())
+}
+
+func geminiPartText(part *dto.GeminiPart) string {
+	switch {
+	case part.InlineData != nil:
+		if strings.HasPrefix(part.InlineData.MimeType, "image") {
+			return "![image](data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data + ")"
+		}
+		return fmt.Sprintf("[media](data:%s;base64,%s)", part.InlineData.MimeType, part.InlineData.Data)
+	case part.ExecutableCode != nil:
+		return "```" + part.ExecutableCode.Language + "\n" + part.ExecutableCode.Code + "\n```\n"
+	case part.CodeExecutionResult != nil:
+		return "```output\n" + part.CodeExecutionResult.Output + "\n```\n"
+	}
+	return part.Text
+}
+
+func newClaudeSignatureBlock(signature string) dto.ClaudeMediaMessage {
+	return dto.ClaudeMediaMessage{Type: "thinking", Thinking: common.GetPointer(""), Signature: signature}
+}
+
+// responseGemini2Claude 转换非流式响应，相邻的思考或文本 part 合并为一个块
+func responseGemini2Claude(c *gin.Context, response *dto.GeminiChatResponse, info *relaycommon.RelayInfo, usage *dto.Usage) *dto.ClaudeResponse {
+	claudeResponse := &dto.ClaudeResponse{
+		Id:      claudeMessageID(c),
+		Type:    "message",
+		Role:    "assistant",
+		Model:   info.UpstreamModelName,
+		Content: make([]dto.ClaudeMediaMessage, 0),
+		Usage:   buildClaudeUsageFromGemini(usage),
+	}
+	finishReason := ""
+	hasToolUse := false
+	if len(response.Candidates) > 0 {
+		candidate := response.Candidates[0]
+		if candidate.FinishReason != nil {
+			finishReason = *candidate.FinishReason
+		}
+		lastType := ""
+		for i := range candidate.Content.Parts {
+			part := &candidate.Content.Parts[i]
+			signature := decodeThoughtSignature(part.ThoughtSignature)
+			switch {
+			case part.Thought:
+				if lastType == "thinking" {
+					last := &claudeResponse.Content[len(claudeResponse.Content)-1]
+					if last.Signature == "" {
+						*last.Thinking += part.Text
+						last.Signature = signature
+						continue
+					}
+				}
+				claudeResponse.Content = append(claudeResponse.Content, dto.ClaudeMediaMessage{
+					Type: "thinking", Thinking: common.GetPointer(part.Text), Signature: signature,
+				})
+				lastType = "thinking"
+			case part.FunctionCall != nil:
+				if signature != "" {
+					claudeResponse.Content = append(claudeResponse.Content, newClaudeSignatureBlock(signature))
+				}
+				args := part.FunctionCall.Arguments
+				if args == nil {
+					args = map[string]any{}
+				}
+				claudeResponse.Content = append(claudeResponse.Content, dto.ClaudeMediaMessage{
+					Type: "tool_use", Id: claudeToolUseID(part.FunctionCall), Name: part.FunctionCall.FunctionName, Input: args,
+				})
+				hasToolUse = true
+				lastType = "tool_use"
+			default:
+				text := geminiPartText(part)
+				if text == "" && signature == "" {
+					continue
+				}
+				if signature != "" {
+					claudeResponse.Content = append(claudeResponse.Content, newClaudeSignatureBlock(signature))
+				} else if lastType == dto.ContentTypeText {
+					last := &claudeResponse.Content[len(claudeResponse.Content)-1]
+					last.SetText(last.GetText() + text)
+					continue
+				}
+				block := dto.ClaudeMediaMessage{Type: dto.ContentTypeText}
+				block.SetText(text)
+				claudeResponse.Content = append(claudeResponse.Content, block)
+				lastType = dto.ContentTypeText
+			}
+		}
+	}
+	claudeResponse.StopReason = stopReasonGemini2Claude(finishReason)
+	if hasToolUse {
+		claudeResponse.StopReason = "tool_use"
+	}
+	return claudeResponse
+}
+
+// GeminiClaudeHandler 处理 Claude 格式请求的非流式响应
+func GeminiClaudeHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	service.CloseResponseBodyGracefully(resp)
+	if common.DebugEnabled {
+		println(string(responseBody))
+	}
+	var geminiResponse dto.GeminiChatResponse
+	if err := common.Unmarshal(responseBody, &geminiResponse); err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeBadResponseBody, http.StatusInternalServerError)
+	}
+	usage := buildUsageFromGeminiMetadata(geminiResponse.UsageMetadata, info.GetEstimatePromptTokens())
+	usage.UsageSemantic = "openai"
+	usage.UsageSource = "gemini"
+	if len(geminiResponse.Candidates) == 0 {
+		if geminiResponse.PromptFeedback != nil && geminiResponse.PromptFeedback.BlockReason != nil {
+			common.SetContextKey(c, constant.ContextKeyAdminRejectReason, fmt.Sprintf("gemini_block_reason=%s", *geminiResponse.PromptFeedback.BlockReason))
+			return nil, types.NewOpenAIError(
+				errors.New("request blocked by Gemini API: "+*geminiResponse.PromptFeedback.BlockReason),
+				types.ErrorCodePromptBlocked,
+				http.StatusBadRequest,
+			)
+		}
+		common.SetContextKey(c, constant.ContextKeyAdminRejectReason, "gemini_empty_candidates")
+		return nil, types.NewOpenAIError(errors.New("empty response from Gemini API"), types.ErrorCodeEmptyResponse, http.StatusInternalServerError)
+	}
+
+	claudeResponse := responseGemini2Claude(c, &geminiResponse, info, &usage)
+	responseBody, err = common.Marshal(claudeResponse)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	service.IOCopyBytesGracefully(c, resp, responseBody)
+	return &usage, nil
+}
+
+// claudeStreamState 记录流式转换中当前打开的内容块
+type claudeStreamState struct {
+	c         *gin.Context
+	index     int
+	openType  string // 当前打开的块类型：thinking、text，为空表示没有打开的块
+	toolUse   bool
+	finish    string
+	started   bool
+	messageID string
+}
+
+func (s *claudeStreamState) send(resp dto.ClaudeResponse) {
+	_ = helper.ClaudeData(s.c, resp)
+}
+
+func (s *claudeStreamState) closeBlock() {
+	if s.openType == "" {
+		return
+	}
+	s.send(*generateClaudeStopBlock(s.index))
+	s.index++
+	s.openType = ""
+}
+
+func (s *claudeStreamState) openBlock(blockType string, block *dto.ClaudeMediaMessage) {
+	if s.openType == blockType && blockType != "" {
+		return
+	}
+	s.closeBlock()
+	resp := dto.ClaudeResponse{Type: "content_block_start", ContentBlock: block}
+	resp.SetIndex(s.index)
+	s.send(resp)
+	s.openType = blockType
+}
+
+func (s *claudeStreamState) delta(delta *dto.ClaudeMediaMessage) {
+	resp := dto.ClaudeResponse{Type: "content_block_delta", Delta: delta}
+	resp.SetIndex(s.index)
+	s.send(resp)
+}
+
+// signatureBlock 发送仅带签名的 thinking 块
+func (s *claudeStreamState) signatureBlock(signature string) {
+	s.closeBlock()
+	s.openBlock("thinking", &dto.ClaudeMediaMessage{Type: "thinking", Thinking: common.GetPointer("")})
+	s.delta(&dto.ClaudeMediaMessage{Type: "signature_delta", Signature: signature})
+	s.closeBlock()
+}
+
+func generateClaudeStopBlock(index int) *dto.ClaudeResponse {
+	resp := &dto.ClaudeResponse{Type: "content_block_stop"}
+	resp.SetIndex(index)
+	return resp
+}
+
+func (s *claudeStreamState) handle(info *relaycommon.RelayInfo, response *dto.GeminiChatResponse) {
+	if !s.started {
+		s.started = true
+		message := &dto.ClaudeMediaMessage{
+			Id:    s.messageID,
+			Type:  "message",
+			Role:  "assistant",
+			Model: info.UpstreamModelName,
+			Usage: &dto.ClaudeUsage{InputTokens: info.GetEstimatePromptTokens()},
+		}
+		message.SetContent(make([]any, 0))
+		s.send(dto.ClaudeResponse{Type: "message_start", Message: message})
+	}
+	if len(response.Candidates) == 0 {
+		return
+	}
+	candidate := response.Candidates[0]
+	if candidate.FinishReason != nil {
+		s.finish = *candidate.FinishReason
+	}
+	for i := range candidate.Content.Parts {
+		part := &candidate.Content.Parts[i]
+		signature := decodeThoughtSignature(part.ThoughtSignature)
+		switch {
+		case part.Thought:
+			s.openBlock("thinking", &dto.ClaudeMediaMessage{Type: "thinking", Thinking: common.GetPointer("")})
+			if part.Text != "" {
+				s.delta(&dto.ClaudeMediaMessage{Type: "thinking_delta", Thinking: common.GetPointer(part.Text)})
+			}
+			if signature != "" {
+				s.delta(&dto.ClaudeMediaMessage{Type: "signature_delta", Signature: signature})
+				s.closeBlock()
+			}
+		case part.FunctionCall != nil:
+			if signature != "" {
+				s.signatureBlock(signature)
+			}
+			s.closeBlock()
+			s.openBlock("tool_use", &dto.ClaudeMediaMessage{
+				Type: "tool_use", Id: claudeToolUseID(part.FunctionCall), Name: part.FunctionCall.FunctionName, Input: map[string]any{},
+			})
+			args := part.FunctionCall.Arguments
+			if args == nil {
+				args = map[string]any{}
+			}
+			argsJson, err := common.Marshal(args)
+			if err == nil {
+				s.delta(&dto.ClaudeMediaMessage{Type: "input_json_delta", PartialJson: common.GetPointer(string(argsJson))})
+			}
+			s.closeBlock()
+			s.toolUse = true
+		default:
+			text := geminiPartText(part)
+			if signature != "" {
+				s.signatureBlock(signature)
+			}
+			if text == "" {
+				continue
+			}
+			s.openBlock(dto.ContentTypeText, &dto.ClaudeMediaMessage{Type: dto.ContentTypeText, Text: common.GetPointer("")})
+			s.delta(&dto.ClaudeMediaMessage{Type: "text_delta", Text: common.GetPointer(text)})
+		}
+	}
+}
+
+func (s *claudeStreamState) finishMessage(usage *dto.Usage) {
+	s.closeBlock()
+	stopReason := stopReasonGemini2Claude(s.finish)
+	if s.toolUse {
+		stopReason = "tool_use"
+	}
+	s.send(dto.ClaudeResponse{
+		Type:  "message_delta",
+		Usage: buildClaudeUsageFromGemini(usage),
+		Delta: &dto.ClaudeMediaMessage{StopReason: common.GetPointer(stopReason)},
+	})
+	s.send(dto.ClaudeResponse{Type: "message_stop"})
+}
+
+// GeminiClaudeStreamHandler 将 Gemini 流式响应直接转换为 Claude SSE 事件
+func GeminiClaudeStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response) (*dto.Usage, *types.NewAPIError) {
+	state := &claudeStreamState{c: c, messageID: claudeMessageID(c)}
+	usage, err := geminiStreamHandler(c, info, resp, func(data string, geminiResponse *dto.GeminiChatResponse) bool {
+		state.handle(info, geminiResponse)
+		return true
+	})
+	if err != nil {
+		return usage, err
+	}
+	usage.UsageSemantic = "openai"
+	usage.UsageSource = "gemini"
+	if state.started {
+		state.finishMessage(usage)
+	}
+	return usage, nil
+}
@@ -366,9 +366,10 @@ func CovertOpenAI2Gemini(c *gin.Context, textRequest dto.GeneralOpenAIRequest, i
 	geminiRequest.SafetySettings = safetySettings
 
 	// openaiContent.FuncToToolCalls()
-	if textRequest.Tools != nil {
+	if textRequest.Tools != nil || textRequest.WebSearchOptions != nil {
 		functions := make([]dto.FunctionRequest, 0, len(textRequest.Tools))
-		googleSearch := false
+		// web_search_options 对应 Gemini 的 Google 搜索工具
+		googleSearch := textRequest.WebSearchOptions != nil
 		codeExecution := false
 		urlContext := false
 		for _, tool := range textRequest.Tools {
@@ -1260,9 +1261,24 @@ func handleFinalStream(c *gin.Context, info *relaycommon.RelayInfo, resp *dto.Ch
 	return nil
 }
 
+// GeminiWebSearchRequestsContextKey 记录 Google 搜索 grounding 产生的搜索次数
+const GeminiWebSearchRequestsContextKey = "gemini_web_search_requests"
+
+// geminiWebSearchCount 统计响应中 grounding 使用的搜索查询数
+func geminiWebSearchCount(geminiResponse *dto.GeminiChatResponse) int {
+	count := 0
+	for _, candidate := range geminiResponse.Candidates {
+		if candidate.GroundingMetadata != nil {
+			count = max(count, len(candidate.GroundingMetadata.WebSearchQueries))
+		}
+	}
+	return count
+}
+
 func geminiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.Response, callback func(data string, geminiResponse *dto.GeminiChatResponse) bool) (*dto.Usage, *types.NewAPIError) {
 	var usage = &dto.Usage{}
 	var imageCount int
+	var webSearchCount int
 	responseText := strings.Builder{}
 
 	helper.StreamScannerHandler(c, resp, info, func(data string, sr *helper.StreamResult) {
@@ -1293,6 +1309,7 @@ func geminiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 			mappedUsage := buildUsageFromGeminiMetadata(geminiResponse.UsageMetadata, info.GetEstimatePromptTokens())
 			*usage = mappedUsage
 		}
+		webSearchCount = max(webSearchCount, geminiWebSearchCount(&geminiResponse))
 
 		if !callback(data, &geminiResponse) {
 			sr.Stop(fmt.Errorf("gemini callback stopped"))
@@ -1304,6 +1321,9 @@ func geminiStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http
 			usage.CompletionTokens = imageCount * 1400
 		}
 	}
+	if webSearchCount > 0 {
+		c.Set(GeminiWebSearchRequestsContextKey, webSearchCount)
+	}
 
 	if usage.CompletionTokens <= 0 {
 		if info.ReceivedResponseCount > 0 {
@@ -1455,6 +1475,9 @@ func GeminiChatHandler(c *gin.Context, info *relaycommon.RelayInfo, resp *http.R
 		}
 		return &usage, nil
 	}
+	if webSearchCount := geminiWebSearchCount(&geminiResponse); webSearchCount > 0 {
+		c.Set(GeminiWebSearchRequestsContextKey, webSearchCount)
+	}
 	fullTextResponse := responseGeminiChat2OpenAI(c, &geminiResponse)
 	fullTextResponse.Model = info.UpstreamModelName
 	usage := buildUsageFromGeminiMetadata(geminiResponse.UsageMetadata, info.GetEstimatePromptTokens())
@@ -0,0 +1,145 @@
+package gemini
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertClaude2GeminiRestoresSignaturesAndToolNames(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatClaude,
+		OriginModelName: "gemini-2.5-pro",
+		ChannelMeta: &relaycommon.ChannelMeta{
+			UpstreamModelName: "gemini-2.5-pro",
+		},
+	}
+
+	var request dto.ClaudeRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"model": "gemini-2.5-pro",
+		"max_tokens": 1024,
+		"system": [{"type": "text", "text": "be brief"}],
+		"thinking": {"type": "enabled", "budget_tokens": 2048},
+		"tools": [{"name": "get_weather", "input_schema": {"type": "object", "properties": {"city": {"type": "string"}}}}],
+		"tool_choice": {"type": "tool", "name": "get_weather"},
+		"messages": [
+			{"role": "user", "content": "weather in Paris?"},
+			{"role": "assistant", "content": [
+				{"type": "thinking", "thinking": "need a tool", "signature": "sig-thought"},
+				{"type": "thinking", "thinking": "", "signature": "sig-call"},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": "{\"temp\": 20}"}
+			]}
+		]
+	}`, &request))
+
+	geminiRequest, err := ConvertClaude2Gemini(c, &request, info)
+	require.NoError(t, err)
+
+	require.NotNil(t, geminiRequest.SystemInstructions)
+	require.Equal(t, "be brief", geminiRequest.SystemInstructions.Parts[0].Text)
+	require.NotNil(t, geminiRequest.GenerationConfig.ThinkingConfig)
+	require.True(t, geminiRequest.GenerationConfig.ThinkingConfig.IncludeThoughts)
+	require.Equal(t, []string{"get_weather"}, geminiRequest.ToolConfig.FunctionCallingConfig.AllowedFunctionNames)
+
+	require.Len(t, geminiRequest.Contents, 3)
+	model := geminiRequest.Contents[1]
+	require.Equal(t, "model", model.Role)
+	require.Len(t, model.Parts, 2)
+	require.True(t, model.Parts[0].Thought)
+	require.Equal(t, "sig-thought", decodeThoughtSignature(model.Parts[0].ThoughtSignature))
+	require.NotNil(t, model.Parts[1].FunctionCall)
+	require.Equal(t, "toolu_1", model.Parts[1].FunctionCall.ID)
+	require.Equal(t, "sig-call", decodeThoughtSignature(model.Parts[1].ThoughtSignature))
+
+	toolResult := geminiRequest.Contents[2].Parts[0].FunctionResponse
+	require.NotNil(t, toolResult)
+	require.Equal(t, "get_weather", toolResult.Name)
+	require.EqualValues(t, 20, toolResult.Response["temp"])
+	require.JSONEq(t, `"toolu_1"`, string(toolResult.ID))
+
+	info.ChannelType = constant.ChannelTypeVertexAi
+	geminiRequest, err = ConvertClaude2Gemini(c, &request, info)
+	require.NoError(t, err)
+	require.Empty(t, geminiRequest.Contents[1].Parts[1].FunctionCall.ID)
+	require.Empty(t, geminiRequest.Contents[2].Parts[0].FunctionResponse.ID)
+}
+
+func TestGeminiClaudeHandlerPreservesSignaturesToolIdsAndCacheUsage(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	info := &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatClaude,
+		OriginModelName: "gemini-2.5-pro",
+		ChannelMeta: &relaycommon.ChannelMeta{
+			UpstreamModelName: "gemini-2.5-pro",
+		},
+	}
+
+	payload := dto.GeminiChatResponse{
+		Candidates: []dto.GeminiChatCandidate{
+			{
+				Content: dto.GeminiChatContent{
+					Role: "model",
+					Parts: []dto.GeminiPart{
+						{Text: "thinking...", Thought: true},
+						{
+							FunctionCall:     &dto.FunctionCall{FunctionName: "get_weather", Arguments: map[string]any{"city": "Paris"}, ID: "call_1"},
+							ThoughtSignature: encodeThoughtSignature("sig-call"),
+						},
+					},
+				},
+				FinishReason: common.GetPointer("STOP"),
+			},
+		},
+		UsageMetadata: dto.GeminiUsageMetadata{
+			PromptTokenCount:        100,
+			CachedContentTokenCount: 40,
+			CandidatesTokenCount:    10,
+			TotalTokenCount:         110,
+		},
+	}
+	body, err := common.Marshal(payload)
+	require.NoError(t, err)
+
+	usage, newAPIError := GeminiClaudeHandler(c, info, &http.Response{Body: io.NopCloser(bytes.NewReader(body))})
+	require.Nil(t, newAPIError)
+	require.Equal(t, 100, usage.PromptTokens)
+	require.Equal(t, "openai", usage.UsageSemantic)
+
+	var claudeResponse dto.ClaudeResponse
+	require.NoError(t, common.Unmarshal(recorder.Body.Bytes(), &claudeResponse))
+	require.Equal(t, "tool_use", claudeResponse.StopReason)
+	require.Len(t, claudeResponse.Content, 3)
+	require.Equal(t, "thinking", claudeResponse.Content[0].Type)
+	require.Equal(t, "thinking", claudeResponse.Content[1].Type)
+	require.Equal(t, "sig-call", claudeResponse.Content[1].Signature)
+	require.Equal(t, "tool_use", claudeResponse.Content[2].Type)
+	require.Equal(t, "call_1", claudeResponse.Content[2].Id)
+	require.Equal(t, 60, claudeResponse.Usage.InputTokens)
+	require.Equal(t, 40, claudeResponse.Usage.CacheReadInputTokens)
+}
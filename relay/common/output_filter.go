@@ -0,0 +1,78 @@
+package common
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrOutputFiltered 输出过滤器要求停止生成时记录到流状态中的错误
+var ErrOutputFiltered = errors.New("output stopped by content filter")
+
+// OutputContentFilter 过滤上游返回的模型输出内容，由 service 层按请求创建并放入上下文
+type OutputContentFilter interface {
+	// FilterStreamData 过滤一条上游 SSE 数据，返回替换后的数据；stop 为 true 时应在转发本条数据后停止生成
+	FilterStreamData(data string) (result string, stop bool)
+}
+
+// OutputStreamFlusher 由暂存了流式文本的输出过滤器实现，用于在一路输出结束前以及流结束时补发暂存的文本
+type OutputStreamFlusher interface {
+	// FlushStreamData 返回需要在 data 之前转发的数据
+	FlushStreamData(data string) []string
+	// FlushStreamEnd 返回流结束时仍需转发的数据
+	FlushStreamEnd() []string
+}
+
+// outputFilterKeys 输出过滤器在上下文中的键，按顺序执行：先还原脱敏占位符，再检查屏蔽词
+var outputFilterKeys = []constant.ContextKey{constant.ContextKeyPIIRedactor, constant.ContextKeyOutputFilter}
+
+// GetOutputContentFilters 返回当前请求启用的输出过滤器
+func GetOutputContentFilters(c *gin.Context) []OutputContentFilter {
+	filters := make([]OutputContentFilter, 0, len(outputFilterKeys))
+	for _, key := range outputFilterKeys {
+		if filter, ok := common.GetContextKeyType[OutputContentFilter](c, key); ok && filter != nil {
+			filters = append(filters, filter)
+		}
+	}
+	return filters
+}
+
+// FilterStreamPayloads 依次执行输出过滤器，返回需要按顺序转发的数据以及是否需要停止生成；
+// 过滤器补发的数据只交给其后的过滤器处理
+func FilterStreamPayloads(filters []OutputContentFilter, payloads []string) ([]string, bool) {
+	stop := false
+	for _, filter := range filters {
+		payloads, stop = filterStreamPayloads(filter, payloads, stop)
+	}
+	return payloads, stop
+}
+
+// FlushStreamPayloads 在流结束时收集各过滤器暂存的数据，返回需要按顺序转发的数据以及是否需要停止生成
+func FlushStreamPayloads(filters []OutputContentFilter) ([]string, bool) {
+	var payloads []string
+	stop := false
+	for _, filter := range filters {
+		payloads, stop = filterStreamPayloads(filter, payloads, stop)
+		if flusher, ok := filter.(OutputStreamFlusher); ok {
+			payloads = append(payloads, flusher.FlushStreamEnd()...)
+		}
+	}
+	return payloads, stop
+}
+
+func filterStreamPayloads(filter OutputContentFilter, payloads []string, stop bool) ([]string, bool) {
+	flusher, _ := filter.(OutputStreamFlusher)
+	next := make([]string, 0, len(payloads))
+	for _, data := range payloads {
+		if flusher != nil {
+			next = append(next, flusher.FlushStreamData(data)...)
+		}
+		filtered, s := filter.FilterStreamData(data)
+		stop = stop || s
+		next = append(next, filtered)
+	}
+	return next, stop
+}
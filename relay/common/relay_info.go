@@ -4,6 +4,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -128,8 +131,10 @@ type RelayInfo struct {
 	// 免费模型时为 nil。
 	Billing BillingSettler
 	// BillingSource indicates whether this request is billed from wallet quota or subscription.
-	// "" or "wallet" => wallet; "subscription" => subscription
+	// "" or "wallet" => wallet; "subscription" => subscription; "organization" => organization wallet
 	BillingSource string
+	// OrganizationId is the organization whose shared wallet pays for this request (token bound to an organization).
+	OrganizationId int
 	// SubscriptionId is the user_subscriptions.id used when BillingSource == "subscription"
 	SubscriptionId int
 	// SubscriptionPreConsumed is the amount pre-consumed on subscription item (quota units or 1)
@@ -462,6 +467,7 @@ func genBaseRelayInfo(c *gin.Context, request dto.Request) *RelayInfo {
 		TokenKey:       common.GetContextKeyString(c, constant.ContextKeyTokenKey),
 		TokenUnlimited: common.GetContextKeyBool(c, constant.ContextKeyTokenUnlimited),
 		TokenGroup:     tokenGroup,
+		OrganizationId: common.GetContextKeyInt(c, constant.ContextKeyTokenOrganizationId),
 
 		isFirstResponse: true,
 		RelayMode:       relayconstant.Path2RelayMode(c.Request.URL.Path),
@@ -652,6 +658,63 @@ func (info *RelayInfo) HasSendResponse() bool {
 	return info.FirstResponseTime.After(info.StartTime)
 }
 
+// Clone 复制一份可与原 RelayInfo 并发使用的副本（如对冲请求），请求体与转换过程中会修改的状态均为独立副本。
+// 计费会话不会复制，副本需要自行预扣费。
+func (info *RelayInfo) Clone() (*RelayInfo, error) {
+	clone := *info
+	clone.Billing = nil
+	if info.Request != nil {
+		requestType := reflect.TypeOf(info.Request)
+		if requestType.Kind() != reflect.Ptr {
+			return nil, fmt.Errorf("unexpected request type: %s", requestType)
+		}
+		data, err := common.Marshal(info.Request)
+		if err != nil {
+			return nil, err
+		}
+		request, ok := reflect.New(requestType.Elem()).Interface().(dto.Request)
+		if !ok {
+			return nil, fmt.Errorf("unexpected request type: %s", requestType)
+		}
+		if err := common.Unmarshal(data, request); err != nil {
+			return nil, err
+		}
+		clone.Request = request
+	}
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		clone.ChannelMeta = &channelMeta
+	}
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		clone.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		tools := make(map[string]*BuildInToolInfo, len(info.ResponsesUsageInfo.BuiltInTools))
+		for name, tool := range info.ResponsesUsageInfo.BuiltInTools {
+			toolCopy := *tool
+			tools[name] = &toolCopy
+		}
+		clone.ResponsesUsageInfo = &ResponsesUsageInfo{BuiltInTools: tools}
+	}
+	if info.RerankerInfo != nil {
+		rerankerInfo := *info.RerankerInfo
+		clone.RerankerInfo = &rerankerInfo
+	}
+	if info.TaskRelayInfo != nil {
+		taskRelayInfo := *info.TaskRelayInfo
+		clone.TaskRelayInfo = &taskRelayInfo
+	}
+	clone.RequestHeaders = maps.Clone(info.RequestHeaders)
+	clone.RuntimeHeadersOverride = maps.Clone(info.RuntimeHeadersOverride)
+	clone.PriceData.OtherRatios = maps.Clone(info.PriceData.OtherRatios)
+	clone.ParamOverrideAudit = slices.Clone(info.ParamOverrideAudit)
+	clone.RealtimeTools = slices.Clone(info.RealtimeTools)
+	clone.StreamStatus = nil
+	clone.RequestConversionChain = append([]types.RelayFormat(nil), info.RequestConversionChain...)
+	return &clone, nil
+}
+
 type TaskRelayInfo struct {
 	Action       string
 	OriginTaskID string
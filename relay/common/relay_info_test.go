@@ -38,3 +38,28 @@ func TestRelayInfoGetFinalRequestRelayFormatNilReceiver(t *testing.T) {
 	var info *RelayInfo
 	require.Equal(t, types.RelayFormat(""), info.GetFinalRequestRelayFormat())
 }
+
+type stubBillingSettler struct{ BillingSettler }
+
+func TestRelayInfoCloneDoesNotShareMutableState(t *testing.T) {
+	info := &RelayInfo{
+		Billing:                &stubBillingSettler{},
+		RequestHeaders:         map[string]string{"X-Test": "1"},
+		RuntimeHeadersOverride: map[string]interface{}{"X-Override": "1"},
+		PriceData:              types.PriceData{OtherRatios: map[string]float64{"seconds": 2}},
+		ChannelMeta:            &ChannelMeta{ChannelId: 1},
+	}
+
+	clone, err := info.Clone()
+	require.NoError(t, err)
+	require.Nil(t, clone.Billing)
+
+	clone.RequestHeaders["X-Test"] = "2"
+	clone.RuntimeHeadersOverride["X-Override"] = "2"
+	clone.PriceData.AddOtherRatio("size", 3)
+	clone.ChannelId = 2
+	require.Equal(t, "1", info.RequestHeaders["X-Test"])
+	require.Equal(t, "1", info.RuntimeHeadersOverride["X-Override"])
+	require.NotContains(t, info.PriceData.OtherRatios, "size")
+	require.Equal(t, 1, info.ChannelId)
+}
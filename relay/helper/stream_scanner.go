@@ -195,15 +195,31 @@ func StreamScannerHandler(c *gin.Context, resp *http.Response, info *relaycommon
 			common.SafeSendBool(stopChan, true)
 		}()
 		sr := newStreamResult(info.StreamStatus)
+		outputFilters := relaycommon.GetOutputContentFilters(c)
+		// handle 转发过滤后的数据，返回是否需要停止
+		handle := func(payloads []string, filtered bool) bool {
+			for _, data := range payloads {
+				sr.reset()
+				writeMutex.Lock()
+				dataHandler(data, sr)
+				writeMutex.Unlock()
+				if sr.IsStopped() {
+					return true
+				}
+			}
+			if filtered {
+				sr.Stop(relaycommon.ErrOutputFiltered)
+				return true
+			}
+			return false
+		}
 		for data := range dataChan {
-			sr.reset()
-			writeMutex.Lock()
-			dataHandler(data, sr)
-			writeMutex.Unlock()
-			if sr.IsStopped() {
+			if handle(relaycommon.FilterStreamPayloads(outputFilters, []string{data})) {
 				return
 			}
 		}
+		// 上游结束后补发输出过滤器暂存的文本
+		handle(relaycommon.FlushStreamPayloads(outputFilters))
 	})
 
 	// Scanner goroutine with improved error handling
@@ -0,0 +1,64 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RealtimeBridgeAudioHelper Realtime 桥接模式在当前渠道上执行语音识别或语音合成，
+// 响应写入 c.Writer，返回的用量由调用方按 Realtime 用量计费
+func RealtimeBridgeAudioHelper(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Usage, *types.NewAPIError) {
+	return relayAudio(c, info)
+}
+
+// RealtimeBridgeChatHelper Realtime 桥接模式在当前渠道上执行一次非流式 Chat Completions 请求，
+// 渠道可以是任意类型，响应统一为 OpenAI 格式写入 c.Writer，返回的用量由调用方按 Realtime 用量计费
+func RealtimeBridgeChatHelper(c *gin.Context, info *relaycommon.RelayInfo) (*dto.Usage, *types.NewAPIError) {
+	info.InitChannelMeta(c)
+
+	chatReq, ok := info.Request.(*dto.GeneralOpenAIRequest)
+	if !ok {
+		return nil, types.NewError(errors.New("invalid request type"), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+	request, err := common.DeepCopy(chatReq)
+	if err != nil {
+		return nil, types.NewError(fmt.Errorf("failed to copy request to GeneralOpenAIRequest: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
+	}
+	if err = helper.ModelMappedHelper(c, info, request); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+	if err = service.ApplyChannelPIIRedaction(c, info, request); err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return nil, types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
+	}
+	adaptor.Init(info)
+	applySystemPromptIfNeeded(c, info, request)
+
+	httpResp, newAPIError := doChatCompletionsRequest(c, info, adaptor, request)
+	if newAPIError != nil {
+		return nil, newAPIError
+	}
+	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, c.GetString("status_code_mapping"))
+		return nil, newAPIError
+	}
+	usageDto, _ := usage.(*dto.Usage)
+	if usageDto == nil {
+		usageDto = &dto.Usage{}
+	}
+	return usageDto, nil
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// expandConversation 将网关本地会话中的会话项展开到请求输入之前，返回请求引用的会话。
+// 会话由网关保存，与渠道无关，因此无论上游是否原生支持 Responses API 都在本地展开
+func expandConversation(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) (*model.Conversation, *types.NewAPIError) {
+	if len(request.Conversation) == 0 || common.GetJsonType(request.Conversation) == "null" {
+		return nil, nil
+	}
+	if !operation_setting.GetConversationSetting().Enabled {
+		return nil, types.NewErrorWithStatusCode(errors.New("conversation is not enabled"), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	conversationId, err := service.ParseConversationID(request.Conversation)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if request.PreviousResponseID != "" {
+		return nil, types.NewErrorWithStatusCode(
+			errors.New("previous_response_id and conversation cannot be used together"),
+			types.ErrorCodeInvalidRequest,
+			http.StatusBadRequest,
+			types.ErrOptionWithSkipRetry(),
+		)
+	}
+	conversation, err := service.GetConversation(info.UserId, conversationId)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if conversation == nil {
+		return nil, types.NewErrorWithStatusCode(
+			fmt.Errorf("Conversation with id '%s' not found.", conversationId),
+			types.ErrorCodeInvalidRequest,
+			http.StatusNotFound,
+			types.ErrOptionWithSkipRetry(),
+		)
+	}
+
+	history, err := service.LoadConversationInput(conversation)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	inputItems, err := service.ParseResponsesInputItems(request.Input)
+	if err != nil {
+		return nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	input, err := common.Marshal(append(history, inputItems...))
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	request.Input = input
+	request.Conversation = nil
+	return conversation, nil
+}
+
+// appendToConversation 将本次请求的原始输入与响应输出追加到会话
+func appendToConversation(conversation *model.Conversation, request *dto.OpenAIResponsesRequest, responseJSON []byte) {
+	if conversation == nil || len(responseJSON) == 0 {
+		return
+	}
+	inputItems, err := service.ParseResponsesInputItems(request.Input)
+	if err != nil {
+		return
+	}
+	service.AppendResponseToConversation(conversation, inputItems, responseJSON)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	appconstant "github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
 	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
@@ -65,18 +66,61 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	passThrough := model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled
+	viaChat := info.RelayMode == relayconstant.RelayModeResponses && responsesViaChatCompletionsEnabled(info.ApiType)
+	// 本地保存的是展开前的原始输入，展开需在脱敏之前完成
+	var conversation *model.Conversation
+	if info.RelayMode == relayconstant.RelayModeResponses {
+		// 会话只存在于网关本地，上游无法识别会话 id，透传时同样需要展开，展开后改为发送转换后的请求
+		if conversation, newAPIError = expandConversation(info, request); newAPIError != nil {
+			return newAPIError
+		}
+		if conversation != nil {
+			passThrough = false
+		}
+		if viaChat || !passThrough {
+			if newAPIError = expandPreviousResponse(info, request, viaChat); newAPIError != nil {
+				return newAPIError
+			}
+		}
+	}
+
+	if info.RelayMode == relayconstant.RelayModeResponses {
+		service.SetResponsesStoreHook(c, func(responseJSON []byte) {
+			saveStoredResponse(info, responsesReq, responseJSON)
+		})
+	}
+
+	if err = service.ApplyChannelPIIRedaction(c, info, request); err != nil {
+		return types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
 	adaptor := GetAdaptor(info.ApiType)
 	if adaptor == nil {
 		return types.NewError(fmt.Errorf("invalid api type: %d", info.ApiType), types.ErrorCodeInvalidApiType, types.ErrOptionWithSkipRetry())
 	}
 	adaptor.Init(info)
+
+	if viaChat {
+		usage, responseJSON, newAPIError := responsesViaChatCompletions(c, info, adaptor, request, responsesReq)
+		if newAPIError != nil {
+			return newAPIError
+		}
+		appendToConversation(conversation, responsesReq, responseJSON)
+		service.PostTextConsumeQuota(c, info, usage, nil)
+		return nil
+	}
+
 	var requestBody io.Reader
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+	if passThrough {
 		storage, err := common.GetBodyStorage(c)
 		if err != nil {
 			return types.NewError(err, types.ErrorCodeReadRequestBodyFailed, types.ErrOptionWithSkipRetry())
 		}
-		requestBody = common.ReaderOnly(storage)
+		requestBody, err = service.PassThroughRequestBody(c, storage)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
 	} else {
 		convertedRequest, err := adaptor.ConvertOpenAIResponsesRequest(c, info, *request)
 		if err != nil {
@@ -152,6 +196,10 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return nil
 	}
 
+	if raw, ok := common.GetContextKeyType[[]byte](c, appconstant.ContextKeyResponsesFinalResponse); ok {
+		appendToConversation(conversation, responsesReq, raw)
+	}
+
 	if strings.HasPrefix(info.OriginModelName, "gpt-4o-audio") {
 		service.PostAudioConsumeQuota(c, info, usageDto, "")
 	} else {
@@ -159,3 +207,12 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 	}
 	return nil
 }
+
+// saveStoredResponse 在本地保存响应，以便后续通过 previous_response_id 与 GET /v1/responses/{id} 访问
+func saveStoredResponse(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest, responseJSON []byte) {
+	inputItems, err := service.ParseResponsesInputItems(request.Input)
+	if err != nil {
+		return
+	}
+	service.SaveStoredResponse(info.UserId, info.ChannelId, request, inputItems, responseJSON)
+}
@@ -0,0 +1,184 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/relay/channel/gemini"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responsesViaChatCompletionsEnabled 上游不支持 Responses API 的渠道类型，由网关经 Chat Completions 转换实现
+func responsesViaChatCompletionsEnabled(apiType int) bool {
+	switch apiType {
+	case constant.APITypeAnthropic, constant.APITypeGemini, constant.APITypeVertexAi:
+		return true
+	}
+	return false
+}
+
+// expandPreviousResponse 使用本地保存的历史展开 previous_response_id。
+// 经由 Chat Completions 转发时总是展开；原生 Responses 上游仅在历史来自其他渠道时展开，
+// 同一渠道或本地不存在记录时保留 previous_response_id 交由上游处理。
+func expandPreviousResponse(info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest, viaChat bool) *types.NewAPIError {
+	if request.PreviousResponseID == "" {
+		return nil
+	}
+	history, record, err := service.LoadResponsesHistory(info.UserId, request.PreviousResponseID)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if record == nil {
+		if !viaChat {
+			return nil
+		}
+		return types.NewErrorWithStatusCode(
+			fmt.Errorf("Previous response with id '%s' not found.", request.PreviousResponseID),
+			types.ErrorCodeInvalidRequest,
+			http.StatusNotFound,
+			types.ErrOptionWithSkipRetry(),
+		)
+	}
+	if !viaChat && record.ChannelId == info.ChannelId {
+		return nil
+	}
+
+	inputItems, err := service.ParseResponsesInputItems(request.Input)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	input, err := common.Marshal(append(history, inputItems...))
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	request.Input = input
+	request.PreviousResponseID = ""
+	return nil
+}
+
+// responsesWebSearchItems 统计渠道的联网搜索次数：Gemini 的 Google 搜索按 web_search_preview 计费，
+// Claude 的联网搜索已由 claude_web_search_requests 单独计费，这里只生成输出记录
+func responsesWebSearchItems(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) []map[string]any {
+	count := c.GetInt("claude_web_search_requests")
+	if geminiCount := c.GetInt(gemini.GeminiWebSearchRequestsContextKey); geminiCount > 0 {
+		count = geminiCount
+		if info.ResponsesUsageInfo != nil {
+			tool, ok := info.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview]
+			if !ok || tool == nil {
+				searchContextSize := "medium"
+				if request.WebSearchOptions != nil && request.WebSearchOptions.SearchContextSize != "" {
+					searchContextSize = request.WebSearchOptions.SearchContextSize
+				}
+				tool = &relaycommon.BuildInToolInfo{ToolName: dto.BuildInToolWebSearchPreview, SearchContextSize: searchContextSize}
+				info.ResponsesUsageInfo.BuiltInTools[dto.BuildInToolWebSearchPreview] = tool
+			}
+			tool.CallCount = geminiCount
+		}
+	}
+	items := make([]map[string]any, 0, count)
+	for i := 0; i < count; i++ {
+		items = append(items, service.NewWebSearchCallItem())
+	}
+	return items
+}
+
+// responsesViaChatCompletions 将 Responses 请求转换为 Chat Completions 请求发往渠道，
+// 并把渠道输出的 Chat Completions 响应转换回 Responses 格式，返回用量与最终响应 JSON。
+// originRequest 为客户端原始请求，用于回显响应中的请求参数
+func responsesViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, request *dto.OpenAIResponsesRequest, originRequest *dto.OpenAIResponsesRequest) (*dto.Usage, []byte, *types.NewAPIError) {
+	chatReq, err := service.ResponsesRequestToChatCompletionsRequest(request)
+	if err != nil {
+		return nil, nil, types.NewErrorWithStatusCode(err, types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	applySystemPromptIfNeeded(c, info, chatReq)
+	info.AppendRequestConversion(types.RelayFormatOpenAI)
+
+	savedRelayMode := info.RelayMode
+	savedRelayFormat := info.RelayFormat
+	savedRequestURLPath := info.RequestURLPath
+	defer func() {
+		info.RelayMode = savedRelayMode
+		info.RelayFormat = savedRelayFormat
+		info.RequestURLPath = savedRequestURLPath
+	}()
+
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RelayFormat = types.RelayFormatOpenAI
+	info.RequestURLPath = "/v1/chat/completions"
+
+	httpResp, newAPIError := doChatCompletionsRequest(c, info, adaptor, chatReq)
+	if newAPIError != nil {
+		return nil, nil, newAPIError
+	}
+	statusCodeMappingStr := c.GetString("status_code_mapping")
+
+	responseID := "resp_" + common.GetUUID()
+	writer := service.NewResponsesChatWriter(c, service.NewResponsesResponse(responseID, originRequest, info.OriginModelName), info.IsStream)
+	defer writer.Restore(c)
+
+	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	if newAPIError != nil {
+		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
+		return nil, nil, newAPIError
+	}
+	usageDto, _ := usage.(*dto.Usage)
+
+	responseJSON, err := writer.Finish(c, usageDto, responsesWebSearchItems(c, info, chatReq))
+	if err != nil {
+		return nil, nil, types.NewError(err, types.ErrorCodeBadResponseBody)
+	}
+	return usageDto, responseJSON, nil
+}
+
+// doChatCompletionsRequest 将 Chat Completions 请求转换为渠道格式并发出，返回状态码为 200 的上游响应
+func doChatCompletionsRequest(c *gin.Context, info *relaycommon.RelayInfo, adaptor channel.Adaptor, chatReq *dto.GeneralOpenAIRequest) (*http.Response, *types.NewAPIError) {
+	convertedRequest, err := adaptor.ConvertOpenAIRequest(c, info, chatReq)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	relaycommon.AppendRequestConversionFromRequest(info, convertedRequest)
+
+	jsonData, err := common.Marshal(convertedRequest)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	jsonData, err = relaycommon.RemoveDisabledFields(jsonData, info.ChannelOtherSettings, info.ChannelSetting.PassThroughBodyEnabled)
+	if err != nil {
+		return nil, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	if len(info.ParamOverride) > 0 {
+		jsonData, err = relaycommon.ApplyParamOverrideWithRelayInfo(jsonData, info)
+		if err != nil {
+			return nil, newAPIErrorFromParamOverride(err)
+		}
+	}
+	if common.DebugEnabled {
+		println("requestBody: ", string(jsonData))
+	}
+
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, types.NewOpenAIError(err, types.ErrorCodeDoRequestFailed, http.StatusInternalServerError)
+	}
+	if resp == nil {
+		return nil, types.NewOpenAIError(nil, types.ErrorCodeBadResponse, http.StatusInternalServerError)
+	}
+
+	httpResp := resp.(*http.Response)
+	if httpResp.StatusCode != http.StatusOK {
+		newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+		service.ResetStatusCode(newAPIError, c.GetString("status_code_mapping"))
+		return nil, newAPIError
+	}
+	return httpResp, nil
+}
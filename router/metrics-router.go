@@ -0,0 +1,17 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+func SetMetricsRouter(router *gin.Engine) {
+	metricsRouter := router.Group("/metrics")
+	metricsRouter.Use(middleware.RouteTag("metrics"))
+	metricsRouter.Use(middleware.MetricsAuth())
+	{
+		metricsRouter.GET("", gin.WrapH(metrics.Handler()))
+	}
+}
@@ -79,6 +79,37 @@ func SetRelayRouter(router *gin.Engine) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
 	}
+	{
+		// files & batches: 上传时按模型分发渠道，之后的请求固定转发到文件/批处理所在的渠道
+		fileRouter := relayV1Router.Group("")
+		fileRouter.POST("/files", middleware.Distribute(), controller.RelayFileUpload)
+		fileRouter.GET("/files", controller.RelayFileList)
+		fileRouter.GET("/files/:id", controller.RelayFileRetrieve)
+		fileRouter.DELETE("/files/:id", controller.RelayFileDelete)
+		fileRouter.GET("/files/:id/content", controller.RelayFileContent)
+		fileRouter.POST("/batches", controller.RelayBatchCreate)
+		fileRouter.GET("/batches", controller.RelayBatchList)
+		fileRouter.GET("/batches/:id", controller.RelayBatchRetrieve)
+		fileRouter.POST("/batches/:id/cancel", controller.RelayBatchCancel)
+	}
+	{
+		// 网关本地保存的 Responses API 响应，与渠道无关
+		storedResponseRouter := relayV1Router.Group("")
+		storedResponseRouter.GET("/responses/:id", controller.RelayResponseRetrieve)
+		storedResponseRouter.DELETE("/responses/:id", controller.RelayResponseDelete)
+	}
+	{
+		// 网关本地保存的 Conversations API 会话，与渠道无关
+		conversationRouter := relayV1Router.Group("/conversations")
+		conversationRouter.POST("", controller.RelayConversationCreate)
+		conversationRouter.GET("/:id", controller.RelayConversationRetrieve)
+		conversationRouter.POST("/:id", controller.RelayConversationUpdate)
+		conversationRouter.DELETE("/:id", controller.RelayConversationDelete)
+		conversationRouter.GET("/:id/items", controller.RelayConversationItemsList)
+		conversationRouter.POST("/:id/items", controller.RelayConversationItemsCreate)
+		conversationRouter.GET("/:id/items/:item_id", controller.RelayConversationItemRetrieve)
+		conversationRouter.DELETE("/:id/items/:item_id", controller.RelayConversationItemDelete)
+	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
@@ -152,11 +183,6 @@ func SetRelayRouter(router *gin.Engine) {
 
 		// not implemented
 		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
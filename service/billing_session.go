@@ -1,10 +1,12 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/logger"
@@ -31,6 +33,17 @@ type BillingSession struct {
 	settled          bool // Settle 全部完成（资金 + 令牌）
 	refunded         bool // Refund 已调用
 	mu               sync.Mutex
+
+	// 令牌周期消费上限的预留状态
+	periodQuota *tokenPeriodReservation
+}
+
+// tokenPeriodReservation 令牌周期消费上限的预留记录
+type tokenPeriodReservation struct {
+	tokenId     int
+	period      string
+	periodStart int64
+	reserved    int
 }
 
 // Settle 根据实际消耗额度进行结算。
@@ -42,6 +55,8 @@ func (s *BillingSession) Settle(actualQuota int) error {
 	if s.settled {
 		return nil
 	}
+	// 0) 按实际消耗调整令牌周期消费（与预扣金额无关，信任旁路时也需要计入）
+	s.settlePeriodQuotaLocked(actualQuota)
 	delta := actualQuota - s.preConsumedQuota
 	if delta == 0 {
 		s.settled = true
@@ -84,6 +99,8 @@ func (s *BillingSession) Refund(c *gin.Context) {
 		return
 	}
 	s.refunded = true
+	periodQuota := s.periodQuota
+	s.periodQuota = nil
 	s.mu.Unlock()
 
 	logger.LogInfo(c, fmt.Sprintf("用户 %d 请求失败, 返还预扣费（token_quota=%s, funding=%s）",
@@ -100,6 +117,8 @@ func (s *BillingSession) Refund(c *gin.Context) {
 	funding := s.funding
 
 	gopool.Go(func() {
+		// 0) 退还令牌周期消费预留
+		refundTokenPeriodQuota(periodQuota)
 		// 1) 退还资金来源
 		if err := funding.Refund(); err != nil {
 			common.SysLog("error refunding billing source: " + err.Error())
@@ -128,6 +147,9 @@ func (s *BillingSession) needsRefundLocked() bool {
 	if s.tokenConsumed > 0 {
 		return true
 	}
+	if s.periodQuota != nil && s.periodQuota.reserved > 0 {
+		return true
+	}
 	// 订阅可能在 tokenConsumed=0 时仍预扣了额度
 	if sub, ok := s.funding.(*SubscriptionFunding); ok && sub.preConsumed > 0 {
 		return true
@@ -157,9 +179,15 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 		logger.LogInfo(c, fmt.Sprintf("用户 %d 需要预扣费 %s (funding=%s)", s.relayInfo.UserId, logger.FormatQuota(effectiveQuota), s.funding.Source()))
 	}
 
+	// ---- 0) 检查并预留令牌周期消费上限（按完整预扣额度计算，不受信任旁路影响） ----
+	if apiErr := s.reservePeriodQuota(quota); apiErr != nil {
+		return apiErr
+	}
+
 	// ---- 1) 预扣令牌额度 ----
 	if effectiveQuota > 0 {
 		if err := PreConsumeTokenQuota(s.relayInfo, effectiveQuota); err != nil {
+			s.rollbackPeriodQuota()
 			return types.NewErrorWithStatusCode(err, types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
 		}
 		s.tokenConsumed = effectiveQuota
@@ -175,6 +203,13 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 			}
 			s.tokenConsumed = 0
 		}
+		s.rollbackPeriodQuota()
+		switch {
+		case errors.Is(err, model.ErrOrganizationQuotaInsufficient), errors.Is(err, model.ErrOrganizationMemberLimitExceeded):
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		case errors.Is(err, model.ErrOrganizationNotFound), errors.Is(err, model.ErrOrganizationDisabled), errors.Is(err, model.ErrOrganizationNotMember):
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeAccessDenied, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
 		// TODO: model 层应定义哨兵错误（如 ErrNoActiveSubscription），用 errors.Is 替代字符串匹配
 		errMsg := err.Error()
 		if strings.Contains(errMsg, "no active subscription") || strings.Contains(errMsg, "subscription quota insufficient") {
@@ -191,6 +226,64 @@ func (s *BillingSession) preConsume(c *gin.Context, quota int) *types.NewAPIErro
 	return nil
 }
 
+// reservePeriodQuota 令牌设置了周期消费上限时，在当前周期内预留本次预扣额度
+func (s *BillingSession) reservePeriodQuota(quota int) *types.NewAPIError {
+	info := s.relayInfo
+	if info.IsPlayground || info.TokenId <= 0 || info.TokenKey == "" {
+		return nil
+	}
+	token, err := model.GetTokenByKey(info.TokenKey, false)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if !token.HasPeriodQuotaLimit() {
+		return nil
+	}
+	periodStart, err := model.ReserveTokenPeriodQuota(info.TokenId, token.QuotaPeriod, token.PeriodQuotaLimit, quota)
+	if err != nil {
+		if errors.Is(err, model.ErrTokenPeriodQuotaExceeded) {
+			resetAt := model.TokenQuotaPeriodEnd(token.QuotaPeriod, time.Now())
+			return types.NewErrorWithStatusCode(fmt.Errorf("令牌%s消费上限 %s 已用尽，将于 %s 重置", model.FormatTokenQuotaPeriod(token.QuotaPeriod), logger.FormatQuota(token.PeriodQuotaLimit), resetAt.Format("2006-01-02 15:04:05")),
+				types.ErrorCodePreConsumeTokenQuotaFailed, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
+	}
+	s.periodQuota = &tokenPeriodReservation{
+		tokenId:     info.TokenId,
+		period:      token.QuotaPeriod,
+		periodStart: periodStart,
+		reserved:    quota,
+	}
+	return nil
+}
+
+// rollbackPeriodQuota 预扣费失败时同步退还周期消费预留
+func (s *BillingSession) rollbackPeriodQuota() {
+	refundTokenPeriodQuota(s.periodQuota)
+	s.periodQuota = nil
+}
+
+// settlePeriodQuotaLocked 按实际消耗调整周期消费，调用方需持有锁
+func (s *BillingSession) settlePeriodQuotaLocked(actualQuota int) {
+	p := s.periodQuota
+	if p == nil {
+		return
+	}
+	s.periodQuota = nil
+	if err := model.AdjustTokenPeriodQuota(p.tokenId, p.period, p.periodStart, actualQuota-p.reserved); err != nil {
+		common.SysLog(fmt.Sprintf("error settling token period quota (tokenId=%d, delta=%d): %s", p.tokenId, actualQuota-p.reserved, err.Error()))
+	}
+}
+
+func refundTokenPeriodQuota(p *tokenPeriodReservation) {
+	if p == nil || p.reserved <= 0 {
+		return
+	}
+	if err := model.AdjustTokenPeriodQuota(p.tokenId, p.period, p.periodStart, -p.reserved); err != nil {
+		common.SysLog(fmt.Sprintf("error refunding token period quota (tokenId=%d, amount=%d): %s", p.tokenId, p.reserved, err.Error()))
+	}
+}
+
 // shouldTrust 统一信任额度检查，适用于钱包和订阅。
 func (s *BillingSession) shouldTrust(c *gin.Context) bool {
 	// 异步任务（ForcePreConsume=true）必须预扣全额，不允许信任旁路
@@ -222,6 +315,9 @@ func (s *BillingSession) shouldTrust(c *gin.Context) bool {
 		// 2. SubscriptionFunding.PreConsume 忽略参数，始终用 s.amount 预扣
 		// 3. 若信任旁路将 effectiveQuota 设为 0，会导致 preConsumedQuota 与实际订阅预扣不一致
 		return false
+	case BillingSourceOrganization:
+		// 组织钱包需要在预扣时累计成员消费，不启用信任旁路
+		return false
 	default:
 		return false
 	}
@@ -311,6 +407,18 @@ func NewBillingSession(c *gin.Context, relayInfo *relaycommon.RelayInfo, preCons
 		return session, nil
 	}
 
+	// 令牌绑定了组织时只从组织钱包扣费，不受个人计费偏好影响
+	if relayInfo.OrganizationId > 0 {
+		session := &BillingSession{
+			relayInfo: relayInfo,
+			funding:   &OrganizationFunding{organizationId: relayInfo.OrganizationId, userId: relayInfo.UserId},
+		}
+		if apiErr := session.preConsume(c, preConsumedQuota); apiErr != nil {
+			return nil, apiErr
+		}
+		return session, nil
+	}
+
 	switch pref {
 	case "subscription_only":
 		return trySubscription()
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	bodyCaptureCleanupInterval  = 1 * time.Hour
+	bodyCaptureCleanupBatchSize = 1000
+)
+
+var (
+	bodyCaptureCleanupOnce    sync.Once
+	bodyCaptureCleanupRunning atomic.Bool
+)
+
+// bodyCaptureState 单个请求的内容留存状态，保存在 gin context 中
+type bodyCaptureState struct {
+	info   *relaycommon.RelayInfo
+	writer *bodyCaptureWriter
+}
+
+// bodyCaptureWriter 在写给客户端的同时留存响应内容。
+// 非流式响应保留前 limit 字节；流式响应逐行解析 SSE 事件，按输出路拼接为完整文本。
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	limit  int
+	stream bool
+
+	raw          bytes.Buffer
+	rawTruncated bool
+
+	line      bytes.Buffer
+	events    int
+	slots     []string
+	texts     map[string]*strings.Builder
+	textBytes int
+	truncated bool
+}
+
+func newBodyCaptureWriter(w gin.ResponseWriter, limit int, stream bool) *bodyCaptureWriter {
+	return &bodyCaptureWriter{
+		ResponseWriter: w,
+		limit:          limit,
+		stream:         stream,
+		texts:          make(map[string]*strings.Builder),
+	}
+}
+
+func (w *bodyCaptureWriter) capture(b []byte) {
+	if !w.rawTruncated {
+		remain := w.limit - w.raw.Len()
+		if len(b) > remain {
+			w.raw.Write(b[:captureCutIndex(b, remain)])
+			w.rawTruncated = true
+		} else {
+			w.raw.Write(b)
+		}
+	}
+	if !w.stream || w.truncated {
+		return
+	}
+	for len(b) > 0 {
+		idx := bytes.IndexByte(b, '\n')
+		if idx < 0 {
+			// 不完整的行暂存，超长的行不会是需要解析的事件
+			if w.line.Len()+len(b) <= w.limit {
+				w.line.Write(b)
+			}
+			return
+		}
+		w.line.Write(b[:idx])
+		w.captureLine(w.line.Bytes())
+		w.line.Reset()
+		b = b[idx+1:]
+	}
+}
+
+func (w *bodyCaptureWriter) captureLine(line []byte) {
+	line = bytes.TrimSpace(line)
+	if !bytes.HasPrefix(line, []byte("data:")) {
+		return
+	}
+	data := bytes.TrimSpace(line[len("data:"):])
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	w.events++
+	for _, field := range collectStreamTextFields(data) {
+		text := field.text
+		if w.textBytes+len(text) > w.limit {
+			// 达到上限后保留能放下的部分，之后的事件不再解析
+			text = text[:captureCutIndex([]byte(text), w.limit-w.textBytes)]
+			w.truncated = true
+		}
+		builder, ok := w.texts[field.slot]
+		if !ok {
+			builder = &strings.Builder{}
+			w.texts[field.slot] = builder
+			w.slots = append(w.slots, field.slot)
+		}
+		builder.WriteString(text)
+		w.textBytes += len(text)
+		if w.truncated {
+			return
+		}
+	}
+}
+
+func (w *bodyCaptureWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// body 返回留存的响应内容与是否被截断。流式响应解析出事件时返回拼接后的文本，否则返回原始内容。
+func (w *bodyCaptureWriter) body() (string, bool) {
+	if !w.stream || w.events == 0 {
+		return w.raw.String(), w.rawTruncated
+	}
+	outputs := make([]map[string]string, 0, len(w.slots))
+	for _, slot := range w.slots {
+		outputs = append(outputs, map[string]string{"slot": slot, "text": w.texts[slot].String()})
+	}
+	data, err := common.Marshal(map[string]any{
+		"object":  "reassembled_stream",
+		"events":  w.events,
+		"outputs": outputs,
+	})
+	if err != nil {
+		return w.raw.String(), w.rawTruncated
+	}
+	// 转义后的内容可能超过上限
+	body, truncated := truncateCaptureBody(data, w.limit)
+	return body, truncated || w.truncated
+}
+
+// captureCutIndex 返回不超过 limit 且不会截断 UTF-8 字符的截断位置
+func captureCutIndex(data []byte, limit int) int {
+	if limit >= len(data) {
+		return len(data)
+	}
+	if limit <= 0 {
+		return 0
+	}
+	for limit > 0 && !utf8.RuneStart(data[limit]) {
+		limit--
+	}
+	return limit
+}
+
+func truncateCaptureBody(data []byte, limit int) (string, bool) {
+	if len(data) > limit {
+		return string(data[:captureCutIndex(data, limit)]), true
+	}
+	return string(data), false
+}
+
+// SetupBodyCapture 按采样率与令牌 / 用户范围决定是否留存当前请求，留存时包装 c.Writer 记录响应。
+// 渠道范围要等选定渠道后才能判断，在 SaveBodyCapture 中检查。
+func SetupBodyCapture(c *gin.Context, info *relaycommon.RelayInfo) {
+	setting := operation_setting.GetBodyCaptureSetting()
+	if !setting.Enabled || setting.MaxBodyBytes <= 0 {
+		return
+	}
+	if setting.HasScope() && len(setting.ChannelIds) == 0 && !setting.InScope(info.TokenId, info.UserId, 0) {
+		return
+	}
+	if setting.SampleRate < 1 && rand.Float64() >= setting.SampleRate {
+		return
+	}
+	writer := newBodyCaptureWriter(c.Writer, setting.MaxBodyBytes, info.IsStream)
+	c.Writer = writer
+	common.SetContextKey(c, constant.ContextKeyBodyCapture, &bodyCaptureState{info: info, writer: writer})
+}
+
+// SaveBodyCapture 在响应（包括错误响应）写出后异步保存留存内容，未开启留存的请求直接返回
+func SaveBodyCapture(c *gin.Context) {
+	state, ok := common.GetContextKeyType[*bodyCaptureState](c, constant.ContextKeyBodyCapture)
+	if !ok || state == nil {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyBodyCapture, nil)
+
+	setting := operation_setting.GetBodyCaptureSetting()
+	info := state.info
+	channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId)
+	if !setting.InScope(info.TokenId, info.UserId, channelId) {
+		return
+	}
+
+	capture := &model.RequestCapture{
+		RequestId:   c.GetString(common.RequestIdKey),
+		UserId:      info.UserId,
+		TokenId:     info.TokenId,
+		ChannelId:   channelId,
+		ModelName:   info.OriginModelName,
+		RequestPath: c.Request.URL.Path,
+		IsStream:    info.IsStream,
+		StatusCode:  state.writer.Status(),
+		CreatedAt:   common.GetTimestamp(),
+	}
+	if storage, err := common.GetBodyStorage(c); err == nil {
+		if data, err := storage.Bytes(); err == nil {
+			requestBody, truncated := truncateCaptureBody(data, state.writer.limit)
+			capture.RequestBody, capture.RequestTruncated = model.LargeText(requestBody), truncated
+		}
+	}
+	responseBody, truncated := state.writer.body()
+	capture.ResponseBody, capture.ResponseTruncated = model.LargeText(responseBody), truncated
+
+	gopool.Go(func() {
+		if err := capture.Insert(); err != nil {
+			logger.LogError(context.Background(), fmt.Sprintf("failed to save request capture %s: %s", capture.RequestId, err.Error()))
+		}
+	})
+}
+
+// StartBodyCaptureCleanupTask 定期清理超过留存天数的请求内容
+func StartBodyCaptureCleanupTask() {
+	bodyCaptureCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(bodyCaptureCleanupInterval)
+			defer ticker.Stop()
+
+			runBodyCaptureCleanupOnce()
+			for range ticker.C {
+				runBodyCaptureCleanupOnce()
+			}
+		})
+	})
+}
+
+func runBodyCaptureCleanupOnce() {
+	if !bodyCaptureCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer bodyCaptureCleanupRunning.Store(false)
+
+	retentionDays := operation_setting.GetBodyCaptureSetting().RetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+	ctx := context.Background()
+	targetTimestamp := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	count, err := model.DeleteOldRequestCaptures(ctx, targetTimestamp, bodyCaptureCleanupBatchSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("request capture cleanup task failed: %v", err))
+		return
+	}
+	if common.DebugEnabled && count > 0 {
+		logger.LogDebug(ctx, "request capture cleanup: deleted_count=%d", count)
+	}
+}
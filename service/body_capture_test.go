@@ -0,0 +1,82 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func newTestBodyCaptureWriter(limit int, stream bool) *bodyCaptureWriter {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	return newBodyCaptureWriter(c.Writer, limit, stream)
+}
+
+func TestBodyCaptureWriterReassemblesStream(t *testing.T) {
+	w := newTestBodyCaptureWriter(1024, true)
+	chunks := []string{
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"con",
+		"tent\":\"lo\"}}]}\n\ndata: [DONE]\n\n",
+	}
+	for _, chunk := range chunks {
+		_, err := w.WriteString(chunk)
+		require.NoError(t, err)
+	}
+
+	body, truncated := w.body()
+	assert.False(t, truncated)
+	assert.Equal(t, "reassembled_stream", gjson.Get(body, "object").String())
+	assert.EqualValues(t, 2, gjson.Get(body, "events").Int())
+	assert.Equal(t, "Hello", gjson.Get(body, "outputs.0.text").String())
+}
+
+func TestBodyCaptureWriterTruncates(t *testing.T) {
+	w := newTestBodyCaptureWriter(8, false)
+	_, err := w.Write([]byte(`{"id":"chatcmpl-1"}`))
+	require.NoError(t, err)
+
+	body, truncated := w.body()
+	assert.True(t, truncated)
+	assert.Equal(t, `{"id":"c`, body)
+
+	data, truncated := truncateCaptureBody([]byte("short"), 8)
+	assert.False(t, truncated)
+	assert.Equal(t, "short", data)
+}
+
+func TestBodyCaptureWriterStreamWithoutEventsKeepsRaw(t *testing.T) {
+	w := newTestBodyCaptureWriter(1024, true)
+	raw, _ := common.Marshal(map[string]any{"error": map[string]any{"message": "bad"}})
+	_, err := w.Write(raw)
+	require.NoError(t, err)
+
+	body, truncated := w.body()
+	assert.False(t, truncated)
+	assert.Equal(t, string(raw), body)
+}
+
+func TestBodyCaptureTruncatesAtRuneBoundary(t *testing.T) {
+	data, truncated := truncateCaptureBody([]byte("你好世界"), 7)
+	assert.True(t, truncated)
+	assert.Equal(t, "你好", data)
+
+	w := newTestBodyCaptureWriter(8, true)
+	chunks := []string{
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"你好\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"世界\"}}]}\n\n",
+		"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"!\"}}]}\n\n",
+	}
+	for _, chunk := range chunks {
+		_, err := w.WriteString(chunk)
+		require.NoError(t, err)
+	}
+	assert.True(t, w.truncated)
+	assert.Equal(t, "你好", w.texts["choices.0"].String())
+	assert.Equal(t, 2, w.events)
+}
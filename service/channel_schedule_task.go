@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+const channelScheduleTickInterval = 1 * time.Minute
+
+var (
+	channelScheduleOnce    sync.Once
+	channelScheduleRunning atomic.Bool
+)
+
+// StartChannelScheduleTask 每分钟按渠道可用时段切换 abilities 的启用状态
+func StartChannelScheduleTask() {
+	channelScheduleOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			logger.LogInfo(context.Background(), fmt.Sprintf("channel schedule task started: tick=%s", channelScheduleTickInterval))
+			ticker := time.NewTicker(channelScheduleTickInterval)
+			defer ticker.Stop()
+
+			runChannelScheduleOnce()
+			for range ticker.C {
+				runChannelScheduleOnce()
+			}
+		})
+	})
+}
+
+func runChannelScheduleOnce() {
+	if !channelScheduleRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer channelScheduleRunning.Store(false)
+
+	switched, err := model.SyncChannelScheduleAbilities(time.Now())
+	if err != nil {
+		logger.LogWarn(context.Background(), fmt.Sprintf("channel schedule task failed: %v", err))
+		return
+	}
+	if common.DebugEnabled && switched > 0 {
+		logger.LogDebug(context.Background(), "channel schedule: switched_count=%d", switched)
+	}
+}
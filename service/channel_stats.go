@@ -0,0 +1,249 @@
+package service
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// channelStatsBucketCount 滚动窗口切分的桶数量，窗口长度由 ChannelSelectSetting.WindowSeconds 决定
+const channelStatsBucketCount = 10
+
+type channelStatsBucket struct {
+	start     int64 // 桶起始时间（unix 秒，按桶宽对齐）
+	total     int64
+	success   int64
+	rateLimit int64
+	ttftSum   int64 // 毫秒
+	ttftCount int64
+}
+
+type channelModelStats struct {
+	mu      sync.Mutex
+	buckets [channelStatsBucketCount]channelStatsBucket
+}
+
+// ChannelModelStatsSnapshot 渠道在某模型上的滚动统计快照
+type ChannelModelStatsSnapshot struct {
+	ChannelId     int     `json:"channel_id"`
+	ModelName     string  `json:"model_name"`
+	Total         int64   `json:"total"`
+	Success       int64   `json:"success"`
+	RateLimited   int64   `json:"rate_limited"`
+	AvgTTFTMs     float64 `json:"avg_ttft_ms"`
+	SuccessRate   float64 `json:"success_rate"`
+	RateLimitRate float64 `json:"rate_limit_rate"`
+	Score         float64 `json:"score"`
+	WindowSeconds int     `json:"window_seconds"`
+}
+
+var channelModelStatsMap sync.Map // map[string]*channelModelStats
+
+func channelModelStatsKey(channelId int, modelName string) string {
+	return strconv.Itoa(channelId) + "\n" + modelName
+}
+
+func channelStatsBucketSeconds() int64 {
+	windowSeconds := int64(operation_setting.GetChannelSelectSetting().WindowSeconds)
+	if windowSeconds <= 0 {
+		windowSeconds = 300
+	}
+	bucketSeconds := windowSeconds / channelStatsBucketCount
+	if bucketSeconds <= 0 {
+		bucketSeconds = 1
+	}
+	return bucketSeconds
+}
+
+func (s *channelModelStats) observe(now int64, bucketSeconds int64, success bool, rateLimited bool, ttft time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start := now - now%bucketSeconds
+	b := &s.buckets[(start/bucketSeconds)%channelStatsBucketCount]
+	if b.start != start {
+		*b = channelStatsBucket{start: start}
+	}
+	b.total++
+	if success {
+		b.success++
+	}
+	if rateLimited {
+		b.rateLimit++
+	}
+	if ttft > 0 {
+		b.ttftSum += ttft.Milliseconds()
+		b.ttftCount++
+	}
+}
+
+func (s *channelModelStats) sum(now int64, bucketSeconds int64) channelStatsBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var total channelStatsBucket
+	oldest := now - now%bucketSeconds - bucketSeconds*(channelStatsBucketCount-1)
+	for _, b := range s.buckets {
+		if b.start < oldest || b.total == 0 {
+			continue
+		}
+		total.total += b.total
+		total.success += b.success
+		total.rateLimit += b.rateLimit
+		total.ttftSum += b.ttftSum
+		total.ttftCount += b.ttftCount
+	}
+	return total
+}
+
+// IsChannelAttributableError 判断错误是否应计入渠道健康度，用户侧的参数错误等不影响渠道评分
+func IsChannelAttributableError(err *types.NewAPIError) bool {
+	if err == nil {
+		return false
+	}
+	if types.IsChannelError(err) {
+		return true
+	}
+	code := err.StatusCode
+	if code < 100 || code > 599 {
+		return true
+	}
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500 ||
+		code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// ObserveChannelResult 记录一次真实转发的结果，用于自适应渠道选择
+// ttft 为本次尝试开始到首字节的耗时，非流式请求为整体耗时，失败时传 0
+func ObserveChannelResult(channelId int, modelName string, relayErr *types.NewAPIError, ttft time.Duration) {
+	if channelId <= 0 || modelName == "" {
+		return
+	}
+	if relayErr != nil && !IsChannelAttributableError(relayErr) {
+		return
+	}
+	key := channelModelStatsKey(channelId, modelName)
+	v, _ := channelModelStatsMap.LoadOrStore(key, &channelModelStats{})
+	success := relayErr == nil
+	rateLimited := relayErr != nil && relayErr.StatusCode == http.StatusTooManyRequests
+	if !success {
+		ttft = 0
+	}
+	v.(*channelModelStats).observe(time.Now().Unix(), channelStatsBucketSeconds(), success, rateLimited, ttft)
+}
+
+// GetChannelModelStats 返回渠道在某模型上的统计快照
+func GetChannelModelStats(channelId int, modelName string) ChannelModelStatsSnapshot {
+	setting := operation_setting.GetChannelSelectSetting()
+	snapshot := ChannelModelStatsSnapshot{
+		ChannelId:     channelId,
+		ModelName:     modelName,
+		Score:         1,
+		WindowSeconds: setting.WindowSeconds,
+	}
+	v, ok := channelModelStatsMap.Load(channelModelStatsKey(channelId, modelName))
+	if !ok {
+		return snapshot
+	}
+	sum := v.(*channelModelStats).sum(time.Now().Unix(), channelStatsBucketSeconds())
+	snapshot.Total = sum.total
+	snapshot.Success = sum.success
+	snapshot.RateLimited = sum.rateLimit
+	if sum.total > 0 {
+		snapshot.SuccessRate = float64(sum.success) / float64(sum.total)
+		snapshot.RateLimitRate = float64(sum.rateLimit) / float64(sum.total)
+	}
+	if sum.ttftCount > 0 {
+		snapshot.AvgTTFTMs = float64(sum.ttftSum) / float64(sum.ttftCount)
+	}
+	snapshot.Score = channelHealthScore(sum, setting)
+	return snapshot
+}
+
+// ListChannelModelStats 返回指定渠道（channelId <= 0 表示全部）在窗口内有样本的统计
+func ListChannelModelStats(channelId int) []ChannelModelStatsSnapshot {
+	result := make([]ChannelModelStatsSnapshot, 0)
+	channelModelStatsMap.Range(func(k, _ any) bool {
+		idStr, modelName, ok := strings.Cut(k.(string), "\n")
+		if !ok {
+			return true
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil || (channelId > 0 && id != channelId) {
+			return true
+		}
+		snapshot := GetChannelModelStats(id, modelName)
+		if snapshot.Total > 0 {
+			result = append(result, snapshot)
+		}
+		return true
+	})
+	return result
+}
+
+// channelHealthScore 计算渠道健康度，取值 (0, 1]
+//
+//	score = 平滑成功率^2 × (1 - 429比例 × RateLimitPenalty) × min(1, 2 × TTFTReferenceMs / (TTFTReferenceMs + avgTTFT))
+//
+// 样本不足 MinSamples 时返回 1，保证新渠道和冷门渠道能获得探测流量。
+func channelHealthScore(sum channelStatsBucket, setting *operation_setting.ChannelSelectSetting) float64 {
+	minSamples := int64(setting.MinSamples)
+	if sum.total == 0 || sum.total < minSamples {
+		return 1
+	}
+	successRate := (float64(sum.success) + 1) / (float64(sum.total) + 2)
+	score := successRate * successRate
+
+	if setting.RateLimitPenalty > 0 {
+		rateLimitRate := float64(sum.rateLimit) / float64(sum.total)
+		score *= math.Max(0, 1-rateLimitRate*setting.RateLimitPenalty)
+	}
+
+	if sum.ttftCount > 0 && setting.TTFTReferenceMs > 0 {
+		ref := float64(setting.TTFTReferenceMs)
+		avgTTFT := float64(sum.ttftSum) / float64(sum.ttftCount)
+		score *= math.Min(1, 2*ref/(ref+avgTTFT))
+	}
+
+	minScore := setting.MinScore
+	if minScore <= 0 {
+		minScore = 0.01
+	}
+	return math.Min(1, math.Max(minScore, score))
+}
+
+// channelSelectWeightFunc 返回分组生效的渠道权重系数，乘在与静态权重随机相同平滑规则的静态权重上：
+//   - weight 策略且未启用熔断时返回 nil，沿用静态权重随机
+//   - adaptive 策略乘以健康度
+//   - 启用熔断时再乘以熔断系数（熔断为 0，半开为探测比例）
+//   - 启用上游限流跟踪时，单 Key 渠道已知额度耗尽则系数为 0
+func channelSelectWeightFunc(group string, modelName string) model.ChannelWeightFunc {
+	adaptive := operation_setting.GetChannelSelectStrategy(group) == operation_setting.ChannelSelectStrategyAdaptive
+	breakerEnabled := operation_setting.GetCircuitBreakerSetting().Enabled
+	rateLimitEnabled := operation_setting.GetUpstreamRateLimitSetting().Enabled
+	if !adaptive && !breakerEnabled && !rateLimitEnabled {
+		return nil
+	}
+	return func(channel *model.Channel) float64 {
+		weight := 1.0
+		if adaptive {
+			weight *= GetChannelModelStats(channel.Id, modelName).Score
+		}
+		if breakerEnabled {
+			weight *= circuitBreakerWeightFactor(channel.Id, -1)
+		}
+		if rateLimitEnabled && !channel.ChannelInfo.IsMultiKey && IsUpstreamRateLimited(channel.Id, 0) {
+			return 0
+		}
+		return weight
+	}
+}
+
+// getRandomSatisfiedChannelByStrategy 按分组配置的策略在优先级分层内选择渠道
+func getRandomSatisfiedChannelByStrategy(group string, modelName string, retry int) (*model.Channel, error) {
+	return model.GetRandomSatisfiedChannelWeighted(group, modelName, retry, channelSelectWeightFunc(group, modelName))
+}
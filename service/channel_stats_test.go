@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChannelModelStats_WindowExpiresOldBuckets(t *testing.T) {
+	stats := &channelModelStats{}
+	now := int64(10_000)
+	stats.observe(now, 30, true, false, 500*time.Millisecond)
+	stats.observe(now, 30, false, true, 0)
+
+	sum := stats.sum(now, 30)
+	require.EqualValues(t, 2, sum.total)
+	require.EqualValues(t, 1, sum.success)
+	require.EqualValues(t, 1, sum.rateLimit)
+	require.EqualValues(t, 500, sum.ttftSum)
+
+	later := now + 30*channelStatsBucketCount
+	require.Zero(t, stats.sum(later, 30).total)
+
+	stats.observe(later, 30, true, false, 0)
+	require.EqualValues(t, 1, stats.sum(later, 30).total)
+}
+
+func TestChannelHealthScore(t *testing.T) {
+	setting := &operation_setting.ChannelSelectSetting{
+		MinSamples:       5,
+		TTFTReferenceMs:  1000,
+		RateLimitPenalty: 1,
+		MinScore:         0.05,
+	}
+
+	require.Equal(t, 1.0, channelHealthScore(channelStatsBucket{total: 4}, setting), "too few samples is neutral")
+
+	healthy := channelHealthScore(channelStatsBucket{total: 100, success: 100, ttftSum: 50_000, ttftCount: 100}, setting)
+	slow := channelHealthScore(channelStatsBucket{total: 100, success: 100, ttftSum: 500_000, ttftCount: 100}, setting)
+	limited := channelHealthScore(channelStatsBucket{total: 100, success: 50, rateLimit: 50, ttftSum: 25_000, ttftCount: 50}, setting)
+	broken := channelHealthScore(channelStatsBucket{total: 100}, setting)
+
+	require.Greater(t, healthy, slow)
+	require.Greater(t, healthy, limited)
+	require.Equal(t, setting.MinScore, broken)
+}
+
+func TestObserveChannelResult_IgnoresClientErrors(t *testing.T) {
+	channelId := int(time.Now().UnixNano() % 1_000_000_000)
+	modelName := "stats-test-model"
+
+	ObserveChannelResult(channelId, modelName, types.NewErrorWithStatusCode(errors.New("bad request"), types.ErrorCodeInvalidRequest, http.StatusBadRequest), 0)
+	require.Zero(t, GetChannelModelStats(channelId, modelName).Total)
+
+	ObserveChannelResult(channelId, modelName, types.NewErrorWithStatusCode(errors.New("too many requests"), types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests), time.Second)
+	ObserveChannelResult(channelId, modelName, nil, 800*time.Millisecond)
+
+	snapshot := GetChannelModelStats(channelId, modelName)
+	require.EqualValues(t, 2, snapshot.Total)
+	require.EqualValues(t, 1, snapshot.Success)
+	require.EqualValues(t, 1, snapshot.RateLimited)
+	require.Equal(t, 800.0, snapshot.AvgTTFTMs)
+}
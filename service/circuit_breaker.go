@@ -0,0 +1,335 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+	"github.com/samber/hot"
+)
+
+const (
+	CircuitBreakerStateClosed   = "closed"
+	CircuitBreakerStateOpen     = "open"
+	CircuitBreakerStateHalfOpen = "half_open"
+
+	circuitBreakerCacheNamespace = "new-api:circuit_breaker:v1"
+	circuitBreakerMaxErrorLength = 256
+)
+
+var (
+	circuitBreakerCacheOnce sync.Once
+	circuitBreakerCache     *cachex.HybridCache[CircuitBreakerState]
+
+	circuitBreakerLocks [64]sync.Mutex
+)
+
+// CircuitBreakerState 熔断器持久化状态，存储于内存或 Redis
+type CircuitBreakerState struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	HalfOpenSuccesses   int    `json:"half_open_successes"`
+	OpenedAt            int64  `json:"opened_at"`
+	LastFailureAt       int64  `json:"last_failure_at"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+// CircuitBreakerSnapshot 熔断器状态快照，State 为计算后的实际状态（open 到期后为 half_open）
+type CircuitBreakerSnapshot struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	HalfOpenSuccesses   int    `json:"half_open_successes"`
+	OpenedAt            int64  `json:"opened_at,omitempty"`
+	HalfOpenAt          int64  `json:"half_open_at,omitempty"`
+	LastFailureAt       int64  `json:"last_failure_at,omitempty"`
+	LastError           string `json:"last_error,omitempty"`
+}
+
+func getCircuitBreakerCache() *cachex.HybridCache[CircuitBreakerState] {
+	circuitBreakerCacheOnce.Do(func() {
+		circuitBreakerCache = cachex.NewHybridCache[CircuitBreakerState](cachex.HybridCacheConfig[CircuitBreakerState]{
+			Namespace: cachex.Namespace(circuitBreakerCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[CircuitBreakerState]{},
+			Memory: func() *hot.HotCache[string, CircuitBreakerState] {
+				return hot.NewHotCache[string, CircuitBreakerState](hot.LRU, 100_000).
+					WithTTL(time.Hour).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return circuitBreakerCache
+}
+
+// circuitBreakerKey 渠道级熔断器 key 为 "<channelId>:channel"，多 Key 渠道的单个 key 为 "<channelId>:key:<index>"
+func circuitBreakerKey(channelId int, keyIndex int) string {
+	if keyIndex < 0 {
+		return strconv.Itoa(channelId) + ":channel"
+	}
+	return strconv.Itoa(channelId) + ":key:" + strconv.Itoa(keyIndex)
+}
+
+func circuitBreakerLock(key string) *sync.Mutex {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return &circuitBreakerLocks[h.Sum32()%uint32(len(circuitBreakerLocks))]
+}
+
+func circuitBreakerTTL(setting *operation_setting.CircuitBreakerSetting) time.Duration {
+	ttl := time.Duration(setting.OpenSeconds) * time.Second * 10
+	if ttl < time.Hour {
+		ttl = time.Hour
+	}
+	return ttl
+}
+
+// effectiveState 返回考虑熔断到期后的实际状态
+func (s CircuitBreakerState) effectiveState(now int64, setting *operation_setting.CircuitBreakerSetting) string {
+	switch s.State {
+	case CircuitBreakerStateOpen:
+		if now >= s.OpenedAt+int64(setting.OpenSeconds) {
+			return CircuitBreakerStateHalfOpen
+		}
+		return CircuitBreakerStateOpen
+	case CircuitBreakerStateHalfOpen:
+		return CircuitBreakerStateHalfOpen
+	default:
+		return CircuitBreakerStateClosed
+	}
+}
+
+// next 根据一次请求结果推进状态机，返回新状态以及是否需要写回
+func (s CircuitBreakerState) next(now int64, setting *operation_setting.CircuitBreakerSetting, failed bool, errMsg string) (CircuitBreakerState, bool) {
+	state := s.effectiveState(now, setting)
+	if !failed {
+		switch state {
+		case CircuitBreakerStateHalfOpen:
+			s.State = CircuitBreakerStateHalfOpen
+			s.HalfOpenSuccesses++
+			if s.HalfOpenSuccesses >= max(setting.HalfOpenSuccessThreshold, 1) {
+				return CircuitBreakerState{State: CircuitBreakerStateClosed}, true
+			}
+			return s, true
+		case CircuitBreakerStateOpen:
+			// 熔断前已发出的请求成功返回，不改变熔断状态
+			return s, false
+		default:
+			if s.ConsecutiveFailures == 0 {
+				return s, false
+			}
+			s.ConsecutiveFailures = 0
+			return s, true
+		}
+	}
+
+	if len(errMsg) > circuitBreakerMaxErrorLength {
+		errMsg = errMsg[:circuitBreakerMaxErrorLength]
+	}
+	s.ConsecutiveFailures++
+	s.LastFailureAt = now
+	s.LastError = errMsg
+	switch state {
+	case CircuitBreakerStateHalfOpen:
+		// 探测失败，重新熔断
+		s.State = CircuitBreakerStateOpen
+		s.OpenedAt = now
+		s.HalfOpenSuccesses = 0
+	case CircuitBreakerStateOpen:
+	default:
+		if s.ConsecutiveFailures >= max(setting.FailureThreshold, 1) {
+			s.State = CircuitBreakerStateOpen
+			s.OpenedAt = now
+		}
+	}
+	return s, true
+}
+
+func getCircuitBreakerState(key string) (CircuitBreakerState, bool) {
+	state, found, err := getCircuitBreakerCache().Get(key)
+	if err != nil {
+		common.SysError(fmt.Sprintf("circuit breaker cache get failed: key=%s, err=%v", key, err))
+		return CircuitBreakerState{}, false
+	}
+	return state, found
+}
+
+func observeCircuitBreaker(channelId int, keyIndex int, failed bool, errMsg string) {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	key := circuitBreakerKey(channelId, keyIndex)
+	lock := circuitBreakerLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	prev, found := getCircuitBreakerState(key)
+	if !found && !failed {
+		return
+	}
+	now := time.Now().Unix()
+	next, changed := prev.next(now, setting, failed, errMsg)
+	if !changed {
+		return
+	}
+	if next.State == CircuitBreakerStateOpen && prev.effectiveState(now, setting) != CircuitBreakerStateOpen {
+		common.SysLog(fmt.Sprintf("circuit breaker opened: channel #%d, key index %d, consecutive failures %d, last error: %s", channelId, keyIndex, next.ConsecutiveFailures, next.LastError))
+	}
+	if next.State == CircuitBreakerStateClosed && prev.State != CircuitBreakerStateClosed && prev.State != "" {
+		common.SysLog(fmt.Sprintf("circuit breaker closed: channel #%d, key index %d", channelId, keyIndex))
+	}
+	if err := getCircuitBreakerCache().SetWithTTL(key, next, circuitBreakerTTL(setting)); err != nil {
+		common.SysError(fmt.Sprintf("circuit breaker cache set failed: key=%s, err=%v", key, err))
+	}
+}
+
+// ObserveCircuitBreakerResult 将一次转发结果计入渠道级熔断器，多 Key 渠道同时计入对应 key 的熔断器
+func ObserveCircuitBreakerResult(channelId int, isMultiKey bool, keyIndex int, relayErr *types.NewAPIError) {
+	if channelId <= 0 || !operation_setting.GetCircuitBreakerSetting().Enabled {
+		return
+	}
+	if relayErr != nil && !IsChannelAttributableError(relayErr) {
+		return
+	}
+	failed := relayErr != nil
+	errMsg := ""
+	if failed {
+		errMsg = relayErr.ErrorWithStatusCode()
+	}
+	observeCircuitBreaker(channelId, -1, failed, errMsg)
+	if isMultiKey && keyIndex >= 0 {
+		observeCircuitBreaker(channelId, keyIndex, failed, errMsg)
+	}
+}
+
+// circuitBreakerWeightFactor 返回渠道选择时的权重系数：关闭为 1，熔断为 0，半开为 HalfOpenProbeRatio
+func circuitBreakerWeightFactor(channelId int, keyIndex int) float64 {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	if !setting.Enabled {
+		return 1
+	}
+	state, found := getCircuitBreakerState(circuitBreakerKey(channelId, keyIndex))
+	if !found {
+		return 1
+	}
+	switch state.effectiveState(time.Now().Unix(), setting) {
+	case CircuitBreakerStateOpen:
+		return 0
+	case CircuitBreakerStateHalfOpen:
+		return setting.HalfOpenProbeRatio
+	default:
+		return 1
+	}
+}
+
+// circuitBreakerKeyFactors 一次批量读取多 Key 渠道所有 key 的熔断状态，返回非 1 的权重系数
+func circuitBreakerKeyFactors(channelId int, keyCount int) map[int]float64 {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	keys := make([]string, keyCount)
+	for i := range keys {
+		keys[i] = circuitBreakerKey(channelId, i)
+	}
+	states, err := getCircuitBreakerCache().GetMany(keys)
+	if err != nil {
+		common.SysError(fmt.Sprintf("circuit breaker cache get failed: channel #%d, err=%v", channelId, err))
+	}
+	now := time.Now().Unix()
+	factors := make(map[int]float64, len(states))
+	for i, key := range keys {
+		state, ok := states[key]
+		if !ok {
+			continue
+		}
+		switch state.effectiveState(now, setting) {
+		case CircuitBreakerStateOpen:
+			factors[i] = 0
+		case CircuitBreakerStateHalfOpen:
+			factors[i] = setting.HalfOpenProbeRatio
+		}
+	}
+	return factors
+}
+
+// CircuitBreakerKeyFilter 返回多 Key 渠道选择 key 时使用的过滤函数；熔断中的 key 不可用，半开的 key 按探测比例放行。
+// 状态在返回前一次性读取，过滤函数本身不访问缓存，可以在渠道轮询锁内调用
+func CircuitBreakerKeyFilter(channelId int, keyCount int) func(keyIndex int) bool {
+	if !operation_setting.GetCircuitBreakerSetting().Enabled || keyCount <= 0 {
+		return nil
+	}
+	factors := circuitBreakerKeyFactors(channelId, keyCount)
+	return func(keyIndex int) bool {
+		factor, ok := factors[keyIndex]
+		if !ok || factor >= 1 {
+			return true
+		}
+		return factor > 0 && rand.Float64() < factor
+	}
+}
+
+func GetCircuitBreakerSnapshot(channelId int, keyIndex int) CircuitBreakerSnapshot {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	state, found := getCircuitBreakerState(circuitBreakerKey(channelId, keyIndex))
+	if !found {
+		return CircuitBreakerSnapshot{State: CircuitBreakerStateClosed}
+	}
+	snapshot := CircuitBreakerSnapshot{
+		State:               state.effectiveState(time.Now().Unix(), setting),
+		ConsecutiveFailures: state.ConsecutiveFailures,
+		HalfOpenSuccesses:   state.HalfOpenSuccesses,
+		OpenedAt:            state.OpenedAt,
+		LastFailureAt:       state.LastFailureAt,
+		LastError:           state.LastError,
+	}
+	if state.State == CircuitBreakerStateOpen {
+		snapshot.HalfOpenAt = state.OpenedAt + int64(setting.OpenSeconds)
+	}
+	return snapshot
+}
+
+// GetChannelCircuitBreakerSnapshot 返回渠道级熔断器状态
+func GetChannelCircuitBreakerSnapshot(channelId int) CircuitBreakerSnapshot {
+	return GetCircuitBreakerSnapshot(channelId, -1)
+}
+
+// ResetCircuitBreaker 重置熔断器，keyIndex 为 nil 时重置渠道级及该渠道所有 key 的熔断器
+func ResetCircuitBreaker(channelId int, keyIndex *int) (int, error) {
+	cache := getCircuitBreakerCache()
+	if keyIndex != nil {
+		res, err := cache.DeleteMany([]string{circuitBreakerKey(channelId, *keyIndex)})
+		if err != nil {
+			return 0, err
+		}
+		deleted := 0
+		for _, ok := range res {
+			if ok {
+				deleted++
+			}
+		}
+		return deleted, nil
+	}
+	return cache.DeleteByPrefix(strconv.Itoa(channelId) + ":")
+}
+
+// ChannelKeyFilter 返回多 Key 渠道选择 key 时使用的过滤函数，综合熔断状态与上游限流状态；均未启用时返回 nil。
+// 所有 key 的状态在调用时批量读取（Redis 下各一次 MGET），避免持有渠道轮询锁时逐个 key 访问 Redis
+func ChannelKeyFilter(channelId int, keyCount int) func(keyIndex int) bool {
+	breakerFilter := CircuitBreakerKeyFilter(channelId, keyCount)
+	if !operation_setting.GetUpstreamRateLimitSetting().Enabled || keyCount <= 0 {
+		return breakerFilter
+	}
+	limited := upstreamRateLimitedKeys(channelId, keyCount)
+	return func(keyIndex int) bool {
+		if limited[keyIndex] {
+			return false
+		}
+		return breakerFilter == nil || breakerFilter(keyIndex)
+	}
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerState_Transitions(t *testing.T) {
+	setting := &operation_setting.CircuitBreakerSetting{
+		Enabled:                  true,
+		FailureThreshold:         3,
+		OpenSeconds:              60,
+		HalfOpenProbeRatio:       0.1,
+		HalfOpenSuccessThreshold: 2,
+	}
+	now := int64(1_000)
+	state := CircuitBreakerState{}
+
+	// consecutive failures below threshold keep the breaker closed, a success resets the counter
+	state, _ = state.next(now, setting, true, "boom")
+	state, _ = state.next(now, setting, true, "boom")
+	require.Equal(t, CircuitBreakerStateClosed, state.effectiveState(now, setting))
+	state, changed := state.next(now, setting, false, "")
+	require.True(t, changed)
+	require.Zero(t, state.ConsecutiveFailures)
+
+	for i := 0; i < 3; i++ {
+		state, _ = state.next(now, setting, true, "boom")
+	}
+	require.Equal(t, CircuitBreakerStateOpen, state.effectiveState(now, setting))
+	require.Equal(t, now, state.OpenedAt)
+
+	// open expires into half-open, a failed probe re-opens it
+	probeTime := now + 60
+	require.Equal(t, CircuitBreakerStateHalfOpen, state.effectiveState(probeTime, setting))
+	reopened, _ := state.next(probeTime, setting, true, "still down")
+	require.Equal(t, CircuitBreakerStateOpen, reopened.effectiveState(probeTime, setting))
+	require.Equal(t, probeTime, reopened.OpenedAt)
+
+	// enough successful probes close it
+	state, _ = state.next(probeTime, setting, false, "")
+	require.Equal(t, CircuitBreakerStateHalfOpen, state.State)
+	state, _ = state.next(probeTime, setting, false, "")
+	require.Equal(t, CircuitBreakerStateClosed, state.effectiveState(probeTime, setting))
+	require.Zero(t, state.ConsecutiveFailures)
+}
+
+func TestCircuitBreakerState_SuccessWhileOpenIsIgnored(t *testing.T) {
+	setting := &operation_setting.CircuitBreakerSetting{FailureThreshold: 1, OpenSeconds: 60, HalfOpenSuccessThreshold: 1}
+	state, _ := CircuitBreakerState{}.next(100, setting, true, "boom")
+	require.Equal(t, CircuitBreakerStateOpen, state.State)
+
+	next, changed := state.next(110, setting, false, "")
+	require.False(t, changed)
+	require.Equal(t, CircuitBreakerStateOpen, next.effectiveState(110, setting))
+}
+
+func TestChannelKeyFilter_PrefetchesKeyStates(t *testing.T) {
+	setting := operation_setting.GetCircuitBreakerSetting()
+	saved := *setting
+	t.Cleanup(func() { *setting = saved })
+	setting.Enabled = true
+	setting.FailureThreshold = 1
+	setting.OpenSeconds = 60
+
+	channelId := 987654
+	_, _ = ResetCircuitBreaker(channelId, nil)
+	t.Cleanup(func() { _, _ = ResetCircuitBreaker(channelId, nil) })
+	observeCircuitBreaker(channelId, 1, true, "boom")
+
+	filter := ChannelKeyFilter(channelId, 3)
+	require.NotNil(t, filter)
+	// 状态在创建过滤函数时读取，之后的变化不影响本次选择
+	observeCircuitBreaker(channelId, 2, true, "boom")
+	require.True(t, filter(0))
+	require.False(t, filter(1))
+	require.True(t, filter(2))
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/openaicompat"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	conversationCleanupInterval  = time.Hour
+	conversationCleanupBatchSize = 100
+	// ConversationMaxItemsPerRequest 单次创建或追加的会话项上限，与 OpenAI 保持一致
+	ConversationMaxItemsPerRequest = 20
+)
+
+var (
+	conversationCleanupOnce    sync.Once
+	conversationCleanupRunning atomic.Bool
+)
+
+var errConversationItemTooLarge = errors.New("conversation item too large")
+
+var conversationItemIDPrefixes = map[string]string{
+	"message":              "msg",
+	"function_call":        "fc",
+	"function_call_output": "fco",
+	"reasoning":            "rs",
+	"web_search_call":      "ws",
+}
+
+// ParseConversationID 解析 Responses 请求的 conversation 参数
+func ParseConversationID(conversation []byte) (string, error) {
+	return openaicompat.ParseConversationID(conversation)
+}
+
+// normalizeConversationItem 补全会话项的类型、ID 与状态，并将字符串消息内容展开为内容片段
+func normalizeConversationItem(raw map[string]any) map[string]any {
+	item := make(map[string]any, len(raw)+2)
+	for key, value := range raw {
+		item[key] = value
+	}
+	itemType := common.Interface2String(item["type"])
+	if itemType == "" && item["role"] != nil {
+		itemType = "message"
+		item["type"] = itemType
+	}
+	if common.Interface2String(item["id"]) == "" {
+		prefix, ok := conversationItemIDPrefixes[itemType]
+		if !ok {
+			prefix = "item"
+		}
+		item["id"] = prefix + "_" + common.GetUUID()
+	}
+	if itemType != "message" {
+		return item
+	}
+	if _, ok := item["status"]; !ok {
+		item["status"] = "completed"
+	}
+	if text, ok := item["content"].(string); ok {
+		partType := "input_text"
+		if common.Interface2String(item["role"]) == "assistant" {
+			partType = "output_text"
+		}
+		item["content"] = []map[string]any{{"type": partType, "text": text}}
+	}
+	return item
+}
+
+func newConversationItem(raw map[string]any, maxItemBytes int, now int64) (*model.ConversationItem, error) {
+	item := normalizeConversationItem(raw)
+	content, err := common.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	if maxItemBytes > 0 && len(content) > maxItemBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the maximum size of %d bytes", errConversationItemTooLarge, len(content), maxItemBytes)
+	}
+	return &model.ConversationItem{
+		ItemId:    common.Interface2String(item["id"]),
+		Type:      common.Interface2String(item["type"]),
+		Content:   model.LargeText(content),
+		CreatedAt: now,
+	}, nil
+}
+
+// NewConversationItems 规范化会话项，单个会话项超过大小上限时返回错误
+func NewConversationItems(rawItems []map[string]any) ([]*model.ConversationItem, error) {
+	maxItemBytes := operation_setting.GetConversationSetting().MaxItemBytes
+	now := common.GetTimestamp()
+	items := make([]*model.ConversationItem, 0, len(rawItems))
+	for i, raw := range rawItems {
+		item, err := newConversationItem(raw, maxItemBytes, now)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// CreateConversation 为用户创建会话，metadata 为空时保存为空对象
+func CreateConversation(userId int, metadata json.RawMessage, rawItems []map[string]any) (*model.Conversation, error) {
+	items, err := NewConversationItems(rawItems)
+	if err != nil {
+		return nil, err
+	}
+	if len(metadata) == 0 || common.GetJsonType(metadata) != "object" {
+		metadata = json.RawMessage("{}")
+	}
+	now := common.GetTimestamp()
+	conversation := &model.Conversation{
+		ConversationId: "conv_" + common.GetUUID(),
+		UserId:         userId,
+		Metadata:       string(metadata),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := model.CreateConversation(conversation, items); err != nil {
+		return nil, err
+	}
+	return conversation, nil
+}
+
+// ConversationObject 构建 Conversations API 的会话对象
+func ConversationObject(conversation *model.Conversation) map[string]any {
+	metadata := json.RawMessage(conversation.Metadata)
+	if len(metadata) == 0 {
+		metadata = json.RawMessage("{}")
+	}
+	return map[string]any{
+		"id":         conversation.ConversationId,
+		"object":     "conversation",
+		"created_at": conversation.CreatedAt,
+		"metadata":   metadata,
+	}
+}
+
+// ConversationItemsList 构建会话项列表响应
+func ConversationItemsList(items []*model.ConversationItem, hasMore bool) map[string]any {
+	data := make([]json.RawMessage, 0, len(items))
+	for _, item := range items {
+		data = append(data, json.RawMessage(item.Content))
+	}
+	list := map[string]any{
+		"object":   "list",
+		"data":     data,
+		"first_id": nil,
+		"last_id":  nil,
+		"has_more": hasMore,
+	}
+	if len(items) > 0 {
+		list["first_id"] = items[0].ItemId
+		list["last_id"] = items[len(items)-1].ItemId
+	}
+	return list
+}
+
+// AppendConversationItems 向会话追加会话项，超出会话项上限时删除最早的会话项
+func AppendConversationItems(conversation *model.Conversation, rawItems []map[string]any) ([]*model.ConversationItem, error) {
+	items, err := NewConversationItems(rawItems)
+	if err != nil {
+		return nil, err
+	}
+	if err := addConversationItems(conversation, items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func addConversationItems(conversation *model.Conversation, items []*model.ConversationItem) error {
+	maxItems := operation_setting.GetConversationSetting().MaxItems
+	return model.AddConversationItems(conversation, items, maxItems, common.GetTimestamp())
+}
+
+// LoadConversationInput 返回会话中可作为 Responses 输入的会话项
+func LoadConversationInput(conversation *model.Conversation) ([]map[string]any, error) {
+	items, err := model.GetAllConversationItems(conversation.ConversationId)
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]map[string]any, 0, len(items))
+	for _, item := range items {
+		var content map[string]any
+		if err := common.UnmarshalJsonStr(string(item.Content), &content); err != nil {
+			return nil, fmt.Errorf("invalid conversation item %s: %w", item.ItemId, err)
+		}
+		contents = append(contents, content)
+	}
+	return openaicompat.ResponsesOutputToInputItems(contents), nil
+}
+
+// GetConversation 获取用户的会话，不存在时返回 (nil, nil)
+func GetConversation(userId int, conversationId string) (*model.Conversation, error) {
+	return model.GetConversation(userId, conversationId)
+}
+
+// AppendResponseToConversation 将一次 Responses 请求的输入项与输出项追加到会话，
+// 超过大小上限的会话项单独跳过并记录日志，不影响本轮其他会话项
+func AppendResponseToConversation(conversation *model.Conversation, inputItems []map[string]any, responseJSON []byte) {
+	rawItems := append([]map[string]any{}, inputItems...)
+	for _, output := range gjson.GetBytes(responseJSON, "output").Array() {
+		var item map[string]any
+		if err := common.UnmarshalJsonStr(output.Raw, &item); err == nil {
+			rawItems = append(rawItems, item)
+		}
+	}
+	maxItemBytes := operation_setting.GetConversationSetting().MaxItemBytes
+	now := common.GetTimestamp()
+	items := make([]*model.ConversationItem, 0, len(rawItems))
+	for i, raw := range rawItems {
+		item, err := newConversationItem(raw, maxItemBytes, now)
+		if err != nil {
+			logger.LogWarn(context.Background(), fmt.Sprintf("skip item %d of conversation %s: %s", i, conversation.ConversationId, err.Error()))
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return
+	}
+	if err := addConversationItems(conversation, items); err != nil {
+		logger.LogError(context.Background(), fmt.Sprintf("failed to append items to conversation %s: %s", conversation.ConversationId, err.Error()))
+	}
+}
+
+// StartConversationCleanupTask 定期清理超过留存天数未更新的会话
+func StartConversationCleanupTask() {
+	conversationCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(conversationCleanupInterval)
+			defer ticker.Stop()
+
+			runConversationCleanupOnce()
+			for range ticker.C {
+				runConversationCleanupOnce()
+			}
+		})
+	})
+}
+
+// CleanupExpiredConversations 清理超过留存天数未更新的会话，定时任务与清理历史日志时执行
+func CleanupExpiredConversations(ctx context.Context) (int64, error) {
+	retentionDays := operation_setting.GetConversationSetting().RetentionDays
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+	targetTimestamp := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	return model.DeleteExpiredConversations(ctx, targetTimestamp, conversationCleanupBatchSize)
+}
+
+func runConversationCleanupOnce() {
+	if !conversationCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer conversationCleanupRunning.Store(false)
+
+	ctx := context.Background()
+	count, err := CleanupExpiredConversations(ctx)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("conversation cleanup task failed: %v", err))
+		return
+	}
+	if common.DebugEnabled && count > 0 {
+		logger.LogDebug(ctx, "conversation cleanup: deleted_count=%d", count)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversationItemsRoundTrip(t *testing.T) {
+	t.Cleanup(func() {
+		model.DB.Exec("DELETE FROM conversations")
+		model.DB.Exec("DELETE FROM conversation_items")
+	})
+
+	conversation, err := CreateConversation(1, nil, []map[string]any{
+		{"role": "user", "content": "hi"},
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(conversation.ConversationId, "conv_"))
+	require.Equal(t, 1, conversation.ItemCount)
+
+	found, err := GetConversation(2, conversation.ConversationId)
+	require.NoError(t, err)
+	require.Nil(t, found, "conversation must be scoped to its user")
+
+	responseJSON := []byte(`{"output":[
+		{"type":"reasoning","id":"rs_1","summary":[]},
+		{"type":"message","id":"msg_1","role":"assistant","status":"completed","content":[{"type":"output_text","text":"hello","annotations":[]}]}
+	]}`)
+	AppendResponseToConversation(conversation, []map[string]any{{"role": "user", "content": "again"}}, responseJSON)
+	require.Equal(t, 4, conversation.ItemCount)
+
+	input, err := LoadConversationInput(conversation)
+	require.NoError(t, err)
+	require.Len(t, input, 3)
+	require.Equal(t, "input_text", input[0]["content"].([]any)[0].(map[string]any)["type"])
+	require.Equal(t, "assistant", input[2]["role"])
+	require.NotContains(t, input[2], "id")
+
+	items, hasMore, err := model.GetConversationItems(conversation.ConversationId, "", 2, true)
+	require.NoError(t, err)
+	require.True(t, hasMore)
+	require.Equal(t, "msg_1", items[0].ItemId)
+
+	setting := operation_setting.GetConversationSetting()
+	maxItems, maxItemBytes := setting.MaxItems, setting.MaxItemBytes
+	t.Cleanup(func() { setting.MaxItems, setting.MaxItemBytes = maxItems, maxItemBytes })
+
+	setting.MaxItems = 3
+	_, err = AppendConversationItems(conversation, []map[string]any{{"role": "user", "content": "trim"}})
+	require.NoError(t, err)
+	require.Equal(t, 3, conversation.ItemCount)
+	all, err := model.GetAllConversationItems(conversation.ConversationId)
+	require.NoError(t, err)
+	require.Equal(t, "rs_1", all[0].ItemId)
+
+	setting.MaxItemBytes = 64
+	_, err = AppendConversationItems(conversation, []map[string]any{{"role": "user", "content": strings.Repeat("x", 100)}})
+	require.Error(t, err)
+
+	// 追加响应时只跳过超限的会话项
+	setting.MaxItems, setting.MaxItemBytes = 10, 200
+	AppendResponseToConversation(conversation, []map[string]any{
+		{"role": "user", "content": strings.Repeat("x", 200)},
+		{"role": "user", "content": "ok"},
+	}, []byte(`{"output":[]}`))
+	require.Equal(t, 4, conversation.ItemCount)
+}
+
+func TestParseConversationID(t *testing.T) {
+	id, err := ParseConversationID([]byte(`"conv_1"`))
+	require.NoError(t, err)
+	require.Equal(t, "conv_1", id)
+
+	id, err = ParseConversationID([]byte(`{"id":"conv_2"}`))
+	require.NoError(t, err)
+	require.Equal(t, "conv_2", id)
+
+	_, err = ParseConversationID([]byte(`1`))
+	require.Error(t, err)
+}
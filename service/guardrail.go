@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const guardrailRedactedText = "[REDACTED]"
+
+// GuardrailDecision 一条规则的审核结果，写入日志 Other 的 guardrail 字段
+type GuardrailDecision struct {
+	Rule     string   `json:"rule"`
+	Provider string   `json:"provider"`
+	Action   string   `json:"action"`
+	Matches  []string `json:"matches,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// guardrailResult 规则的命中情况：matches 为命中的类别或 PII 类型，redact 改写单段文本
+type guardrailResult struct {
+	matches []string
+	redact  func(text string) string
+}
+
+// ApplyGuardrails 在转发前按规则审核请求文本：block 返回 OpenAI 格式的错误，redact 改写 request 并记录改写供透传时使用，flag 仅记录
+func ApplyGuardrails(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) *types.NewAPIError {
+	setting := operation_setting.GetGuardrailSetting()
+	if !setting.Enabled || len(setting.Rules) == 0 || request == nil {
+		return nil
+	}
+	var texts []string
+	decisions := make([]GuardrailDecision, 0)
+	redactions := make([]func(text string) string, 0)
+	defer func() {
+		if len(decisions) > 0 {
+			common.SetContextKey(c, constant.ContextKeyGuardrailDecisions, decisions)
+		}
+		if len(redactions) > 0 {
+			common.SetContextKey(c, constant.ContextKeyGuardrailRedactions, redactions)
+		}
+	}()
+
+	for i := range setting.Rules {
+		rule := &setting.Rules[i]
+		if !rule.Match(info.UsingGroup, info.TokenId) {
+			continue
+		}
+		if texts == nil {
+			collected, err := CollectRequestTexts(request)
+			if err != nil {
+				logger.LogError(c, "guardrail: failed to collect request texts: "+err.Error())
+				return nil
+			}
+			if len(collected) == 0 {
+				return nil
+			}
+			texts = collected
+		}
+
+		result, err := evaluateGuardrailRule(c, info, rule, texts)
+		if err != nil {
+			logger.LogError(c, fmt.Sprintf("guardrail rule %s failed: %s", rule.Name, err.Error()))
+			decisions = append(decisions, GuardrailDecision{Rule: rule.Name, Provider: rule.Provider, Action: rule.Action, Error: err.Error()})
+			if !setting.FailOpen {
+				return types.NewErrorWithStatusCode(fmt.Errorf("guardrail %s unavailable", rule.Name), types.ErrorCodeGuardrailBlocked, http.StatusServiceUnavailable, types.ErrOptionWithSkipRetry())
+			}
+			continue
+		}
+		if result == nil || len(result.matches) == 0 {
+			continue
+		}
+		decisions = append(decisions, GuardrailDecision{Rule: rule.Name, Provider: rule.Provider, Action: rule.Action, Matches: result.matches})
+
+		switch rule.Action {
+		case operation_setting.GuardrailActionBlock:
+			recordGuardrailBlock(c, info, decisions)
+			return types.WithOpenAIError(types.OpenAIError{
+				Message: fmt.Sprintf("request blocked by guardrail %s: %s", rule.Name, strings.Join(result.matches, ", ")),
+				Type:    "invalid_request_error",
+				Code:    string(types.ErrorCodeGuardrailBlocked),
+			}, http.StatusBadRequest, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		case operation_setting.GuardrailActionRedact:
+			changed, err := RewriteRequestText(request, result.redact)
+			if err != nil {
+				logger.LogError(c, "guardrail: failed to redact request: "+err.Error())
+				continue
+			}
+			if changed {
+				// 后续规则基于脱敏后的文本审核
+				texts = nil
+				redactions = append(redactions, result.redact)
+			}
+		}
+	}
+	return nil
+}
+
+// GetGuardrailDecisions 返回当前请求的审核结果
+func GetGuardrailDecisions(c *gin.Context) []GuardrailDecision {
+	decisions, _ := common.GetContextKeyType[[]GuardrailDecision](c, constant.ContextKeyGuardrailDecisions)
+	return decisions
+}
+
+// getGuardrailRedactions 返回当前请求按顺序执行过的审核改写
+func getGuardrailRedactions(c *gin.Context) []func(text string) string {
+	if c == nil {
+		return nil
+	}
+	redactions, _ := common.GetContextKeyType[[]func(text string) string](c, constant.ContextKeyGuardrailRedactions)
+	return redactions
+}
+
+func evaluateGuardrailRule(c *gin.Context, info *relaycommon.RelayInfo, rule *operation_setting.GuardrailRule, texts []string) (*guardrailResult, error) {
+	switch rule.Provider {
+	case operation_setting.GuardrailProviderRegex:
+		return evaluateRegexRule(rule, texts), nil
+	case operation_setting.GuardrailProviderModeration:
+		return evaluateModerationRule(c, info, rule, texts)
+	}
+	return nil, fmt.Errorf("unknown guardrail provider: %s", rule.Provider)
+}
+
+func evaluateRegexRule(rule *operation_setting.GuardrailRule, texts []string) *guardrailResult {
+	matched := make([]string, 0)
+	for _, text := range texts {
+		for _, m := range FindPII(text, rule.PIITypes, rule.Patterns) {
+			matched = append(matched, m.Type)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	return &guardrailResult{
+		matches: RemoveDuplicate(matched),
+		redact: func(text string) string {
+			return ReplacePII(text, FindPII(text, rule.PIITypes, rule.Patterns), func(m PIIMatch) string {
+				return "[REDACTED:" + m.Type + "]"
+			})
+		},
+	}
+}
+
+func evaluateModerationRule(c *gin.Context, info *relaycommon.RelayInfo, rule *operation_setting.GuardrailRule, texts []string) (*guardrailResult, error) {
+	response, err := requestModeration(c, info, rule, texts)
+	if err != nil {
+		return nil, err
+	}
+	flaggedTexts := make(map[string]bool)
+	matched := make([]string, 0)
+	for i, result := range response.Results {
+		if i >= len(texts) {
+			break
+		}
+		categories := moderationMatchedCategories(rule, result)
+		if len(categories) == 0 {
+			continue
+		}
+		flaggedTexts[texts[i]] = true
+		matched = append(matched, categories...)
+	}
+	if len(matched) == 0 {
+		return nil, nil
+	}
+	return &guardrailResult{
+		matches: RemoveDuplicate(matched),
+		redact: func(text string) string {
+			// 审核接口只给出整段结果，命中的文本段整体替换
+			if flaggedTexts[text] {
+				return guardrailRedactedText
+			}
+			return text
+		},
+	}, nil
+}
+
+func moderationMatchedCategories(rule *operation_setting.GuardrailRule, result dto.OpenAIModerationResult) []string {
+	matched := make([]string, 0)
+	if len(rule.Categories) == 0 && rule.Threshold <= 0 {
+		if !result.Flagged {
+			return nil
+		}
+		for category, flagged := range result.Categories {
+			if flagged {
+				matched = append(matched, category)
+			}
+		}
+		if len(matched) == 0 {
+			matched = append(matched, "flagged")
+		}
+		return matched
+	}
+	categories := rule.Categories
+	if len(categories) == 0 {
+		for category := range result.CategoryScores {
+			categories = append(categories, category)
+		}
+	}
+	for _, category := range categories {
+		if rule.Threshold > 0 {
+			if result.CategoryScores[category] >= rule.Threshold {
+				matched = append(matched, category)
+			}
+		} else if result.Categories[category] {
+			matched = append(matched, category)
+		}
+	}
+	return matched
+}
+
+func getModerationChannel(c *gin.Context, info *relaycommon.RelayInfo, rule *operation_setting.GuardrailRule) (*model.Channel, error) {
+	if rule.ChannelId > 0 {
+		return model.CacheGetChannel(rule.ChannelId)
+	}
+	groups := []string{info.UsingGroup}
+	if info.UsingGroup == "auto" {
+		groups = GetUserAutoGroup(common.GetContextKeyString(c, constant.ContextKeyUserGroup))
+	}
+	for _, group := range groups {
+		channel, err := model.GetRandomSatisfiedChannel(group, rule.Model, 0)
+		if err == nil && channel != nil {
+			return channel, nil
+		}
+	}
+	return nil, fmt.Errorf("no available channel for moderation model %s", rule.Model)
+}
+
+func requestModeration(c *gin.Context, info *relaycommon.RelayInfo, rule *operation_setting.GuardrailRule, texts []string) (*dto.OpenAIModerationResponse, error) {
+	channel, err := getModerationChannel(c, info, rule)
+	if err != nil {
+		return nil, err
+	}
+	key, _, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	body, err := common.Marshal(dto.OpenAIModerationRequest{Model: rule.Model, Input: texts})
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(operation_setting.GetGuardrailSetting().TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = constant.ChannelBaseURLs[channel.Type]
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "application/json")
+	client, err := GetHttpClientWithProxy(channel.GetSetting().Proxy)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseResponseBodyGracefully(resp)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation request failed: status %d, body %s", resp.StatusCode, string(data))
+	}
+	var response dto.OpenAIModerationResponse
+	if err := common.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Results) == 0 {
+		return nil, errors.New("moderation response has no results")
+	}
+	return &response, nil
+}
+
+// recordGuardrailBlock 被拦截的请求不会产生消费日志，单独记录一条错误日志
+func recordGuardrailBlock(c *gin.Context, info *relaycommon.RelayInfo, decisions []GuardrailDecision) {
+	other := map[string]any{
+		"guardrail":    decisions,
+		"request_path": c.Request.URL.Path,
+	}
+	useTimeSeconds := int(time.Now().Unix() - info.StartTime.Unix())
+	model.RecordErrorLog(c, info.UserId, 0, info.OriginModelName, c.GetString("token_name"), "请求被内容审核规则拦截",
+		info.TokenId, useTimeSeconds, info.IsStream, info.UsingGroup, other)
+}
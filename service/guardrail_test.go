@@ -0,0 +1,87 @@
+package service
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestRewriteRequestText_OpenAIAndClaude(t *testing.T) {
+	openaiReq := &dto.GeneralOpenAIRequest{
+		Model: "gpt-4o",
+		Messages: []dto.Message{
+			{Role: "system", Content: "mail me at a@b.com"},
+			{Role: "user", Content: []any{
+				map[string]any{"type": "text", "text": "a@b.com here"},
+				map[string]any{"type": "image_url", "image_url": map[string]any{"url": "https://a@b.com/x.png"}},
+			}},
+		},
+	}
+	changed, err := RewriteRequestText(openaiReq, func(text string) string {
+		return ReplacePII(text, FindPII(text, []string{PIITypeEmail}, nil), func(m PIIMatch) string { return "[email]" })
+	})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "mail me at [email]", openaiReq.Messages[0].StringContent())
+	content := openaiReq.Messages[1].ParseContent()
+	require.Len(t, content, 2)
+	assert.Equal(t, "[email] here", content[0].Text)
+	assert.Equal(t, "https://a@b.com/x.png", content[1].GetImageMedia().Url)
+
+	claudeReq := &dto.ClaudeRequest{
+		Model:    "claude-sonnet-4",
+		System:   "system text",
+		Messages: []dto.ClaudeMessage{{Role: "user", Content: "hello"}},
+	}
+	texts, err := CollectRequestTexts(claudeReq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"system text", "hello"}, texts)
+}
+
+func TestEvaluateRegexRule(t *testing.T) {
+	rule := &operation_setting.GuardrailRule{Name: "pii", Provider: operation_setting.GuardrailProviderRegex, PIITypes: []string{PIITypePhone}}
+	assert.Nil(t, evaluateRegexRule(rule, []string{"nothing here"}))
+
+	result := evaluateRegexRule(rule, []string{"call 13812345678", "or 13987654321"})
+	require.NotNil(t, result)
+	assert.Equal(t, []string{PIITypePhone}, result.matches)
+	assert.Equal(t, "call [REDACTED:phone]", result.redact("call 13812345678"))
+}
+
+func TestModerationMatchedCategories(t *testing.T) {
+	result := dto.OpenAIModerationResult{
+		Flagged:        true,
+		Categories:     map[string]bool{"violence": true, "harassment": false},
+		CategoryScores: map[string]float64{"violence": 0.91, "harassment": 0.4},
+	}
+	assert.Equal(t, []string{"violence"}, moderationMatchedCategories(&operation_setting.GuardrailRule{}, result))
+	assert.Empty(t, moderationMatchedCategories(&operation_setting.GuardrailRule{Categories: []string{"harassment"}}, result))
+	assert.Equal(t, []string{"harassment"}, moderationMatchedCategories(&operation_setting.GuardrailRule{Categories: []string{"harassment"}, Threshold: 0.3}, result))
+}
+
+func TestPassThroughRequestBody_AppliesGuardrailRedactions(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	storage, err := common.CreateBodyStorage([]byte(`{"model":"gpt-4o","messages":[{"role":"user","content":"call 13812345678"}]}`))
+	require.NoError(t, err)
+	defer storage.Close()
+
+	rule := &operation_setting.GuardrailRule{Name: "pii", Provider: operation_setting.GuardrailProviderRegex, PIITypes: []string{PIITypePhone}}
+	result := evaluateRegexRule(rule, []string{"call 13812345678"})
+	require.NotNil(t, result)
+	common.SetContextKey(c, constant.ContextKeyGuardrailRedactions, []func(text string) string{result.redact})
+
+	reader, err := PassThroughRequestBody(c, storage)
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "call [REDACTED:phone]", gjson.GetBytes(body, "messages.0.content").String())
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrHedgeLost 对冲请求未胜出，写出被丢弃
+var ErrHedgeLost = errors.New("hedged request lost")
+
+const (
+	HedgeRoleWinner = "winner"
+	HedgeRoleLoser  = "loser"
+)
+
+// HedgeGroup 同一请求的多次对冲尝试，首个向客户端写出内容的尝试胜出，其余尝试被取消
+type HedgeGroup struct {
+	target gin.ResponseWriter
+
+	mu       sync.Mutex
+	attempts []*HedgeAttempt
+	winner   *HedgeAttempt
+	won      chan struct{}
+}
+
+// HedgeAttempt 一次对冲尝试，拥有独立的 Writer 与请求上下文
+type HedgeAttempt struct {
+	group     *HedgeGroup
+	ChannelId int
+	cancel    context.CancelFunc
+	writer    *hedgeWriter
+}
+
+// HedgeLogInfo 对冲信息，写入日志 Other 的 hedge 字段
+type HedgeLogInfo struct {
+	Role            string `json:"role"`
+	ChannelId       int    `json:"channel_id"`
+	WinnerChannelId int    `json:"winner_channel_id"`
+	Channels        []int  `json:"channels"`
+}
+
+// ShouldHedge 判断当前请求是否开启对冲，仅对文本类的 OpenAI / Claude / Responses / Gemini 请求生效
+func ShouldHedge(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	switch info.RelayFormat {
+	case types.RelayFormatOpenAI, types.RelayFormatClaude, types.RelayFormatOpenAIResponses, types.RelayFormatGemini:
+	default:
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	return operation_setting.GetHedgeSetting().Match(info.UsingGroup, info.TokenId)
+}
+
+func NewHedgeGroup(target gin.ResponseWriter) *HedgeGroup {
+	return &HedgeGroup{
+		target: target,
+		won:    make(chan struct{}),
+	}
+}
+
+// Attach 将子上下文作为一次对冲尝试：替换其 Writer，并派生可单独取消的请求上下文
+func (g *HedgeGroup) Attach(c *gin.Context, channelId int) *HedgeAttempt {
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	attempt := &HedgeAttempt{
+		group:     g,
+		ChannelId: channelId,
+		cancel:    cancel,
+	}
+	attempt.writer = &hedgeWriter{attempt: attempt, header: make(http.Header), status: http.StatusOK}
+	c.Writer = attempt.writer
+	common.SetContextKey(c, constant.ContextKeyHedgeAttempt, attempt)
+
+	g.mu.Lock()
+	g.attempts = append(g.attempts, attempt)
+	g.mu.Unlock()
+	return attempt
+}
+
+// Won 在决出胜者后关闭
+func (g *HedgeGroup) Won() <-chan struct{} {
+	return g.won
+}
+
+// Winner 返回胜出的尝试，尚未决出时返回 nil
+func (g *HedgeGroup) Winner() *HedgeAttempt {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.winner
+}
+
+// claim 尝试成为胜者：将暂存的响应头写到客户端，并取消其余尝试
+func (g *HedgeGroup) claim(attempt *HedgeAttempt) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.winner != nil {
+		return g.winner == attempt
+	}
+	g.winner = attempt
+	header := g.target.Header()
+	for key, values := range attempt.writer.header {
+		header[key] = values
+	}
+	g.target.WriteHeader(attempt.writer.status)
+	for _, other := range g.attempts {
+		if other != attempt {
+			other.cancel()
+		}
+	}
+	close(g.won)
+	return true
+}
+
+// Role 返回尝试的角色，尚未决出胜者时返回空字符串
+func (a *HedgeAttempt) Role() string {
+	winner := a.group.Winner()
+	switch {
+	case winner == nil:
+		return ""
+	case winner == a:
+		return HedgeRoleWinner
+	default:
+		return HedgeRoleLoser
+	}
+}
+
+// Cancel 取消该尝试的请求上下文
+func (a *HedgeAttempt) Cancel() {
+	a.cancel()
+}
+
+// LogInfo 返回写入日志的对冲信息，只有一次尝试（未触发对冲）时返回 nil
+func (a *HedgeAttempt) LogInfo() *HedgeLogInfo {
+	g := a.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.attempts) < 2 {
+		return nil
+	}
+	info := &HedgeLogInfo{Role: HedgeRoleLoser, ChannelId: a.ChannelId}
+	for _, attempt := range g.attempts {
+		info.Channels = append(info.Channels, attempt.ChannelId)
+	}
+	if g.winner != nil {
+		info.WinnerChannelId = g.winner.ChannelId
+	}
+	if g.winner == a {
+		info.Role = HedgeRoleWinner
+	}
+	return info
+}
+
+// GetHedgeAttempt 返回当前上下文对应的对冲尝试，未开启对冲时返回 nil
+func GetHedgeAttempt(c *gin.Context) *HedgeAttempt {
+	attempt, ok := common.GetContextKeyType[*HedgeAttempt](c, constant.ContextKeyHedgeAttempt)
+	if !ok {
+		return nil
+	}
+	return attempt
+}
+
+// IsHedgeLoser 当前上下文是否为未胜出的对冲尝试
+func IsHedgeLoser(c *gin.Context) bool {
+	attempt := GetHedgeAttempt(c)
+	return attempt != nil && attempt.Role() == HedgeRoleLoser
+}
+
+// isUnbilledHedgeLoser 未胜出且不计费的对冲尝试
+func isUnbilledHedgeLoser(c *gin.Context) bool {
+	return IsHedgeLoser(c) && !operation_setting.GetHedgeSetting().BillBoth
+}
+
+// SettleHedgeLoser 结算未胜出而被取消的对冲尝试：开启 bill_both 时按预扣费与预估额度中的较大者扣费，否则退还预扣费。
+// 返回扣除的额度。
+func SettleHedgeLoser(c *gin.Context, info *relaycommon.RelayInfo) int {
+	if info.Billing == nil {
+		return 0
+	}
+	if !operation_setting.GetHedgeSetting().BillBoth {
+		info.Billing.Refund(c)
+		return 0
+	}
+	quota := max(info.Billing.GetPreConsumedQuota(), info.PriceData.QuotaToPreConsume)
+	if err := info.Billing.Settle(quota); err != nil {
+		logger.LogError(c, "error settling cancelled hedged request: "+err.Error())
+		return 0
+	}
+	model.UpdateUserUsedQuotaAndRequestCount(info.UserId, quota)
+	model.UpdateChannelUsedQuota(info.ChannelId, quota)
+	return quota
+}
+
+// hedgeWriter 在决出胜者前暂存响应头，首次写出内容时争夺胜者，未胜出的写出返回 ErrHedgeLost
+type hedgeWriter struct {
+	attempt *HedgeAttempt
+	header  http.Header
+	status  int
+}
+
+func (w *hedgeWriter) isWinner() bool {
+	return w.attempt.group.Winner() == w.attempt
+}
+
+// isPing SSE 保活注释不参与争夺胜者
+func isPing(b []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(b), []byte(":"))
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.isWinner() {
+		return w.attempt.group.target.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.isWinner() {
+		w.attempt.group.target.WriteHeader(code)
+		return
+	}
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.isWinner() {
+		w.attempt.group.target.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Write(b []byte) (int, error) {
+	if w.attempt.group.Winner() == nil && isPing(b) {
+		return len(b), nil
+	}
+	if !w.attempt.group.claim(w.attempt) {
+		return 0, ErrHedgeLost
+	}
+	return w.attempt.group.target.Write(b)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.isWinner() {
+		return w.attempt.group.target.Status()
+	}
+	return w.status
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.isWinner() {
+		return w.attempt.group.target.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.isWinner() && w.attempt.group.target.Written()
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.isWinner() {
+		w.attempt.group.target.Flush()
+	}
+}
+
+func (w *hedgeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, errors.New("hedged response does not support hijack")
+}
+
+func (w *hedgeWriter) CloseNotify() <-chan bool {
+	return w.attempt.group.target.CloseNotify()
+}
+
+func (w *hedgeWriter) Pusher() http.Pusher {
+	return nil
+}
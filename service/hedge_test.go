@@ -0,0 +1,72 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newHedgeTestContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, recorder
+}
+
+func TestHedgeGroup_FirstWriterWins(t *testing.T) {
+	c, recorder := newHedgeTestContext(t)
+	group := NewHedgeGroup(c.Writer)
+
+	primary := c.Copy()
+	secondary := c.Copy()
+	primaryAttempt := group.Attach(primary, 1)
+	secondaryAttempt := group.Attach(secondary, 2)
+
+	// 保活注释不参与争夺胜者
+	_, err := primary.Writer.WriteString(": PING\n\n")
+	require.NoError(t, err)
+	require.Nil(t, group.Winner())
+
+	secondary.Writer.Header().Set("Content-Type", "text/event-stream")
+	secondary.Writer.WriteHeader(http.StatusAccepted)
+	_, err = secondary.Writer.WriteString("data: hello\n\n")
+	require.NoError(t, err)
+
+	require.Equal(t, secondaryAttempt, group.Winner())
+	require.Equal(t, HedgeRoleWinner, secondaryAttempt.Role())
+	require.Equal(t, HedgeRoleLoser, primaryAttempt.Role())
+	require.Error(t, primary.Request.Context().Err())
+	require.NoError(t, secondary.Request.Context().Err())
+
+	_, err = primary.Writer.WriteString("data: late\n\n")
+	require.ErrorIs(t, err, ErrHedgeLost)
+
+	require.Equal(t, http.StatusAccepted, recorder.Code)
+	require.Equal(t, "text/event-stream", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "data: hello\n\n", recorder.Body.String())
+
+	logInfo := primaryAttempt.LogInfo()
+	require.NotNil(t, logInfo)
+	require.Equal(t, HedgeRoleLoser, logInfo.Role)
+	require.Equal(t, 2, logInfo.WinnerChannelId)
+	require.Equal(t, []int{1, 2}, logInfo.Channels)
+}
+
+func TestHedgeGroup_SingleAttemptHasNoLogInfo(t *testing.T) {
+	c, _ := newHedgeTestContext(t)
+	group := NewHedgeGroup(c.Writer)
+
+	primary := c.Copy()
+	attempt := group.Attach(primary, 1)
+	_, err := primary.Writer.WriteString("{}")
+	require.NoError(t, err)
+
+	require.Equal(t, attempt, GetHedgeAttempt(primary))
+	require.False(t, IsHedgeLoser(primary))
+	require.Nil(t, attempt.LogInfo())
+}
@@ -55,6 +55,21 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["is_system_prompt_overwritten"] = true
 	}
 
+	if decisions := GetGuardrailDecisions(ctx); len(decisions) > 0 {
+		other["guardrail"] = decisions
+	}
+	if fallback := GetModelFallbackInfo(ctx); fallback != nil {
+		other["model_fallback"] = fallback
+	}
+	if failover := GetStreamFailoverInfo(ctx); failover != nil {
+		other["stream_failover"] = failover
+	}
+	if attempt := GetHedgeAttempt(ctx); attempt != nil {
+		if hedge := attempt.LogInfo(); hedge != nil {
+			other["hedge"] = hedge
+		}
+	}
+
 	adminInfo := make(map[string]interface{})
 	adminInfo["use_channel"] = ctx.GetStringSlice("use_channel")
 	isMultiKey := common.GetContextKeyBool(ctx, constant.ContextKeyChannelIsMultiKey)
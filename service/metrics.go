@@ -0,0 +1,44 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/metrics"
+)
+
+func init() {
+	metrics.SetChannelStateProvider(collectChannelStates)
+	metrics.SetTaskQueueProvider(model.CountUnFinishSyncTasksByPlatform)
+}
+
+func channelStatusName(status int) string {
+	switch status {
+	case common.ChannelStatusEnabled:
+		return "enabled"
+	case common.ChannelStatusManuallyDisabled:
+		return "manually_disabled"
+	case common.ChannelStatusAutoDisabled:
+		return "auto_disabled"
+	default:
+		return "unknown"
+	}
+}
+
+// collectChannelStates 抓取指标时读取全部渠道的启用状态
+func collectChannelStates() ([]metrics.ChannelState, error) {
+	channels, err := model.GetChannelStatusList()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]metrics.ChannelState, 0, len(channels))
+	for _, ch := range channels {
+		states = append(states, metrics.ChannelState{
+			Id:         ch.Id,
+			Name:       ch.Name,
+			Type:       ch.Type,
+			Status:     ch.Status,
+			StatusName: channelStatusName(ch.Status),
+		})
+	}
+	return states, nil
+}
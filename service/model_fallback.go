@@ -0,0 +1,140 @@
+package service
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelFallbackInfo 模型备用链的切换记录，写入日志 Other 的 model_fallback 字段
+type ModelFallbackInfo struct {
+	RequestedModel string   `json:"requested_model"`
+	UsedModel      string   `json:"used_model"`
+	TriedModels    []string `json:"tried_models"`
+	Reasons        []string `json:"reasons"`
+}
+
+// ClassifyFallbackError 将错误归类为备用链的错误类别，无法归类时返回空字符串
+func ClassifyFallbackError(err *types.NewAPIError) string {
+	if err == nil {
+		return ""
+	}
+	if err.GetErrorCode() == types.ErrorCodeGetChannelFailed {
+		return operation_setting.ModelFallbackErrorNoChannel
+	}
+	message := strings.ToLower(err.Error())
+	if strings.Contains(string(err.GetErrorCode()), "context_length") ||
+		strings.Contains(message, "context_length_exceeded") ||
+		strings.Contains(message, "maximum context length") {
+		return operation_setting.ModelFallbackErrorContextLength
+	}
+	switch code := err.StatusCode; {
+	case code == http.StatusTooManyRequests:
+		return operation_setting.ModelFallbackErrorRateLimit
+	case code == http.StatusRequestTimeout || code == http.StatusGatewayTimeout || code == 524:
+		return operation_setting.ModelFallbackErrorTimeout
+	case code >= 500 && code <= 599:
+		return operation_setting.ModelFallbackErrorServerError
+	}
+	return ""
+}
+
+// GetModelFallbackInfo 返回当前请求的备用链切换记录，未切换时返回 nil
+func GetModelFallbackInfo(c *gin.Context) *ModelFallbackInfo {
+	fallback, ok := common.GetContextKeyType[*ModelFallbackInfo](c, constant.ContextKeyModelFallback)
+	if !ok {
+		return nil
+	}
+	return fallback
+}
+
+func tokenAllowsModel(c *gin.Context, modelName string) bool {
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		return true
+	}
+	limit, ok := common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+	if !ok {
+		return false
+	}
+	return limit[ratio_setting.FormatMatchingModelName(modelName)]
+}
+
+// nextFallbackCandidate 返回备用链上下一个未尝试且令牌允许的模型
+func nextFallbackCandidate(c *gin.Context, info *relaycommon.RelayInfo) (string, bool) {
+	requestedModel := info.OriginModelName
+	tried := []string{info.OriginModelName}
+	if fallback := GetModelFallbackInfo(c); fallback != nil {
+		requestedModel = fallback.RequestedModel
+		tried = fallback.TriedModels
+	}
+	for _, candidate := range operation_setting.GetModelFallbackSetting().GetChain(info.UsingGroup, requestedModel) {
+		if candidate == "" || slices.Contains(tried, candidate) || !tokenAllowsModel(c, candidate) {
+			continue
+		}
+		return candidate, true
+	}
+	return "", false
+}
+
+func canFallbackModel(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	if !operation_setting.GetModelFallbackSetting().Enabled || info.RelayFormat == types.RelayFormatOpenAIRealtime {
+		return false
+	}
+	if c.Writer.Written() {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	return true
+}
+
+// ShouldSkipRetryForFallback 错误类别配置为立即切换且存在可用的备用模型时，不再重试当前模型
+func ShouldSkipRetryForFallback(c *gin.Context, info *relaycommon.RelayInfo, err *types.NewAPIError) bool {
+	if !canFallbackModel(c, info) {
+		return false
+	}
+	if !operation_setting.GetModelFallbackSetting().IsFallbackErrorClass(ClassifyFallbackError(err)) {
+		return false
+	}
+	_, ok := nextFallbackCandidate(c, info)
+	return ok
+}
+
+// NextFallbackModel 判断失败的请求是否应切换备用模型，返回链上下一个模型并记录切换。
+// exhausted 表示当前模型的渠道已重试用尽；已向客户端写出响应或指定了渠道时不切换。
+func NextFallbackModel(c *gin.Context, info *relaycommon.RelayInfo, err *types.NewAPIError, exhausted bool) (string, bool) {
+	if err == nil || !canFallbackModel(c, info) {
+		return "", false
+	}
+	setting := operation_setting.GetModelFallbackSetting()
+	class := ClassifyFallbackError(err)
+	if !setting.IsFallbackErrorClass(class) && !(exhausted && setting.OnRetryExhausted) {
+		return "", false
+	}
+	candidate, ok := nextFallbackCandidate(c, info)
+	if !ok {
+		return "", false
+	}
+	if class == "" {
+		class = "retry_exhausted"
+	}
+	fallback := GetModelFallbackInfo(c)
+	if fallback == nil {
+		fallback = &ModelFallbackInfo{RequestedModel: info.OriginModelName, TriedModels: []string{info.OriginModelName}}
+	}
+	fallback.UsedModel = candidate
+	fallback.TriedModels = append(fallback.TriedModels, candidate)
+	fallback.Reasons = append(fallback.Reasons, class)
+	common.SetContextKey(c, constant.ContextKeyModelFallback, fallback)
+	return candidate, true
+}
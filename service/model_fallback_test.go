@@ -0,0 +1,79 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withModelFallbackSetting(t *testing.T, setting operation_setting.ModelFallbackSetting) {
+	t.Helper()
+	current := operation_setting.GetModelFallbackSetting()
+	saved := *current
+	*current = setting
+	t.Cleanup(func() { *current = saved })
+}
+
+func TestClassifyFallbackError(t *testing.T) {
+	cases := map[string]*types.NewAPIError{
+		operation_setting.ModelFallbackErrorRateLimit:     types.NewErrorWithStatusCode(errors.New("slow down"), types.ErrorCodeBadResponseStatusCode, http.StatusTooManyRequests),
+		operation_setting.ModelFallbackErrorServerError:   types.NewErrorWithStatusCode(errors.New("boom"), types.ErrorCodeBadResponseStatusCode, http.StatusBadGateway),
+		operation_setting.ModelFallbackErrorTimeout:       types.NewErrorWithStatusCode(errors.New("timeout"), types.ErrorCodeBadResponseStatusCode, http.StatusGatewayTimeout),
+		operation_setting.ModelFallbackErrorNoChannel:     types.NewError(errors.New("no channel"), types.ErrorCodeGetChannelFailed),
+		operation_setting.ModelFallbackErrorContextLength: types.NewErrorWithStatusCode(errors.New("This model's maximum context length is 8192 tokens"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest),
+		"": types.NewErrorWithStatusCode(errors.New("bad request"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest),
+	}
+	for class, err := range cases {
+		assert.Equal(t, class, ClassifyFallbackError(err), err.Error())
+	}
+}
+
+func TestNextFallbackModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withModelFallbackSetting(t, operation_setting.ModelFallbackSetting{
+		Enabled: true,
+		Chains: map[string]map[string][]string{
+			"*":   {"gpt-4o": {"gpt-4.1"}},
+			"vip": {"gpt-4o": {"gpt-4.1", "claude-sonnet"}},
+		},
+		OnRetryExhausted: true,
+		ErrorClasses:     []string{operation_setting.ModelFallbackErrorContextLength},
+	})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	info := &relaycommon.RelayInfo{OriginModelName: "gpt-4o", UsingGroup: "vip"}
+	serverErr := types.NewErrorWithStatusCode(errors.New("boom"), types.ErrorCodeBadResponseStatusCode, http.StatusBadGateway)
+	badRequest := types.NewErrorWithStatusCode(errors.New("bad request"), types.ErrorCodeBadResponseStatusCode, http.StatusBadRequest)
+
+	_, ok := NextFallbackModel(c, info, badRequest, false)
+	assert.False(t, ok, "non-retryable errors outside the configured classes do not fall back")
+	assert.False(t, ShouldSkipRetryForFallback(c, info, serverErr))
+
+	next, ok := NextFallbackModel(c, info, serverErr, true)
+	require.True(t, ok)
+	assert.Equal(t, "gpt-4.1", next)
+	info.OriginModelName = next
+
+	// 令牌模型限制排除了 claude-sonnet，备用链用尽
+	common.SetContextKey(c, constant.ContextKeyTokenModelLimitEnabled, true)
+	common.SetContextKey(c, constant.ContextKeyTokenModelLimit, map[string]bool{"gpt-4o": true, "gpt-4.1": true})
+	_, ok = NextFallbackModel(c, info, serverErr, true)
+	assert.False(t, ok)
+
+	fallback := GetModelFallbackInfo(c)
+	require.NotNil(t, fallback)
+	assert.Equal(t, "gpt-4o", fallback.RequestedModel)
+	assert.Equal(t, "gpt-4.1", fallback.UsedModel)
+	assert.Equal(t, []string{"gpt-4o", "gpt-4.1"}, fallback.TriedModels)
+	assert.Equal(t, []string{operation_setting.ModelFallbackErrorServerError}, fallback.Reasons)
+}
@@ -0,0 +1,373 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+)
+
+const (
+	// OpenAIBatchRatioKey 批处理折扣倍率在 TaskBillingContext.OtherRatios 中的键
+	OpenAIBatchRatioKey = "batch_ratio"
+	// OpenAIBatchCompletionRatioKey 提交时的补全倍率快照
+	OpenAIBatchCompletionRatioKey = "completion_ratio"
+
+	openAIBatchOutputMaxLineBytes = 64 << 20
+	openAIBatchInputMaxLineBytes  = 16 << 20
+
+	// openAIBatchSettleRetryWindow 批处理结束后下载或解析输出文件失败时的重试期限，
+	// 超过后按预扣额度结算，避免任务一直停留在处理中
+	openAIBatchSettleRetryWindow = 24 * time.Hour
+)
+
+// IsOpenAIBatchChannel 渠道是否支持透传 Files / Batches API
+func IsOpenAIBatchChannel(channelType int) bool {
+	return channelType == constant.ChannelTypeOpenAI
+}
+
+// OpenAIBatchChannelKey 返回文件所绑定的渠道密钥；上游文件归属于具体密钥所在的账号，
+// 多密钥渠道必须使用上传时的同一个密钥访问。
+func OpenAIBatchChannelKey(channel *model.Channel, keyIndex int) string {
+	if channel.ChannelInfo.IsMultiKey {
+		keys := channel.GetKeys()
+		if keyIndex >= 0 && keyIndex < len(keys) {
+			return keys[keyIndex]
+		}
+	}
+	return channel.Key
+}
+
+// DoOpenAIBatchRequest 向渠道发送 Files / Batches API 请求
+func DoOpenAIBatchRequest(ctx context.Context, channel *model.Channel, key string, method string, path string, body io.Reader, contentType string) (*http.Response, error) {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = constant.ChannelBaseURLs[channel.Type]
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(baseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if channel.OpenAIOrganization != nil && *channel.OpenAIOrganization != "" {
+		req.Header.Set("OpenAI-Organization", *channel.OpenAIOrganization)
+	}
+	client, err := GetHttpClientWithProxy(channel.GetSetting().Proxy)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// OpenAIBatchTaskStatus 将上游批处理状态映射为任务状态，未知状态返回空字符串
+func OpenAIBatchTaskStatus(status string) model.TaskStatus {
+	switch status {
+	case dto.BatchStatusValidating:
+		return model.TaskStatusQueued
+	case dto.BatchStatusInProgress, dto.BatchStatusFinalizing, dto.BatchStatusCancelling:
+		return model.TaskStatusInProgress
+	case dto.BatchStatusCompleted:
+		return model.TaskStatusSuccess
+	case dto.BatchStatusFailed, dto.BatchStatusExpired, dto.BatchStatusCancelled:
+		return model.TaskStatusFailure
+	}
+	return ""
+}
+
+// OpenAIBatchInputSummary 批处理输入文件（JSONL）的模型与预估用量
+type OpenAIBatchInputSummary struct {
+	Model        string
+	Requests     int
+	PromptTokens int
+}
+
+// ScanOpenAIBatchInput 读取批处理输入文件的所有请求：每一行都必须指定模型且模型相同。
+// 计费使用文件内容中的模型，不信任客户端在表单中另行声明的模型；PromptTokens 为按文本估算的输入 token 数，用于预扣费
+func ScanOpenAIBatchInput(r io.Reader) (OpenAIBatchInputSummary, error) {
+	var summary OpenAIBatchInputSummary
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), openAIBatchInputMaxLineBytes)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var item struct {
+			Body json.RawMessage `json:"body"`
+		}
+		if err := common.Unmarshal(line, &item); err != nil {
+			return summary, fmt.Errorf("line %d: invalid JSON: %w", lineNo, err)
+		}
+		var body dto.GeneralOpenAIRequest
+		if len(item.Body) == 0 || common.Unmarshal(item.Body, &body) != nil {
+			return summary, fmt.Errorf("line %d: invalid request body", lineNo)
+		}
+		if body.Model == "" {
+			return summary, fmt.Errorf("line %d: model is required", lineNo)
+		}
+		if summary.Model == "" {
+			summary.Model = body.Model
+		} else if body.Model != summary.Model {
+			return summary, fmt.Errorf("line %d: all requests in a batch must use the same model, got %s and %s", lineNo, summary.Model, body.Model)
+		}
+		summary.Requests++
+		if meta := body.GetTokenCountMeta(); meta != nil {
+			summary.PromptTokens += EstimateTokenByModel(body.Model, meta.CombineText)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return summary, err
+	}
+	if summary.Requests == 0 {
+		return summary, errors.New("the batch input file contains no requests")
+	}
+	return summary, nil
+}
+
+// OpenAIBatchUsage 批处理输出文件中成功请求的用量汇总
+type OpenAIBatchUsage struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+}
+
+// ParseOpenAIBatchOutput 汇总批处理输出文件（JSONL）中所有成功请求的用量
+func ParseOpenAIBatchOutput(r io.Reader) (OpenAIBatchUsage, error) {
+	var usage OpenAIBatchUsage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), openAIBatchOutputMaxLineBytes)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var item dto.OpenAIBatchOutputLine
+		if err := common.Unmarshal(line, &item); err != nil {
+			continue
+		}
+		if item.Response == nil || item.Response.StatusCode != http.StatusOK {
+			continue
+		}
+		usage.Requests++
+		var body struct {
+			Usage *dto.Usage `json:"usage"`
+		}
+		if err := common.Unmarshal(item.Response.Body, &body); err != nil || body.Usage == nil {
+			continue
+		}
+		usage.PromptTokens += body.Usage.PromptTokens
+		usage.CompletionTokens += body.Usage.CompletionTokens
+	}
+	return usage, scanner.Err()
+}
+
+// CalculateOpenAIBatchQuota 按提交时的计费快照计算批处理的实际额度
+func CalculateOpenAIBatchQuota(bc *model.TaskBillingContext, usage OpenAIBatchUsage) int {
+	if bc == nil {
+		return 0
+	}
+	batchRatio := 1.0
+	completionRatio := 1.0
+	if r, ok := bc.OtherRatios[OpenAIBatchRatioKey]; ok && r > 0 {
+		batchRatio = r
+	}
+	if r, ok := bc.OtherRatios[OpenAIBatchCompletionRatioKey]; ok && r > 0 {
+		completionRatio = r
+	}
+	if bc.PerCallBilling {
+		return int(bc.ModelPrice * common.QuotaPerUnit * bc.GroupRatio * batchRatio * float64(usage.Requests))
+	}
+	tokens := float64(usage.PromptTokens) + float64(usage.CompletionTokens)*completionRatio
+	return int(tokens * bc.ModelRatio * bc.GroupRatio * batchRatio)
+}
+
+// UpdateOpenAIBatchTasks 按渠道同步批处理任务状态
+func UpdateOpenAIBatchTasks(ctx context.Context, taskChannelM map[int][]string, taskM map[string]*model.Task) error {
+	for channelId, batchIds := range taskChannelM {
+		ch, err := model.CacheGetChannel(channelId)
+		if err != nil {
+			var failedIDs []int64
+			for _, batchId := range batchIds {
+				if t, ok := taskM[batchId]; ok {
+					failedIDs = append(failedIDs, t.ID)
+				}
+			}
+			if errUpdate := model.TaskBulkUpdateByID(failedIDs, map[string]any{
+				"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
+				"status":      "FAILURE",
+				"progress":    "100%",
+			}); errUpdate != nil {
+				common.SysLog(fmt.Sprintf("UpdateOpenAIBatchTasks error: %v", errUpdate))
+			}
+			continue
+		}
+		for _, batchId := range batchIds {
+			if err := updateOpenAIBatchTask(ctx, ch, taskM[batchId]); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("Failed to update batch %s: %s", batchId, err.Error()))
+			}
+		}
+	}
+	return nil
+}
+
+// OpenAIBatchTaskKey 返回批处理提交时使用的渠道密钥
+func OpenAIBatchTaskKey(ch *model.Channel, task *model.Task) string {
+	if task.PrivateData.Key != "" {
+		return task.PrivateData.Key
+	}
+	return ch.Key
+}
+
+func updateOpenAIBatchTask(ctx context.Context, ch *model.Channel, task *model.Task) error {
+	if task == nil {
+		return nil
+	}
+	key := OpenAIBatchTaskKey(ch, task)
+	resp, err := DoOpenAIBatchRequest(ctx, ch, key, http.MethodGet, "/v1/batches/"+task.GetUpstreamTaskID(), nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("upstream status code: %d, body: %s", resp.StatusCode, string(responseBody))
+	}
+	var batch dto.OpenAIBatch
+	if err := common.Unmarshal(responseBody, &batch); err != nil {
+		return err
+	}
+	status := OpenAIBatchTaskStatus(batch.Status)
+	if status == "" {
+		return fmt.Errorf("unknown batch status %s", batch.Status)
+	}
+
+	isDone := status == model.TaskStatusSuccess || status == model.TaskStatusFailure
+	var usage *OpenAIBatchUsage
+	if isDone && task.Status != status {
+		// 先取得实际用量再写入终态：下载或解析失败时保持原状态，下一轮轮询重试
+		usage, err = fetchOpenAIBatchUsage(ctx, ch, key, &batch)
+		if err != nil {
+			if time.Since(time.Unix(batch.FinishedAt(), 0)) < openAIBatchSettleRetryWindow {
+				return fmt.Errorf("batch %s finished but settlement failed, will retry: %w", task.TaskID, err)
+			}
+			logger.LogError(ctx, fmt.Sprintf("批处理 %s 结算持续失败，按预扣额度 %s 结算: %s", task.TaskID, logger.LogQuota(task.Quota), err.Error()))
+		}
+	}
+
+	snap := task.Snapshot()
+	now := time.Now().Unix()
+	task.Status = status
+	task.Data = responseBody
+	switch status {
+	case model.TaskStatusInProgress:
+		if task.StartTime == 0 {
+			task.StartTime = now
+		}
+		if total := batch.RequestCounts.Total; total > 0 {
+			done := batch.RequestCounts.Completed + batch.RequestCounts.Failed
+			task.Progress = fmt.Sprintf("%d%%", min(done*100/total, 99))
+		}
+	case model.TaskStatusSuccess, model.TaskStatusFailure:
+		task.Progress = "100%"
+		if task.FinishTime == 0 {
+			task.FinishTime = now
+		}
+		if status == model.TaskStatusFailure {
+			task.FailReason = batch.Status
+			if batch.Errors != nil && len(batch.Errors.Data) > 0 {
+				task.FailReason = batch.Errors.Data[0].Message
+			}
+		}
+	}
+
+	if snap.Equal(task.Snapshot()) {
+		return nil
+	}
+	won, err := task.UpdateWithStatus(snap.Status)
+	if err != nil {
+		return err
+	}
+	if won && isDone && snap.Status != status {
+		settleOpenAIBatchTask(ctx, ch, task, &batch, usage)
+	}
+	return nil
+}
+
+// fetchOpenAIBatchUsage 下载并汇总批处理输出文件中的用量，没有输出文件时用量为 0
+func fetchOpenAIBatchUsage(ctx context.Context, ch *model.Channel, key string, batch *dto.OpenAIBatch) (*OpenAIBatchUsage, error) {
+	if batch.OutputFileID == "" {
+		return &OpenAIBatchUsage{}, nil
+	}
+	resp, err := DoOpenAIBatchRequest(ctx, ch, key, http.MethodGet, "/v1/files/"+batch.OutputFileID+"/content", nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("download output file %s: %w", batch.OutputFileID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download output file %s: status code %d", batch.OutputFileID, resp.StatusCode)
+	}
+	usage, err := ParseOpenAIBatchOutput(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse output file %s: %w", batch.OutputFileID, err)
+	}
+	return &usage, nil
+}
+
+// settleOpenAIBatchTask 批处理到达终态后登记输出文件，并将创建时的预扣额度结算为输出文件中的实际用量。
+// 过期或取消的批处理也可能产出部分结果，同样需要计费；没有成功请求时全额退还。
+// usage 为 nil 表示多次重试后仍无法获取用量，预扣额度即为最终扣费。
+func settleOpenAIBatchTask(ctx context.Context, ch *model.Channel, task *model.Task, batch *dto.OpenAIBatch, usage *OpenAIBatchUsage) {
+	keyIndex := 0
+	if inputFile, err := model.GetRelayFile(task.UserId, batch.InputFileID); err == nil && inputFile != nil {
+		keyIndex = inputFile.KeyIndex
+	}
+	for _, fileId := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if err := model.EnsureRelayFile(&model.RelayFile{
+			FileId:    fileId,
+			UserId:    task.UserId,
+			ChannelId: ch.Id,
+			KeyIndex:  keyIndex,
+			ModelName: taskModelName(task),
+			Purpose:   "batch_output",
+			CreatedAt: time.Now().Unix(),
+		}); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("登记批处理输出文件 %s 失败: %s", fileId, err.Error()))
+		}
+	}
+	if usage == nil {
+		return
+	}
+
+	quota := CalculateOpenAIBatchQuota(task.PrivateData.BillingContext, *usage)
+	if quota <= 0 {
+		RefundTaskQuota(ctx, task, "批处理没有成功的请求")
+		task.Quota = 0
+	} else {
+		reason := fmt.Sprintf("批处理结算：requests=%d, prompt_tokens=%d, completion_tokens=%d",
+			usage.Requests, usage.PromptTokens, usage.CompletionTokens)
+		RecalculateTaskQuota(ctx, task, quota, reason)
+	}
+	if _, err := task.UpdateWithStatus(task.Status); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("更新批处理 %s 额度失败: %s", task.TaskID, err.Error()))
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOpenAIBatchOutput(t *testing.T) {
+	output := strings.Join([]string{
+		`{"id":"batch_req_1","custom_id":"a","response":{"status_code":200,"body":{"model":"gpt-4o-mini","usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}}}`,
+		`{"id":"batch_req_2","custom_id":"b","response":{"status_code":200,"body":{"object":"list","usage":{"prompt_tokens":7,"total_tokens":7}}}}`,
+		`{"id":"batch_req_3","custom_id":"c","response":{"status_code":400,"body":{"error":{"message":"bad"}}}}`,
+		`{"id":"batch_req_4","custom_id":"d","response":null,"error":{"code":"timeout"}}`,
+		``,
+		`not json`,
+	}, "\n")
+
+	usage, err := ParseOpenAIBatchOutput(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Equal(t, OpenAIBatchUsage{Requests: 2, PromptTokens: 17, CompletionTokens: 5}, usage)
+}
+
+func TestScanOpenAIBatchInput(t *testing.T) {
+	input := strings.Join([]string{
+		`{"custom_id":"a","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o-mini","messages":[{"role":"user","content":"hello there"}]}}`,
+		``,
+		`{"custom_id":"b","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o-mini","messages":[{"role":"user","content":"how are you"}]}}`,
+	}, "\n")
+	summary, err := ScanOpenAIBatchInput(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Equal(t, "gpt-4o-mini", summary.Model)
+	require.Equal(t, 2, summary.Requests)
+	require.Positive(t, summary.PromptTokens)
+
+	// the model billed is taken from every line, mixing models is rejected
+	mixed := input + "\n" + `{"custom_id":"c","method":"POST","url":"/v1/chat/completions","body":{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}}`
+	_, err = ScanOpenAIBatchInput(strings.NewReader(mixed))
+	require.ErrorContains(t, err, "same model")
+
+	_, err = ScanOpenAIBatchInput(strings.NewReader(`{"custom_id":"a","body":{"messages":[]}}`))
+	require.ErrorContains(t, err, "model is required")
+	_, err = ScanOpenAIBatchInput(strings.NewReader("\n"))
+	require.Error(t, err)
+}
+
+func TestCalculateOpenAIBatchQuota(t *testing.T) {
+	usage := OpenAIBatchUsage{Requests: 2, PromptTokens: 1000, CompletionTokens: 500}
+
+	require.Equal(t, 0, CalculateOpenAIBatchQuota(nil, usage))
+
+	byRatio := &model.TaskBillingContext{
+		ModelRatio: 2,
+		GroupRatio: 1,
+		OtherRatios: map[string]float64{
+			OpenAIBatchRatioKey:           0.5,
+			OpenAIBatchCompletionRatioKey: 4,
+		},
+	}
+	// (1000 + 500*4) * 2 * 1 * 0.5
+	require.Equal(t, 3000, CalculateOpenAIBatchQuota(byRatio, usage))
+
+	byPrice := &model.TaskBillingContext{
+		ModelPrice:     0.01,
+		GroupRatio:     1,
+		PerCallBilling: true,
+		OtherRatios:    map[string]float64{OpenAIBatchRatioKey: 0.5},
+	}
+	require.Equal(t, int(0.01*common.QuotaPerUnit*0.5*2), CalculateOpenAIBatchQuota(byPrice, usage))
+}
+
+func TestOpenAIBatchTaskStatus(t *testing.T) {
+	require.Equal(t, model.TaskStatus(model.TaskStatusQueued), OpenAIBatchTaskStatus(dto.BatchStatusValidating))
+	require.Equal(t, model.TaskStatus(model.TaskStatusInProgress), OpenAIBatchTaskStatus(dto.BatchStatusFinalizing))
+	require.Equal(t, model.TaskStatus(model.TaskStatusSuccess), OpenAIBatchTaskStatus(dto.BatchStatusCompleted))
+	require.Equal(t, model.TaskStatus(model.TaskStatusFailure), OpenAIBatchTaskStatus(dto.BatchStatusExpired))
+	require.Equal(t, model.TaskStatus(""), OpenAIBatchTaskStatus("unknown"))
+}
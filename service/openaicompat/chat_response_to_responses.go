@@ -0,0 +1,183 @@
+package openaicompat
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+const (
+	ResponsesStatusCompleted  = "completed"
+	ResponsesStatusIncomplete = "incomplete"
+	ResponsesStatusInProgress = "in_progress"
+)
+
+func newResponsesItemID(prefix string) string {
+	return prefix + "_" + common.GetUUID()
+}
+
+func rawOrNil(raw []byte) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	var v any
+	if err := common.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	return v
+}
+
+func rawBoolOrDefault(raw []byte, def bool) bool {
+	var v bool
+	if len(raw) == 0 || common.Unmarshal(raw, &v) != nil {
+		return def
+	}
+	return v
+}
+
+// NewResponsesResponse 根据请求构建 Responses 响应对象的公共字段，output 与 usage 由调用方补充
+func NewResponsesResponse(id string, req *dto.OpenAIResponsesRequest, model string, createdAt int64) map[string]any {
+	response := map[string]any{
+		"id":                 id,
+		"object":             "response",
+		"created_at":         createdAt,
+		"status":             ResponsesStatusInProgress,
+		"model":              model,
+		"output":             []map[string]any{},
+		"error":              nil,
+		"incomplete_details": nil,
+		"usage":              nil,
+	}
+	if req == nil {
+		return response
+	}
+	response["instructions"] = rawOrNil(req.Instructions)
+	response["metadata"] = rawOrNil(req.Metadata)
+	response["text"] = rawOrNil(req.Text)
+	response["tool_choice"] = rawOrNil(req.ToolChoice)
+	response["tools"] = req.GetToolsMap()
+	response["temperature"] = req.Temperature
+	response["top_p"] = req.TopP
+	response["max_output_tokens"] = req.MaxOutputTokens
+	response["reasoning"] = req.Reasoning
+	response["parallel_tool_calls"] = rawBoolOrDefault(req.ParallelToolCalls, true)
+	response["store"] = rawBoolOrDefault(req.Store, true)
+	if conversationID, _ := ParseConversationID(req.Conversation); conversationID != "" {
+		response["conversation"] = map[string]any{"id": conversationID}
+	}
+	if req.PreviousResponseID != "" {
+		response["previous_response_id"] = req.PreviousResponseID
+	} else {
+		response["previous_response_id"] = nil
+	}
+	return response
+}
+
+// ChatUsageToResponsesUsage 将 Chat Completions 用量转换为 Responses 用量格式
+func ChatUsageToResponsesUsage(usage *dto.Usage) map[string]any {
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	inputTokens := usage.PromptTokens
+	if usage.UsageSemantic == "anthropic" {
+		// Claude 的 input_tokens 不含缓存部分，Responses 的 input_tokens 需包含
+		inputTokens += usage.PromptTokensDetails.CachedTokens + usage.PromptTokensDetails.CachedCreationTokens
+	}
+	totalTokens := inputTokens + usage.CompletionTokens
+	return map[string]any{
+		"input_tokens":  inputTokens,
+		"output_tokens": usage.CompletionTokens,
+		"total_tokens":  totalTokens,
+		"input_tokens_details": map[string]any{
+			"cached_tokens": usage.PromptTokensDetails.CachedTokens,
+		},
+		"output_tokens_details": map[string]any{
+			"reasoning_tokens": usage.CompletionTokenDetails.ReasoningTokens,
+		},
+	}
+}
+
+// FinishResponsesResponse 填充最终的 output、usage 与状态；finish_reason 为 length 时标记为 incomplete
+func FinishResponsesResponse(response map[string]any, output []map[string]any, usage *dto.Usage, finishReason string) {
+	if output == nil {
+		output = []map[string]any{}
+	}
+	response["output"] = output
+	response["usage"] = ChatUsageToResponsesUsage(usage)
+	if finishReason == "length" {
+		response["status"] = ResponsesStatusIncomplete
+		response["incomplete_details"] = map[string]any{"reason": "max_output_tokens"}
+		return
+	}
+	response["status"] = ResponsesStatusCompleted
+}
+
+func newReasoningItem(id string, text string) map[string]any {
+	summary := []map[string]any{}
+	if text != "" {
+		summary = append(summary, map[string]any{"type": "summary_text", "text": text})
+	}
+	return map[string]any{"id": id, "type": "reasoning", "summary": summary}
+}
+
+func newMessageItem(id string, status string, text string) map[string]any {
+	content := []map[string]any{}
+	if status == ResponsesStatusCompleted {
+		content = append(content, newOutputTextPart(text))
+	}
+	return map[string]any{
+		"id":      id,
+		"type":    "message",
+		"status":  status,
+		"role":    "assistant",
+		"content": content,
+	}
+}
+
+func newOutputTextPart(text string) map[string]any {
+	return map[string]any{"type": "output_text", "text": text, "annotations": []any{}}
+}
+
+func newFunctionCallItem(id string, status string, callID string, name string, arguments string) map[string]any {
+	return map[string]any{
+		"id":        id,
+		"type":      "function_call",
+		"status":    status,
+		"call_id":   callID,
+		"name":      name,
+		"arguments": arguments,
+	}
+}
+
+// NewWebSearchCallItem 构建内置联网搜索的调用记录项
+func NewWebSearchCallItem() map[string]any {
+	return map[string]any{
+		"id":     newResponsesItemID("ws"),
+		"type":   dto.BuildInCallWebSearchCall,
+		"status": ResponsesStatusCompleted,
+		"action": map[string]any{"type": "search"},
+	}
+}
+
+// ChatCompletionsResponseToResponsesOutput 将非流式 Chat Completions 响应的首个 choice 转换为 Responses 输出项
+func ChatCompletionsResponseToResponsesOutput(resp *dto.OpenAITextResponse) ([]map[string]any, string) {
+	output := make([]map[string]any, 0)
+	if resp == nil || len(resp.Choices) == 0 {
+		return output, ""
+	}
+	choice := resp.Choices[0]
+	reasoning := choice.Message.ReasoningContent
+	if reasoning == "" {
+		reasoning = choice.Message.Reasoning
+	}
+	if reasoning != "" {
+		output = append(output, newReasoningItem(newResponsesItemID("rs"), reasoning))
+	}
+	if text := choice.Message.StringContent(); text != "" {
+		output = append(output, newMessageItem(newResponsesItemID("msg"), ResponsesStatusCompleted, text))
+	}
+	for _, toolCall := range choice.Message.ParseToolCalls() {
+		output = append(output, newFunctionCallItem(newResponsesItemID("fc"), ResponsesStatusCompleted,
+			toolCall.ID, toolCall.Function.Name, toolCall.Function.Arguments))
+	}
+	return output, choice.FinishReason
+}
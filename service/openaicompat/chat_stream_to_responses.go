@@ -0,0 +1,234 @@
+package openaicompat
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/QuantumNous/new-api/dto"
+)
+
+type responsesStreamToolCall struct {
+	outputIndex int
+	itemID      string
+	callID      string
+	name        string
+	arguments   strings.Builder
+}
+
+// ChatToResponsesStreamState 将 Chat Completions 流式分片转换为 Responses 流式事件
+type ChatToResponsesStreamState struct {
+	Response     map[string]any
+	Usage        *dto.Usage
+	FinishReason string
+
+	sequence int
+	output   []map[string]any
+
+	reasoningIndex int
+	reasoningID    string
+	reasoningText  strings.Builder
+
+	messageIndex int
+	messageID    string
+	messageText  strings.Builder
+
+	toolCalls map[int]*responsesStreamToolCall
+}
+
+func NewChatToResponsesStreamState(response map[string]any) *ChatToResponsesStreamState {
+	return &ChatToResponsesStreamState{
+		Response:       response,
+		reasoningIndex: -1,
+		messageIndex:   -1,
+		toolCalls:      make(map[int]*responsesStreamToolCall),
+	}
+}
+
+func (s *ChatToResponsesStreamState) event(eventType string, fields map[string]any) map[string]any {
+	fields["type"] = eventType
+	fields["sequence_number"] = s.sequence
+	s.sequence++
+	return fields
+}
+
+func (s *ChatToResponsesStreamState) addItem(item map[string]any) (int, map[string]any) {
+	index := len(s.output)
+	s.output = append(s.output, item)
+	return index, s.event("response.output_item.added", map[string]any{"output_index": index, "item": item})
+}
+
+func (s *ChatToResponsesStreamState) doneItem(index int, item map[string]any) map[string]any {
+	s.output[index] = item
+	return s.event("response.output_item.done", map[string]any{"output_index": index, "item": item})
+}
+
+// Start 返回 response.created 与 response.in_progress 事件
+func (s *ChatToResponsesStreamState) Start() []map[string]any {
+	return []map[string]any{
+		s.event("response.created", map[string]any{"response": s.Response}),
+		s.event("response.in_progress", map[string]any{"response": s.Response}),
+	}
+}
+
+func (s *ChatToResponsesStreamState) closeReasoning() []map[string]any {
+	if s.reasoningIndex < 0 {
+		return nil
+	}
+	index, id, text := s.reasoningIndex, s.reasoningID, s.reasoningText.String()
+	s.reasoningIndex = -1
+	s.reasoningText.Reset()
+	part := map[string]any{"type": "summary_text", "text": text}
+	return []map[string]any{
+		s.event("response.reasoning_summary_text.done", map[string]any{"item_id": id, "output_index": index, "summary_index": 0, "text": text}),
+		s.event("response.reasoning_summary_part.done", map[string]any{"item_id": id, "output_index": index, "summary_index": 0, "part": part}),
+		s.doneItem(index, newReasoningItem(id, text)),
+	}
+}
+
+func (s *ChatToResponsesStreamState) closeMessage() []map[string]any {
+	if s.messageIndex < 0 {
+		return nil
+	}
+	index, id, text := s.messageIndex, s.messageID, s.messageText.String()
+	s.messageIndex = -1
+	s.messageText.Reset()
+	return []map[string]any{
+		s.event("response.output_text.done", map[string]any{"item_id": id, "output_index": index, "content_index": 0, "text": text}),
+		s.event("response.content_part.done", map[string]any{"item_id": id, "output_index": index, "content_index": 0, "part": newOutputTextPart(text)}),
+		s.doneItem(index, newMessageItem(id, ResponsesStatusCompleted, text)),
+	}
+}
+
+func (s *ChatToResponsesStreamState) closeToolCalls() []map[string]any {
+	if len(s.toolCalls) == 0 {
+		return nil
+	}
+	keys := make([]int, 0, len(s.toolCalls))
+	for key := range s.toolCalls {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	events := make([]map[string]any, 0, len(keys)*2)
+	for _, key := range keys {
+		call := s.toolCalls[key]
+		arguments := call.arguments.String()
+		events = append(events,
+			s.event("response.function_call_arguments.done", map[string]any{"item_id": call.itemID, "output_index": call.outputIndex, "arguments": arguments}),
+			s.doneItem(call.outputIndex, newFunctionCallItem(call.itemID, ResponsesStatusCompleted, call.callID, call.name, arguments)),
+		)
+	}
+	s.toolCalls = make(map[int]*responsesStreamToolCall)
+	return events
+}
+
+// HandleChunk 处理一个 Chat Completions 流式分片，返回需要下发的 Responses 事件
+func (s *ChatToResponsesStreamState) HandleChunk(chunk *dto.ChatCompletionsStreamResponse) []map[string]any {
+	if chunk == nil {
+		return nil
+	}
+	if chunk.Usage != nil {
+		s.Usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return nil
+	}
+	choice := chunk.Choices[0]
+	var events []map[string]any
+
+	if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+		events = append(events, s.closeMessage()...)
+		events = append(events, s.closeToolCalls()...)
+		if s.reasoningIndex < 0 {
+			s.reasoningID = newResponsesItemID("rs")
+			var added map[string]any
+			s.reasoningIndex, added = s.addItem(newReasoningItem(s.reasoningID, ""))
+			events = append(events, added, s.event("response.reasoning_summary_part.added", map[string]any{
+				"item_id": s.reasoningID, "output_index": s.reasoningIndex, "summary_index": 0,
+				"part": map[string]any{"type": "summary_text", "text": ""},
+			}))
+		}
+		s.reasoningText.WriteString(reasoning)
+		events = append(events, s.event("response.reasoning_summary_text.delta", map[string]any{
+			"item_id": s.reasoningID, "output_index": s.reasoningIndex, "summary_index": 0, "delta": reasoning,
+		}))
+	}
+
+	if text := choice.Delta.GetContentString(); text != "" {
+		events = append(events, s.closeReasoning()...)
+		events = append(events, s.closeToolCalls()...)
+		if s.messageIndex < 0 {
+			s.messageID = newResponsesItemID("msg")
+			var added map[string]any
+			s.messageIndex, added = s.addItem(newMessageItem(s.messageID, ResponsesStatusInProgress, ""))
+			events = append(events, added, s.event("response.content_part.added", map[string]any{
+				"item_id": s.messageID, "output_index": s.messageIndex, "content_index": 0, "part": newOutputTextPart(""),
+			}))
+		}
+		s.messageText.WriteString(text)
+		events = append(events, s.event("response.output_text.delta", map[string]any{
+			"item_id": s.messageID, "output_index": s.messageIndex, "content_index": 0, "delta": text,
+		}))
+	}
+
+	for i, toolCall := range choice.Delta.ToolCalls {
+		events = append(events, s.closeReasoning()...)
+		events = append(events, s.closeMessage()...)
+		key := i
+		if toolCall.Index != nil {
+			key = *toolCall.Index
+		}
+		call, ok := s.toolCalls[key]
+		if !ok {
+			call = &responsesStreamToolCall{itemID: newResponsesItemID("fc"), callID: toolCall.ID, name: toolCall.Function.Name}
+			var added map[string]any
+			call.outputIndex, added = s.addItem(newFunctionCallItem(call.itemID, ResponsesStatusInProgress, call.callID, call.name, ""))
+			s.toolCalls[key] = call
+			events = append(events, added)
+		}
+		if toolCall.Function.Arguments != "" {
+			call.arguments.WriteString(toolCall.Function.Arguments)
+			events = append(events, s.event("response.function_call_arguments.delta", map[string]any{
+				"item_id": call.itemID, "output_index": call.outputIndex, "delta": toolCall.Function.Arguments,
+			}))
+		}
+	}
+
+	if choice.FinishReason != nil && *choice.FinishReason != "" {
+		s.FinishReason = *choice.FinishReason
+	}
+	return events
+}
+
+// AddCompletedItem 追加一个已完成的输出项（如联网搜索记录）
+func (s *ChatToResponsesStreamState) AddCompletedItem(item map[string]any) []map[string]any {
+	index, added := s.addItem(item)
+	return []map[string]any{added, s.doneItem(index, item)}
+}
+
+// Output 返回当前已产生的输出项
+func (s *ChatToResponsesStreamState) Output() []map[string]any {
+	return s.output
+}
+
+// CloseItems 结束所有未完成的输出项
+func (s *ChatToResponsesStreamState) CloseItems() []map[string]any {
+	var events []map[string]any
+	events = append(events, s.closeReasoning()...)
+	events = append(events, s.closeMessage()...)
+	events = append(events, s.closeToolCalls()...)
+	return events
+}
+
+// Finish 结束所有输出项并返回最终的 response.completed（或 response.incomplete）事件
+func (s *ChatToResponsesStreamState) Finish(usage *dto.Usage) []map[string]any {
+	events := s.CloseItems()
+	if usage == nil {
+		usage = s.Usage
+	}
+	FinishResponsesResponse(s.Response, s.output, usage, s.FinishReason)
+	eventType := "response.completed"
+	if s.Response["status"] == ResponsesStatusIncomplete {
+		eventType = "response.incomplete"
+	}
+	return append(events, s.event(eventType, map[string]any{"response": s.Response}))
+}
@@ -0,0 +1,312 @@
+package openaicompat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// ParseResponsesInputItems 将 Responses 请求的 input 统一为输入项数组，字符串输入视为一条 user 消息
+func ParseResponsesInputItems(input []byte) ([]map[string]any, error) {
+	if len(input) == 0 {
+		return []map[string]any{}, nil
+	}
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		return []map[string]any{{"type": "message", "role": "user", "content": text}}, nil
+	case "array":
+		var items []map[string]any
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input items: %w", err)
+		}
+		return items, nil
+	}
+	return nil, errors.New("input must be a string or an array of items")
+}
+
+// ResponsesOutputToInputItems 将输出项转换为可作为下一轮输入的项，仅保留消息与函数调用。
+// 项 ID 只在生成它的上游有效，转换时去除
+func ResponsesOutputToInputItems(output []map[string]any) []map[string]any {
+	items := make([]map[string]any, 0, len(output))
+	for _, item := range output {
+		switch common.Interface2String(item["type"]) {
+		case "message", "function_call", "function_call_output":
+			inputItem := make(map[string]any, len(item))
+			for key, value := range item {
+				if key != "id" {
+					inputItem[key] = value
+				}
+			}
+			items = append(items, inputItem)
+		}
+	}
+	return items
+}
+
+// ParseConversationID 解析 Responses 请求的 conversation 参数，支持字符串或 {"id": "..."}
+func ParseConversationID(conversation []byte) (string, error) {
+	if len(conversation) == 0 {
+		return "", nil
+	}
+	switch common.GetJsonType(conversation) {
+	case "string":
+		var id string
+		if err := common.Unmarshal(conversation, &id); err != nil {
+			return "", err
+		}
+		return id, nil
+	case "object":
+		var obj struct {
+			ID string `json:"id"`
+		}
+		if err := common.Unmarshal(conversation, &obj); err != nil {
+			return "", err
+		}
+		return obj.ID, nil
+	}
+	return "", errors.New("conversation must be a string or an object with an id")
+}
+
+func responsesTextOf(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var sb strings.Builder
+		for _, part := range v {
+			if m, ok := part.(map[string]any); ok {
+				sb.WriteString(common.Interface2String(m["text"]))
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+func responsesContentToChat(role string, content any) (any, error) {
+	parts, ok := content.([]any)
+	if !ok {
+		return responsesTextOf(content), nil
+	}
+	// 使用 []any 以便 Message.ParseContent 识别
+	mediaContents := make([]any, 0, len(parts))
+	for _, p := range parts {
+		part, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch partType := common.Interface2String(part["type"]); partType {
+		case "input_text", "output_text", "text", "refusal":
+			text := common.Interface2String(part["text"])
+			if partType == "refusal" {
+				text = common.Interface2String(part["refusal"])
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: text})
+		case "input_image":
+			url := common.Interface2String(part["image_url"])
+			if url == "" {
+				return nil, errors.New("input_image without image_url is not supported on this channel")
+			}
+			imageUrl := dto.MessageImageUrl{Url: url, Detail: common.Interface2String(part["detail"])}
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeImageURL, ImageUrl: imageUrl})
+		case "input_file":
+			file := dto.MessageFile{
+				FileName: common.Interface2String(part["filename"]),
+				FileData: common.Interface2String(part["file_data"]),
+				FileId:   common.Interface2String(part["file_id"]),
+			}
+			if file.FileData == "" {
+				if fileUrl := common.Interface2String(part["file_url"]); fileUrl != "" {
+					file.FileData = fileUrl
+				}
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeFile, File: file})
+		case "input_audio":
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeInputAudio, InputAudio: part["input_audio"]})
+		default:
+			return nil, fmt.Errorf("content type %s of %s message is not supported on this channel", partType, role)
+		}
+	}
+	return mediaContents, nil
+}
+
+func responsesToolsToChat(req *dto.OpenAIResponsesRequest, out *dto.GeneralOpenAIRequest) error {
+	for _, tool := range req.GetToolsMap() {
+		switch toolType := common.Interface2String(tool["type"]); toolType {
+		case "function":
+			name := common.Interface2String(tool["name"])
+			if name == "" {
+				return errors.New("function tool name is required")
+			}
+			out.Tools = append(out.Tools, dto.ToolCallRequest{
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:        name,
+					Description: common.Interface2String(tool["description"]),
+					Parameters:  tool["parameters"],
+				},
+			})
+		case dto.BuildInToolWebSearchPreview, "web_search", "web_search_preview_2025_03_11":
+			options := &dto.WebSearchOptions{SearchContextSize: common.Interface2String(tool["search_context_size"])}
+			if location, ok := tool["user_location"].(map[string]any); ok {
+				// Chat Completions 的 user_location 将位置信息包装在 approximate 字段中
+				options.UserLocation, _ = common.Marshal(map[string]any{"type": "approximate", "approximate": location})
+			}
+			out.WebSearchOptions = options
+		default:
+			return fmt.Errorf("tool type %s is not supported on this channel", toolType)
+		}
+	}
+
+	if len(req.ToolChoice) > 0 {
+		var toolChoice any
+		if err := common.Unmarshal(req.ToolChoice, &toolChoice); err != nil {
+			return fmt.Errorf("invalid tool_choice: %w", err)
+		}
+		if m, ok := toolChoice.(map[string]any); ok && common.Interface2String(m["type"]) == "function" {
+			// Responses: {"type":"function","name":"..."}
+			// Chat: {"type":"function","function":{"name":"..."}}
+			toolChoice = map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": common.Interface2String(m["name"])},
+			}
+		}
+		out.ToolChoice = toolChoice
+	}
+	if len(req.ParallelToolCalls) > 0 {
+		var parallel bool
+		if err := common.Unmarshal(req.ParallelToolCalls, &parallel); err == nil {
+			out.ParallelTooCalls = &parallel
+		}
+	}
+	return nil
+}
+
+func responsesTextFormatToChat(text []byte) *dto.ResponseFormat {
+	if len(text) == 0 {
+		return nil
+	}
+	var textConfig struct {
+		Format map[string]any `json:"format"`
+	}
+	if err := common.Unmarshal(text, &textConfig); err != nil || textConfig.Format == nil {
+		return nil
+	}
+	switch formatType := common.Interface2String(textConfig.Format["type"]); formatType {
+	case "json_object":
+		return &dto.ResponseFormat{Type: formatType}
+	case "json_schema":
+		schema := make(map[string]any, len(textConfig.Format))
+		for key, value := range textConfig.Format {
+			if key != "type" {
+				schema[key] = value
+			}
+		}
+		schemaRaw, _ := common.Marshal(schema)
+		return &dto.ResponseFormat{Type: formatType, JsonSchema: schemaRaw}
+	}
+	return nil
+}
+
+// ResponsesRequestToChatCompletionsRequest 将 Responses 请求转换为 Chat Completions 请求，
+// 用于不支持 Responses API 的上游。input 需已展开 previous_response_id 引用的历史。
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	if req.Model == "" {
+		return nil, errors.New("model is required")
+	}
+
+	out := &dto.GeneralOpenAIRequest{
+		Model:       req.Model,
+		Stream:      req.Stream,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   req.MaxOutputTokens,
+		User:        req.User,
+	}
+	if req.Stream != nil && *req.Stream {
+		out.StreamOptions = &dto.StreamOptions{IncludeUsage: true}
+	}
+	if req.Reasoning != nil && req.Reasoning.Effort != "" && req.Reasoning.Effort != "none" {
+		out.ReasoningEffort = req.Reasoning.Effort
+	}
+	out.ResponseFormat = responsesTextFormatToChat(req.Text)
+	if err := responsesToolsToChat(req, out); err != nil {
+		return nil, err
+	}
+
+	if len(req.Instructions) > 0 {
+		var instructions string
+		if err := common.Unmarshal(req.Instructions, &instructions); err == nil && strings.TrimSpace(instructions) != "" {
+			out.Messages = append(out.Messages, dto.Message{Role: "system", Content: instructions})
+		}
+	}
+
+	items, err := ParseResponsesInputItems(req.Input)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		itemType := common.Interface2String(item["type"])
+		if itemType == "" && item["role"] != nil {
+			itemType = "message"
+		}
+		switch itemType {
+		case "message":
+			role := common.Interface2String(item["role"])
+			if role == "developer" {
+				role = "system"
+			}
+			content, err := responsesContentToChat(role, item["content"])
+			if err != nil {
+				return nil, err
+			}
+			out.Messages = append(out.Messages, dto.Message{Role: role, Content: content})
+		case "function_call":
+			toolCall := dto.ToolCallRequest{
+				ID:   common.Interface2String(item["call_id"]),
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      common.Interface2String(item["name"]),
+					Arguments: common.Interface2String(item["arguments"]),
+				},
+			}
+			// 连续的函数调用合并到同一条 assistant 消息
+			if n := len(out.Messages); n > 0 && out.Messages[n-1].Role == "assistant" {
+				last := &out.Messages[n-1]
+				last.SetToolCalls(append(last.ParseToolCalls(), toolCall))
+				continue
+			}
+			message := dto.Message{Role: "assistant", Content: ""}
+			message.SetToolCalls([]dto.ToolCallRequest{toolCall})
+			out.Messages = append(out.Messages, message)
+		case "function_call_output":
+			output := item["output"]
+			if _, ok := output.(string); !ok {
+				output = responsesTextOf(output)
+			}
+			out.Messages = append(out.Messages, dto.Message{
+				Role:       "tool",
+				Content:    output,
+				ToolCallId: common.Interface2String(item["call_id"]),
+			})
+		case "reasoning", "web_search_call", "item_reference":
+			// 推理与内置工具调用记录无需回传上游
+		default:
+			return nil, fmt.Errorf("input item type %s is not supported on this channel", itemType)
+		}
+	}
+	if len(out.Messages) == 0 {
+		return nil, errors.New("input is required")
+	}
+	return out, nil
+}
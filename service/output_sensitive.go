@@ -0,0 +1,568 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+const outputSensitiveMask = "**###**"
+
+// outputTextField 响应 JSON 中的一段模型输出文本，slot 标识同一路输出（如同一个 choice），final 表示该路输出在本条数据中结束
+type outputTextField struct {
+	path  string
+	slot  string
+	text  string
+	final bool
+}
+
+// outputStreamTemplate 一路输出最近一条携带文本的流式数据，用于补发暂存的文本
+type outputStreamTemplate struct {
+	data []byte
+	path string
+}
+
+// OutputSensitiveFilter 按分组策略检查模型输出中的屏蔽词。
+// 流式输出时，log 策略为每一路输出保留上一段文本的末尾作为滑动窗口；mask 与 truncate 策略则暂存末尾可能构成屏蔽词前缀的文本，
+// 在下一个分片、该路输出结束或流结束时再发出，拆分在两个分片之间的屏蔽词同样会被处理。
+type OutputSensitiveFilter struct {
+	policy     string
+	words      []string
+	windowSize int
+
+	mu        sync.Mutex
+	windows   map[string][]rune
+	pending   map[string][]rune
+	templates map[string]outputStreamTemplate
+	slots     []string
+	hits      []string
+	truncated bool
+}
+
+func newOutputSensitiveFilter(policy string, words []string) *OutputSensitiveFilter {
+	maxLen := 0
+	for _, word := range words {
+		if n := len([]rune(strings.TrimSpace(word))); n > maxLen {
+			maxLen = n
+		}
+	}
+	windowSize := maxLen - 1
+	if windowSize < 0 {
+		windowSize = 0
+	}
+	return &OutputSensitiveFilter{
+		policy:     policy,
+		words:      words,
+		windowSize: windowSize,
+		windows:    make(map[string][]rune),
+		pending:    make(map[string][]rune),
+		templates:  make(map[string]outputStreamTemplate),
+	}
+}
+
+func resolveOutputSensitivePolicy(group string) string {
+	policy := operation_setting.GetOutputSensitiveSetting().GetPolicy(group)
+	if policy != "" {
+		return policy
+	}
+	if setting.StopOnSensitiveEnabled {
+		return operation_setting.OutputSensitivePolicyTruncate
+	}
+	return operation_setting.OutputSensitivePolicyMask
+}
+
+// SetupOutputSensitiveFilter 在开启输出检查时为当前请求创建过滤器
+func SetupOutputSensitiveFilter(c *gin.Context, info *relaycommon.RelayInfo) {
+	if !setting.ShouldCheckCompletionSensitive() || len(setting.SensitiveWords) == 0 {
+		return
+	}
+	filter := newOutputSensitiveFilter(resolveOutputSensitivePolicy(info.UsingGroup), setting.SensitiveWords)
+	common.SetContextKey(c, constant.ContextKeyOutputFilter, filter)
+}
+
+func getOutputSensitiveFilter(c *gin.Context) *OutputSensitiveFilter {
+	if c == nil {
+		return nil
+	}
+	filter, ok := common.GetContextKeyType[*OutputSensitiveFilter](c, constant.ContextKeyOutputFilter)
+	if !ok {
+		return nil
+	}
+	return filter
+}
+
+// sensitiveSpan 一次屏蔽词命中在文本中的位置（rune，左闭右开）
+type sensitiveSpan struct {
+	start, end int
+	word       string
+}
+
+func lowerRunes(runes []rune) []rune {
+	lowered := make([]rune, len(runes))
+	for i, r := range runes {
+		lowered[i] = unicode.ToLower(r)
+	}
+	return lowered
+}
+
+// holdsBack 流式输出时是否暂存可能构成屏蔽词前缀的文本，log 策略不修改输出，无需暂存
+func (f *OutputSensitiveFilter) holdsBack(slot string) bool {
+	return slot != "" && f.windowSize > 0 && f.policy != operation_setting.OutputSensitivePolicyLog
+}
+
+// scanText 检查一段文本，返回处理后的文本（truncate 策略下为截断后的文本）以及新命中的屏蔽词
+func (f *OutputSensitiveFilter) scanText(slot string, text string, final bool) (string, []string) {
+	if f.holdsBack(slot) {
+		return f.scanHoldBack(slot, text, final)
+	}
+	return f.scanWindow(slot, text)
+}
+
+// scanWindow 以上一段文本的末尾作为滑动窗口检查本段文本，本段文本原样或按策略处理后立即发出
+func (f *OutputSensitiveFilter) scanWindow(slot string, text string) (string, []string) {
+	m := getOrBuildAC(f.words)
+	if m == nil || text == "" {
+		return text, nil
+	}
+	textRunes := []rune(text)
+	window := f.windows[slot]
+	combined := make([]rune, 0, len(window)+len(textRunes))
+	combined = append(combined, window...)
+	combined = append(combined, textRunes...)
+
+	if slot != "" && f.windowSize > 0 {
+		start := len(combined) - f.windowSize
+		if start < 0 {
+			start = 0
+		}
+		f.windows[slot] = append([]rune(nil), combined[start:]...)
+	}
+
+	offset := len(window)
+	spans := make([]sensitiveSpan, 0)
+	words := make([]string, 0)
+	for _, hit := range m.MultiPatternSearch(lowerRunes(combined), false) {
+		end := hit.Pos + len(hit.Word)
+		if end <= offset {
+			// 完全落在窗口内的命中已在上一个分片处理过
+			continue
+		}
+		start := hit.Pos - offset
+		if start < 0 {
+			start = 0
+		}
+		spans = append(spans, sensitiveSpan{start: start, end: end - offset})
+		words = append(words, string(hit.Word))
+	}
+	return f.applyPolicy(textRunes, spans), words
+}
+
+// scanHoldBack 将暂存文本与本段文本合并检查，发出不可能再构成屏蔽词的部分，末尾 windowSize 个字符暂存到下一次；
+// 跨越发出边界的命中整体发出，final 为 true 时发出全部文本
+func (f *OutputSensitiveFilter) scanHoldBack(slot string, text string, final bool) (string, []string) {
+	m := getOrBuildAC(f.words)
+	pending := f.pending[slot]
+	if m == nil || (text == "" && len(pending) == 0) {
+		return text, nil
+	}
+	combined := make([]rune, 0, len(pending)+len(text))
+	combined = append(combined, pending...)
+	combined = append(combined, []rune(text)...)
+
+	hits := m.MultiPatternSearch(lowerRunes(combined), false)
+	spans := make([]sensitiveSpan, 0, len(hits))
+	for _, hit := range hits {
+		spans = append(spans, sensitiveSpan{start: hit.Pos, end: hit.Pos + len(hit.Word), word: string(hit.Word)})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	boundary := len(combined)
+	if !final {
+		boundary = len(combined) - f.windowSize
+		if boundary < 0 {
+			boundary = 0
+		}
+		for _, s := range spans {
+			if s.start < boundary && s.end > boundary {
+				boundary = s.end
+			}
+		}
+	}
+
+	emitted := make([]sensitiveSpan, 0, len(spans))
+	words := make([]string, 0)
+	for _, s := range spans {
+		// 起始位置落在暂存部分的命中留到下一次处理，避免重复记录
+		if s.start < boundary {
+			emitted = append(emitted, s)
+			words = append(words, s.word)
+		}
+	}
+	if boundary < len(combined) {
+		f.pending[slot] = append([]rune(nil), combined[boundary:]...)
+	} else {
+		delete(f.pending, slot)
+	}
+	return f.applyPolicy(combined[:boundary], emitted), words
+}
+
+// applyPolicy 按策略处理命中：mask 替换命中部分，truncate 截断到首个命中之前，log 原样返回
+func (f *OutputSensitiveFilter) applyPolicy(runes []rune, spans []sensitiveSpan) string {
+	if len(spans) == 0 {
+		return string(runes)
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	if f.policy == operation_setting.OutputSensitivePolicyTruncate {
+		return string(runes[:spans[0].start])
+	}
+	if f.policy != operation_setting.OutputSensitivePolicyMask {
+		return string(runes)
+	}
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		prev := &merged[len(merged)-1]
+		if s.start <= prev.end {
+			if s.end > prev.end {
+				prev.end = s.end
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	var builder strings.Builder
+	builder.Grow(len(runes))
+	last := 0
+	for _, s := range merged {
+		builder.WriteString(string(runes[last:s.start]))
+		builder.WriteString(outputSensitiveMask)
+		last = s.end
+	}
+	builder.WriteString(string(runes[last:]))
+	return builder.String()
+}
+
+// apply 对 JSON 中的文本字段执行策略，返回处理后的数据以及是否触发截断
+func (f *OutputSensitiveFilter) apply(data []byte, fields []outputTextField, onTruncate func(data []byte, field outputTextField) []byte) ([]byte, bool) {
+	if f.truncated {
+		return data, true
+	}
+	for _, field := range fields {
+		if f.holdsBack(field.slot) {
+			f.rememberTemplate(field.slot, data, field.path)
+		}
+		replaced, words := f.scanText(field.slot, field.text, field.final)
+		if replaced != field.text {
+			if updated, err := sjson.SetBytes(data, field.path, replaced); err == nil {
+				data = updated
+			}
+		}
+		if len(words) == 0 {
+			continue
+		}
+		f.hits = append(f.hits, words...)
+		if f.policy == operation_setting.OutputSensitivePolicyTruncate {
+			if onTruncate != nil {
+				data = onTruncate(data, field)
+			}
+			f.truncated = true
+			return data, true
+		}
+	}
+	return data, false
+}
+
+// rememberTemplate 记录一路输出最近一条携带文本的数据，补发暂存文本时以它为模板，并去掉其中的用量避免重复统计
+func (f *OutputSensitiveFilter) rememberTemplate(slot string, data []byte, path string) {
+	if _, ok := f.templates[slot]; !ok {
+		f.slots = append(f.slots, slot)
+	}
+	template := append([]byte(nil), data...)
+	for _, key := range []string{"usage", "usageMetadata"} {
+		if updated, err := sjson.DeleteBytes(template, key); err == nil {
+			template = updated
+		}
+	}
+	f.templates[slot] = outputStreamTemplate{data: template, path: path}
+}
+
+// flushSlot 按模板生成一条携带该路暂存文本的数据，没有暂存文本时返回 nil
+func (f *OutputSensitiveFilter) flushSlot(slot string) []byte {
+	template, ok := f.templates[slot]
+	if !ok || len(f.pending[slot]) == 0 {
+		return nil
+	}
+	replaced, words := f.scanHoldBack(slot, "", true)
+	f.hits = append(f.hits, words...)
+	if len(words) > 0 && f.policy == operation_setting.OutputSensitivePolicyTruncate {
+		f.truncated = true
+	}
+	if replaced == "" {
+		return nil
+	}
+	data, err := sjson.SetBytes(template.data, template.path, replaced)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// FilterStreamData 过滤一条上游 SSE 数据，支持 OpenAI Chat、Responses、Claude 与 Gemini 的流式格式
+func (f *OutputSensitiveFilter) FilterStreamData(data string) (string, bool) {
+	raw := []byte(data)
+	fields := collectStreamTextFields(raw)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(fields) == 0 {
+		return data, f.truncated
+	}
+	result, stop := f.apply(raw, fields, nil)
+	return string(result), stop
+}
+
+// FlushStreamData 在一路输出结束的数据（如带 finish_reason 的分片、content_block_stop）之前补发该路暂存的文本
+func (f *OutputSensitiveFilter) FlushStreamData(data string) []string {
+	raw := []byte(data)
+	endSlots := collectStreamEndSlots(raw)
+	if len(endSlots) == 0 {
+		return nil
+	}
+	// 本条数据自身携带文本的输出在 FilterStreamData 中一并发出
+	withText := make(map[string]bool)
+	for _, field := range collectStreamTextFields(raw) {
+		withText[field.slot] = true
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	payloads := make([]string, 0)
+	for _, slot := range endSlots {
+		if f.truncated || withText[slot] {
+			continue
+		}
+		if flushed := f.flushSlot(slot); flushed != nil {
+			payloads = append(payloads, string(flushed))
+		}
+	}
+	return payloads
+}
+
+// FlushStreamEnd 在流结束时补发所有仍暂存的文本
+func (f *OutputSensitiveFilter) FlushStreamEnd() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	payloads := make([]string, 0)
+	for _, slot := range f.slots {
+		if f.truncated {
+			break
+		}
+		if flushed := f.flushSlot(slot); flushed != nil {
+			payloads = append(payloads, string(flushed))
+		}
+	}
+	return payloads
+}
+
+// FilterResponseBody 过滤非流式响应体，截断时 OpenAI 格式的 finish_reason 会被置为 content_filter
+func (f *OutputSensitiveFilter) FilterResponseBody(data []byte) []byte {
+	fields := collectBodyTextFields(data)
+	if len(fields) == 0 {
+		return data
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result, _ := f.apply(data, fields, func(data []byte, field outputTextField) []byte {
+		if !strings.HasPrefix(field.path, "choices.") {
+			return data
+		}
+		index := strings.SplitN(strings.TrimPrefix(field.path, "choices."), ".", 2)[0]
+		if updated, err := sjson.SetBytes(data, "choices."+index+".finish_reason", "content_filter"); err == nil {
+			return updated
+		}
+		return data
+	})
+	return result
+}
+
+// Hits 返回已命中的屏蔽词（去重）
+func (f *OutputSensitiveFilter) Hits() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return RemoveDuplicate(f.hits)
+}
+
+func collectStreamTextFields(data []byte) []outputTextField {
+	fields := make([]outputTextField, 0, 1)
+	eventType := gjson.GetBytes(data, "type").String()
+	switch {
+	case eventType == "content_block_delta":
+		// Claude
+		if text := gjson.GetBytes(data, "delta.text"); text.Type == gjson.String {
+			fields = append(fields, outputTextField{path: "delta.text", slot: "claude." + gjson.GetBytes(data, "index").String(), text: text.String()})
+		}
+	case eventType == "response.output_text.delta":
+		// OpenAI Responses
+		if text := gjson.GetBytes(data, "delta"); text.Type == gjson.String {
+			fields = append(fields, outputTextField{path: "delta", slot: "responses." + gjson.GetBytes(data, "output_index").String(), text: text.String()})
+		}
+	default:
+		fields = appendChoiceFields(fields, data, "delta.content")
+		fields = appendGeminiFields(fields, data)
+	}
+	return fields
+}
+
+// collectStreamEndSlots 返回在本条流式数据中结束的各路输出
+func collectStreamEndSlots(data []byte) []string {
+	slots := make([]string, 0, 1)
+	switch gjson.GetBytes(data, "type").String() {
+	case "content_block_stop":
+		slots = append(slots, "claude."+gjson.GetBytes(data, "index").String())
+	case "response.output_text.done":
+		slots = append(slots, "responses."+gjson.GetBytes(data, "output_index").String())
+	default:
+		gjson.GetBytes(data, "choices").ForEach(func(key, value gjson.Result) bool {
+			if value.Get("finish_reason").String() != "" {
+				slots = append(slots, "choices."+value.Get("index").String())
+			}
+			return true
+		})
+		gjson.GetBytes(data, "candidates").ForEach(func(key, candidate gjson.Result) bool {
+			if candidate.Get("finishReason").String() != "" {
+				slots = append(slots, "candidates."+key.String())
+			}
+			return true
+		})
+	}
+	return slots
+}
+
+func collectBodyTextFields(data []byte) []outputTextField {
+	fields := make([]outputTextField, 0, 1)
+	fields = appendChoiceFields(fields, data, "message.content")
+	fields = appendGeminiFields(fields, data)
+	gjson.GetBytes(data, "content").ForEach(func(key, value gjson.Result) bool {
+		// Claude
+		if value.Get("type").String() == "text" {
+			fields = append(fields, outputTextField{path: "content." + key.String() + ".text", slot: "", text: value.Get("text").String()})
+		}
+		return true
+	})
+	gjson.GetBytes(data, "output").ForEach(func(key, value gjson.Result) bool {
+		// OpenAI Responses
+		value.Get("content").ForEach(func(partKey, part gjson.Result) bool {
+			if part.Get("type").String() == "output_text" {
+				fields = append(fields, outputTextField{path: "output." + key.String() + ".content." + partKey.String() + ".text", slot: "", text: part.Get("text").String()})
+			}
+			return true
+		})
+		return true
+	})
+	return fields
+}
+
+func appendChoiceFields(fields []outputTextField, data []byte, subPath string) []outputTextField {
+	gjson.GetBytes(data, "choices").ForEach(func(key, value gjson.Result) bool {
+		if text := value.Get(subPath); text.Type == gjson.String {
+			fields = append(fields, outputTextField{path: "choices." + key.String() + "." + subPath, slot: "choices." + value.Get("index").String(), text: text.String(), final: value.Get("finish_reason").String() != ""})
+		}
+		return true
+	})
+	return fields
+}
+
+func appendGeminiFields(fields []outputTextField, data []byte) []outputTextField {
+	gjson.GetBytes(data, "candidates").ForEach(func(key, candidate gjson.Result) bool {
+		final := candidate.Get("finishReason").String() != ""
+		candidate.Get("content.parts").ForEach(func(partKey, part gjson.Result) bool {
+			if text := part.Get("text"); text.Type == gjson.String && !part.Get("thought").Bool() {
+				fields = append(fields, outputTextField{path: "candidates." + key.String() + ".content.parts." + partKey.String() + ".text", slot: "candidates." + key.String(), text: text.String(), final: final})
+			}
+			return true
+		})
+		return true
+	})
+	return fields
+}
+
+// FilterOutputBody 按当前请求的输出过滤器处理非流式响应体：先还原脱敏占位符，再检查屏蔽词
+func FilterOutputBody(c *gin.Context, data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	if redactor := getPIIRedactor(c); redactor != nil {
+		data = redactor.FilterResponseBody(data)
+	}
+	if filter := getOutputSensitiveFilter(c); filter != nil {
+		data = filter.FilterResponseBody(data)
+	}
+	return data
+}
+
+// RecordOutputSensitiveViolation 记录请求输出中命中的屏蔽词，配置了违规扣费时同时扣除费用，返回是否存在违规
+func RecordOutputSensitiveViolation(c *gin.Context, relayInfo *relaycommon.RelayInfo) bool {
+	filter := getOutputSensitiveFilter(c)
+	if filter == nil || relayInfo == nil {
+		return false
+	}
+	words := filter.Hits()
+	if len(words) == 0 {
+		return false
+	}
+	logger.LogWarn(c, fmt.Sprintf("output sensitive words detected: %s, policy: %s", strings.Join(words, ", "), filter.policy))
+
+	settings := operation_setting.GetOutputSensitiveSetting()
+	groupRatio := relayInfo.PriceData.GroupRatioInfo.GroupRatio
+	feeQuota := calcViolationFeeQuota(settings.ViolationDeductionAmount, groupRatio)
+	useTimeSeconds := int(time.Now().Unix() - relayInfo.StartTime.Unix())
+	tokenName := c.GetString("token_name")
+	other := map[string]any{
+		"output_sensitive":        true,
+		"output_sensitive_words":  words,
+		"output_sensitive_policy": filter.policy,
+	}
+	content := "输出内容命中屏蔽词：" + strings.Join(words, ", ")
+
+	if feeQuota > 0 {
+		if err := PostConsumeQuota(relayInfo, feeQuota, 0, true); err != nil {
+			logger.LogError(c, fmt.Sprintf("failed to charge output sensitive violation fee: %s", err.Error()))
+		} else {
+			model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, feeQuota)
+			model.UpdateChannelUsedQuota(relayInfo.ChannelId, feeQuota)
+			other["violation_fee"] = true
+			other["fee_quota"] = feeQuota
+			other["base_amount"] = settings.ViolationDeductionAmount
+			other["group_ratio"] = groupRatio
+			model.RecordConsumeLog(c, relayInfo.UserId, model.RecordConsumeLogParams{
+				ChannelId:      relayInfo.ChannelId,
+				ModelName:      relayInfo.OriginModelName,
+				TokenName:      tokenName,
+				Quota:          feeQuota,
+				Content:        content + "，扣除违规费用 " + logger.LogQuota(feeQuota),
+				TokenId:        relayInfo.TokenId,
+				UseTimeSeconds: useTimeSeconds,
+				IsStream:       relayInfo.IsStream,
+				Group:          relayInfo.UsingGroup,
+				Other:          other,
+			})
+			return true
+		}
+	}
+
+	model.RecordErrorLog(c, relayInfo.UserId, relayInfo.ChannelId, relayInfo.OriginModelName, tokenName, content,
+		relayInfo.TokenId, useTimeSeconds, relayInfo.IsStream, relayInfo.UsingGroup, other)
+	return true
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestOutputSensitiveFilter_StreamWordSplitAcrossChunks(t *testing.T) {
+	filter := newOutputSensitiveFilter(operation_setting.OutputSensitivePolicyLog, []string{"forbidden"})
+
+	data, stop := filter.FilterStreamData(`{"choices":[{"index":0,"delta":{"content":"this is forb"}}]}`)
+	assert.False(t, stop)
+	assert.Equal(t, "this is forb", gjson.Get(data, "choices.0.delta.content").String())
+	assert.Empty(t, filter.Hits())
+
+	data, stop = filter.FilterStreamData(`{"choices":[{"index":0,"delta":{"content":"IDDEN text"}}]}`)
+	assert.False(t, stop)
+	assert.Equal(t, "IDDEN text", gjson.Get(data, "choices.0.delta.content").String())
+	assert.Equal(t, []string{"forbidden"}, filter.Hits())
+
+	// 已经处理过的命中不会在下一个分片重复记录
+	filter.FilterStreamData(`{"choices":[{"index":0,"delta":{"content":" more"}}]}`)
+	assert.Len(t, filter.hits, 1)
+}
+
+func TestOutputSensitiveFilter_StreamMask(t *testing.T) {
+	filter := newOutputSensitiveFilter(operation_setting.OutputSensitivePolicyMask, []string{"secret"})
+
+	// 末尾可能构成屏蔽词前缀的文本暂存到下一个分片
+	data, stop := filter.FilterStreamData(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"a secret and a sec"}}`)
+	assert.False(t, stop)
+	assert.Equal(t, "a **###** and ", gjson.Get(data, "delta.text").String())
+
+	data, _ = filter.FilterStreamData(`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"ret!"}}`)
+	assert.Equal(t, "a **###**", gjson.Get(data, "delta.text").String())
+	assert.Equal(t, []string{"secret"}, filter.Hits())
+	assert.Len(t, filter.hits, 2)
+
+	// 一路输出结束前补发暂存的文本
+	flushed := filter.FlushStreamData(`{"type":"content_block_stop","index":0}`)
+	require.Len(t, flushed, 1)
+	assert.Equal(t, "!", gjson.Get(flushed[0], "delta.text").String())
+	assert.Equal(t, "content_block_delta", gjson.Get(flushed[0], "type").String())
+	assert.Empty(t, filter.FlushStreamEnd())
+}
+
+func TestOutputSensitiveFilter_StreamFlush(t *testing.T) {
+	filter := newOutputSensitiveFilter(operation_setting.OutputSensitivePolicyMask, []string{"secret"})
+
+	data, _ := filter.FilterStreamData(`{"choices":[{"index":0,"delta":{"content":"hello se"}}],"usage":null}`)
+	assert.Equal(t, "hel", gjson.Get(data, "choices.0.delta.content").String())
+
+	// 结束分片自身携带文本时一并发出
+	data, _ = filter.FilterStreamData(`{"choices":[{"index":0,"delta":{"content":"cret"},"finish_reason":"stop"}]}`)
+	assert.Equal(t, "lo **###**", gjson.Get(data, "choices.0.delta.content").String())
+	assert.Empty(t, filter.FlushStreamData(`{"choices":[{"index":0,"delta":{"content":"cret"},"finish_reason":"stop"}]}`))
+
+	// 上游异常结束时，流结束时补发
+	filter.FilterStreamData(`{"candidates":[{"content":{"parts":[{"text":"tail"}]}}],"usageMetadata":{"totalTokenCount":3}}`)
+	flushed := filter.FlushStreamEnd()
+	require.Len(t, flushed, 1)
+	assert.Equal(t, "tail", gjson.Get(flushed[0], "candidates.0.content.parts.0.text").String())
+	assert.False(t, gjson.Get(flushed[0], "usageMetadata").Exists())
+}
+
+func TestOutputSensitiveFilter_StreamTruncate(t *testing.T) {
+	filter := newOutputSensitiveFilter(operation_setting.OutputSensitivePolicyTruncate, []string{"secret"})
+
+	data, stop := filter.FilterStreamData(`{"candidates":[{"content":{"parts":[{"text":"keep this SECRET part"}]}}]}`)
+	require.True(t, stop)
+	assert.Equal(t, "keep this ", gjson.Get(data, "candidates.0.content.parts.0.text").String())
+
+	_, stop = filter.FilterStreamData(`{"candidates":[{"content":{"parts":[{"text":"after"}]}}]}`)
+	assert.True(t, stop)
+}
+
+func TestOutputSensitiveFilter_ResponseBody(t *testing.T) {
+	filter := newOutputSensitiveFilter(operation_setting.OutputSensitivePolicyTruncate, []string{"secret"})
+	body := filter.FilterResponseBody([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"the secret is out"},"finish_reason":"stop"}]}`))
+	assert.Equal(t, "the ", gjson.GetBytes(body, "choices.0.message.content").String())
+	assert.Equal(t, "content_filter", gjson.GetBytes(body, "choices.0.finish_reason").String())
+
+	filter = newOutputSensitiveFilter(operation_setting.OutputSensitivePolicyMask, []string{"secret"})
+	body = filter.FilterResponseBody([]byte(`{"content":[{"type":"text","text":"secret secret"}]}`))
+	assert.Equal(t, "**###** **###**", gjson.GetBytes(body, "content.0.text").String())
+}
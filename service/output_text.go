@@ -0,0 +1,43 @@
+package service
+
+import (
+	"bytes"
+	"strings"
+)
+
+// ExtractOutputText 提取响应中的模型输出文本，流式响应按 SSE 事件拼接，多路输出以换行分隔
+func ExtractOutputText(body []byte, isStream bool) string {
+	if !isStream {
+		texts := make([]string, 0, 1)
+		for _, field := range collectBodyTextFields(body) {
+			texts = append(texts, field.text)
+		}
+		return strings.Join(texts, "\n")
+	}
+	slots := make([]string, 0, 1)
+	builders := make(map[string]*strings.Builder)
+	for _, line := range bytes.Split(body, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, []byte("data:")) {
+			continue
+		}
+		data := bytes.TrimSpace(line[len("data:"):])
+		if len(data) == 0 || data[0] != '{' {
+			continue
+		}
+		for _, field := range collectStreamTextFields(data) {
+			builder, ok := builders[field.slot]
+			if !ok {
+				builder = &strings.Builder{}
+				builders[field.slot] = builder
+				slots = append(slots, field.slot)
+			}
+			builder.WriteString(field.text)
+		}
+	}
+	texts := make([]string, 0, len(slots))
+	for _, slot := range slots {
+		texts = append(texts, builders[slot].String())
+	}
+	return strings.Join(texts, "\n")
+}
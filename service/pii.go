@@ -0,0 +1,180 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+const (
+	PIITypeEmail      = "email"
+	PIITypePhone      = "phone"
+	PIITypeIdCard     = "id_card"
+	PIITypeCreditCard = "credit_card"
+	PIITypeCustom     = "custom"
+)
+
+// AllPIITypes 内置 PII 类型，顺序即重叠时的优先级
+var AllPIITypes = []string{PIITypeIdCard, PIITypeCreditCard, PIITypeEmail, PIITypePhone}
+
+var piiPatterns = map[string]*regexp.Regexp{
+	PIITypeEmail:      regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	PIITypePhone:      regexp.MustCompile(`(?:\+?86[\-\s]?)?\b1[3-9]\d{9}\b|\+\d{1,3}[\-\s]?\(?\d{2,4}\)?[\-\s]?\d{3,4}[\-\s]?\d{3,4}\b`),
+	PIITypeIdCard:     regexp.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+	PIITypeCreditCard: regexp.MustCompile(`\b\d(?:[\-\s]?\d){12,18}\b`),
+}
+
+var piiValidators = map[string]func(value string) bool{
+	PIITypeIdCard:     validIdCardChecksum,
+	PIITypeCreditCard: validLuhn,
+}
+
+var customPatternCache sync.Map
+
+// PIIMatch 文本中的一处 PII，Start / End 为字节偏移
+type PIIMatch struct {
+	Type  string
+	Start int
+	End   int
+	Value string
+}
+
+// compileCustomPattern 编译并缓存自定义正则，无法编译的正则只记录一次日志并缓存为 nil
+func compileCustomPattern(pattern string) *regexp.Regexp {
+	if v, ok := customPatternCache.Load(pattern); ok {
+		return v.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		if _, loaded := customPatternCache.LoadOrStore(pattern, (*regexp.Regexp)(nil)); !loaded {
+			common.SysError(fmt.Sprintf("invalid guardrail pattern %q: %s", pattern, err.Error()))
+		}
+		return nil
+	}
+	customPatternCache.Store(pattern, re)
+	return re
+}
+
+// FindPII 查找文本中的内置 PII 与自定义正则命中，重叠的命中只保留优先级更高的一处
+func FindPII(text string, piiTypes []string, customPatterns []string) []PIIMatch {
+	if text == "" {
+		return nil
+	}
+	candidates := make([]PIIMatch, 0)
+	for _, piiType := range AllPIITypes {
+		if !slices.Contains(piiTypes, piiType) {
+			continue
+		}
+		re := piiPatterns[piiType]
+		validator := piiValidators[piiType]
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			value := text[loc[0]:loc[1]]
+			if validator != nil && !validator(value) {
+				continue
+			}
+			candidates = append(candidates, PIIMatch{Type: piiType, Start: loc[0], End: loc[1], Value: value})
+		}
+	}
+	for _, pattern := range customPatterns {
+		re := compileCustomPattern(pattern)
+		if re == nil {
+			continue
+		}
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			candidates = append(candidates, PIIMatch{Type: PIITypeCustom, Start: loc[0], End: loc[1], Value: text[loc[0]:loc[1]]})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// 按优先级依次占用区间，与已占用区间重叠的命中丢弃
+	accepted := make([]PIIMatch, 0, len(candidates))
+	for _, m := range candidates {
+		overlap := false
+		for _, a := range accepted {
+			if m.Start < a.End && a.Start < m.End {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			accepted = append(accepted, m)
+		}
+	}
+	sort.Slice(accepted, func(i, j int) bool { return accepted[i].Start < accepted[j].Start })
+	return accepted
+}
+
+// ReplacePII 将命中逐处替换为 replace 的返回值
+func ReplacePII(text string, matches []PIIMatch, replace func(m PIIMatch) string) string {
+	if len(matches) == 0 {
+		return text
+	}
+	result := make([]byte, 0, len(text))
+	last := 0
+	for _, m := range matches {
+		result = append(result, text[last:m.Start]...)
+		result = append(result, replace(m)...)
+		last = m.End
+	}
+	result = append(result, text[last:]...)
+	return string(result)
+}
+
+func digitsOf(value string) []int {
+	digits := make([]int, 0, len(value))
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, int(r-'0'))
+		}
+	}
+	return digits
+}
+
+// validLuhn 信用卡号的 Luhn 校验
+func validLuhn(value string) bool {
+	digits := digitsOf(value)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIdCardChecksum 18 位居民身份证号的校验码
+func validIdCardChecksum(value string) bool {
+	if len(value) != 18 {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	checks := "10X98765432"
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(value[i]-'0') * weights[i]
+	}
+	last := value[17]
+	if last == 'x' {
+		last = 'X'
+	}
+	return checks[sum%11] == last
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/sjson"
+)
+
+var (
+	piiPlaceholderPattern = regexp.MustCompile(`\[(?:EMAIL|PHONE|ID_CARD|CREDIT_CARD)_\d+\]`)
+	// piiPlaceholderPrefix 匹配文本末尾可能被拆到下一个分片的占位符前半段
+	piiPlaceholderPrefix = regexp.MustCompile(`\[[A-Z_]*\d*$`)
+)
+
+const piiPlaceholderMaxLen = len("[CREDIT_CARD_") + 6
+
+// PIIRedactor 按渠道设置对请求中的个人信息脱敏，restore 模式下记录占位符并在响应中还原
+type PIIRedactor struct {
+	mode  string
+	types []string
+
+	mu        sync.Mutex
+	values    map[string]string // 原文 -> 占位符，同一原文复用同一占位符
+	originals map[string]string // 占位符 -> 原文
+	counters  map[string]int
+	pending   map[string]string // 流式输出中尚未完整的占位符前半段
+}
+
+// NewPIIRedactor 渠道未开启脱敏时返回 nil
+func NewPIIRedactor(setting dto.ChannelSettings) *PIIRedactor {
+	if setting.PIIRedactionMode != dto.PIIRedactionModeMask && setting.PIIRedactionMode != dto.PIIRedactionModeRestore {
+		return nil
+	}
+	types := setting.PIIRedactionTypes
+	if len(types) == 0 {
+		types = AllPIITypes
+	}
+	return &PIIRedactor{
+		mode:      setting.PIIRedactionMode,
+		types:     types,
+		values:    make(map[string]string),
+		originals: make(map[string]string),
+		counters:  make(map[string]int),
+		pending:   make(map[string]string),
+	}
+}
+
+func (r *PIIRedactor) placeholder(m PIIMatch) string {
+	label := strings.ToUpper(m.Type)
+	if r.mode == dto.PIIRedactionModeMask {
+		return "[" + label + "]"
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if placeholder, ok := r.values[m.Value]; ok {
+		return placeholder
+	}
+	r.counters[label]++
+	placeholder := fmt.Sprintf("[%s_%d]", label, r.counters[label])
+	r.values[m.Value] = placeholder
+	r.originals[placeholder] = m.Value
+	return placeholder
+}
+
+// Redact 替换文本中的个人信息
+func (r *PIIRedactor) Redact(text string) string {
+	return ReplacePII(text, FindPII(text, r.types, nil), r.placeholder)
+}
+
+// Restore 将文本中的占位符还原为原文，未知的占位符保持不变
+func (r *PIIRedactor) Restore(text string) string {
+	if !strings.Contains(text, "[") {
+		return text
+	}
+	return piiPlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if original, ok := r.originals[placeholder]; ok {
+			return original
+		}
+		return placeholder
+	})
+}
+
+func (r *PIIRedactor) restoring() bool {
+	if r.mode != dto.PIIRedactionModeRestore {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.originals) > 0
+}
+
+// restoreSlot 还原一段流式文本，末尾不完整的占位符暂存到同一路输出的下一个分片
+func (r *PIIRedactor) restoreSlot(slot string, text string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	text = r.pending[slot] + text
+	delete(r.pending, slot)
+	if loc := piiPlaceholderPrefix.FindStringIndex(text); loc != nil && loc[1]-loc[0] <= piiPlaceholderMaxLen {
+		r.pending[slot] = text[loc[0]:]
+		text = text[:loc[0]]
+	}
+	return r.Restore(text)
+}
+
+// FilterStreamData 实现 relaycommon.OutputContentFilter，还原流式输出中的占位符
+func (r *PIIRedactor) FilterStreamData(data string) (string, bool) {
+	if !r.restoring() {
+		return data, false
+	}
+	raw := []byte(data)
+	for _, field := range collectStreamTextFields(raw) {
+		restored := r.restoreSlot(field.slot, field.text)
+		if restored == field.text {
+			continue
+		}
+		if updated, err := sjson.SetBytes(raw, field.path, restored); err == nil {
+			raw = updated
+		}
+	}
+	return string(raw), false
+}
+
+// FilterResponseBody 还原非流式响应中的占位符
+func (r *PIIRedactor) FilterResponseBody(data []byte) []byte {
+	if !r.restoring() {
+		return data
+	}
+	for _, field := range collectBodyTextFields(data) {
+		restored := r.Restore(field.text)
+		if restored == field.text {
+			continue
+		}
+		if updated, err := sjson.SetBytes(data, field.path, restored); err == nil {
+			data = updated
+		}
+	}
+	return data
+}
+
+func getPIIRedactor(c *gin.Context) *PIIRedactor {
+	if c == nil {
+		return nil
+	}
+	redactor, ok := common.GetContextKeyType[*PIIRedactor](c, constant.ContextKeyPIIRedactor)
+	if !ok {
+		return nil
+	}
+	return redactor
+}
+
+// ApplyChannelPIIRedaction 按当前渠道的设置对请求脱敏，需在转换为上游格式之前调用。
+// 每次选择渠道都会重新创建脱敏器，重试到未开启脱敏的渠道时清除上一次的状态。
+func ApplyChannelPIIRedaction(c *gin.Context, info *relaycommon.RelayInfo, request dto.Request) error {
+	redactor := NewPIIRedactor(info.ChannelSetting)
+	if redactor == nil {
+		common.SetContextKey(c, constant.ContextKeyPIIRedactor, nil)
+		return nil
+	}
+	common.SetContextKey(c, constant.ContextKeyPIIRedactor, redactor)
+	_, err := RewriteRequestText(request, redactor.Redact)
+	return err
+}
+
+// PassThroughRequestBody 返回透传模式下的请求体，内容审核规则改写过请求或渠道开启脱敏时，同样改写原始请求体
+func PassThroughRequestBody(c *gin.Context, storage common.BodyStorage) (io.Reader, error) {
+	rewrites := getGuardrailRedactions(c)
+	if redactor := getPIIRedactor(c); redactor != nil {
+		rewrites = append(rewrites[:len(rewrites):len(rewrites)], redactor.Redact)
+	}
+	if len(rewrites) == 0 {
+		return common.ReaderOnly(storage), nil
+	}
+	data, err := storage.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	for _, rewrite := range rewrites {
+		data, _, err = RewriteJSONText(data, rewrite)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bytes.NewReader(data), nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestPIIRedactor_MaskMode(t *testing.T) {
+	assert.Nil(t, NewPIIRedactor(dto.ChannelSettings{}))
+
+	redactor := NewPIIRedactor(dto.ChannelSettings{PIIRedactionMode: dto.PIIRedactionModeMask, PIIRedactionTypes: []string{PIITypeEmail}})
+	require.NotNil(t, redactor)
+	assert.Equal(t, "mail [EMAIL], call 13812345678", redactor.Redact("mail a@example.com, call 13812345678"))
+	assert.False(t, redactor.restoring())
+}
+
+func TestPIIRedactor_RestoreRoundTrip(t *testing.T) {
+	redactor := NewPIIRedactor(dto.ChannelSettings{PIIRedactionMode: dto.PIIRedactionModeRestore})
+	redacted := redactor.Redact("a@example.com / b@example.com / a@example.com / 13812345678")
+	assert.Equal(t, "[EMAIL_1] / [EMAIL_2] / [EMAIL_1] / [PHONE_1]", redacted)
+
+	body := redactor.FilterResponseBody([]byte(`{"choices":[{"index":0,"message":{"content":"reply to [EMAIL_2] and [EMAIL_9]"}}]}`))
+	assert.Equal(t, "reply to b@example.com and [EMAIL_9]", gjson.GetBytes(body, "choices.0.message.content").String())
+}
+
+func TestPIIRedactor_StreamPlaceholderSplitAcrossChunks(t *testing.T) {
+	redactor := NewPIIRedactor(dto.ChannelSettings{PIIRedactionMode: dto.PIIRedactionModeRestore})
+	redactor.Redact("my phone is 13812345678")
+
+	first, stop := redactor.FilterStreamData(`{"choices":[{"index":0,"delta":{"content":"call [PHO"}}]}`)
+	assert.False(t, stop)
+	assert.Equal(t, "call ", gjson.Get(first, "choices.0.delta.content").String())
+
+	second, _ := redactor.FilterStreamData(`{"choices":[{"index":0,"delta":{"content":"NE_1] now"}}]}`)
+	assert.Equal(t, "13812345678 now", gjson.Get(second, "choices.0.delta.content").String())
+}
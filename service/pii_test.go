@@ -0,0 +1,49 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindPII_BuiltinTypes(t *testing.T) {
+	text := "联系 alice@example.com 或 13812345678，身份证 11010519491231002X，卡号 4111 1111 1111 1111。"
+	matches := FindPII(text, AllPIITypes, nil)
+	require.Len(t, matches, 4)
+
+	types := make([]string, 0, len(matches))
+	values := make([]string, 0, len(matches))
+	for _, m := range matches {
+		types = append(types, m.Type)
+		values = append(values, m.Value)
+	}
+	assert.Equal(t, []string{PIITypeEmail, PIITypePhone, PIITypeIdCard, PIITypeCreditCard}, types)
+	assert.Equal(t, []string{"alice@example.com", "13812345678", "11010519491231002X", "4111 1111 1111 1111"}, values)
+}
+
+func TestFindPII_RejectsInvalidChecksums(t *testing.T) {
+	assert.Empty(t, FindPII("身份证 110105194912310021", []string{PIITypeIdCard}, nil))
+	assert.Empty(t, FindPII("order 4111111111111112", []string{PIITypeCreditCard}, nil))
+}
+
+func TestFindPII_CustomPatternAndReplace(t *testing.T) {
+	text := "ticket EMP-00123 for bob@example.org"
+	matches := FindPII(text, []string{PIITypeEmail}, []string{`EMP-\d+`, "("})
+	require.Len(t, matches, 2)
+	assert.Equal(t, PIITypeCustom, matches[0].Type)
+
+	redacted := ReplacePII(text, matches, func(m PIIMatch) string { return "<" + m.Type + ">" })
+	assert.Equal(t, "ticket <custom> for <email>", redacted)
+}
+
+func TestFindPII_SkipsInvalidCustomPattern(t *testing.T) {
+	matches := FindPII("key sk-abc", nil, []string{"([a-z", `sk-\w+`})
+	require.Len(t, matches, 1)
+	assert.Equal(t, "sk-abc", matches[0].Value)
+
+	// the failed compile is cached, so later calls skip it without recompiling
+	v, ok := customPatternCache.Load("([a-z")
+	require.True(t, ok)
+	assert.Nil(t, v)
+}
@@ -212,6 +212,9 @@ func PostWssConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, mod
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
 	}
+	recordMultiKeyTokenUsage(ctx, relayInfo, totalTokens)
+	// 按整个会话累计的 token 数结算 TPM，会话结束释放租约时不再退还
+	SettleUsageLimit(ctx, totalTokens)
 
 	logModel := modelName
 	if extraContent != "" {
@@ -313,10 +316,12 @@ func PostAudioConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, u
 		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
 		model.UpdateChannelUsedQuota(relayInfo.ChannelId, quota)
 	}
+	recordMultiKeyTokenUsage(ctx, relayInfo, totalTokens)
 
 	if err := SettleBilling(ctx, relayInfo, quota); err != nil {
 		logger.LogError(ctx, "error settling billing: "+err.Error())
 	}
+	SettleUsageLimit(ctx, totalTokens)
 
 	logModel := relayInfo.OriginModelName
 	if extraContent != "" {
@@ -366,7 +371,7 @@ func PreConsumeTokenQuota(relayInfo *relaycommon.RelayInfo, quota int) error {
 
 func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQuota int, sendEmail bool) (err error) {
 
-	// 1) Consume from wallet quota OR subscription item
+	// 1) Consume from wallet quota OR subscription item OR organization wallet
 	if relayInfo != nil && relayInfo.BillingSource == BillingSourceSubscription {
 		if relayInfo.SubscriptionId == 0 {
 			return errors.New("subscription id is missing")
@@ -378,6 +383,10 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 			}
 			relayInfo.SubscriptionPostDelta += delta
 		}
+	} else if relayInfo.OrganizationId > 0 {
+		if err := model.AdjustOrganizationQuota(relayInfo.OrganizationId, relayInfo.UserId, quota); err != nil {
+			return err
+		}
 	} else {
 		// Wallet
 		if quota > 0 {
@@ -401,7 +410,7 @@ func PostConsumeQuota(relayInfo *relaycommon.RelayInfo, quota int, preConsumedQu
 		}
 	}
 
-	if sendEmail {
+	if sendEmail && relayInfo.OrganizationId == 0 {
 		if (quota + preConsumedQuota) != 0 {
 			checkAndSendQuotaNotify(relayInfo, quota, preConsumedQuota)
 		}
@@ -505,3 +514,11 @@ func checkAndSendSubscriptionQuotaNotify(relayInfo *relaycommon.RelayInfo) {
 		}
 	})
 }
+
+// recordMultiKeyTokenUsage 累加多Key渠道当前key今日的token用量，用于每日预算与 least_tokens_today 模式
+func recordMultiKeyTokenUsage(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, totalTokens int) {
+	if totalTokens <= 0 || !common.GetContextKeyBool(ctx, constant.ContextKeyChannelIsMultiKey) {
+		return
+	}
+	model.RecordMultiKeyTokenUsage(relayInfo.ChannelId, common.GetContextKeyInt(ctx, constant.ContextKeyChannelMultiKeyIndex), totalTokens)
+}
@@ -0,0 +1,597 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RealtimeBridgeSampleRate 桥接模式只支持 pcm16 格式：24kHz、16 位、单声道、小端
+	RealtimeBridgeSampleRate  = 24000
+	realtimeBridgeAudioFormat = "pcm16"
+	// 每个 response.audio.delta 事件携带的音频字节数（约 0.5 秒）
+	realtimeBridgeAudioChunkBytes = RealtimeBridgeSampleRate * 2 / 2
+)
+
+// ErrRealtimeBridgeQuota 阶段计费失败（额度不足），会话随之结束
+var ErrRealtimeBridgeQuota = errors.New("realtime bridge quota exceeded")
+
+// RealtimeBridgeStages 桥接模式的三个阶段，由调用方选择渠道执行并计费，返回各阶段的用量
+type RealtimeBridgeStages interface {
+	// Transcribe 识别一段 pcm16 音频，返回文本
+	Transcribe(audio []byte) (string, *dto.RealtimeUsage, error)
+	// Chat 根据对话历史生成回复文本
+	Chat(request *dto.GeneralOpenAIRequest) (string, *dto.RealtimeUsage, error)
+	// Speak 合成语音，返回 pcm16 音频
+	Speak(text string, voice string) ([]byte, *dto.RealtimeUsage, error)
+}
+
+// RealtimeStageWriter 桥接阶段的响应写入器。客户端连接已升级为 WebSocket，渠道输出只保存在内存中，由桥接转换为 Realtime 事件
+type RealtimeStageWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func NewRealtimeStageWriter(w gin.ResponseWriter) *RealtimeStageWriter {
+	return &RealtimeStageWriter{
+		ResponseWriter: w,
+		header:         http.Header{},
+		status:         http.StatusOK,
+	}
+}
+
+func (w *RealtimeStageWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *RealtimeStageWriter) WriteHeader(code int) {
+	if code > 0 {
+		w.status = code
+	}
+}
+
+func (w *RealtimeStageWriter) WriteHeaderNow() {}
+
+func (w *RealtimeStageWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *RealtimeStageWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *RealtimeStageWriter) Status() int {
+	return w.status
+}
+
+func (w *RealtimeStageWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *RealtimeStageWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (w *RealtimeStageWriter) Flush() {}
+
+// Body 返回渠道写出的响应内容
+func (w *RealtimeStageWriter) Body() []byte {
+	return w.body.Bytes()
+}
+
+// PCM16ToWav 为采样率为 sampleRate 的单声道 pcm16 音频加上 WAV 文件头，用于语音识别渠道的文件上传
+func PCM16ToWav(pcm []byte, sampleRate int) []byte {
+	var buf bytes.Buffer
+	buf.Grow(44 + len(pcm))
+	buf.WriteString("RIFF")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(36+len(pcm)))
+	buf.WriteString("WAVEfmt ")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(16))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(1)) // 单声道
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*2))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(2))
+	_ = binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	_ = binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	return buf.Bytes()
+}
+
+func pcm16Duration(pcm []byte) float64 {
+	return float64(len(pcm)/2) / RealtimeBridgeSampleRate
+}
+
+func newRealtimeUsage(inputText, inputAudio, outputText, outputAudio int) *dto.RealtimeUsage {
+	usage := &dto.RealtimeUsage{
+		InputTokens:  inputText + inputAudio,
+		OutputTokens: outputText + outputAudio,
+	}
+	usage.TotalTokens = usage.InputTokens + usage.OutputTokens
+	usage.InputTokenDetails.TextTokens = inputText
+	usage.InputTokenDetails.AudioTokens = inputAudio
+	usage.OutputTokenDetails.TextTokens = outputText
+	usage.OutputTokenDetails.AudioTokens = outputAudio
+	return usage
+}
+
+// RealtimeTranscriptionUsage 语音识别阶段的用量：输入音频按时长折算，输出为识别文本
+func RealtimeTranscriptionUsage(pcm []byte, transcript string, model string) *dto.RealtimeUsage {
+	return newRealtimeUsage(0, audioInputTokens(pcm16Duration(pcm)), CountTextToken(transcript, model), 0)
+}
+
+// RealtimeChatUsage 对话阶段的用量，取渠道返回的用量
+func RealtimeChatUsage(usage *dto.Usage) *dto.RealtimeUsage {
+	if usage == nil {
+		return newRealtimeUsage(0, 0, 0, 0)
+	}
+	return newRealtimeUsage(usage.PromptTokens, 0, usage.CompletionTokens, 0)
+}
+
+// RealtimeSpeechUsage 语音合成阶段的用量：输入为文本，输出音频按时长折算
+func RealtimeSpeechUsage(text string, pcm []byte, model string) *dto.RealtimeUsage {
+	return newRealtimeUsage(CountTextToken(text, model), 0, 0, audioOutputTokens(pcm16Duration(pcm)))
+}
+
+func addRealtimeUsage(total *dto.RealtimeUsage, usage *dto.RealtimeUsage) {
+	if usage == nil {
+		return
+	}
+	total.TotalTokens += usage.TotalTokens
+	total.InputTokens += usage.InputTokens
+	total.OutputTokens += usage.OutputTokens
+	total.InputTokenDetails.TextTokens += usage.InputTokenDetails.TextTokens
+	total.InputTokenDetails.AudioTokens += usage.InputTokenDetails.AudioTokens
+	total.OutputTokenDetails.TextTokens += usage.OutputTokenDetails.TextTokens
+	total.OutputTokenDetails.AudioTokens += usage.OutputTokenDetails.AudioTokens
+}
+
+type realtimeBridgeItem struct {
+	id      string
+	message dto.Message
+}
+
+// realtimeBridgeClientEvent 桥接模式处理的客户端事件字段
+type realtimeBridgeClientEvent struct {
+	EventId  string                  `json:"event_id"`
+	Type     string                  `json:"type"`
+	Session  *realtimeBridgeSession  `json:"session"`
+	Audio    string                  `json:"audio"`
+	Item     *dto.RealtimeItem       `json:"item"`
+	ItemId   string                  `json:"item_id"`
+	Response *realtimeBridgeResponse `json:"response"`
+}
+
+type realtimeBridgeSession struct {
+	Modalities        []string `json:"modalities"`
+	Instructions      *string  `json:"instructions"`
+	Voice             string   `json:"voice"`
+	InputAudioFormat  string   `json:"input_audio_format"`
+	OutputAudioFormat string   `json:"output_audio_format"`
+	Temperature       *float64 `json:"temperature"`
+}
+
+type realtimeBridgeResponse struct {
+	Modalities   []string `json:"modalities"`
+	Instructions *string  `json:"instructions"`
+	Voice        string   `json:"voice"`
+	Temperature  *float64 `json:"temperature"`
+}
+
+// RealtimeBridgeSession 在网关中终结的 Realtime 会话：
+// 提交的输入音频经语音识别转为文本，response.create 时由对话模型生成回复，再经语音合成输出音频。
+// 桥接模式不做服务端语音活动检测，客户端需要使用 input_audio_buffer.commit 与 response.create 控制轮次
+type RealtimeBridgeSession struct {
+	id     string
+	model  string
+	bridge operation_setting.RealtimeBridgeModel
+	stages RealtimeBridgeStages
+	emit   func(event map[string]any) error
+
+	modalities   []string
+	instructions string
+	voice        string
+	temperature  *float64
+
+	audio []byte
+	items []realtimeBridgeItem
+}
+
+func NewRealtimeBridgeSession(model string, bridge operation_setting.RealtimeBridgeModel, stages RealtimeBridgeStages, emit func(event map[string]any) error) *RealtimeBridgeSession {
+	modalities := []string{"text"}
+	if bridge.SpeechModel != "" {
+		modalities = append(modalities, "audio")
+	}
+	return &RealtimeBridgeSession{
+		id:         "sess_" + common.GetUUID(),
+		model:      model,
+		bridge:     bridge,
+		stages:     stages,
+		emit:       emit,
+		modalities: modalities,
+		voice:      common.GetStringIfEmpty(bridge.Voice, "alloy"),
+	}
+}
+
+func (s *RealtimeBridgeSession) send(eventType string, fields map[string]any) error {
+	event := map[string]any{
+		"event_id": "event_" + common.GetUUID(),
+		"type":     eventType,
+	}
+	for key, value := range fields {
+		event[key] = value
+	}
+	return s.emit(event)
+}
+
+func (s *RealtimeBridgeSession) sendError(clientEventId string, errorType string, code string, message string) error {
+	return s.send(dto.RealtimeEventTypeError, map[string]any{
+		"error": map[string]any{
+			"type":     errorType,
+			"code":     code,
+			"message":  message,
+			"param":    nil,
+			"event_id": clientEventId,
+		},
+	})
+}
+
+func (s *RealtimeBridgeSession) sessionObject() map[string]any {
+	session := map[string]any{
+		"id":                        s.id,
+		"object":                    "realtime.session",
+		"model":                     s.model,
+		"modalities":                s.modalities,
+		"instructions":              s.instructions,
+		"voice":                     s.voice,
+		"input_audio_format":        realtimeBridgeAudioFormat,
+		"output_audio_format":       realtimeBridgeAudioFormat,
+		"input_audio_transcription": map[string]any{"model": s.bridge.TranscriptionModel},
+		"turn_detection":            nil,
+		"tools":                     []any{},
+		"tool_choice":               "none",
+	}
+	if s.temperature != nil {
+		session["temperature"] = *s.temperature
+	}
+	return session
+}
+
+func (s *RealtimeBridgeSession) lastItemId() any {
+	if len(s.items) == 0 {
+		return nil
+	}
+	return s.items[len(s.items)-1].id
+}
+
+// Start 发送 session.created
+func (s *RealtimeBridgeSession) Start() error {
+	return s.send(dto.RealtimeEventTypeSessionCreated, map[string]any{"session": s.sessionObject()})
+}
+
+// HandleEvent 处理一条客户端事件。客户端事件的错误以 error 事件返回给客户端，
+// 只有写出失败或额度不足时返回错误，调用方应结束会话
+func (s *RealtimeBridgeSession) HandleEvent(message []byte) error {
+	var event realtimeBridgeClientEvent
+	if err := common.Unmarshal(message, &event); err != nil {
+		return s.sendError("", "invalid_request_error", "invalid_json", "invalid event: "+err.Error())
+	}
+	switch event.Type {
+	case dto.RealtimeEventTypeSessionUpdate:
+		return s.updateSession(&event)
+	case dto.RealtimeEventInputAudioBufferAppend:
+		audio, err := base64.StdEncoding.DecodeString(event.Audio)
+		if err != nil {
+			return s.sendError(event.EventId, "invalid_request_error", "invalid_audio", "audio must be base64 encoded")
+		}
+		maxBytes := operation_setting.GetRealtimeBridgeSetting().MaxAudioBytes
+		if maxBytes > 0 && len(s.audio)+len(audio) > maxBytes {
+			return s.sendError(event.EventId, "invalid_request_error", "input_audio_buffer_full", fmt.Sprintf("input audio buffer exceeds %d bytes", maxBytes))
+		}
+		s.audio = append(s.audio, audio...)
+		return nil
+	case "input_audio_buffer.clear":
+		s.audio = nil
+		return s.send("input_audio_buffer.cleared", nil)
+	case "input_audio_buffer.commit":
+		return s.commitAudio(&event)
+	case dto.RealtimeEventTypeConversationCreate:
+		return s.createItem(&event)
+	case "conversation.item.delete":
+		index := slices.IndexFunc(s.items, func(item realtimeBridgeItem) bool { return item.id == event.ItemId })
+		if index < 0 {
+			return s.sendError(event.EventId, "invalid_request_error", "item_not_found", fmt.Sprintf("Item with item_id '%s' not found", event.ItemId))
+		}
+		s.items = slices.Delete(s.items, index, index+1)
+		return s.send("conversation.item.deleted", map[string]any{"item_id": event.ItemId})
+	case dto.RealtimeEventTypeResponseCreate:
+		return s.createResponse(&event)
+	case "response.cancel":
+		// 回复在处理客户端事件时同步生成，收到取消时已没有进行中的回复
+		return nil
+	default:
+		return s.sendError(event.EventId, "invalid_request_error", "unsupported_event", fmt.Sprintf("event type '%s' is not supported in bridge mode", event.Type))
+	}
+}
+
+func (s *RealtimeBridgeSession) updateSession(event *realtimeBridgeClientEvent) error {
+	update := event.Session
+	if update == nil {
+		return s.send(dto.RealtimeEventTypeSessionUpdated, map[string]any{"session": s.sessionObject()})
+	}
+	for _, format := range []string{update.InputAudioFormat, update.OutputAudioFormat} {
+		if format != "" && format != realtimeBridgeAudioFormat {
+			return s.sendError(event.EventId, "invalid_request_error", "unsupported_audio_format", "only pcm16 audio is supported in bridge mode")
+		}
+	}
+	if len(update.Modalities) > 0 {
+		s.modalities = update.Modalities
+	}
+	if update.Instructions != nil {
+		s.instructions = *update.Instructions
+	}
+	if update.Voice != "" {
+		s.voice = update.Voice
+	}
+	if update.Temperature != nil {
+		s.temperature = update.Temperature
+	}
+	return s.send(dto.RealtimeEventTypeSessionUpdated, map[string]any{"session": s.sessionObject()})
+}
+
+// stageError 阶段失败时向客户端报告，额度不足时返回错误结束会话
+func (s *RealtimeBridgeSession) stageError(err error, report func() error) error {
+	if reportErr := report(); reportErr != nil {
+		return reportErr
+	}
+	if errors.Is(err, ErrRealtimeBridgeQuota) {
+		return err
+	}
+	return nil
+}
+
+func (s *RealtimeBridgeSession) commitAudio(event *realtimeBridgeClientEvent) error {
+	if len(s.audio) == 0 {
+		return s.sendError(event.EventId, "invalid_request_error", "input_audio_buffer_commit_empty", "Error committing input audio buffer: the buffer is empty.")
+	}
+	audio := s.audio
+	s.audio = nil
+
+	itemId := "item_" + common.GetUUID()
+	previousItemId := s.lastItemId()
+	if err := s.send("input_audio_buffer.committed", map[string]any{"previous_item_id": previousItemId, "item_id": itemId}); err != nil {
+		return err
+	}
+	item := map[string]any{
+		"id":      itemId,
+		"object":  "realtime.item",
+		"type":    "message",
+		"status":  "completed",
+		"role":    "user",
+		"content": []any{map[string]any{"type": "input_audio", "transcript": nil}},
+	}
+	if err := s.send(dto.RealtimeEventConversationItemCreated, map[string]any{"previous_item_id": previousItemId, "item": item}); err != nil {
+		return err
+	}
+
+	transcript, _, err := s.stages.Transcribe(audio)
+	if err != nil {
+		return s.stageError(err, func() error {
+			return s.send("conversation.item.input_audio_transcription.failed", map[string]any{
+				"item_id":       itemId,
+				"content_index": 0,
+				"error":         map[string]any{"type": "transcription_error", "message": err.Error()},
+			})
+		})
+	}
+	s.items = append(s.items, realtimeBridgeItem{
+		id:      itemId,
+		message: dto.Message{Role: "user", Content: transcript},
+	})
+	return s.send("conversation.item.input_audio_transcription.completed", map[string]any{
+		"item_id":       itemId,
+		"content_index": 0,
+		"transcript":    transcript,
+	})
+}
+
+func realtimeItemText(item *dto.RealtimeItem) string {
+	var parts []string
+	for _, content := range item.Content {
+		switch {
+		case content.Text != "":
+			parts = append(parts, content.Text)
+		case content.Transcript != "":
+			parts = append(parts, content.Transcript)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (s *RealtimeBridgeSession) createItem(event *realtimeBridgeClientEvent) error {
+	item := event.Item
+	if item == nil || (item.Type != "" && item.Type != "message") {
+		return s.sendError(event.EventId, "invalid_request_error", "unsupported_item", "only message items are supported in bridge mode")
+	}
+	switch item.Role {
+	case "user", "assistant", "system":
+	default:
+		return s.sendError(event.EventId, "invalid_request_error", "invalid_role", "item role must be user, assistant or system")
+	}
+	text := realtimeItemText(item)
+	if text == "" {
+		return s.sendError(event.EventId, "invalid_request_error", "empty_item", "only text content is supported in bridge mode")
+	}
+	itemId := common.GetStringIfEmpty(item.Id, "item_"+common.GetUUID())
+	previousItemId := s.lastItemId()
+	s.items = append(s.items, realtimeBridgeItem{
+		id:      itemId,
+		message: dto.Message{Role: item.Role, Content: text},
+	})
+	created := *item
+	created.Id = itemId
+	created.Type = "message"
+	created.Status = "completed"
+	return s.send(dto.RealtimeEventConversationItemCreated, map[string]any{"previous_item_id": previousItemId, "item": created})
+}
+
+func (s *RealtimeBridgeSession) createResponse(event *realtimeBridgeClientEvent) error {
+	modalities := s.modalities
+	instructions := s.instructions
+	voice := s.voice
+	temperature := s.temperature
+	if options := event.Response; options != nil {
+		if len(options.Modalities) > 0 {
+			modalities = options.Modalities
+		}
+		if options.Instructions != nil {
+			instructions = *options.Instructions
+		}
+		voice = common.GetStringIfEmpty(options.Voice, voice)
+		if options.Temperature != nil {
+			temperature = options.Temperature
+		}
+	}
+	withAudio := slices.Contains(modalities, "audio") && s.bridge.SpeechModel != ""
+
+	responseId := "resp_" + common.GetUUID()
+	response := map[string]any{
+		"id":     responseId,
+		"object": "realtime.response",
+		"status": "in_progress",
+		"output": []any{},
+		"usage":  nil,
+	}
+	if err := s.send("response.created", map[string]any{"response": response}); err != nil {
+		return err
+	}
+	failed := func(err error) error {
+		return s.stageError(err, func() error {
+			response["status"] = "failed"
+			response["status_details"] = map[string]any{
+				"type":  "failed",
+				"error": map[string]any{"type": "server_error", "message": err.Error()},
+			}
+			return s.send(dto.RealtimeEventTypeResponseDone, map[string]any{"response": response})
+		})
+	}
+
+	messages := make([]dto.Message, 0, len(s.items)+1)
+	if instructions != "" {
+		messages = append(messages, dto.Message{Role: "system", Content: instructions})
+	}
+	for _, item := range s.items {
+		messages = append(messages, item.message)
+	}
+	text, chatUsage, err := s.stages.Chat(&dto.GeneralOpenAIRequest{
+		Model:       s.bridge.ChatModel,
+		Messages:    messages,
+		Temperature: temperature,
+	})
+	if err != nil {
+		return failed(err)
+	}
+	usage := &dto.RealtimeUsage{}
+	addRealtimeUsage(usage, chatUsage)
+
+	var audio []byte
+	if withAudio {
+		var speechUsage *dto.RealtimeUsage
+		audio, speechUsage, err = s.stages.Speak(text, voice)
+		if err != nil {
+			return failed(err)
+		}
+		addRealtimeUsage(usage, speechUsage)
+	}
+
+	itemId := "item_" + common.GetUUID()
+	previousItemId := s.lastItemId()
+	s.items = append(s.items, realtimeBridgeItem{
+		id:      itemId,
+		message: dto.Message{Role: "assistant", Content: text},
+	})
+	item := map[string]any{
+		"id":      itemId,
+		"object":  "realtime.item",
+		"type":    "message",
+		"status":  "in_progress",
+		"role":    "assistant",
+		"content": []any{},
+	}
+	position := map[string]any{"response_id": responseId, "item_id": itemId, "output_index": 0, "content_index": 0}
+	withPosition := func(fields map[string]any) map[string]any {
+		for key, value := range position {
+			fields[key] = value
+		}
+		return fields
+	}
+
+	if err := s.send("response.output_item.added", map[string]any{"response_id": responseId, "output_index": 0, "item": item}); err != nil {
+		return err
+	}
+	if err := s.send(dto.RealtimeEventConversationItemCreated, map[string]any{"previous_item_id": previousItemId, "item": item}); err != nil {
+		return err
+	}
+
+	var part map[string]any
+	if withAudio {
+		if err := s.send("response.content_part.added", withPosition(map[string]any{"part": map[string]any{"type": "audio", "transcript": ""}})); err != nil {
+			return err
+		}
+		if err := s.send(dto.RealtimeEventResponseAudioTranscriptionDelta, withPosition(map[string]any{"delta": text})); err != nil {
+			return err
+		}
+		for start := 0; start < len(audio); start += realtimeBridgeAudioChunkBytes {
+			end := min(start+realtimeBridgeAudioChunkBytes, len(audio))
+			if err := s.send(dto.RealtimeEventResponseAudioDelta, withPosition(map[string]any{"delta": base64.StdEncoding.EncodeToString(audio[start:end])})); err != nil {
+				return err
+			}
+		}
+		if err := s.send("response.audio.done", withPosition(map[string]any{})); err != nil {
+			return err
+		}
+		if err := s.send("response.audio_transcript.done", withPosition(map[string]any{"transcript": text})); err != nil {
+			return err
+		}
+		part = map[string]any{"type": "audio", "transcript": text}
+	} else {
+		if err := s.send("response.content_part.added", withPosition(map[string]any{"part": map[string]any{"type": "text", "text": ""}})); err != nil {
+			return err
+		}
+		if err := s.send("response.text.delta", withPosition(map[string]any{"delta": text})); err != nil {
+			return err
+		}
+		if err := s.send("response.text.done", withPosition(map[string]any{"text": text})); err != nil {
+			return err
+		}
+		part = map[string]any{"type": "text", "text": text}
+	}
+	if err := s.send("response.content_part.done", withPosition(map[string]any{"part": part})); err != nil {
+		return err
+	}
+
+	item["status"] = "completed"
+	item["content"] = []any{part}
+	if err := s.send("response.output_item.done", map[string]any{"response_id": responseId, "output_index": 0, "item": item}); err != nil {
+		return err
+	}
+	response["status"] = "completed"
+	response["output"] = []any{item}
+	response["usage"] = usage
+	return s.send(dto.RealtimeEventTypeResponseDone, map[string]any{"response": response})
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"mime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrRealtimeBridgeAudioFormat 语音合成渠道返回了无法转换为 pcm16 的音频
+var ErrRealtimeBridgeAudioFormat = errors.New("speech audio cannot be converted to pcm16")
+
+// compressedAudioTypes 无法在网关内解码的压缩音频格式
+var compressedAudioTypes = []string{
+	"audio/mpeg", "audio/mp3", "audio/ogg", "audio/opus", "audio/aac", "audio/flac",
+	"audio/webm", "audio/mp4", "audio/x-m4a",
+}
+
+// SpeechToPCM16 将语音合成渠道返回的音频转换为桥接使用的 24kHz 单声道 pcm16。
+// WAV 按文件头解析，声明了采样率的原始 pcm 按声明的采样率与声道数处理，audio/L16 为大端序；
+// mp3、opus 等压缩格式无法解码，返回 ErrRealtimeBridgeAudioFormat。
+func SpeechToPCM16(audio []byte, contentType string) ([]byte, error) {
+	if isWav(audio) {
+		samples, sampleRate, channels, err := parseWav(audio)
+		if err != nil {
+			return nil, err
+		}
+		return samplesToPCM16(resamplePCM16(downmixPCM16(samples, channels), sampleRate, RealtimeBridgeSampleRate)), nil
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	mediaType = strings.ToLower(mediaType)
+	if isCompressedAudio(audio, mediaType) {
+		if mediaType == "" {
+			mediaType = "compressed"
+		}
+		return nil, fmt.Errorf("%w: channel returned %s audio, configure a speech model that outputs pcm", ErrRealtimeBridgeAudioFormat, mediaType)
+	}
+
+	sampleRate := RealtimeBridgeSampleRate
+	if rate, err := strconv.Atoi(params["rate"]); err == nil && rate > 0 {
+		sampleRate = rate
+	}
+	channels := 1
+	if count, err := strconv.Atoi(params["channels"]); err == nil && count > 0 {
+		channels = count
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if mediaType == "audio/l16" {
+		order = binary.BigEndian
+	}
+	samples := make([]int16, len(audio)/2)
+	for i := range samples {
+		samples[i] = int16(order.Uint16(audio[i*2:]))
+	}
+	return samplesToPCM16(resamplePCM16(downmixPCM16(samples, channels), sampleRate, RealtimeBridgeSampleRate)), nil
+}
+
+// ResamplePCM16 将 24kHz pcm16 音频重采样为 sampleRate，用于只接受特定采样率的语音识别渠道
+func ResamplePCM16(pcm []byte, sampleRate int) []byte {
+	if sampleRate <= 0 || sampleRate == RealtimeBridgeSampleRate {
+		return pcm
+	}
+	samples := make([]int16, len(pcm)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+	}
+	return samplesToPCM16(resamplePCM16(samples, RealtimeBridgeSampleRate, sampleRate))
+}
+
+func isWav(audio []byte) bool {
+	return len(audio) >= 12 && string(audio[:4]) == "RIFF" && string(audio[8:12]) == "WAVE"
+}
+
+func isCompressedAudio(audio []byte, mediaType string) bool {
+	if slices.Contains(compressedAudioTypes, mediaType) {
+		return true
+	}
+	switch {
+	case bytes.HasPrefix(audio, []byte("ID3")), bytes.HasPrefix(audio, []byte("OggS")), bytes.HasPrefix(audio, []byte("fLaC")):
+		return true
+	case len(audio) >= 8 && string(audio[4:8]) == "ftyp":
+		return true
+	}
+	return false
+}
+
+// parseWav 解析 16 位 PCM 编码的 WAV，返回采样、采样率与声道数
+func parseWav(audio []byte) ([]int16, int, int, error) {
+	var sampleRate, channels int
+	for offset := 12; offset+8 <= len(audio); {
+		chunkId := string(audio[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(audio[offset+4:]))
+		body := audio[offset+8:]
+		if size > len(body) {
+			// 流式生成的 WAV 可能没有填写长度
+			size = len(body)
+		}
+		switch chunkId {
+		case "fmt ":
+			if size < 16 {
+				return nil, 0, 0, fmt.Errorf("%w: invalid wav header", ErrRealtimeBridgeAudioFormat)
+			}
+			format := binary.LittleEndian.Uint16(body)
+			channels = int(binary.LittleEndian.Uint16(body[2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			bits := binary.LittleEndian.Uint16(body[14:])
+			// 1 为 PCM，0xFFFE 为 WAVE_FORMAT_EXTENSIBLE
+			if (format != 1 && format != 0xFFFE) || bits != 16 || channels <= 0 || sampleRate <= 0 {
+				return nil, 0, 0, fmt.Errorf("%w: wav must be 16-bit pcm, got format %d with %d bits", ErrRealtimeBridgeAudioFormat, format, bits)
+			}
+		case "data":
+			if sampleRate == 0 {
+				return nil, 0, 0, fmt.Errorf("%w: wav data before fmt chunk", ErrRealtimeBridgeAudioFormat)
+			}
+			samples := make([]int16, size/2)
+			for i := range samples {
+				samples[i] = int16(binary.LittleEndian.Uint16(body[i*2:]))
+			}
+			return samples, sampleRate, channels, nil
+		}
+		offset += 8 + size + size%2
+	}
+	return nil, 0, 0, fmt.Errorf("%w: wav has no data chunk", ErrRealtimeBridgeAudioFormat)
+}
+
+// downmixPCM16 将交错存放的多声道采样平均为单声道
+func downmixPCM16(samples []int16, channels int) []int16 {
+	if channels <= 1 {
+		return samples
+	}
+	mono := make([]int16, len(samples)/channels)
+	for i := range mono {
+		sum := 0
+		for ch := 0; ch < channels; ch++ {
+			sum += int(samples[i*channels+ch])
+		}
+		mono[i] = int16(sum / channels)
+	}
+	return mono
+}
+
+// resamplePCM16 按线性插值将单声道采样从 from 重采样为 to
+func resamplePCM16(samples []int16, from int, to int) []int16 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+	out := make([]int16, int(int64(len(samples))*int64(to)/int64(from)))
+	step := float64(from) / float64(to)
+	for i := range out {
+		pos := float64(i) * step
+		idx := int(pos)
+		if idx >= len(samples)-1 {
+			out[i] = samples[len(samples)-1]
+			continue
+		}
+		frac := pos - float64(idx)
+		out[i] = int16(float64(samples[idx])*(1-frac) + float64(samples[idx+1])*frac)
+	}
+	return out
+}
+
+func samplesToPCM16(samples []int16) []byte {
+	pcm := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(sample))
+	}
+	return pcm
+}
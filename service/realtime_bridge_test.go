@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRealtimeBridgeStages struct {
+	chatRequest *dto.GeneralOpenAIRequest
+	speakErr    error
+}
+
+func (f *fakeRealtimeBridgeStages) Transcribe(audio []byte) (string, *dto.RealtimeUsage, error) {
+	return "hello", newRealtimeUsage(0, 10, 2, 0), nil
+}
+
+func (f *fakeRealtimeBridgeStages) Chat(request *dto.GeneralOpenAIRequest) (string, *dto.RealtimeUsage, error) {
+	f.chatRequest = request
+	return "hi there", newRealtimeUsage(20, 0, 3, 0), nil
+}
+
+func (f *fakeRealtimeBridgeStages) Speak(text string, voice string) ([]byte, *dto.RealtimeUsage, error) {
+	if f.speakErr != nil {
+		return nil, nil, f.speakErr
+	}
+	return make([]byte, realtimeBridgeAudioChunkBytes+10), newRealtimeUsage(3, 0, 0, 50), nil
+}
+
+func TestRealtimeBridgeSession(t *testing.T) {
+	stages := &fakeRealtimeBridgeStages{}
+	var events []map[string]any
+	session := NewRealtimeBridgeSession("bridge-realtime", operation_setting.RealtimeBridgeModel{
+		TranscriptionModel: "whisper-1",
+		ChatModel:          "claude-sonnet-4-5",
+		SpeechModel:        "tts-1",
+	}, stages, func(event map[string]any) error {
+		data, err := common.Marshal(event)
+		require.NoError(t, err)
+		var decoded map[string]any
+		require.NoError(t, common.Unmarshal(data, &decoded))
+		events = append(events, decoded)
+		return nil
+	})
+	types := func() []string {
+		var result []string
+		for _, event := range events {
+			result = append(result, event["type"].(string))
+		}
+		events = nil
+		return result
+	}
+
+	require.NoError(t, session.Start())
+	require.NoError(t, session.HandleEvent([]byte(`{"type":"session.update","session":{"instructions":"be nice","voice":"verse"}}`)))
+	require.Equal(t, []string{"session.created", "session.updated"}, types())
+
+	require.NoError(t, session.HandleEvent([]byte(`{"type":"session.update","session":{"input_audio_format":"g711_ulaw"}}`)))
+	require.Equal(t, []string{"error"}, types())
+
+	audio := base64.StdEncoding.EncodeToString([]byte{1, 2, 3, 4})
+	require.NoError(t, session.HandleEvent([]byte(`{"type":"input_audio_buffer.append","audio":"`+audio+`"}`)))
+	require.NoError(t, session.HandleEvent([]byte(`{"type":"input_audio_buffer.commit"}`)))
+	transcription := events[len(events)-1]
+	require.Equal(t, []string{"input_audio_buffer.committed", "conversation.item.created", "conversation.item.input_audio_transcription.completed"}, types())
+	require.Equal(t, "hello", transcription["transcript"])
+
+	require.NoError(t, session.HandleEvent([]byte(`{"type":"response.create"}`)))
+	done := events[len(events)-1]
+	require.Equal(t, []string{
+		"response.created", "response.output_item.added", "conversation.item.created", "response.content_part.added",
+		"response.audio_transcript.delta", "response.audio.delta", "response.audio.delta", "response.audio.done",
+		"response.audio_transcript.done", "response.content_part.done", "response.output_item.done", "response.done",
+	}, types())
+	response := done["response"].(map[string]any)
+	require.Equal(t, "completed", response["status"])
+	require.EqualValues(t, 76, response["usage"].(map[string]any)["total_tokens"])
+
+	require.Len(t, stages.chatRequest.Messages, 2)
+	require.Equal(t, "system", stages.chatRequest.Messages[0].Role)
+	require.Equal(t, "hello", stages.chatRequest.Messages[1].StringContent())
+
+	// 额度不足时报告失败并结束会话
+	stages.speakErr = ErrRealtimeBridgeQuota
+	err := session.HandleEvent([]byte(`{"type":"response.create"}`))
+	require.True(t, errors.Is(err, ErrRealtimeBridgeQuota))
+	require.Equal(t, "failed", events[len(events)-1]["response"].(map[string]any)["status"])
+}
+
+func TestPCM16ToWav(t *testing.T) {
+	wav := PCM16ToWav(make([]byte, 480), RealtimeBridgeSampleRate)
+	require.Len(t, wav, 44+480)
+	require.Equal(t, "RIFF", string(wav[:4]))
+	require.Equal(t, "WAVE", string(wav[8:12]))
+	require.Equal(t, "data", string(wav[36:40]))
+}
+
+func TestSpeechToPCM16(t *testing.T) {
+	// 24kHz 原始 pcm 保持不变
+	pcm := samplesToPCM16([]int16{1, -2, 3, -4})
+	converted, err := SpeechToPCM16(pcm, "audio/pcm")
+	require.NoError(t, err)
+	require.Equal(t, pcm, converted)
+
+	// 12kHz 的 WAV 重采样为 24kHz，长度翻倍
+	wav := PCM16ToWav(samplesToPCM16([]int16{0, 100, 200, 300}), 12000)
+	converted, err = SpeechToPCM16(wav, "audio/wav")
+	require.NoError(t, err)
+	require.Len(t, converted, 16)
+	require.Equal(t, samplesToPCM16([]int16{0, 50, 100, 150}), converted[:8])
+
+	// audio/L16 为大端序双声道
+	converted, err = SpeechToPCM16([]byte{0x00, 0x02, 0x00, 0x04}, "audio/L16; rate=24000; channels=2")
+	require.NoError(t, err)
+	require.Equal(t, samplesToPCM16([]int16{3}), converted)
+
+	_, err = SpeechToPCM16([]byte("ID3\x04rest"), "application/octet-stream")
+	require.ErrorIs(t, err, ErrRealtimeBridgeAudioFormat)
+	_, err = SpeechToPCM16([]byte{0xff, 0xfb, 0x90, 0x00}, "audio/mpeg")
+	require.ErrorIs(t, err, ErrRealtimeBridgeAudioFormat)
+}
+
+func TestResamplePCM16(t *testing.T) {
+	pcm := samplesToPCM16([]int16{0, 30, 60, 90, 120, 150})
+	require.Equal(t, samplesToPCM16([]int16{0, 45, 90, 135}), ResamplePCM16(pcm, 16000))
+	require.Equal(t, pcm, ResamplePCM16(pcm, 0))
+}
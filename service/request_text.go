@@ -0,0 +1,96 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// requestTextRoots 承载对话文本的顶层字段，覆盖 OpenAI Chat / Completions、Claude Messages、Responses 与 Gemini 请求
+var requestTextRoots = []string{"messages", "prompt", "input", "instructions", "system", "contents", "systemInstruction", "system_instruction"}
+
+// requestTextKeys 文本字段之下承载文本的键，其余键（如图片地址、工具参数）保持不变
+var requestTextKeys = map[string]bool{"content": true, "text": true}
+
+func rewriteTextValue(value any, isText bool, rewrite func(text string) string, changed *bool) any {
+	switch v := value.(type) {
+	case string:
+		if !isText {
+			return v
+		}
+		rewritten := rewrite(v)
+		if rewritten != v {
+			*changed = true
+		}
+		return rewritten
+	case map[string]any:
+		for key, item := range v {
+			v[key] = rewriteTextValue(item, requestTextKeys[key], rewrite, changed)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			// 数组中的字符串（如 prompt 数组）沿用父字段的判断
+			v[i] = rewriteTextValue(item, isText, rewrite, changed)
+		}
+		return v
+	}
+	return value
+}
+
+// RewriteJSONText 对 JSON 请求体中的对话文本逐段调用 rewrite，返回改写后的请求体以及是否有修改
+func RewriteJSONText(data []byte, rewrite func(text string) string) ([]byte, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body map[string]any
+	if err := decoder.Decode(&body); err != nil {
+		return data, false, err
+	}
+	changed := false
+	for _, root := range requestTextRoots {
+		if item, ok := body[root]; ok {
+			body[root] = rewriteTextValue(item, true, rewrite, &changed)
+		}
+	}
+	if !changed {
+		return data, false, nil
+	}
+	rewritten, err := common.Marshal(body)
+	if err != nil {
+		return data, false, err
+	}
+	return rewritten, true, nil
+}
+
+// RewriteRequestText 对请求中的对话文本逐段调用 rewrite，有修改时写回 request 并返回 true
+func RewriteRequestText(request dto.Request, rewrite func(text string) string) (bool, error) {
+	if request == nil {
+		return false, nil
+	}
+	data, err := common.Marshal(request)
+	if err != nil {
+		return false, err
+	}
+	data, changed, err := RewriteJSONText(data, rewrite)
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := common.Unmarshal(data, request); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// CollectRequestTexts 返回请求中的全部对话文本段
+func CollectRequestTexts(request dto.Request) ([]string, error) {
+	texts := make([]string, 0)
+	_, err := RewriteRequestText(request, func(text string) string {
+		if text != "" {
+			texts = append(texts, text)
+		}
+		return text
+	})
+	return texts, err
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/hot"
+)
+
+const (
+	responseCacheNamespace = "new-api:response_cache:v1"
+	// ResponseCacheHeader 响应头，标记本次响应是否来自网关缓存（hit / miss）
+	ResponseCacheHeader = "X-New-Api-Response-Cache"
+)
+
+// 规范化请求体时忽略的字段：只影响上游的用户标识，不影响生成结果
+var responseCacheIgnoredFields = []string{"user", "metadata"}
+
+// ResponseCacheEntry 缓存的上游响应及其计费信息
+type ResponseCacheEntry struct {
+	StatusCode       int    `json:"status_code"`
+	ContentType      string `json:"content_type"`
+	Body             []byte `json:"body"`
+	IsStream         bool   `json:"is_stream"`
+	ModelName        string `json:"model_name"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Quota            int    `json:"quota"`
+	CreatedAt        int64  `json:"created_at"`
+}
+
+// ResponseCacheRequest 一次可缓存请求的查找条件
+type ResponseCacheRequest struct {
+	// Key 精确匹配的缓存键
+	Key       string
+	UserId    int
+	ModelName string
+	Path      string
+	// NormalizedBody 规范化后的请求体（字段排序，去除无关字段）
+	NormalizedBody []byte
+}
+
+// ResponseCacheMatcher 响应缓存的匹配策略。
+// 目前只有精确匹配实现，后续可以基于 NormalizedBody 计算 embedding 实现相似度匹配。
+type ResponseCacheMatcher interface {
+	Lookup(req *ResponseCacheRequest) (*ResponseCacheEntry, bool, error)
+	Store(req *ResponseCacheRequest, entry *ResponseCacheEntry, ttl time.Duration) error
+}
+
+var (
+	responseCacheOnce    sync.Once
+	responseCache        *cachex.HybridCache[ResponseCacheEntry]
+	responseCacheMatcher ResponseCacheMatcher = exactResponseCacheMatcher{}
+)
+
+// SetResponseCacheMatcher 替换响应缓存的匹配策略
+func SetResponseCacheMatcher(matcher ResponseCacheMatcher) {
+	if matcher != nil {
+		responseCacheMatcher = matcher
+	}
+}
+
+func getResponseCache() *cachex.HybridCache[ResponseCacheEntry] {
+	responseCacheOnce.Do(func() {
+		responseCache = cachex.NewHybridCache[ResponseCacheEntry](cachex.HybridCacheConfig[ResponseCacheEntry]{
+			Namespace: cachex.Namespace(responseCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[ResponseCacheEntry]{},
+			Memory: func() *hot.HotCache[string, ResponseCacheEntry] {
+				return hot.NewHotCache[string, ResponseCacheEntry](hot.LRU, 10_000).
+					WithTTL(24 * time.Hour).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return responseCache
+}
+
+type exactResponseCacheMatcher struct{}
+
+func (exactResponseCacheMatcher) Lookup(req *ResponseCacheRequest) (*ResponseCacheEntry, bool, error) {
+	entry, found, err := getResponseCache().Get(req.Key)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return &entry, true, nil
+}
+
+func (exactResponseCacheMatcher) Store(req *ResponseCacheRequest, entry *ResponseCacheEntry, ttl time.Duration) error {
+	return getResponseCache().SetWithTTL(req.Key, *entry, ttl)
+}
+
+// responseCacheState 单个请求的响应缓存状态，保存在 gin context 中
+type responseCacheState struct {
+	request *ResponseCacheRequest
+	writer  *responseCaptureWriter
+
+	usageRecorded    bool
+	promptTokens     int
+	completionTokens int
+	quota            int
+}
+
+// responseCaptureWriter 在写给客户端的同时保存响应内容，超过上限后停止保存
+type responseCaptureWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *responseCaptureWriter) capture(b []byte) {
+	if w.overflow {
+		return
+	}
+	if w.buf.Len()+len(b) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(b)
+}
+
+func (w *responseCaptureWriter) Write(b []byte) (int, error) {
+	w.capture(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// ShouldUseResponseCache 判断当前请求是否启用响应缓存：
+// 全局开启，且令牌开启了响应缓存或令牌分组在配置的分组中，且请求为 chat completions / messages / embeddings
+func ShouldUseResponseCache(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	setting := operation_setting.GetResponseCacheSetting()
+	if !setting.Enabled || info == nil {
+		return false
+	}
+	if !common.GetContextKeyBool(c, constant.ContextKeyTokenResponseCache) && !setting.IsResponseCacheGroup(info.UsingGroup) {
+		return false
+	}
+	switch info.RelayFormat {
+	case types.RelayFormatOpenAI:
+		return info.RelayMode == relayconstant.RelayModeChatCompletions
+	case types.RelayFormatClaude, types.RelayFormatEmbedding:
+		return true
+	default:
+		return false
+	}
+}
+
+// NormalizeResponseCacheBody 规范化请求体：解析后按字段名排序重新序列化，并去除无关字段
+func NormalizeResponseCacheBody(body []byte) ([]byte, error) {
+	var payload map[string]any
+	if err := common.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	for _, field := range responseCacheIgnoredFields {
+		delete(payload, field)
+	}
+	return common.Marshal(payload)
+}
+
+func buildResponseCacheRequest(c *gin.Context, info *relaycommon.RelayInfo) (*ResponseCacheRequest, error) {
+	storage, err := common.GetBodyStorage(c)
+	if err != nil {
+		return nil, err
+	}
+	body, err := storage.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := NormalizeResponseCacheBody(body)
+	if err != nil {
+		return nil, err
+	}
+	path := c.Request.URL.Path
+	hash := sha256.New()
+	hash.Write([]byte(strconv.Itoa(info.UserId)))
+	hash.Write([]byte{0})
+	hash.Write([]byte(path))
+	hash.Write([]byte{0})
+	hash.Write([]byte(info.OriginModelName))
+	hash.Write([]byte{0})
+	hash.Write(normalized)
+	return &ResponseCacheRequest{
+		Key:            hex.EncodeToString(hash.Sum(nil)),
+		UserId:         info.UserId,
+		ModelName:      info.OriginModelName,
+		Path:           path,
+		NormalizedBody: normalized,
+	}, nil
+}
+
+// LookupResponseCache 查找缓存的响应。未命中时开始记录本次响应，请求成功后由 StoreResponseCache 写入缓存。
+// 请求头 Cache-Control: no-cache 跳过查找，no-store 不写入缓存。
+func LookupResponseCache(c *gin.Context, info *relaycommon.RelayInfo) (*ResponseCacheEntry, bool) {
+	req, err := buildResponseCacheRequest(c, info)
+	if err != nil {
+		logger.LogWarn(c, "response cache: failed to build cache key: "+err.Error())
+		return nil, false
+	}
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	if !strings.Contains(cacheControl, "no-cache") {
+		entry, found, err := responseCacheMatcher.Lookup(req)
+		if err != nil {
+			logger.LogWarn(c, "response cache: lookup failed: "+err.Error())
+		}
+		if found && entry.IsStream == info.IsStream {
+			return entry, true
+		}
+	}
+	c.Header(ResponseCacheHeader, "miss")
+	if strings.Contains(cacheControl, "no-store") {
+		return nil, false
+	}
+	writer := &responseCaptureWriter{
+		ResponseWriter: c.Writer,
+		limit:          operation_setting.GetResponseCacheSetting().MaxEntryBytes,
+	}
+	c.Writer = writer
+	common.SetContextKey(c, constant.ContextKeyResponseCache, &responseCacheState{request: req, writer: writer})
+	return nil, false
+}
+
+// RecordResponseCacheUsage 记录本次请求的用量和实际消耗，用于命中缓存时按比例计费
+func RecordResponseCacheUsage(c *gin.Context, promptTokens int, completionTokens int, quota int) {
+	state, ok := common.GetContextKeyType[*responseCacheState](c, constant.ContextKeyResponseCache)
+	if !ok {
+		return
+	}
+	state.usageRecorded = true
+	state.promptTokens = promptTokens
+	state.completionTokens = completionTokens
+	state.quota = quota
+}
+
+// StoreResponseCache 请求成功后将记录的响应写入缓存
+func StoreResponseCache(c *gin.Context, info *relaycommon.RelayInfo) {
+	state, ok := common.GetContextKeyType[*responseCacheState](c, constant.ContextKeyResponseCache)
+	if !ok || !state.usageRecorded {
+		return
+	}
+	// 切换到备用模型的响应不写入缓存，缓存键对应的是原请求模型
+	if GetModelFallbackInfo(c) != nil {
+		return
+	}
+	// 续写拼接或中途中断的流式响应不写入缓存
+	if GetStreamFailoverInfo(c) != nil {
+		return
+	}
+	writer := state.writer
+	if writer.overflow || writer.buf.Len() == 0 || writer.Status() != http.StatusOK {
+		return
+	}
+	setting := operation_setting.GetResponseCacheSetting()
+	entry := &ResponseCacheEntry{
+		StatusCode:       writer.Status(),
+		ContentType:      writer.Header().Get("Content-Type"),
+		Body:             bytes.Clone(writer.buf.Bytes()),
+		IsStream:         info.IsStream,
+		ModelName:        info.OriginModelName,
+		PromptTokens:     state.promptTokens,
+		CompletionTokens: state.completionTokens,
+		Quota:            state.quota,
+		CreatedAt:        common.GetTimestamp(),
+	}
+	ttl := time.Duration(max(setting.TTLSeconds, 1)) * time.Second
+	if err := responseCacheMatcher.Store(state.request, entry, ttl); err != nil {
+		logger.LogWarn(c, "response cache: store failed: "+err.Error())
+	}
+}
+
+// ResponseCacheHitQuota 命中缓存时需要扣除的额度
+func ResponseCacheHitQuota(entry *ResponseCacheEntry, ratio float64) int {
+	if entry.Quota <= 0 || ratio <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(entry.Quota) * ratio))
+}
+
+// ChargeResponseCacheHit 命中缓存时按比例计费并记录消费日志
+func ChargeResponseCacheHit(c *gin.Context, info *relaycommon.RelayInfo, entry *ResponseCacheEntry) *types.NewAPIError {
+	ratio := operation_setting.GetResponseCacheSetting().BillingRatio
+	quota := ResponseCacheHitQuota(entry, ratio)
+	if quota > 0 {
+		if apiErr := PreConsumeBilling(c, quota, info); apiErr != nil {
+			return apiErr
+		}
+		if err := SettleBilling(c, info, quota); err != nil {
+			logger.LogError(c, "error settling response cache billing: "+err.Error())
+		}
+	}
+	model.UpdateUserUsedQuotaAndRequestCount(info.UserId, quota)
+
+	other := map[string]interface{}{
+		"response_cache_hit":          true,
+		"response_cache_ratio":        ratio,
+		"response_cache_origin_quota": entry.Quota,
+		"response_cache_created_at":   entry.CreatedAt,
+	}
+	if info.BillingSource != "" {
+		other["billing_source"] = info.BillingSource
+	}
+	model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
+		ChannelId:        0,
+		PromptTokens:     entry.PromptTokens,
+		CompletionTokens: entry.CompletionTokens,
+		ModelName:        info.OriginModelName,
+		TokenName:        c.GetString("token_name"),
+		Quota:            quota,
+		Content:          fmt.Sprintf("命中响应缓存，按原始消耗 %s 的 %.2f 倍计费", logger.FormatQuota(entry.Quota), ratio),
+		TokenId:          info.TokenId,
+		UseTimeSeconds:   int(time.Since(info.StartTime).Seconds()),
+		IsStream:         entry.IsStream,
+		Group:            info.UsingGroup,
+		Other:            other,
+	})
+	return nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeResponseCacheBody(t *testing.T) {
+	a, err := NormalizeResponseCacheBody([]byte(`{"model":"gpt-4o","temperature":0,"messages":[{"role":"user","content":"hi"}],"user":"alice"}`))
+	require.NoError(t, err)
+	b, err := NormalizeResponseCacheBody([]byte(`{"messages":[{"content":"hi","role":"user"}],"metadata":{"user_id":"bob"},"temperature":0,"model":"gpt-4o"}`))
+	require.NoError(t, err)
+	require.Equal(t, string(a), string(b))
+
+	c, err := NormalizeResponseCacheBody([]byte(`{"model":"gpt-4o","temperature":0.5,"messages":[{"role":"user","content":"hi"}]}`))
+	require.NoError(t, err)
+	require.NotEqual(t, string(a), string(c))
+
+	_, err = NormalizeResponseCacheBody([]byte(`not json`))
+	require.Error(t, err)
+}
+
+func TestResponseCacheHitQuota(t *testing.T) {
+	entry := &ResponseCacheEntry{Quota: 1000}
+	require.Equal(t, 0, ResponseCacheHitQuota(entry, 0))
+	require.Equal(t, 100, ResponseCacheHitQuota(entry, 0.1))
+	require.Equal(t, 1000, ResponseCacheHitQuota(entry, 1))
+	require.Equal(t, 0, ResponseCacheHitQuota(&ResponseCacheEntry{}, 0.5))
+}
+
+func TestResponseCaptureWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	writer := &responseCaptureWriter{ResponseWriter: c.Writer, limit: 8}
+	_, _ = writer.WriteString("data: 1\n")
+	require.Equal(t, "data: 1\n", writer.buf.String())
+	require.False(t, writer.overflow)
+
+	// exceeding the limit stops capturing but keeps writing to the client
+	_, _ = writer.Write([]byte("data: 2\n"))
+	require.True(t, writer.overflow)
+	require.Zero(t, writer.buf.Len())
+	require.Equal(t, "data: 1\ndata: 2\n", recorder.Body.String())
+}
+
+func TestExactResponseCacheMatcher(t *testing.T) {
+	matcher := exactResponseCacheMatcher{}
+	req := &ResponseCacheRequest{Key: "exact-matcher-test"}
+
+	_, found, err := matcher.Lookup(req)
+	require.NoError(t, err)
+	require.False(t, found)
+
+	require.NoError(t, matcher.Store(req, &ResponseCacheEntry{StatusCode: 200, Body: []byte(`{"ok":true}`), Quota: 42}, time.Minute))
+	entry, found, err := matcher.Lookup(req)
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, 42, entry.Quota)
+	require.Equal(t, `{"ok":true}`, string(entry.Body))
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service/openaicompat"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResponsesChatWriter 在 Responses 请求经由 Chat Completions 转发时，
+// 将渠道写给客户端的 Chat Completions 输出转换为 Responses 格式。
+// 流式响应逐个分片转换为 Responses 事件，非流式响应先缓存，结束时整体转换。
+type ResponsesChatWriter struct {
+	gin.ResponseWriter
+	stream  bool
+	state   *openaicompat.ChatToResponsesStreamState
+	started bool
+	pending []byte
+	body    bytes.Buffer
+	status  int
+}
+
+// NewResponsesChatWriter 替换 c.Writer，response 为 NewResponsesResponse 构建的响应对象
+func NewResponsesChatWriter(c *gin.Context, response map[string]any, stream bool) *ResponsesChatWriter {
+	writer := &ResponsesChatWriter{
+		ResponseWriter: c.Writer,
+		stream:         stream,
+		state:          openaicompat.NewChatToResponsesStreamState(response),
+		status:         http.StatusOK,
+	}
+	c.Writer = writer
+	return writer
+}
+
+// NewResponsesResponse 根据请求构建 Responses 响应对象的公共字段
+func NewResponsesResponse(id string, req *dto.OpenAIResponsesRequest, model string) map[string]any {
+	return openaicompat.NewResponsesResponse(id, req, model, common.GetTimestamp())
+}
+
+// NewWebSearchCallItem 构建内置联网搜索的调用记录项
+func NewWebSearchCallItem() map[string]any {
+	return openaicompat.NewWebSearchCallItem()
+}
+
+// Restore 还原 c.Writer
+func (w *ResponsesChatWriter) Restore(c *gin.Context) {
+	if c.Writer == w {
+		c.Writer = w.ResponseWriter
+	}
+}
+
+// Started 流式响应是否已向客户端写出事件
+func (w *ResponsesChatWriter) Started() bool {
+	return w.started
+}
+
+func (w *ResponsesChatWriter) WriteHeader(code int) {
+	if w.stream {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *ResponsesChatWriter) WriteHeaderNow() {
+	if w.stream {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *ResponsesChatWriter) Status() int {
+	if w.stream {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *ResponsesChatWriter) Write(b []byte) (int, error) {
+	if !w.stream {
+		return w.body.Write(b)
+	}
+	w.pending = append(w.pending, b...)
+	for {
+		idx := bytes.IndexByte(w.pending, '\n')
+		if idx < 0 {
+			break
+		}
+		line := string(w.pending[:idx])
+		w.pending = w.pending[idx+1:]
+		if err := w.handleLine(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *ResponsesChatWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ResponsesChatWriter) handleLine(line string) error {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasPrefix(line, "data:") {
+		return nil
+	}
+	payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if payload == "" || payload == "[DONE]" {
+		return nil
+	}
+	var chunk dto.ChatCompletionsStreamResponse
+	if err := common.UnmarshalJsonStr(payload, &chunk); err != nil {
+		return nil
+	}
+	return w.writeEvents(w.state.HandleChunk(&chunk))
+}
+
+func (w *ResponsesChatWriter) writeEvents(events []map[string]any) error {
+	if !w.started {
+		w.started = true
+		events = append(w.state.Start(), events...)
+	}
+	for _, event := range events {
+		data, err := common.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w.ResponseWriter, "event: %s\ndata: %s\n\n", event["type"], data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Finish 还原 c.Writer 并写出最终结果：流式补发结束事件，非流式转换并写出完整响应。
+// extraItems 追加在输出末尾（如联网搜索记录），返回最终的响应 JSON；
+// 非流式渠道返回了错误内容时原样写出并返回 nil。
+func (w *ResponsesChatWriter) Finish(c *gin.Context, usage *dto.Usage, extraItems []map[string]any) ([]byte, error) {
+	w.Restore(c)
+
+	if w.stream {
+		if len(w.pending) > 0 {
+			line := string(w.pending)
+			w.pending = nil
+			if err := w.handleLine(line); err != nil {
+				return nil, err
+			}
+		}
+		events := w.state.CloseItems()
+		for _, item := range extraItems {
+			events = append(events, w.state.AddCompletedItem(item)...)
+		}
+		events = append(events, w.state.Finish(usage)...)
+		responseJSON, err := common.Marshal(w.state.Response)
+		if err != nil {
+			return nil, err
+		}
+		RunResponsesStoreHook(c, responseJSON)
+		if err := w.writeEvents(events); err != nil {
+			return nil, err
+		}
+		w.ResponseWriter.Flush()
+		return responseJSON, nil
+	}
+
+	if w.status != http.StatusOK {
+		w.ResponseWriter.Header().Del("Content-Length")
+		w.ResponseWriter.WriteHeader(w.status)
+		_, err := w.ResponseWriter.Write(w.body.Bytes())
+		return nil, err
+	}
+
+	var chatResponse dto.OpenAITextResponse
+	if err := common.Unmarshal(w.body.Bytes(), &chatResponse); err != nil {
+		return nil, fmt.Errorf("invalid chat completions response: %w", err)
+	}
+	output, finishReason := openaicompat.ChatCompletionsResponseToResponsesOutput(&chatResponse)
+	output = append(output, extraItems...)
+	openaicompat.FinishResponsesResponse(w.state.Response, output, usage, finishReason)
+	responseJSON, err := common.Marshal(w.state.Response)
+	if err != nil {
+		return nil, err
+	}
+	RunResponsesStoreHook(c, responseJSON)
+	w.ResponseWriter.Header().Set("Content-Type", "application/json")
+	w.ResponseWriter.Header().Set("Content-Length", fmt.Sprintf("%d", len(responseJSON)))
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	_, err = w.ResponseWriter.Write(responseJSON)
+	return responseJSON, err
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"github.com/tidwall/gjson"
+)
+
+func TestResponsesRequestToChatCompletionsRequest(t *testing.T) {
+	var request dto.OpenAIResponsesRequest
+	require.NoError(t, common.UnmarshalJsonStr(`{
+		"model": "claude-sonnet-4-5",
+		"instructions": "be brief",
+		"max_output_tokens": 512,
+		"stream": true,
+		"reasoning": {"effort": "high"},
+		"tools": [
+			{"type": "function", "name": "get_weather", "parameters": {"type": "object"}},
+			{"type": "web_search_preview", "search_context_size": "low"}
+		],
+		"tool_choice": {"type": "function", "name": "get_weather"},
+		"input": [
+			{"role": "user", "content": [{"type": "input_text", "text": "weather?"}, {"type": "input_image", "image_url": "https://example.com/a.png"}]},
+			{"type": "reasoning", "summary": []},
+			{"type": "function_call", "call_id": "call_1", "name": "get_weather", "arguments": "{\"city\":\"Paris\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "get_weather", "arguments": "{\"city\":\"Rome\"}"},
+			{"type": "function_call_output", "call_id": "call_1", "output": "20C"}
+		]
+	}`, &request))
+
+	chatReq, err := ResponsesRequestToChatCompletionsRequest(&request)
+	require.NoError(t, err)
+	require.Equal(t, uint(512), *chatReq.MaxTokens)
+	require.True(t, chatReq.StreamOptions.IncludeUsage)
+	require.Equal(t, "high", chatReq.ReasoningEffort)
+	require.Len(t, chatReq.Tools, 1)
+	require.Equal(t, "low", chatReq.WebSearchOptions.SearchContextSize)
+	require.Equal(t, "get_weather", chatReq.ToolChoice.(map[string]any)["function"].(map[string]any)["name"])
+
+	require.Len(t, chatReq.Messages, 4)
+	require.Equal(t, "system", chatReq.Messages[0].Role)
+	require.Len(t, chatReq.Messages[1].ParseContent(), 2)
+	require.Equal(t, "assistant", chatReq.Messages[2].Role)
+	require.Len(t, chatReq.Messages[2].ParseToolCalls(), 2)
+	require.Equal(t, "tool", chatReq.Messages[3].Role)
+	require.Equal(t, "call_1", chatReq.Messages[3].ToolCallId)
+
+	request.Tools = []byte(`[{"type": "file_search"}]`)
+	_, err = ResponsesRequestToChatCompletionsRequest(&request)
+	require.Error(t, err)
+}
+
+func TestResponsesChatWriterStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	writer := NewResponsesChatWriter(c, NewResponsesResponse("resp_1", &dto.OpenAIResponsesRequest{Model: "gemini-2.5-pro"}, "gemini-2.5-pro"), true)
+	chunks := []string{
+		`{"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}`,
+		`{"choices":[{"index":0,"delta":{"reasoning_content":"think"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"Hel"}}]}`,
+		`{"choices":[{"index":0,"delta":{"content":"lo"}}]}`,
+		`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]}}]}`,
+	}
+	for _, chunk := range chunks {
+		_, err := c.Writer.WriteString("data: " + chunk + "\n\n")
+		require.NoError(t, err)
+	}
+	// 跨 Write 调用被拆开的行需要拼接后再解析
+	_, _ = c.Writer.WriteString(`data: {"choices":[{"index":0,"delta":{},"finish_`)
+	_, _ = c.Writer.WriteString(`reason":"tool_calls"}]}` + "\n\ndata: [DONE]\n\n")
+
+	// 保存须在 response.completed 写回客户端之前完成
+	var stored []byte
+	SetResponsesStoreHook(c, func(responseJSON []byte) {
+		require.NotContains(t, recorder.Body.String(), "response.completed")
+		stored = responseJSON
+	})
+
+	responseJSON, err := writer.Finish(c, &dto.Usage{PromptTokens: 10, CompletionTokens: 5}, []map[string]any{NewWebSearchCallItem()})
+	require.NoError(t, err)
+	require.Equal(t, gin.ResponseWriter(writer.ResponseWriter), c.Writer)
+	require.Equal(t, responseJSON, stored)
+
+	var types []string
+	var sequence []int64
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			types = append(types, gjson.Get(data, "type").String())
+			sequence = append(sequence, gjson.Get(data, "sequence_number").Int())
+		}
+	}
+	require.Equal(t, "response.created", types[0])
+	require.Equal(t, "response.completed", types[len(types)-1])
+	require.Contains(t, types, "response.reasoning_summary_text.delta")
+	require.Contains(t, types, "response.output_text.done")
+	require.Contains(t, types, "response.function_call_arguments.done")
+	for i := range sequence {
+		require.Equal(t, int64(i), sequence[i])
+	}
+
+	output := gjson.GetBytes(responseJSON, "output").Array()
+	require.Len(t, output, 4)
+	require.Equal(t, "reasoning", output[0].Get("type").String())
+	require.Equal(t, "Hello", output[1].Get("content.0.text").String())
+	require.Equal(t, "call_1", output[2].Get("call_id").String())
+	require.Equal(t, dto.BuildInCallWebSearchCall, output[3].Get("type").String())
+	require.Equal(t, "completed", gjson.GetBytes(responseJSON, "status").String())
+	require.EqualValues(t, 15, gjson.GetBytes(responseJSON, "usage.total_tokens").Int())
+}
+
+func TestResponsesChatWriterNonStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+
+	writer := NewResponsesChatWriter(c, NewResponsesResponse("resp_2", nil, "claude-sonnet-4-5"), false)
+	c.Writer.Header().Set("Content-Length", "999")
+	c.Writer.WriteHeader(200)
+	_, _ = c.Writer.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"length"}]}`))
+
+	usage := &dto.Usage{PromptTokens: 10, CompletionTokens: 5, UsageSemantic: "anthropic"}
+	usage.PromptTokensDetails.CachedTokens = 30
+	responseJSON, err := writer.Finish(c, usage, nil)
+	require.NoError(t, err)
+	require.JSONEq(t, string(responseJSON), recorder.Body.String())
+	require.Equal(t, "incomplete", gjson.GetBytes(responseJSON, "status").String())
+	require.Equal(t, "hi", gjson.GetBytes(responseJSON, "output.0.content.0.text").String())
+	require.EqualValues(t, 40, gjson.GetBytes(responseJSON, "usage.input_tokens").Int())
+}
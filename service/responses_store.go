@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/openaicompat"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+)
+
+const (
+	storedResponseCleanupInterval  = time.Hour
+	storedResponseCleanupBatchSize = 1000
+	storedResponseMaxChainLength   = 100
+)
+
+var (
+	storedResponseCleanupOnce    sync.Once
+	storedResponseCleanupRunning atomic.Bool
+)
+
+// ResponsesStoreEnabled 请求未显式设置 store=false 时保存响应
+func ResponsesStoreEnabled(req *dto.OpenAIResponsesRequest) bool {
+	if req == nil || len(req.Store) == 0 {
+		return true
+	}
+	var store bool
+	if err := common.Unmarshal(req.Store, &store); err != nil {
+		return true
+	}
+	return store
+}
+
+// GetStoredResponse 获取用户保存的响应，不存在时返回 (nil, nil)
+func GetStoredResponse(userId int, responseId string) (*model.StoredResponse, error) {
+	return model.GetStoredResponse(userId, responseId)
+}
+
+// LoadResponsesHistory 沿 previous_response_id 链展开本地保存的历史输入与输出项，
+// 响应不存在时返回 (nil, nil, nil)
+func LoadResponsesHistory(userId int, responseId string) ([]map[string]any, *model.StoredResponse, error) {
+	head, err := model.GetStoredResponse(userId, responseId)
+	if err != nil || head == nil {
+		return nil, nil, err
+	}
+
+	var segments [][]map[string]any
+	for current, depth := head, 0; current != nil && depth < storedResponseMaxChainLength; depth++ {
+		var input, output []map[string]any
+		if current.Input != "" {
+			if err := common.UnmarshalJsonStr(string(current.Input), &input); err != nil {
+				return nil, nil, fmt.Errorf("invalid stored input of response %s: %w", current.ResponseId, err)
+			}
+		}
+		if current.Output != "" {
+			if err := common.UnmarshalJsonStr(string(current.Output), &output); err != nil {
+				return nil, nil, fmt.Errorf("invalid stored output of response %s: %w", current.ResponseId, err)
+			}
+		}
+		segments = append(segments, append(input, openaicompat.ResponsesOutputToInputItems(output)...))
+
+		if current.PreviousResponseId == "" {
+			break
+		}
+		// 链上更早的响应可能已过期清理，此时从能找到的部分开始
+		current, err = model.GetStoredResponse(userId, current.PreviousResponseId)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	items := make([]map[string]any, 0)
+	for i := len(segments) - 1; i >= 0; i-- {
+		items = append(items, segments[i]...)
+	}
+	return items, head, nil
+}
+
+// ParseResponsesInputItems 将 Responses 请求的 input 统一为输入项数组
+func ParseResponsesInputItems(input []byte) ([]map[string]any, error) {
+	return openaicompat.ParseResponsesInputItems(input)
+}
+
+// SetResponsesStoreHook 设置最终响应写回客户端前执行的本地保存
+func SetResponsesStoreHook(c *gin.Context, hook func(responseJSON []byte)) {
+	common.SetContextKey(c, constant.ContextKeyResponsesStoreHook, hook)
+}
+
+// RunResponsesStoreHook 在最终响应写回客户端前同步保存，客户端收到响应后立即使用 previous_response_id 也能查到，
+// 每个请求只执行一次
+func RunResponsesStoreHook(c *gin.Context, responseJSON []byte) {
+	hook, ok := common.GetContextKeyType[func([]byte)](c, constant.ContextKeyResponsesStoreHook)
+	if !ok || hook == nil {
+		return
+	}
+	common.SetContextKey(c, constant.ContextKeyResponsesStoreHook, nil)
+	hook(responseJSON)
+}
+
+// SaveStoredResponse 同步保存一次 Responses 响应，inputItems 为本次请求自身的输入项（不含展开的历史）
+func SaveStoredResponse(userId int, channelId int, req *dto.OpenAIResponsesRequest, inputItems []map[string]any, responseJSON []byte) {
+	setting := operation_setting.GetStoredResponseSetting()
+	if !setting.Enabled || !ResponsesStoreEnabled(req) || len(responseJSON) == 0 {
+		return
+	}
+	if setting.MaxBytes > 0 && len(responseJSON) > setting.MaxBytes {
+		return
+	}
+	responseId := gjson.GetBytes(responseJSON, "id").String()
+	if responseId == "" {
+		return
+	}
+	inputJSON, err := common.Marshal(inputItems)
+	if err != nil {
+		return
+	}
+	output := gjson.GetBytes(responseJSON, "output").Raw
+	if output == "" {
+		output = "[]"
+	}
+	record := &model.StoredResponse{
+		ResponseId:         responseId,
+		UserId:             userId,
+		ChannelId:          channelId,
+		ModelName:          gjson.GetBytes(responseJSON, "model").String(),
+		PreviousResponseId: req.PreviousResponseID,
+		Input:              model.LargeText(inputJSON),
+		Output:             model.LargeText(output),
+		Response:           model.LargeText(responseJSON),
+		CreatedAt:          common.GetTimestamp(),
+	}
+	if err := record.Insert(); err != nil {
+		logger.LogError(context.Background(), fmt.Sprintf("failed to save response %s: %s", responseId, err.Error()))
+	}
+}
+
+// StartStoredResponseCleanupTask 定期清理超过留存天数的本地响应
+func StartStoredResponseCleanupTask() {
+	storedResponseCleanupOnce.Do(func() {
+		if !common.IsMasterNode {
+			return
+		}
+		gopool.Go(func() {
+			ticker := time.NewTicker(storedResponseCleanupInterval)
+			defer ticker.Stop()
+
+			runStoredResponseCleanupOnce()
+			for range ticker.C {
+				runStoredResponseCleanupOnce()
+			}
+		})
+	})
+}
+
+func runStoredResponseCleanupOnce() {
+	if !storedResponseCleanupRunning.CompareAndSwap(false, true) {
+		return
+	}
+	defer storedResponseCleanupRunning.Store(false)
+
+	retentionDays := operation_setting.GetStoredResponseSetting().RetentionDays
+	if retentionDays <= 0 {
+		return
+	}
+	ctx := context.Background()
+	targetTimestamp := time.Now().AddDate(0, 0, -retentionDays).Unix()
+	count, err := model.DeleteOldStoredResponses(ctx, targetTimestamp, storedResponseCleanupBatchSize)
+	if err != nil {
+		logger.LogWarn(ctx, fmt.Sprintf("stored response cleanup task failed: %v", err))
+		return
+	}
+	if common.DebugEnabled && count > 0 {
+		logger.LogDebug(ctx, "stored response cleanup: deleted_count=%d", count)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveStoredResponse_FollowsSetting(t *testing.T) {
+	t.Cleanup(func() { model.DB.Exec("DELETE FROM stored_responses") })
+	setting := operation_setting.GetStoredResponseSetting()
+	enabled, maxBytes := setting.Enabled, setting.MaxBytes
+	t.Cleanup(func() { setting.Enabled, setting.MaxBytes = enabled, maxBytes })
+
+	req := &dto.OpenAIResponsesRequest{}
+	setting.Enabled = false
+	SaveStoredResponse(1, 1, req, nil, []byte(`{"id":"resp_off","output":[]}`))
+	stored, err := GetStoredResponse(1, "resp_off")
+	require.NoError(t, err)
+	require.Nil(t, stored)
+
+	setting.Enabled = true
+	setting.MaxBytes = 16
+	SaveStoredResponse(1, 1, req, nil, []byte(`{"id":"resp_large","output":[]}`))
+	stored, err = GetStoredResponse(1, "resp_large")
+	require.NoError(t, err)
+	require.Nil(t, stored)
+
+	setting.MaxBytes = 0
+	SaveStoredResponse(1, 1, req, nil, []byte(`{"id":"resp_ok","output":[]}`))
+	stored, err = GetStoredResponse(1, "resp_ok")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+}
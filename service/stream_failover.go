@@ -0,0 +1,438 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+)
+
+// StreamFailoverInfo 续写记录，写入日志 Other 的 stream_failover 字段
+type StreamFailoverInfo struct {
+	// 中途中断的渠道与中断原因
+	Channels []int    `json:"channels"`
+	Reasons  []string `json:"reasons"`
+	// 续写时已写出的文本长度（字符数）
+	PrefixLength int `json:"prefix_length"`
+	// 是否由其他渠道续写完成，false 表示未能续写，按已写出的内容结算
+	Completed bool `json:"completed"`
+}
+
+// streamFailoverState 单个请求的续写状态，保存在 gin context 中
+type streamFailoverState struct {
+	writer *streamFailoverWriter
+
+	mu      sync.Mutex
+	pending bool
+	// 中断尝试的 RelayInfo 与累计用量，续写失败时按此结算
+	info    *relaycommon.RelayInfo
+	usage   *dto.Usage
+	trailer [][]byte
+	log     StreamFailoverInfo
+}
+
+// streamFailoverWriter 转发流式对话的 SSE 事件，记录已写出的文本与是否已结束。
+// 结尾的用量块与 [DONE] 暂存到本次尝试结束：正常结束时写出，中断续写时丢弃，由续写的结尾代替。
+// 续写阶段的分片沿用第一段的 id 与 created，用量块合并之前各段的用量。
+type streamFailoverWriter struct {
+	gin.ResponseWriter
+
+	mu        sync.Mutex
+	partial   bytes.Buffer
+	held      [][]byte
+	text      strings.Builder
+	finished  bool
+	toolCalls bool
+	id        string
+	created   int64
+
+	continuing bool
+	prevUsage  *dto.Usage
+	// 当前续写是否已写出数据事件，写出之前失败的续写可以继续换渠道
+	emitted bool
+}
+
+func newStreamFailoverWriter(w gin.ResponseWriter) *streamFailoverWriter {
+	return &streamFailoverWriter{ResponseWriter: w}
+}
+
+func (w *streamFailoverWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.partial.Len() == 0 && !bytes.HasPrefix(b, []byte("data:")) {
+		// 保活注释、错误响应等不是数据事件，直接写出
+		return w.ResponseWriter.Write(b)
+	}
+	w.partial.Write(b)
+	for {
+		idx := bytes.Index(w.partial.Bytes(), []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		event := bytes.Clone(w.partial.Next(idx + 2))
+		if err := w.writeEvent(event); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *streamFailoverWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *streamFailoverWriter) writeEvent(event []byte) error {
+	payload := bytes.TrimSpace(bytes.TrimPrefix(event, []byte("data:")))
+	if string(payload) == "[DONE]" {
+		w.held = append(w.held, event)
+		return nil
+	}
+	if len(payload) == 0 || payload[0] != '{' {
+		return w.writeThrough(event)
+	}
+	if w.continuing {
+		w.emitted = true
+		payload = w.rewriteContinuation(payload)
+		event = append(append([]byte("data: "), payload...), '\n', '\n')
+	}
+	w.observe(payload)
+
+	usage := gjson.GetBytes(payload, "usage")
+	if len(gjson.GetBytes(payload, "choices").Array()) == 0 && usage.Exists() && usage.Type != gjson.Null {
+		w.held = append(w.held, event)
+		return nil
+	}
+	return w.writeThrough(event)
+}
+
+// writeThrough 写出事件，之前暂存的结尾如果后面还有数据事件，说明并非结尾，按原顺序先写出
+func (w *streamFailoverWriter) writeThrough(event []byte) error {
+	for _, held := range w.held {
+		if _, err := w.ResponseWriter.Write(held); err != nil {
+			return err
+		}
+	}
+	w.held = nil
+	_, err := w.ResponseWriter.Write(event)
+	return err
+}
+
+func (w *streamFailoverWriter) observe(payload []byte) {
+	if w.id == "" {
+		w.id = gjson.GetBytes(payload, "id").String()
+		w.created = gjson.GetBytes(payload, "created").Int()
+	}
+	gjson.GetBytes(payload, "choices").ForEach(func(_, choice gjson.Result) bool {
+		if text := choice.Get("delta.content"); text.Type == gjson.String {
+			w.text.WriteString(text.String())
+		}
+		if choice.Get("delta.tool_calls").Exists() {
+			w.toolCalls = true
+		}
+		if reason := choice.Get("finish_reason"); reason.Type == gjson.String && reason.String() != "" {
+			w.finished = true
+		}
+		return true
+	})
+}
+
+// rewriteContinuation 续写的分片沿用第一段的 id 与 created，用量块合并之前各段的用量
+func (w *streamFailoverWriter) rewriteContinuation(payload []byte) []byte {
+	if w.id != "" {
+		if updated, err := sjson.SetBytes(payload, "id", w.id); err == nil {
+			payload = updated
+		}
+	}
+	if w.created > 0 {
+		if updated, err := sjson.SetBytes(payload, "created", w.created); err == nil {
+			payload = updated
+		}
+	}
+	usage := gjson.GetBytes(payload, "usage")
+	if w.prevUsage == nil || !usage.IsObject() {
+		return payload
+	}
+	var current dto.Usage
+	if err := common.UnmarshalJsonStr(usage.Raw, &current); err != nil {
+		return payload
+	}
+	merged := mergeStreamUsage(w.prevUsage, &current)
+	if updated, err := sjson.SetBytes(payload, "usage", merged); err == nil {
+		payload = updated
+	}
+	return payload
+}
+
+// releaseHeld 写出暂存的结尾
+func (w *streamFailoverWriter) releaseHeld() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, held := range w.held {
+		_, _ = w.ResponseWriter.Write(held)
+	}
+	w.held = nil
+	w.ResponseWriter.Flush()
+}
+
+// takeHeld 取出暂存的结尾，不写出
+func (w *streamFailoverWriter) takeHeld() [][]byte {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	held := w.held
+	w.held = nil
+	return held
+}
+
+// mergeStreamUsage 合并多段输出的用量
+func mergeStreamUsage(a, b *dto.Usage) *dto.Usage {
+	merged := *b
+	merged.PromptTokens += a.PromptTokens
+	merged.CompletionTokens += a.CompletionTokens
+	merged.TotalTokens += a.TotalTokens
+	merged.InputTokens += a.InputTokens
+	merged.OutputTokens += a.OutputTokens
+	merged.PromptCacheHitTokens += a.PromptCacheHitTokens
+	merged.PromptTokensDetails.CachedTokens += a.PromptTokensDetails.CachedTokens
+	merged.PromptTokensDetails.CachedCreationTokens += a.PromptTokensDetails.CachedCreationTokens
+	merged.PromptTokensDetails.TextTokens += a.PromptTokensDetails.TextTokens
+	merged.PromptTokensDetails.AudioTokens += a.PromptTokensDetails.AudioTokens
+	merged.PromptTokensDetails.ImageTokens += a.PromptTokensDetails.ImageTokens
+	merged.CompletionTokenDetails.TextTokens += a.CompletionTokenDetails.TextTokens
+	merged.CompletionTokenDetails.AudioTokens += a.CompletionTokenDetails.AudioTokens
+	merged.CompletionTokenDetails.ReasoningTokens += a.CompletionTokenDetails.ReasoningTokens
+	merged.ClaudeCacheCreation5mTokens += a.ClaudeCacheCreation5mTokens
+	merged.ClaudeCacheCreation1hTokens += a.ClaudeCacheCreation1hTokens
+	if merged.InputTokensDetails != nil && a.InputTokensDetails != nil {
+		details := *merged.InputTokensDetails
+		details.CachedTokens += a.InputTokensDetails.CachedTokens
+		details.CachedCreationTokens += a.InputTokensDetails.CachedCreationTokens
+		merged.InputTokensDetails = &details
+	}
+	return &merged
+}
+
+// SetupStreamFailover 开启续写时包装 c.Writer，仅对单路输出的流式 Chat Completions 请求生效
+func SetupStreamFailover(c *gin.Context, info *relaycommon.RelayInfo) {
+	setting := operation_setting.GetStreamFailoverSetting()
+	if !setting.Enabled || setting.MaxFailovers <= 0 {
+		return
+	}
+	if info.RelayFormat != types.RelayFormatOpenAI || info.RelayMode != relayconstant.RelayModeChatCompletions || !info.IsStream {
+		return
+	}
+	if request, ok := info.Request.(*dto.GeneralOpenAIRequest); !ok || (request.N != nil && *request.N > 1) {
+		return
+	}
+	writer := newStreamFailoverWriter(c.Writer)
+	c.Writer = writer
+	common.SetContextKey(c, constant.ContextKeyStreamFailover, &streamFailoverState{writer: writer})
+}
+
+func getStreamFailover(c *gin.Context) *streamFailoverState {
+	state, ok := common.GetContextKeyType[*streamFailoverState](c, constant.ContextKeyStreamFailover)
+	if !ok {
+		return nil
+	}
+	return state
+}
+
+// isInterruptedStreamEnd 上游流在写出结束标记前断开
+func isInterruptedStreamEnd(status *relaycommon.StreamStatus) bool {
+	if status == nil {
+		return false
+	}
+	switch status.EndReason {
+	case relaycommon.StreamEndReasonTimeout, relaycommon.StreamEndReasonScannerErr, relaycommon.StreamEndReasonEOF,
+		relaycommon.StreamEndReasonPanic, relaycommon.StreamEndReasonPingFail:
+		return true
+	}
+	return false
+}
+
+// ShouldFailoverStream 判断本次流式输出是否在 finish_reason 之前中断且可以续写。
+// 已输出工具调用的响应无法拼接续写，客户端断开或对冲未胜出的尝试也不续写。
+func ShouldFailoverStream(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	state := getStreamFailover(c)
+	if state == nil || IsHedgeLoser(c) || c.Request.Context().Err() != nil {
+		return false
+	}
+	if !isInterruptedStreamEnd(info.StreamStatus) {
+		return false
+	}
+	state.mu.Lock()
+	failovers := len(state.log.Channels)
+	state.mu.Unlock()
+	if failovers >= operation_setting.GetStreamFailoverSetting().MaxFailovers {
+		return false
+	}
+	w := state.writer
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return !w.finished && !w.toolCalls
+}
+
+// HoldInterruptedStream 记录中断的尝试与用量，暂存其结尾，返回中断错误以便换渠道续写
+func HoldInterruptedStream(c *gin.Context, info *relaycommon.RelayInfo, usage *dto.Usage) *types.NewAPIError {
+	state := getStreamFailover(c)
+	held, err := info.Clone()
+	if err != nil {
+		held = info
+	}
+	// 中断的尝试与续写属于同一次请求，无法续写时仍通过请求的计费会话结算
+	held.Billing = info.Billing
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.pending = true
+	state.writer.mu.Lock()
+	state.writer.emitted = false
+	state.writer.mu.Unlock()
+	state.info = held
+	if state.usage == nil {
+		state.usage = usage
+	} else {
+		state.usage = mergeStreamUsage(state.usage, usage)
+	}
+	state.trailer = state.writer.takeHeld()
+	state.log.Channels = append(state.log.Channels, info.ChannelId)
+	state.log.Reasons = append(state.log.Reasons, string(info.StreamStatus.EndReason))
+	logger.LogWarn(c, fmt.Sprintf("渠道 #%d 的流式输出在结束前中断（%s），准备换渠道续写", info.ChannelId, info.StreamStatus.Summary()))
+	return types.NewOpenAIError(fmt.Errorf("stream interrupted before finish: %s", info.StreamStatus.Summary()), types.ErrorCodeStreamInterrupted, http.StatusBadGateway)
+}
+
+// IsStreamFailoverPending 是否有中断的流式输出等待续写。续写在写出数据之前失败时仍然等待续写
+func IsStreamFailoverPending(c *gin.Context) bool {
+	state := getStreamFailover(c)
+	if state == nil {
+		return false
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if !state.pending {
+		return false
+	}
+	state.writer.mu.Lock()
+	defer state.writer.mu.Unlock()
+	return !state.writer.emitted
+}
+
+// GetStreamFailoverChannels 返回流式输出中断过的渠道，续写时不再选择
+func GetStreamFailoverChannels(c *gin.Context) []int {
+	state := getStreamFailover(c)
+	if state == nil {
+		return nil
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return append([]int(nil), state.log.Channels...)
+}
+
+// ApplyStreamFailoverPrefill 等待续写时，将已写出的文本作为 assistant 预填消息追加到请求末尾，
+// 返回当前是否为续写请求。续写请求不能透传原始请求体。
+func ApplyStreamFailoverPrefill(c *gin.Context, request *dto.GeneralOpenAIRequest) bool {
+	state := getStreamFailover(c)
+	if state == nil {
+		return false
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	w := state.writer
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if state.pending && !w.emitted {
+		// 续写写出数据之前可能失败并换渠道重试，每次都按当前的中断记录设置
+		w.continuing = true
+		w.prevUsage = state.usage
+		state.log.PrefixLength = len([]rune(w.text.String()))
+	}
+	if !w.continuing {
+		return false
+	}
+	if prefix := w.text.String(); prefix != "" {
+		request.Messages = append(request.Messages, dto.Message{
+			Role:    "assistant",
+			Content: prefix,
+		})
+	}
+	return true
+}
+
+// FinishStreamFailover 本次流式输出正常结束：写出暂存的结尾，续写完成时返回合并后的用量
+func FinishStreamFailover(c *gin.Context, usage *dto.Usage) *dto.Usage {
+	state := getStreamFailover(c)
+	if state == nil {
+		return usage
+	}
+	state.writer.releaseHeld()
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.usage == nil {
+		return usage
+	}
+	if usage != nil {
+		usage = mergeStreamUsage(state.usage, usage)
+	} else {
+		usage = state.usage
+	}
+	state.pending = false
+	state.usage = nil
+	state.trailer = nil
+	state.log.Completed = true
+	return usage
+}
+
+// SettleInterruptedStream 无法续写时写出中断尝试的结尾，并按已写出的内容结算。没有中断记录时返回 false。
+func SettleInterruptedStream(c *gin.Context) bool {
+	state := getStreamFailover(c)
+	if state == nil {
+		return false
+	}
+	state.mu.Lock()
+	info, usage, trailer := state.info, state.usage, state.trailer
+	state.pending = false
+	state.usage = nil
+	state.trailer = nil
+	state.mu.Unlock()
+	if usage == nil {
+		return false
+	}
+	// 续写失败时可能还暂存着续写尝试的结尾，丢弃后以中断尝试的结尾收尾
+	state.writer.takeHeld()
+	state.writer.mu.Lock()
+	state.writer.held = trailer
+	state.writer.mu.Unlock()
+	state.writer.releaseHeld()
+	PostTextConsumeQuota(c, info, usage, nil)
+	return true
+}
+
+// GetStreamFailoverInfo 返回续写记录，未发生中断时返回 nil
+func GetStreamFailoverInfo(c *gin.Context) *StreamFailoverInfo {
+	state := getStreamFailover(c)
+	if state == nil {
+		return nil
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if len(state.log.Channels) == 0 {
+		return nil
+	}
+	info := state.log
+	return &info
+}
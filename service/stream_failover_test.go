@@ -0,0 +1,127 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func newStreamFailoverTestContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	writer := newStreamFailoverWriter(c.Writer)
+	c.Writer = writer
+	common.SetContextKey(c, constant.ContextKeyStreamFailover, &streamFailoverState{writer: writer})
+	return c, recorder
+}
+
+func writeStreamEvent(t *testing.T, c *gin.Context, data string) {
+	t.Helper()
+	_, err := c.Writer.WriteString("data: " + data)
+	require.NoError(t, err)
+	_, err = c.Writer.WriteString("\n\n")
+	require.NoError(t, err)
+}
+
+func TestStreamFailover_SplicesContinuation(t *testing.T) {
+	c, recorder := newStreamFailoverTestContext(t)
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 1}}
+	info.StreamStatus = relaycommon.NewStreamStatus()
+	info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonTimeout, nil)
+
+	writeStreamEvent(t, c, `{"id":"chatcmpl-a","created":100,"choices":[{"index":0,"delta":{"content":"Hello, "}}]}`)
+	writeStreamEvent(t, c, `{"id":"chatcmpl-a","created":100,"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`)
+	writeStreamEvent(t, c, "[DONE]")
+
+	require.True(t, ShouldFailoverStream(c, info))
+	apiErr := HoldInterruptedStream(c, info, &dto.Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12})
+	require.NotNil(t, apiErr)
+	require.True(t, IsStreamFailoverPending(c))
+	require.Equal(t, []int{1}, GetStreamFailoverChannels(c))
+
+	request := &dto.GeneralOpenAIRequest{Messages: []dto.Message{{Role: "user", Content: "hi"}}}
+	require.True(t, ApplyStreamFailoverPrefill(c, request))
+	require.Len(t, request.Messages, 2)
+	require.Equal(t, "assistant", request.Messages[1].Role)
+	require.Equal(t, "Hello, ", request.Messages[1].StringContent())
+
+	writeStreamEvent(t, c, `{"id":"chatcmpl-b","created":200,"choices":[{"index":0,"delta":{"content":"world"},"finish_reason":"stop"}]}`)
+	writeStreamEvent(t, c, `{"id":"chatcmpl-b","created":200,"choices":[],"usage":{"prompt_tokens":15,"completion_tokens":1,"total_tokens":16}}`)
+	writeStreamEvent(t, c, "[DONE]")
+
+	usage := FinishStreamFailover(c, &dto.Usage{PromptTokens: 15, CompletionTokens: 1, TotalTokens: 16})
+	require.Equal(t, 25, usage.PromptTokens)
+	require.Equal(t, 3, usage.CompletionTokens)
+	require.Equal(t, 28, usage.TotalTokens)
+
+	body := recorder.Body.String()
+	require.Equal(t, 1, strings.Count(body, "[DONE]"))
+	require.NotContains(t, body, "chatcmpl-b")
+	require.Contains(t, body, `"total_tokens":28`)
+	require.NotContains(t, body, `"total_tokens":12`)
+	require.True(t, strings.HasSuffix(body, "data: [DONE]\n\n"))
+
+	failover := GetStreamFailoverInfo(c)
+	require.NotNil(t, failover)
+	require.True(t, failover.Completed)
+	require.Equal(t, 7, failover.PrefixLength)
+	require.Equal(t, []string{string(relaycommon.StreamEndReasonTimeout)}, failover.Reasons)
+}
+
+func TestStreamFailover_SkipsFinishedOrToolCallStreams(t *testing.T) {
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 1}}
+	info.StreamStatus = relaycommon.NewStreamStatus()
+	info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonScannerErr, nil)
+
+	c, _ := newStreamFailoverTestContext(t)
+	writeStreamEvent(t, c, `{"id":"a","choices":[{"index":0,"delta":{"content":"done"},"finish_reason":"stop"}]}`)
+	require.False(t, ShouldFailoverStream(c, info))
+
+	c, _ = newStreamFailoverTestContext(t)
+	writeStreamEvent(t, c, `{"id":"a","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"name":"f"}}]}}]}`)
+	require.False(t, ShouldFailoverStream(c, info))
+
+	c, _ = newStreamFailoverTestContext(t)
+	writeStreamEvent(t, c, `{"id":"a","choices":[{"index":0,"delta":{"content":"partial"}}]}`)
+	require.True(t, ShouldFailoverStream(c, info))
+
+	normal := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 1}}
+	normal.StreamStatus = relaycommon.NewStreamStatus()
+	normal.StreamStatus.SetEndReason(relaycommon.StreamEndReasonDone, nil)
+	require.False(t, ShouldFailoverStream(c, normal))
+}
+
+func TestStreamFailover_StaysPendingUntilContinuationWrites(t *testing.T) {
+	c, _ := newStreamFailoverTestContext(t)
+	info := &relaycommon.RelayInfo{ChannelMeta: &relaycommon.ChannelMeta{ChannelId: 1}}
+	info.StreamStatus = relaycommon.NewStreamStatus()
+	info.StreamStatus.SetEndReason(relaycommon.StreamEndReasonEOF, nil)
+
+	writeStreamEvent(t, c, `{"id":"chatcmpl-a","created":100,"choices":[{"index":0,"delta":{"content":"Hello"}}]}`)
+	require.True(t, ShouldFailoverStream(c, info))
+	require.NotNil(t, HoldInterruptedStream(c, info, &dto.Usage{CompletionTokens: 1}))
+
+	// the first alternate fails before writing anything, the next one gets the same prefill
+	for i := 0; i < 2; i++ {
+		request := &dto.GeneralOpenAIRequest{Messages: []dto.Message{{Role: "user", Content: "hi"}}}
+		require.True(t, ApplyStreamFailoverPrefill(c, request))
+		require.Len(t, request.Messages, 2)
+		require.Equal(t, "Hello", request.Messages[1].StringContent())
+		require.True(t, IsStreamFailoverPending(c))
+	}
+
+	writeStreamEvent(t, c, `{"id":"chatcmpl-b","created":200,"choices":[{"index":0,"delta":{"content":" world"}}]}`)
+	require.False(t, IsStreamFailoverPending(c))
+}
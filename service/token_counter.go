@@ -379,7 +379,7 @@ func CountAudioTokenInput(audioBase64 string, audioFormat string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return int(duration / 60 * 100 / 0.06), nil
+	return audioInputTokens(duration), nil
 }
 
 func CountAudioTokenOutput(audioBase64 string, audioFormat string) (int, error) {
@@ -390,7 +390,15 @@ func CountAudioTokenOutput(audioBase64 string, audioFormat string) (int, error)
 	if err != nil {
 		return 0, err
 	}
-	return int(duration / 60 * 200 / 0.24), nil
+	return audioOutputTokens(duration), nil
+}
+
+func audioInputTokens(duration float64) int {
+	return int(duration / 60 * 100 / 0.06)
+}
+
+func audioOutputTokens(duration float64) int {
+	return int(duration / 60 * 200 / 0.24)
 }
 
 // CountTextToken 统计文本的token数量，仅OpenAI模型使用tokenizer，其余模型使用估算
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/pkg/cachex"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/samber/hot"
+)
+
+const upstreamRateLimitCacheNamespace = "new-api:upstream_rate_limit:v1"
+
+var (
+	upstreamRateLimitCacheOnce sync.Once
+	upstreamRateLimitCache     *cachex.HybridCache[UpstreamRateLimitState]
+)
+
+// UpstreamRateLimitState 上游返回的某个渠道 key 的限流状态，时间均为 unix 毫秒
+type UpstreamRateLimitState struct {
+	RemainingRequests *int64 `json:"remaining_requests,omitempty"`
+	RemainingTokens   *int64 `json:"remaining_tokens,omitempty"`
+	RequestsResetAt   int64  `json:"requests_reset_at,omitempty"`
+	TokensResetAt     int64  `json:"tokens_reset_at,omitempty"`
+	RetryAfterUntil   int64  `json:"retry_after_until,omitempty"`
+	UpdatedAt         int64  `json:"updated_at"`
+}
+
+// UpstreamRateLimitSnapshot 限流状态快照
+type UpstreamRateLimitSnapshot struct {
+	KeyIndex       int                     `json:"key_index"`
+	Exhausted      bool                    `json:"exhausted"`
+	AvailableAt    int64                   `json:"available_at,omitempty"`
+	State          *UpstreamRateLimitState `json:"state,omitempty"`
+	TrackedHeaders bool                    `json:"tracked_headers"`
+}
+
+func getUpstreamRateLimitCache() *cachex.HybridCache[UpstreamRateLimitState] {
+	upstreamRateLimitCacheOnce.Do(func() {
+		upstreamRateLimitCache = cachex.NewHybridCache[UpstreamRateLimitState](cachex.HybridCacheConfig[UpstreamRateLimitState]{
+			Namespace: cachex.Namespace(upstreamRateLimitCacheNamespace),
+			Redis:     common.RDB,
+			RedisEnabled: func() bool {
+				return common.RedisEnabled && common.RDB != nil
+			},
+			RedisCodec: cachex.JSONCodec[UpstreamRateLimitState]{},
+			Memory: func() *hot.HotCache[string, UpstreamRateLimitState] {
+				return hot.NewHotCache[string, UpstreamRateLimitState](hot.LRU, 100_000).
+					WithTTL(time.Hour).
+					WithJanitor().
+					Build()
+			},
+		})
+	})
+	return upstreamRateLimitCache
+}
+
+func upstreamRateLimitKey(channelId int, keyIndex int) string {
+	return strconv.Itoa(channelId) + ":" + strconv.Itoa(keyIndex)
+}
+
+// parseRateLimitReset 解析重置时间：
+//   - OpenAI: "1s"、"6m0s"、"20ms" 等 Go duration 格式
+//   - Anthropic: RFC 3339 时间
+//   - 纯数字按秒处理
+func parseRateLimitReset(value string, now time.Time) (int64, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d).UnixMilli(), true
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UnixMilli(), true
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return now.Add(time.Duration(seconds * float64(time.Second))).UnixMilli(), true
+	}
+	return 0, false
+}
+
+// parseRetryAfter 解析 retry-after-ms 以及 retry-after（秒数或 HTTP 日期）
+func parseRetryAfter(header http.Header, now time.Time) (int64, bool) {
+	if ms := strings.TrimSpace(header.Get("retry-after-ms")); ms != "" {
+		if v, err := strconv.ParseFloat(ms, 64); err == nil && v >= 0 {
+			return now.Add(time.Duration(v * float64(time.Millisecond))).UnixMilli(), true
+		}
+	}
+	value := strings.TrimSpace(header.Get("retry-after"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return now.Add(time.Duration(seconds * float64(time.Second))).UnixMilli(), true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t.UnixMilli(), true
+	}
+	return 0, false
+}
+
+// rateLimitBucket 一个限流维度的剩余量与重置时间响应头
+type rateLimitBucket struct {
+	remaining string
+	reset     string
+}
+
+// parseRateLimitBuckets 返回各维度中最小的剩余量，以及已耗尽（剩余量不超过 minRemaining）维度的最晚重置时间。
+// 没有耗尽的维度时取剩余量最小的维度的重置时间，未耗尽维度的重置时间不会延长冷却
+func parseRateLimitBuckets(header http.Header, now time.Time, minRemaining int64, buckets ...rateLimitBucket) (*int64, int64) {
+	var remaining *int64
+	exhaustedResetAt := int64(0)
+	lowestResetAt := int64(0)
+	for _, bucket := range buckets {
+		value := strings.TrimSpace(header.Get(bucket.remaining))
+		if value == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		resetAt, _ := parseRateLimitReset(header.Get(bucket.reset), now)
+		if remaining == nil || v < *remaining {
+			remaining = common.GetPointer(v)
+			lowestResetAt = resetAt
+		} else if v == *remaining {
+			lowestResetAt = max(lowestResetAt, resetAt)
+		}
+		if v <= minRemaining {
+			exhaustedResetAt = max(exhaustedResetAt, resetAt)
+		}
+	}
+	if exhaustedResetAt > 0 {
+		return remaining, exhaustedResetAt
+	}
+	return remaining, lowestResetAt
+}
+
+// ParseUpstreamRateLimitHeaders 从上游响应头中解析限流状态，未携带任何限流头时返回 false
+func ParseUpstreamRateLimitHeaders(header http.Header, statusCode int, now time.Time) (UpstreamRateLimitState, bool) {
+	state := UpstreamRateLimitState{UpdatedAt: now.UnixMilli()}
+	setting := operation_setting.GetUpstreamRateLimitSetting()
+	state.RemainingRequests, state.RequestsResetAt = parseRateLimitBuckets(header, now, setting.MinRemainingRequests,
+		rateLimitBucket{remaining: "x-ratelimit-remaining-requests", reset: "x-ratelimit-reset-requests"},
+		rateLimitBucket{remaining: "anthropic-ratelimit-requests-remaining", reset: "anthropic-ratelimit-requests-reset"},
+	)
+	state.RemainingTokens, state.TokensResetAt = parseRateLimitBuckets(header, now, setting.MinRemainingTokens,
+		rateLimitBucket{remaining: "x-ratelimit-remaining-tokens", reset: "x-ratelimit-reset-tokens"},
+		rateLimitBucket{remaining: "anthropic-ratelimit-tokens-remaining", reset: "anthropic-ratelimit-tokens-reset"},
+		rateLimitBucket{remaining: "anthropic-ratelimit-input-tokens-remaining", reset: "anthropic-ratelimit-input-tokens-reset"},
+		rateLimitBucket{remaining: "anthropic-ratelimit-output-tokens-remaining", reset: "anthropic-ratelimit-output-tokens-reset"},
+	)
+	// retry-after 只在限流或服务不可用时才表示需要等待
+	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+		if until, ok := parseRetryAfter(header, now); ok {
+			state.RetryAfterUntil = until
+		}
+	}
+	tracked := state.RemainingRequests != nil || state.RemainingTokens != nil || state.RetryAfterUntil > 0
+	return state, tracked
+}
+
+// availableAt 返回 key 恢复可用的时间（unix 毫秒），0 表示当前可用
+func (s UpstreamRateLimitState) availableAt(nowMs int64, setting *operation_setting.UpstreamRateLimitSetting) int64 {
+	defaultReset := s.UpdatedAt + int64(setting.DefaultResetSeconds)*1000
+	maxReset := s.UpdatedAt + int64(setting.MaxResetSeconds)*1000
+	clamp := func(resetAt int64) int64 {
+		if resetAt <= 0 {
+			resetAt = defaultReset
+		}
+		if setting.MaxResetSeconds > 0 && resetAt > maxReset {
+			resetAt = maxReset
+		}
+		return resetAt
+	}
+
+	availableAt := int64(0)
+	if s.RetryAfterUntil > 0 {
+		availableAt = clamp(s.RetryAfterUntil)
+	}
+	if s.RemainingRequests != nil && *s.RemainingRequests <= setting.MinRemainingRequests {
+		availableAt = max(availableAt, clamp(s.RequestsResetAt))
+	}
+	if s.RemainingTokens != nil && *s.RemainingTokens <= setting.MinRemainingTokens {
+		availableAt = max(availableAt, clamp(s.TokensResetAt))
+	}
+	if availableAt <= nowMs {
+		return 0
+	}
+	return availableAt
+}
+
+// ObserveUpstreamRateLimitHeaders 记录上游响应携带的限流信息
+func ObserveUpstreamRateLimitHeaders(channelId int, keyIndex int, resp *http.Response) {
+	if channelId <= 0 || resp == nil {
+		return
+	}
+	setting := operation_setting.GetUpstreamRateLimitSetting()
+	if !setting.Enabled {
+		return
+	}
+	now := time.Now()
+	state, tracked := ParseUpstreamRateLimitHeaders(resp.Header, resp.StatusCode, now)
+	if !tracked {
+		return
+	}
+	ttl := time.Minute
+	resetAt := max(state.RequestsResetAt, state.TokensResetAt, state.RetryAfterUntil)
+	if d := time.Duration(resetAt-now.UnixMilli()) * time.Millisecond; d > ttl {
+		ttl = min(d, time.Duration(math.Max(float64(setting.MaxResetSeconds), 60))*time.Second)
+	}
+	key := upstreamRateLimitKey(channelId, keyIndex)
+	if err := getUpstreamRateLimitCache().SetWithTTL(key, state, ttl); err != nil {
+		common.SysError(fmt.Sprintf("upstream rate limit cache set failed: key=%s, err=%v", key, err))
+	}
+}
+
+// IsUpstreamRateLimited 判断渠道 key 是否已知上游额度耗尽且未到重置时间
+func IsUpstreamRateLimited(channelId int, keyIndex int) bool {
+	setting := operation_setting.GetUpstreamRateLimitSetting()
+	if !setting.Enabled {
+		return false
+	}
+	state, found, err := getUpstreamRateLimitCache().Get(upstreamRateLimitKey(channelId, keyIndex))
+	if err != nil || !found {
+		return false
+	}
+	return state.availableAt(time.Now().UnixMilli(), setting) > 0
+}
+
+// upstreamRateLimitedKeys 一次批量读取多 Key 渠道所有 key 的上游限流状态，返回额度耗尽的 key
+func upstreamRateLimitedKeys(channelId int, keyCount int) map[int]bool {
+	setting := operation_setting.GetUpstreamRateLimitSetting()
+	keys := make([]string, keyCount)
+	for i := range keys {
+		keys[i] = upstreamRateLimitKey(channelId, i)
+	}
+	states, err := getUpstreamRateLimitCache().GetMany(keys)
+	if err != nil {
+		common.SysError(fmt.Sprintf("upstream rate limit cache get failed: channel #%d, err=%v", channelId, err))
+	}
+	nowMs := time.Now().UnixMilli()
+	limited := make(map[int]bool)
+	for i, key := range keys {
+		if state, ok := states[key]; ok && state.availableAt(nowMs, setting) > 0 {
+			limited[i] = true
+		}
+	}
+	return limited
+}
+
+// GetUpstreamRateLimitSnapshot 返回渠道 key 的上游限流状态
+func GetUpstreamRateLimitSnapshot(channelId int, keyIndex int) UpstreamRateLimitSnapshot {
+	snapshot := UpstreamRateLimitSnapshot{KeyIndex: keyIndex}
+	state, found, err := getUpstreamRateLimitCache().Get(upstreamRateLimitKey(channelId, keyIndex))
+	if err != nil || !found {
+		return snapshot
+	}
+	snapshot.TrackedHeaders = true
+	snapshot.State = &state
+	snapshot.AvailableAt = state.availableAt(time.Now().UnixMilli(), operation_setting.GetUpstreamRateLimitSetting())
+	snapshot.Exhausted = snapshot.AvailableAt > 0
+	return snapshot
+}
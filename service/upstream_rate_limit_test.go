@@ -0,0 +1,99 @@
+package service
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseUpstreamRateLimitHeaders_OpenAI(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	header := http.Header{}
+	header.Set("x-ratelimit-remaining-requests", "0")
+	header.Set("x-ratelimit-remaining-tokens", "1500")
+	header.Set("x-ratelimit-reset-requests", "6m0s")
+	header.Set("x-ratelimit-reset-tokens", "20ms")
+
+	state, tracked := ParseUpstreamRateLimitHeaders(header, http.StatusOK, now)
+	require.True(t, tracked)
+	require.EqualValues(t, 0, *state.RemainingRequests)
+	require.EqualValues(t, 1500, *state.RemainingTokens)
+	require.Equal(t, now.Add(6*time.Minute).UnixMilli(), state.RequestsResetAt)
+	require.Equal(t, now.Add(20*time.Millisecond).UnixMilli(), state.TokensResetAt)
+	require.Zero(t, state.RetryAfterUntil)
+
+	setting := &operation_setting.UpstreamRateLimitSetting{Enabled: true, DefaultResetSeconds: 10, MaxResetSeconds: 300}
+	// requests exhausted, reset capped by MaxResetSeconds
+	require.Equal(t, now.Add(300*time.Second).UnixMilli(), state.availableAt(now.UnixMilli(), setting))
+	require.Zero(t, state.availableAt(now.Add(301*time.Second).UnixMilli(), setting))
+}
+
+func TestParseUpstreamRateLimitHeaders_Anthropic(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set("anthropic-ratelimit-requests-remaining", "10")
+	header.Set("anthropic-ratelimit-requests-reset", now.Add(30*time.Second).Format(time.RFC3339))
+	header.Set("anthropic-ratelimit-input-tokens-remaining", "0")
+	header.Set("anthropic-ratelimit-input-tokens-reset", now.Add(45*time.Second).Format(time.RFC3339))
+	header.Set("anthropic-ratelimit-output-tokens-remaining", "2000")
+
+	state, tracked := ParseUpstreamRateLimitHeaders(header, http.StatusOK, now)
+	require.True(t, tracked)
+	require.EqualValues(t, 10, *state.RemainingRequests)
+	require.EqualValues(t, 0, *state.RemainingTokens)
+
+	setting := &operation_setting.UpstreamRateLimitSetting{Enabled: true, DefaultResetSeconds: 10, MaxResetSeconds: 300}
+	require.Equal(t, now.Add(45*time.Second).UnixMilli(), state.availableAt(now.UnixMilli(), setting))
+}
+
+func TestParseUpstreamRateLimitHeaders_OnlyExhaustedBucketReset(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set("anthropic-ratelimit-input-tokens-remaining", "0")
+	header.Set("anthropic-ratelimit-input-tokens-reset", now.Add(20*time.Second).Format(time.RFC3339))
+	header.Set("anthropic-ratelimit-output-tokens-remaining", "2000")
+	header.Set("anthropic-ratelimit-output-tokens-reset", now.Add(4*time.Minute).Format(time.RFC3339))
+	header.Set("anthropic-ratelimit-tokens-remaining", "2000")
+	header.Set("anthropic-ratelimit-tokens-reset", now.Add(3*time.Minute).Format(time.RFC3339))
+
+	state, tracked := ParseUpstreamRateLimitHeaders(header, http.StatusOK, now)
+	require.True(t, tracked)
+	require.EqualValues(t, 0, *state.RemainingTokens)
+	// output/total buckets are not exhausted, their later reset must not extend the cooldown
+	require.Equal(t, now.Add(20*time.Second).UnixMilli(), state.TokensResetAt)
+
+	setting := &operation_setting.UpstreamRateLimitSetting{Enabled: true, DefaultResetSeconds: 10, MaxResetSeconds: 300}
+	require.Equal(t, now.Add(20*time.Second).UnixMilli(), state.availableAt(now.UnixMilli(), setting))
+}
+
+func TestParseUpstreamRateLimitHeaders_RetryAfter(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	header := http.Header{}
+	header.Set("retry-after", "7")
+
+	// retry-after on a successful response is ignored
+	_, tracked := ParseUpstreamRateLimitHeaders(header, http.StatusOK, now)
+	require.False(t, tracked)
+
+	state, tracked := ParseUpstreamRateLimitHeaders(header, http.StatusTooManyRequests, now)
+	require.True(t, tracked)
+	require.Equal(t, now.Add(7*time.Second).UnixMilli(), state.RetryAfterUntil)
+
+	header.Set("retry-after-ms", "1500")
+	state, _ = ParseUpstreamRateLimitHeaders(header, http.StatusTooManyRequests, now)
+	require.Equal(t, now.Add(1500*time.Millisecond).UnixMilli(), state.RetryAfterUntil)
+}
+
+func TestUpstreamRateLimitState_DefaultReset(t *testing.T) {
+	now := int64(1_700_000_000_000)
+	state := UpstreamRateLimitState{RemainingTokens: new(int64), UpdatedAt: now}
+	setting := &operation_setting.UpstreamRateLimitSetting{Enabled: true, DefaultResetSeconds: 10, MaxResetSeconds: 300}
+	require.Equal(t, now+10_000, state.availableAt(now, setting))
+
+	remaining := int64(100)
+	state.RemainingTokens = &remaining
+	require.Zero(t, state.availableAt(now, setting))
+}
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/limiter"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// usageLimitLeaseTTL 并发名额的最长占用时间，防止进程异常退出后名额无法释放
+	usageLimitLeaseTTL = 30 * time.Minute
+	usageLimitWindow   = time.Minute
+
+	usageLimitScopeToken = "token"
+	usageLimitScopeUser  = "user"
+)
+
+type usageLimitScope struct {
+	name        string
+	id          int
+	tpm         int
+	concurrency int
+}
+
+func (s usageLimitScope) tpmKey() string {
+	return fmt.Sprintf("usageLimit:tpm:%s:%d", s.name, s.id)
+}
+
+func (s usageLimitScope) concurrencyKey() string {
+	return fmt.Sprintf("usageLimit:concurrency:%s:%d", s.name, s.id)
+}
+
+// UsageLimitLease 单次请求占用的 TPM 与并发额度。
+// TPM 先按预估 token 数扣减，结算时按实际用量补扣或退还；请求结束时释放并发名额。
+type UsageLimitLease struct {
+	leaseId  string
+	scopes   []usageLimitScope
+	acquired []usageLimitScope // 已占用并发名额的范围
+	charged  int64             // 当前已计入 TPM 令牌桶的 token 数
+	settled  bool
+	released bool
+	mu       sync.Mutex
+}
+
+func getUsageLimiter() limiter.UsageLimiter {
+	if common.RedisEnabled && common.RDB != nil {
+		return limiter.NewRedisUsageLimiter(common.RDB)
+	}
+	return limiter.NewMemoryUsageLimiter()
+}
+
+// collectUsageLimitScopes 汇总当前请求生效的限制：
+//   - 令牌：使用令牌上配置的值
+//   - 用户：使用用户上配置的值，未配置（为 0）时使用分组配置
+func collectUsageLimitScopes(c *gin.Context) []usageLimitScope {
+	scopes := make([]usageLimitScope, 0, 2)
+
+	tokenScope := usageLimitScope{
+		name:        usageLimitScopeToken,
+		id:          common.GetContextKeyInt(c, constant.ContextKeyTokenId),
+		tpm:         common.GetContextKeyInt(c, constant.ContextKeyTokenTpmLimit),
+		concurrency: common.GetContextKeyInt(c, constant.ContextKeyTokenConcurrencyLimit),
+	}
+	if tokenScope.id > 0 && (tokenScope.tpm > 0 || tokenScope.concurrency > 0) {
+		scopes = append(scopes, tokenScope)
+	}
+
+	userScope := usageLimitScope{
+		name:        usageLimitScopeUser,
+		id:          c.GetInt("id"),
+		tpm:         common.GetContextKeyInt(c, constant.ContextKeyUserTpmLimit),
+		concurrency: common.GetContextKeyInt(c, constant.ContextKeyUserConcurrencyLimit),
+	}
+	group := common.GetContextKeyString(c, constant.ContextKeyTokenGroup)
+	if group == "" {
+		group = common.GetContextKeyString(c, constant.ContextKeyUserGroup)
+	}
+	if groupLimit, found := setting.GetGroupUsageLimit(group); found {
+		if userScope.tpm <= 0 {
+			userScope.tpm = groupLimit.TPM
+		}
+		if userScope.concurrency <= 0 {
+			userScope.concurrency = groupLimit.Concurrency
+		}
+	}
+	if userScope.id > 0 && (userScope.tpm > 0 || userScope.concurrency > 0) {
+		scopes = append(scopes, userScope)
+	}
+	return scopes
+}
+
+func usageLimitScopeLabel(name string) string {
+	if name == usageLimitScopeToken {
+		return "令牌"
+	}
+	return "用户"
+}
+
+// usageLimitError 构造 OpenAI 风格的 429 错误，并设置 retry-after 响应头
+func usageLimitError(c *gin.Context, errorType string, message string, retryAfter time.Duration) *types.NewAPIError {
+	seconds := max(int(math.Ceil(retryAfter.Seconds())), 1)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	return types.WithOpenAIError(types.OpenAIError{
+		Message: message,
+		Type:    errorType,
+		Code:    string(types.ErrorCodeRateLimitExceeded),
+	}, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// AcquireUsageLimit 检查并占用当前请求的并发名额和预估 TPM 额度。
+// 未配置任何限制时返回 nil；限流存储异常时放行请求，仅记录日志；预估 token 数超过 TPM 上限的请求直接拒绝，不可重试。
+// 返回的租约需要在请求结束时调用 Release。
+// 限制作用于同步转发（controller.Relay 及 Realtime 桥接的各阶段）；异步任务提交（视频、音乐、Midjourney）
+// 与 Batch API 按任务计费，不计入 TPM 与并发限制。
+func AcquireUsageLimit(c *gin.Context, estimatedTokens int) (*UsageLimitLease, *types.NewAPIError) {
+	scopes := collectUsageLimitScopes(c)
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+	leaseId := c.GetString(common.RequestIdKey)
+	if leaseId == "" {
+		leaseId = common.GetUUID()
+	}
+	lease := &UsageLimitLease{leaseId: leaseId, scopes: scopes}
+	usageLimiter := getUsageLimiter()
+	ctx := context.Background()
+
+	for _, scope := range scopes {
+		if scope.concurrency <= 0 {
+			continue
+		}
+		allowed, err := usageLimiter.AcquireConcurrency(ctx, scope.concurrencyKey(), leaseId, int64(scope.concurrency), usageLimitLeaseTTL)
+		if err != nil {
+			logger.LogError(c, "usage limit concurrency check failed: "+err.Error())
+			continue
+		}
+		if !allowed {
+			lease.Release()
+			return nil, usageLimitError(c, "requests",
+				fmt.Sprintf("%s并发请求数已达上限：最多同时进行 %d 个请求，请稍后重试", usageLimitScopeLabel(scope.name), scope.concurrency),
+				time.Second)
+		}
+		lease.acquired = append(lease.acquired, scope)
+	}
+
+	// 预估为 0 时至少扣减 1，确保令牌桶处于欠账状态时请求会被拒绝
+	requested := int64(max(estimatedTokens, 1))
+	for _, scope := range scopes {
+		if scope.tpm > 0 && requested > int64(scope.tpm) {
+			lease.Release()
+			return nil, types.WithOpenAIError(types.OpenAIError{
+				Message: fmt.Sprintf("%s每分钟 token 数限制 (TPM) 为 %d，本次请求预估 %d 个 token，超过单次可用上限，请减少输入或 max_tokens", usageLimitScopeLabel(scope.name), scope.tpm, requested),
+				Type:    "tokens",
+				Code:    string(types.ErrorCodeRateLimitExceeded),
+			}, http.StatusRequestEntityTooLarge, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+	}
+	taken := make([]usageLimitScope, 0, len(scopes))
+	for _, scope := range scopes {
+		if scope.tpm <= 0 {
+			continue
+		}
+		allowed, retryAfter, err := usageLimiter.TakeTokens(ctx, scope.tpmKey(), requested, int64(scope.tpm), usageLimitWindow, false)
+		if err != nil {
+			logger.LogError(c, "usage limit tpm check failed: "+err.Error())
+			continue
+		}
+		if !allowed {
+			for _, s := range taken {
+				_, _, _ = usageLimiter.TakeTokens(ctx, s.tpmKey(), -requested, int64(s.tpm), usageLimitWindow, true)
+			}
+			lease.Release()
+			return nil, usageLimitError(c, "tokens",
+				fmt.Sprintf("%s已达到每分钟 token 数限制 (TPM)：限制 %d，本次预估 %d，请在 %.1f 秒后重试", usageLimitScopeLabel(scope.name), scope.tpm, requested, retryAfter.Seconds()),
+				retryAfter)
+		}
+		taken = append(taken, scope)
+	}
+	lease.scopes = taken
+	lease.charged = requested
+
+	common.SetContextKey(c, constant.ContextKeyUsageLimitLease, lease)
+	return lease, nil
+}
+
+// adjustLocked 将已计入 TPM 的 token 数调整为 target，target 小于已计入时退还差额
+func (l *UsageLimitLease) adjustLocked(target int64) {
+	delta := target - l.charged
+	if delta == 0 || len(l.scopes) == 0 {
+		l.charged = target
+		return
+	}
+	usageLimiter := getUsageLimiter()
+	for _, scope := range l.scopes {
+		if _, _, err := usageLimiter.TakeTokens(context.Background(), scope.tpmKey(), delta, int64(scope.tpm), usageLimitWindow, true); err != nil {
+			common.SysLog(fmt.Sprintf("usage limit tpm settle failed: key=%s, delta=%d, err=%v", scope.tpmKey(), delta, err))
+		}
+	}
+	l.charged = target
+}
+
+// Settle 按实际使用的 token 数结算 TPM，多扣的退还、少扣的补扣，幂等
+func (l *UsageLimitLease) Settle(totalTokens int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.settled {
+		return
+	}
+	l.settled = true
+	l.adjustLocked(int64(max(totalTokens, 0)))
+}
+
+// Release 释放并发名额；若请求未结算（失败），退还预扣的 TPM 额度
+func (l *UsageLimitLease) Release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return
+	}
+	l.released = true
+	if !l.settled {
+		l.adjustLocked(0)
+	}
+	usageLimiter := getUsageLimiter()
+	for _, scope := range l.acquired {
+		if err := usageLimiter.ReleaseConcurrency(context.Background(), scope.concurrencyKey(), l.leaseId); err != nil {
+			common.SysLog(fmt.Sprintf("usage limit concurrency release failed: key=%s, err=%v", scope.concurrencyKey(), err))
+		}
+	}
+}
+
+// SettleUsageLimit 使用实际用量结算当前请求的 TPM 租约，未启用限制时不做任何操作
+func SettleUsageLimit(c *gin.Context, totalTokens int) {
+	lease, ok := common.GetContextKeyType[*UsageLimitLease](c, constant.ContextKeyUsageLimitLease)
+	if !ok {
+		return
+	}
+	lease.Settle(totalTokens)
+}
@@ -0,0 +1,33 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// BatchSetting OpenAI Files / Batches API 设置
+// 文件与批处理任务透传到上传时所在的 OpenAI 渠道（文件 ID、批处理 ID 固定绑定渠道），
+// 批处理状态通过异步任务轮询同步，完成后按输出文件中的实际用量乘以 BillingRatio 计费。
+type BatchSetting struct {
+	Enabled bool `json:"enabled"`
+	// 批处理计费倍率，OpenAI 官方批处理价格为实时价格的 50%
+	BillingRatio float64 `json:"billing_ratio"`
+}
+
+var batchSetting = BatchSetting{
+	Enabled:      true,
+	BillingRatio: 0.5,
+}
+
+func init() {
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
+
+// GetBillingRatio 返回有效的批处理计费倍率，未配置或非法时按原价计费
+func (s *BatchSetting) GetBillingRatio() float64 {
+	if s.BillingRatio <= 0 {
+		return 1
+	}
+	return s.BillingRatio
+}
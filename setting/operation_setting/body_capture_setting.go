@@ -0,0 +1,53 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// BodyCaptureSetting 请求 / 响应内容留存设置，用于排查问题
+type BodyCaptureSetting struct {
+	Enabled bool `json:"enabled"`
+	// 采样率，0~1
+	SampleRate float64 `json:"sample_rate"`
+	// 留存范围，任一命中即留存；全部为空时留存所有请求
+	TokenIds   []int `json:"token_ids"`
+	UserIds    []int `json:"user_ids"`
+	ChannelIds []int `json:"channel_ids"`
+	// 请求体与响应体各自的最大留存字节数，超出部分截断
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// 留存天数，过期后自动清理
+	RetentionDays int `json:"retention_days"`
+}
+
+var bodyCaptureSetting = BodyCaptureSetting{
+	Enabled:       false,
+	SampleRate:    1,
+	TokenIds:      []int{},
+	UserIds:       []int{},
+	ChannelIds:    []int{},
+	MaxBodyBytes:  32 << 10,
+	RetentionDays: 7,
+}
+
+func init() {
+	config.GlobalConfig.Register("body_capture_setting", &bodyCaptureSetting)
+}
+
+func GetBodyCaptureSetting() *BodyCaptureSetting {
+	return &bodyCaptureSetting
+}
+
+// HasScope 是否配置了留存范围
+func (s *BodyCaptureSetting) HasScope() bool {
+	return len(s.TokenIds) > 0 || len(s.UserIds) > 0 || len(s.ChannelIds) > 0
+}
+
+// InScope 判断请求是否在留存范围内
+func (s *BodyCaptureSetting) InScope(tokenId int, userId int, channelId int) bool {
+	if !s.HasScope() {
+		return true
+	}
+	return slices.Contains(s.TokenIds, tokenId) || slices.Contains(s.UserIds, userId) || slices.Contains(s.ChannelIds, channelId)
+}
@@ -0,0 +1,64 @@
+package operation_setting
+
+import (
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 渠道选择策略
+const (
+	// ChannelSelectStrategyWeight 按优先级分层后，按静态权重随机（默认）
+	ChannelSelectStrategyWeight = "weight"
+	// ChannelSelectStrategyAdaptive 按优先级分层后，按静态权重 × 实时健康度（TTFT、成功率、429 比例）随机
+	ChannelSelectStrategyAdaptive = "adaptive"
+)
+
+type ChannelSelectSetting struct {
+	// 默认策略，未在 GroupStrategies 中配置的分组使用该策略
+	Strategy string `json:"strategy"`
+	// 分组 -> 策略
+	GroupStrategies map[string]string `json:"group_strategies"`
+	// 滚动统计窗口（秒）
+	WindowSeconds int `json:"window_seconds"`
+	// 窗口内样本数少于该值时视为无统计数据，按中性健康度参与选择
+	MinSamples int `json:"min_samples"`
+	// TTFT 参考值（毫秒），平均 TTFT 不超过该值时不降权，为其 3 倍时延迟因子为 0.5
+	TTFTReferenceMs int `json:"ttft_reference_ms"`
+	// 429 比例的惩罚系数，0 表示不考虑 429
+	RateLimitPenalty float64 `json:"rate_limit_penalty"`
+	// 健康度下限，避免劣化渠道完全失去探测流量
+	MinScore float64 `json:"min_score"`
+}
+
+var channelSelectSetting = ChannelSelectSetting{
+	Strategy:         ChannelSelectStrategyWeight,
+	GroupStrategies:  map[string]string{},
+	WindowSeconds:    300,
+	MinSamples:       5,
+	TTFTReferenceMs:  2000,
+	RateLimitPenalty: 1.0,
+	MinScore:         0.02,
+}
+
+func init() {
+	config.GlobalConfig.Register("channel_select_setting", &channelSelectSetting)
+}
+
+func GetChannelSelectSetting() *ChannelSelectSetting {
+	return &channelSelectSetting
+}
+
+// GetChannelSelectStrategy 返回分组生效的渠道选择策略
+func GetChannelSelectStrategy(group string) string {
+	strategy := channelSelectSetting.Strategy
+	if s, ok := channelSelectSetting.GroupStrategies[group]; ok && strings.TrimSpace(s) != "" {
+		strategy = s
+	}
+	switch strings.TrimSpace(strategy) {
+	case ChannelSelectStrategyAdaptive:
+		return ChannelSelectStrategyAdaptive
+	default:
+		return ChannelSelectStrategyWeight
+	}
+}
@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type CircuitBreakerSetting struct {
+	Enabled bool `json:"enabled"`
+	// 连续失败多少次后熔断
+	FailureThreshold int `json:"failure_threshold"`
+	// 熔断持续时间（秒），到期后进入半开状态
+	OpenSeconds int `json:"open_seconds"`
+	// 半开状态下参与选择的流量比例（相对于正常权重），用于放行少量真实请求探测恢复
+	HalfOpenProbeRatio float64 `json:"half_open_probe_ratio"`
+	// 半开状态下连续成功多少次后恢复
+	HalfOpenSuccessThreshold int `json:"half_open_success_threshold"`
+}
+
+var circuitBreakerSetting = CircuitBreakerSetting{
+	Enabled:                  false,
+	FailureThreshold:         5,
+	OpenSeconds:              60,
+	HalfOpenProbeRatio:       0.1,
+	HalfOpenSuccessThreshold: 2,
+}
+
+func init() {
+	config.GlobalConfig.Register("circuit_breaker_setting", &circuitBreakerSetting)
+}
+
+func GetCircuitBreakerSetting() *CircuitBreakerSetting {
+	return &circuitBreakerSetting
+}
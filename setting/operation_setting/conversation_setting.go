@@ -0,0 +1,30 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ConversationSetting OpenAI Conversations API 设置
+// 会话与会话项保存在网关数据库中，可通过 /v1/responses 的 conversation 参数在任意渠道上使用。
+type ConversationSetting struct {
+	Enabled bool `json:"enabled"`
+	// 单个会话最多保留的会话项数，超出时删除最早的会话项
+	MaxItems int `json:"max_items"`
+	// 单个会话项序列化后的最大字节数
+	MaxItemBytes int `json:"max_item_bytes"`
+	// 会话在最后一次更新后保留的天数，过期后自动清理
+	RetentionDays int `json:"retention_days"`
+}
+
+var conversationSetting = ConversationSetting{
+	Enabled:       true,
+	MaxItems:      1000,
+	MaxItemBytes:  1 << 20,
+	RetentionDays: 30,
+}
+
+func init() {
+	config.GlobalConfig.Register("conversation_setting", &conversationSetting)
+}
+
+func GetConversationSetting() *ConversationSetting {
+	return &conversationSetting
+}
@@ -0,0 +1,100 @@
+package operation_setting
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	GuardrailProviderModeration = "moderation" // 调用渠道的 /v1/moderations 接口
+	GuardrailProviderRegex      = "regex"      // 本地正则 / PII 规则
+
+	GuardrailActionBlock  = "block"  // 拒绝请求
+	GuardrailActionRedact = "redact" // 脱敏后继续转发
+	GuardrailActionFlag   = "flag"   // 放行并记录
+)
+
+// GuardrailRule 一条转发前的内容审核规则
+type GuardrailRule struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Provider string `json:"provider"`
+	Action   string `json:"action"`
+	// 生效的分组与令牌，为空表示不限制
+	Groups   []string `json:"groups"`
+	TokenIds []int    `json:"token_ids"`
+
+	// moderation：审核模型，ChannelId 为 0 时按请求分组选择支持该模型的渠道
+	Model     string `json:"model"`
+	ChannelId int    `json:"channel_id"`
+	// 触发的类别，为空时以 flagged 为准；Threshold 大于 0 时按 category_scores 判断
+	Categories []string `json:"categories"`
+	Threshold  float64  `json:"threshold"`
+
+	// regex：内置 PII 类型（email、phone、id_card、credit_card）与自定义正则
+	PIITypes []string `json:"pii_types"`
+	Patterns []string `json:"patterns"`
+}
+
+// Match 判断规则是否作用于指定分组与令牌
+func (r *GuardrailRule) Match(group string, tokenId int) bool {
+	if !r.Enabled {
+		return false
+	}
+	if len(r.Groups) > 0 && !slices.Contains(r.Groups, group) {
+		return false
+	}
+	if len(r.TokenIds) > 0 && !slices.Contains(r.TokenIds, tokenId) {
+		return false
+	}
+	return true
+}
+
+// GuardrailSetting 转发前的内容审核设置
+type GuardrailSetting struct {
+	Enabled bool `json:"enabled"`
+	// 审核服务调用失败时是否放行
+	FailOpen bool `json:"fail_open"`
+	// 审核服务超时时间（秒）
+	TimeoutSeconds int             `json:"timeout_seconds"`
+	Rules          []GuardrailRule `json:"rules"`
+}
+
+var guardrailSetting = GuardrailSetting{
+	Enabled:        false,
+	FailOpen:       true,
+	TimeoutSeconds: 10,
+	Rules:          []GuardrailRule{},
+}
+
+func init() {
+	config.GlobalConfig.Register("guardrail_setting", &guardrailSetting)
+}
+
+func GetGuardrailSetting() *GuardrailSetting {
+	return &guardrailSetting
+}
+
+// CheckGuardrailRules 校验规则配置，自定义正则无法编译时拒绝保存
+func CheckGuardrailRules(jsonStr string) error {
+	rules := make([]GuardrailRule, 0)
+	if strings.TrimSpace(jsonStr) == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return err
+	}
+	for i, rule := range rules {
+		for _, pattern := range rule.Patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("rule #%d: invalid pattern %q: %w", i+1, pattern, err)
+			}
+		}
+	}
+	return nil
+}
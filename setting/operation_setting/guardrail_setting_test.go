@@ -0,0 +1,16 @@
+package operation_setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckGuardrailRules_RejectsInvalidPattern(t *testing.T) {
+	require.NoError(t, CheckGuardrailRules(""))
+	require.NoError(t, CheckGuardrailRules(`[{"name":"ok","provider":"regex","patterns":["sk-[A-Za-z0-9]{20,}"]}]`))
+
+	err := CheckGuardrailRules(`[{"name":"bad","provider":"regex","patterns":["([a-z"]}]`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rule #1")
+}
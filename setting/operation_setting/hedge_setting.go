@@ -0,0 +1,43 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// HedgeSetting 对冲请求设置：首字节超时后向另一个渠道发出相同请求，先响应者胜出
+type HedgeSetting struct {
+	Enabled bool `json:"enabled"`
+	// 等待首字节的时间（毫秒），超时后发出对冲请求
+	DelayMs int `json:"delay_ms"`
+	// 开启对冲的分组与令牌，任一命中即开启
+	Groups   []string `json:"groups"`
+	TokenIds []int    `json:"token_ids"`
+	// 是否同时对未胜出的请求计费，默认只对胜出的请求计费
+	BillBoth bool `json:"bill_both"`
+}
+
+var hedgeSetting = HedgeSetting{
+	Enabled:  false,
+	DelayMs:  2000,
+	Groups:   []string{},
+	TokenIds: []int{},
+	BillBoth: false,
+}
+
+func init() {
+	config.GlobalConfig.Register("hedge_setting", &hedgeSetting)
+}
+
+func GetHedgeSetting() *HedgeSetting {
+	return &hedgeSetting
+}
+
+// Match 判断分组或令牌是否开启了对冲
+func (s *HedgeSetting) Match(group string, tokenId int) bool {
+	if !s.Enabled || s.DelayMs <= 0 {
+		return false
+	}
+	return slices.Contains(s.Groups, group) || slices.Contains(s.TokenIds, tokenId)
+}
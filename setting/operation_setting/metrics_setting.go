@@ -0,0 +1,32 @@
+package operation_setting
+
+import (
+	"os"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// MetricsSetting Prometheus /metrics 端点设置
+type MetricsSetting struct {
+	Enabled bool `json:"enabled"`
+	// 抓取时需携带的 Bearer Token，为空时拒绝所有抓取
+	Token string `json:"token"`
+}
+
+var metricsSetting = MetricsSetting{
+	Enabled: false,
+	Token:   "",
+}
+
+func init() {
+	// 环境变量 METRICS_TOKEN 只作为默认值，便于部署时直接开启；管理员在后台保存的设置会覆盖它，可随时关闭或更换
+	if token := os.Getenv("METRICS_TOKEN"); token != "" {
+		metricsSetting.Enabled = true
+		metricsSetting.Token = token
+	}
+	config.GlobalConfig.Register("metrics_setting", &metricsSetting)
+}
+
+func GetMetricsSetting() *MetricsSetting {
+	return &metricsSetting
+}
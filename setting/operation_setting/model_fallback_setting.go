@@ -0,0 +1,59 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+const (
+	ModelFallbackErrorRateLimit     = "rate_limit"     // 429
+	ModelFallbackErrorServerError   = "server_error"   // 5xx
+	ModelFallbackErrorTimeout       = "timeout"        // 408 / 504 / 524
+	ModelFallbackErrorNoChannel     = "no_channel"     // 重试时无可用渠道
+	ModelFallbackErrorContextLength = "context_length" // 上下文超长
+
+	// ModelFallbackAllGroups 对所有分组生效的备用链
+	ModelFallbackAllGroups = "*"
+)
+
+// ModelFallbackSetting 模型备用链设置：某个模型的全部渠道失败后按链依次改用其他模型
+type ModelFallbackSetting struct {
+	Enabled bool `json:"enabled"`
+	// 分组 -> 请求模型 -> 依次尝试的备用模型，分组为 * 时对所有分组生效
+	Chains map[string]map[string][]string `json:"chains"`
+	// 重试用尽后是否切换备用模型
+	OnRetryExhausted bool `json:"on_retry_exhausted"`
+	// 命中这些错误类别时不再重试当前模型，直接切换备用模型
+	ErrorClasses []string `json:"error_classes"`
+}
+
+var modelFallbackSetting = ModelFallbackSetting{
+	Enabled:          false,
+	Chains:           map[string]map[string][]string{},
+	OnRetryExhausted: true,
+	ErrorClasses:     []string{},
+}
+
+func init() {
+	config.GlobalConfig.Register("model_fallback_setting", &modelFallbackSetting)
+}
+
+func GetModelFallbackSetting() *ModelFallbackSetting {
+	return &modelFallbackSetting
+}
+
+// GetChain 返回分组下模型的备用链，分组未配置时使用 * 的配置
+func (s *ModelFallbackSetting) GetChain(group string, model string) []string {
+	if chains, ok := s.Chains[group]; ok {
+		if chain, ok := chains[model]; ok {
+			return chain
+		}
+	}
+	return s.Chains[ModelFallbackAllGroups][model]
+}
+
+// IsFallbackErrorClass 错误类别是否配置为立即切换备用模型
+func (s *ModelFallbackSetting) IsFallbackErrorClass(class string) bool {
+	return class != "" && slices.Contains(s.ErrorClasses, class)
+}
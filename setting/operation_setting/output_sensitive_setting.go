@@ -0,0 +1,52 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	OutputSensitivePolicyMask     = "mask"     // 替换屏蔽词后继续输出
+	OutputSensitivePolicyTruncate = "truncate" // 截断并停止生成
+	OutputSensitivePolicyLog      = "log"      // 仅记录，不修改输出
+)
+
+// OutputSensitiveSetting 模型输出内容的屏蔽词检查设置，屏蔽词列表与 Prompt 检查共用
+type OutputSensitiveSetting struct {
+	// 默认处理策略，为空时沿用 StopOnSensitiveEnabled（开启为 truncate，否则为 mask）
+	DefaultPolicy string `json:"default_policy"`
+	// 按分组覆盖的处理策略
+	GroupPolicies map[string]string `json:"group_policies"`
+	// 每次违规额外扣除的金额（美元），按分组倍率计算，0 表示仅记录不扣费
+	ViolationDeductionAmount float64 `json:"violation_deduction_amount"`
+}
+
+var outputSensitiveSetting = OutputSensitiveSetting{
+	DefaultPolicy:            "",
+	GroupPolicies:            map[string]string{},
+	ViolationDeductionAmount: 0,
+}
+
+func init() {
+	config.GlobalConfig.Register("output_sensitive_setting", &outputSensitiveSetting)
+}
+
+func GetOutputSensitiveSetting() *OutputSensitiveSetting {
+	return &outputSensitiveSetting
+}
+
+func IsValidOutputSensitivePolicy(policy string) bool {
+	switch policy {
+	case OutputSensitivePolicyMask, OutputSensitivePolicyTruncate, OutputSensitivePolicyLog:
+		return true
+	}
+	return false
+}
+
+// GetPolicy 返回分组的处理策略，未配置时返回默认策略（可能为空）
+func (s *OutputSensitiveSetting) GetPolicy(group string) string {
+	if policy, ok := s.GroupPolicies[group]; ok && IsValidOutputSensitivePolicy(policy) {
+		return policy
+	}
+	if IsValidOutputSensitivePolicy(s.DefaultPolicy) {
+		return s.DefaultPolicy
+	}
+	return ""
+}
@@ -0,0 +1,54 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// RealtimeBridgeModel 桥接模式下一个 Realtime 模型使用的语音识别、对话与语音合成模型
+type RealtimeBridgeModel struct {
+	// /v1/audio/transcriptions 渠道上的语音识别模型
+	TranscriptionModel string `json:"transcription_model"`
+	// 上传给语音识别渠道的 WAV 采样率，为 0 时使用 24000，只接受 16kHz 等采样率的渠道需要设置
+	TranscriptionSampleRate int `json:"transcription_sample_rate"`
+	// /v1/chat/completions 渠道上的对话模型，可以是任意渠道类型
+	ChatModel string `json:"chat_model"`
+	// /v1/audio/speech 渠道上的语音合成模型，为空时只输出文本。
+	// 模型需要能以 pcm 或 WAV 格式输出，mp3、opus 等压缩格式无法转换为 pcm16
+	SpeechModel string `json:"speech_model"`
+	// 客户端未指定 voice 时使用的音色
+	Voice string `json:"voice"`
+}
+
+// RealtimeBridgeSetting Realtime API 桥接设置
+// 请求的模型在 Models 中时，由网关终结 Realtime 协议，依次调用语音识别、对话与语音合成渠道，
+// 不再把 WebSocket 帧转发给 OpenAI 兼容的 Realtime 上游。
+type RealtimeBridgeSetting struct {
+	Enabled bool                           `json:"enabled"`
+	Models  map[string]RealtimeBridgeModel `json:"models"`
+	// 单次提交的输入音频最大字节数（pcm16）
+	MaxAudioBytes int `json:"max_audio_bytes"`
+}
+
+var realtimeBridgeSetting = RealtimeBridgeSetting{
+	Enabled:       false,
+	Models:        map[string]RealtimeBridgeModel{},
+	MaxAudioBytes: 24000 * 2 * 300,
+}
+
+func init() {
+	config.GlobalConfig.Register("realtime_bridge_setting", &realtimeBridgeSetting)
+}
+
+func GetRealtimeBridgeSetting() *RealtimeBridgeSetting {
+	return &realtimeBridgeSetting
+}
+
+// GetModel 返回模型的桥接配置，未开启或未配置时返回 false
+func (s *RealtimeBridgeSetting) GetModel(modelName string) (RealtimeBridgeModel, bool) {
+	if !s.Enabled || modelName == "" {
+		return RealtimeBridgeModel{}, false
+	}
+	bridge, ok := s.Models[modelName]
+	if !ok || bridge.TranscriptionModel == "" || bridge.ChatModel == "" {
+		return RealtimeBridgeModel{}, false
+	}
+	return bridge, true
+}
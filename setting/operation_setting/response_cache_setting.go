@@ -0,0 +1,44 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// ResponseCacheSetting 网关侧响应缓存设置
+// 对 /v1/chat/completions、/v1/messages、/v1/embeddings 的请求按规范化后的请求体精确匹配缓存，
+// 命中时直接回放缓存的响应（流式请求以 SSE 回放），并按 BillingRatio 计费。
+// 需要令牌开启响应缓存，或令牌分组在 Groups 中才会生效。
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// 缓存有效期（秒）
+	TTLSeconds int `json:"ttl_seconds"`
+	// 命中缓存时按原始消耗额度的该比例计费，0 表示免费
+	BillingRatio float64 `json:"billing_ratio"`
+	// 对这些分组的全部令牌启用响应缓存
+	Groups []string `json:"groups"`
+	// 单条响应的最大缓存字节数，超过时不缓存
+	MaxEntryBytes int `json:"max_entry_bytes"`
+}
+
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:       false,
+	TTLSeconds:    3600,
+	BillingRatio:  0,
+	Groups:        []string{},
+	MaxEntryBytes: 1 << 20,
+}
+
+func init() {
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// IsResponseCacheGroup 分组是否对全部令牌启用了响应缓存
+func (s *ResponseCacheSetting) IsResponseCacheGroup(group string) bool {
+	return group != "" && slices.Contains(s.Groups, group)
+}
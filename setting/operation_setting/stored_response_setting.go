@@ -0,0 +1,27 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// StoredResponseSetting Responses API 本地保存设置
+// 响应保存在网关数据库中，用于在任意渠道上展开 previous_response_id 的历史。
+type StoredResponseSetting struct {
+	Enabled bool `json:"enabled"`
+	// 响应保存的天数，过期后自动清理，0 表示不清理
+	RetentionDays int `json:"retention_days"`
+	// 单个响应的最大字节数，超出时不保存，0 表示不限制
+	MaxBytes int `json:"max_bytes"`
+}
+
+var storedResponseSetting = StoredResponseSetting{
+	Enabled:       true,
+	RetentionDays: 30,
+	MaxBytes:      16 << 20,
+}
+
+func init() {
+	config.GlobalConfig.Register("stored_response_setting", &storedResponseSetting)
+}
+
+func GetStoredResponseSetting() *StoredResponseSetting {
+	return &storedResponseSetting
+}
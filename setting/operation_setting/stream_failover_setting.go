@@ -0,0 +1,23 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// StreamFailoverSetting 流式对话中途中断时换渠道续写的设置
+type StreamFailoverSetting struct {
+	Enabled bool `json:"enabled"`
+	// 单个请求最多续写的次数
+	MaxFailovers int `json:"max_failovers"`
+}
+
+var streamFailoverSetting = StreamFailoverSetting{
+	Enabled:      false,
+	MaxFailovers: 1,
+}
+
+func init() {
+	config.GlobalConfig.Register("stream_failover_setting", &streamFailoverSetting)
+}
+
+func GetStreamFailoverSetting() *StreamFailoverSetting {
+	return &streamFailoverSetting
+}
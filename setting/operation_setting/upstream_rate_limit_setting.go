@@ -0,0 +1,34 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// UpstreamRateLimitSetting 上游限流响应头跟踪设置
+// 解析 OpenAI x-ratelimit-*、Anthropic anthropic-ratelimit-* 以及 retry-after 响应头，
+// 在额度耗尽且未到重置时间前，渠道选择会跳过对应的渠道 key。
+type UpstreamRateLimitSetting struct {
+	Enabled bool `json:"enabled"`
+	// 剩余请求数不高于该值时视为耗尽
+	MinRemainingRequests int64 `json:"min_remaining_requests"`
+	// 剩余 token 数不高于该值时视为耗尽
+	MinRemainingTokens int64 `json:"min_remaining_tokens"`
+	// 响应头只给出剩余额度、没有重置时间时，假定的重置时间（秒）
+	DefaultResetSeconds int `json:"default_reset_seconds"`
+	// retry-after / 重置时间的最大值（秒），防止异常响应头导致 key 长时间不可用
+	MaxResetSeconds int `json:"max_reset_seconds"`
+}
+
+var upstreamRateLimitSetting = UpstreamRateLimitSetting{
+	Enabled:              false,
+	MinRemainingRequests: 0,
+	MinRemainingTokens:   0,
+	DefaultResetSeconds:  10,
+	MaxResetSeconds:      300,
+}
+
+func init() {
+	config.GlobalConfig.Register("upstream_rate_limit_setting", &upstreamRateLimitSetting)
+}
+
+func GetUpstreamRateLimitSetting() *UpstreamRateLimitSetting {
+	return &upstreamRateLimitSetting
+}
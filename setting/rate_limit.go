@@ -3,7 +3,12 @@ package setting
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
@@ -67,3 +72,206 @@ func CheckModelRequestRateLimitGroup(jsonStr string) error {
 
 	return nil
 }
+
+// GroupUsageLimit 分组的 TPM 与并发限制，作用于该分组下的每个用户，0 表示不限制
+type GroupUsageLimit struct {
+	TPM         int `json:"tpm"`
+	Concurrency int `json:"concurrency"`
+}
+
+// ModelRequestUsageLimitGroup 分组 TPM / 并发限制，例如 {"default": {"tpm": 100000, "concurrency": 5}}
+var ModelRequestUsageLimitGroup = map[string]GroupUsageLimit{}
+var ModelRequestUsageLimitMutex sync.RWMutex
+
+func ModelRequestUsageLimitGroup2JSONString() string {
+	ModelRequestUsageLimitMutex.RLock()
+	defer ModelRequestUsageLimitMutex.RUnlock()
+
+	jsonBytes, err := json.Marshal(ModelRequestUsageLimitGroup)
+	if err != nil {
+		common.SysLog("error marshalling model request usage limit group: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelRequestUsageLimitGroupByJSONString(jsonStr string) error {
+	limits := make(map[string]GroupUsageLimit)
+	if err := json.Unmarshal([]byte(jsonStr), &limits); err != nil {
+		return err
+	}
+
+	ModelRequestUsageLimitMutex.Lock()
+	defer ModelRequestUsageLimitMutex.Unlock()
+	ModelRequestUsageLimitGroup = limits
+	return nil
+}
+
+func GetGroupUsageLimit(group string) (GroupUsageLimit, bool) {
+	ModelRequestUsageLimitMutex.RLock()
+	defer ModelRequestUsageLimitMutex.RUnlock()
+
+	limit, found := ModelRequestUsageLimitGroup[group]
+	return limit, found
+}
+
+func CheckModelRequestUsageLimitGroup(jsonStr string) error {
+	limits := make(map[string]GroupUsageLimit)
+	if err := json.Unmarshal([]byte(jsonStr), &limits); err != nil {
+		return err
+	}
+	for group, limit := range limits {
+		if limit.TPM < 0 || limit.Concurrency < 0 {
+			return fmt.Errorf("group %s has negative usage limit values: tpm=%d, concurrency=%d", group, limit.TPM, limit.Concurrency)
+		}
+		if limit.TPM > math.MaxInt32 || limit.Concurrency > math.MaxInt32 {
+			return fmt.Errorf("group %s usage limit exceeds max value 2147483647", group)
+		}
+	}
+	return nil
+}
+
+const (
+	ModelRateLimitMatchPrefix = "prefix"
+	ModelRateLimitMatchRegex  = "regex"
+	ModelRateLimitMatchExact  = "exact"
+)
+
+// ModelRateLimitRule 按分组 + 模型匹配的请求速率限制规则，命中规则的请求使用规则自己的计数器，
+// 不再计入分组/全局的请求计数。限制周期与全局配置相同。
+type ModelRateLimitRule struct {
+	Group        string `json:"group"`         // 分组，为空或 "*" 时匹配所有分组
+	Model        string `json:"model"`         // 模型匹配模式
+	Match        string `json:"match"`         // 匹配方式：prefix（默认）、regex、exact
+	TotalCount   int    `json:"total_count"`   // 周期内最多请求次数（包括失败），0 表示不限制
+	SuccessCount int    `json:"success_count"` // 周期内最多请求完成次数，0 表示不限制
+
+	regex *regexp.Regexp
+}
+
+// Key 返回规则的唯一标识，用于区分计数器，规则内容不变时保持稳定
+func (r *ModelRateLimitRule) Key() string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(r.Group + "|" + r.matchType() + "|" + r.Model))
+	return strconv.FormatUint(uint64(h.Sum32()), 16)
+}
+
+func (r *ModelRateLimitRule) matchType() string {
+	if r.Match == "" {
+		return ModelRateLimitMatchPrefix
+	}
+	return r.Match
+}
+
+func (r *ModelRateLimitRule) compile() error {
+	if strings.TrimSpace(r.Model) == "" {
+		return fmt.Errorf("model pattern is empty")
+	}
+	switch r.matchType() {
+	case ModelRateLimitMatchPrefix, ModelRateLimitMatchExact:
+		return nil
+	case ModelRateLimitMatchRegex:
+		re, err := regexp.Compile(r.Model)
+		if err != nil {
+			return fmt.Errorf("invalid model regex %q: %w", r.Model, err)
+		}
+		r.regex = re
+		return nil
+	default:
+		return fmt.Errorf("unknown match type %q", r.Match)
+	}
+}
+
+// Matches 判断规则是否适用于指定分组和模型
+func (r *ModelRateLimitRule) Matches(group string, modelName string) bool {
+	if r.Group != "" && r.Group != "*" && r.Group != group {
+		return false
+	}
+	switch r.matchType() {
+	case ModelRateLimitMatchExact:
+		return modelName == r.Model
+	case ModelRateLimitMatchRegex:
+		return r.regex != nil && r.regex.MatchString(modelName)
+	default:
+		return strings.HasPrefix(modelName, r.Model)
+	}
+}
+
+var ModelRequestRateLimitModelRules = []ModelRateLimitRule{}
+var ModelRequestRateLimitModelRulesMutex sync.RWMutex
+
+func parseModelRequestRateLimitModelRules(jsonStr string) ([]ModelRateLimitRule, error) {
+	rules := make([]ModelRateLimitRule, 0)
+	if strings.TrimSpace(jsonStr) == "" {
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(jsonStr), &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("rule #%d: %w", i+1, err)
+		}
+		if rules[i].TotalCount < 0 || rules[i].SuccessCount < 0 {
+			return nil, fmt.Errorf("rule #%d has negative rate limit values: [%d, %d]", i+1, rules[i].TotalCount, rules[i].SuccessCount)
+		}
+		if rules[i].TotalCount > math.MaxInt32 || rules[i].SuccessCount > math.MaxInt32 {
+			return nil, fmt.Errorf("rule #%d [%d, %d] has max rate limits value 2147483647", i+1, rules[i].TotalCount, rules[i].SuccessCount)
+		}
+	}
+	return rules, nil
+}
+
+func ModelRequestRateLimitModelRules2JSONString() string {
+	ModelRequestRateLimitModelRulesMutex.RLock()
+	defer ModelRequestRateLimitModelRulesMutex.RUnlock()
+
+	jsonBytes, err := json.Marshal(ModelRequestRateLimitModelRules)
+	if err != nil {
+		common.SysLog("error marshalling model request rate limit model rules: " + err.Error())
+	}
+	return string(jsonBytes)
+}
+
+func UpdateModelRequestRateLimitModelRulesByJSONString(jsonStr string) error {
+	rules, err := parseModelRequestRateLimitModelRules(jsonStr)
+	if err != nil {
+		return err
+	}
+
+	ModelRequestRateLimitModelRulesMutex.Lock()
+	defer ModelRequestRateLimitModelRulesMutex.Unlock()
+	ModelRequestRateLimitModelRules = rules
+	return nil
+}
+
+func CheckModelRequestRateLimitModelRules(jsonStr string) error {
+	_, err := parseModelRequestRateLimitModelRules(jsonStr)
+	return err
+}
+
+// HasModelRateLimitRules 是否配置了模型速率限制规则
+func HasModelRateLimitRules() bool {
+	ModelRequestRateLimitModelRulesMutex.RLock()
+	defer ModelRequestRateLimitModelRulesMutex.RUnlock()
+	return len(ModelRequestRateLimitModelRules) > 0
+}
+
+// GetModelRateLimitRule 按配置顺序返回第一个匹配分组和模型的规则
+func GetModelRateLimitRule(group string, modelName string) (ModelRateLimitRule, bool) {
+	ModelRequestRateLimitModelRulesMutex.RLock()
+	defer ModelRequestRateLimitModelRulesMutex.RUnlock()
+
+	for _, rule := range ModelRequestRateLimitModelRules {
+		if rule.Matches(group, modelName) {
+			return rule, true
+		}
+	}
+	return ModelRateLimitRule{}, false
+}
+
+// GetModelRateLimitRules 返回所有规则的副本
+func GetModelRateLimitRules() []ModelRateLimitRule {
+	ModelRequestRateLimitModelRulesMutex.RLock()
+	defer ModelRequestRateLimitModelRulesMutex.RUnlock()
+	return slices.Clone(ModelRequestRateLimitModelRules)
+}
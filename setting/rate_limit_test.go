@@ -0,0 +1,52 @@
+package setting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelRequestRateLimitModelRules(t *testing.T) {
+	original := ModelRequestRateLimitModelRules
+	t.Cleanup(func() { ModelRequestRateLimitModelRules = original })
+
+	err := UpdateModelRequestRateLimitModelRulesByJSONString(`[
+		{"group": "default", "model": "text-embedding-", "total_count": 0, "success_count": 5000},
+		{"model": "^o[0-9]+(-mini)?$", "match": "regex", "total_count": 20, "success_count": 10},
+		{"group": "*", "model": "gpt-4o", "match": "exact", "success_count": 100}
+	]`)
+	require.NoError(t, err)
+	require.True(t, HasModelRateLimitRules())
+
+	rule, ok := GetModelRateLimitRule("default", "text-embedding-3-small")
+	require.True(t, ok)
+	require.Equal(t, 5000, rule.SuccessCount)
+
+	// prefix rule is scoped to the default group
+	_, ok = GetModelRateLimitRule("vip", "text-embedding-3-small")
+	require.False(t, ok)
+
+	rule, ok = GetModelRateLimitRule("vip", "o3-mini")
+	require.True(t, ok)
+	require.Equal(t, 20, rule.TotalCount)
+
+	_, ok = GetModelRateLimitRule("vip", "gpt-4o-mini")
+	require.False(t, ok)
+	rule, ok = GetModelRateLimitRule("vip", "gpt-4o")
+	require.True(t, ok)
+	require.Equal(t, 100, rule.SuccessCount)
+
+	// keys are stable and distinct per rule
+	rules := GetModelRateLimitRules()
+	require.Len(t, rules, 3)
+	require.NotEqual(t, rules[0].Key(), rules[1].Key())
+	require.Equal(t, rules[0].Key(), rules[0].Key())
+}
+
+func TestCheckModelRequestRateLimitModelRules(t *testing.T) {
+	require.NoError(t, CheckModelRequestRateLimitModelRules(""))
+	require.Error(t, CheckModelRequestRateLimitModelRules(`[{"model": ""}]`))
+	require.Error(t, CheckModelRequestRateLimitModelRules(`[{"model": "(", "match": "regex"}]`))
+	require.Error(t, CheckModelRequestRateLimitModelRules(`[{"model": "gpt", "match": "glob"}]`))
+	require.Error(t, CheckModelRequestRateLimitModelRules(`[{"model": "gpt", "total_count": -1}]`))
+}
@@ -59,7 +59,9 @@ const OperationSetting = () => {
     /* 敏感词设置 */
     CheckSensitiveEnabled: false,
     CheckSensitiveOnPromptEnabled: false,
+    CheckSensitiveOnCompletionEnabled: false,
     SensitiveWords: '',
+    'output_sensitive_setting.group_policies': '',
 
     /* 日志设置 */
     LogConsumeEnabled: false,
@@ -32,6 +32,8 @@ const RateLimitSetting = () => {
     ModelRequestRateLimitSuccessCount: 1000,
     ModelRequestRateLimitDurationMinutes: 1,
     ModelRequestRateLimitGroup: '',
+    ModelRequestUsageLimitGroup: '',
+    ModelRequestRateLimitModelRules: '',
   });
 
   let [loading, setLoading] = useState(false);
@@ -42,7 +44,11 @@ const RateLimitSetting = () => {
     if (success) {
       let newInputs = {};
       data.forEach((item) => {
-        if (item.key === 'ModelRequestRateLimitGroup') {
+        if (
+          item.key === 'ModelRequestRateLimitGroup' ||
+          item.key === 'ModelRequestUsageLimitGroup' ||
+          item.key === 'ModelRequestRateLimitModelRules'
+        ) {
           item.value = JSON.stringify(JSON.parse(item.value), null, 2);
         }
 
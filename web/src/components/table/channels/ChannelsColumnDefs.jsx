@@ -511,6 +511,25 @@ export const getChannelsColumns = ({
               </Tooltip>
             </div>
           );
+        } else if (text === 1 && record.schedule_status) {
+          const { active, next_transition_time } = record.schedule_status;
+          return (
+            <Space spacing={4}>
+              {renderStatus(text, record.channel_info, t)}
+              <Tooltip
+                content={
+                  next_transition_time
+                    ? (active ? t('关闭时间：') : t('开放时间：')) +
+                      timestamp2string(next_transition_time)
+                    : t('不会切换')
+                }
+              >
+                <Tag color={active ? 'cyan' : 'grey'} shape='circle'>
+                  {active ? t('时段内') : t('时段外')}
+                </Tag>
+              </Tooltip>
+            </Space>
+          );
         } else {
           return renderStatus(text, record.channel_info, t);
         }
@@ -195,6 +195,8 @@ const EditChannelModal = (props) => {
     pass_through_body_enabled: false,
     system_prompt: '',
     system_prompt_override: false,
+    pii_redaction_mode: '',
+    pii_redaction_types: [],
     settings: '',
     // 仅 Vertex: 密钥格式（存入 settings.vertex_key_type）
     vertex_key_type: 'json',
@@ -214,6 +216,7 @@ const EditChannelModal = (props) => {
     upstream_model_update_last_check_time: 0,
     upstream_model_update_last_detected_models: [],
     upstream_model_update_ignored_models: '',
+    schedule: '',
   };
   const [batch, setBatch] = useState(false);
   const [multiToSingle, setMultiToSingle] = useState(false);
@@ -498,6 +501,8 @@ const EditChannelModal = (props) => {
     proxy: '',
     pass_through_body_enabled: false,
     system_prompt: '',
+    pii_redaction_mode: '',
+    pii_redaction_types: [],
   });
   const showApiConfigCard = true; // 控制是否显示 API 配置卡片
   const getInitValues = () => ({ ...originInputs });
@@ -851,6 +856,8 @@ const EditChannelModal = (props) => {
           data.system_prompt = parsedSettings.system_prompt || '';
           data.system_prompt_override =
             parsedSettings.system_prompt_override || false;
+          data.pii_redaction_mode = parsedSettings.pii_redaction_mode || '';
+          data.pii_redaction_types = parsedSettings.pii_redaction_types || [];
         } catch (error) {
           console.error('解析渠道设置失败:', error);
           data.force_format = false;
@@ -859,6 +866,8 @@ const EditChannelModal = (props) => {
           data.pass_through_body_enabled = false;
           data.system_prompt = '';
           data.system_prompt_override = false;
+          data.pii_redaction_mode = '';
+          data.pii_redaction_types = [];
         }
       } else {
         data.force_format = false;
@@ -867,6 +876,8 @@ const EditChannelModal = (props) => {
         data.pass_through_body_enabled = false;
         data.system_prompt = '';
         data.system_prompt_override = false;
+        data.pii_redaction_mode = '';
+        data.pii_redaction_types = [];
       }
 
       if (data.settings) {
@@ -907,6 +918,9 @@ const EditChannelModal = (props) => {
           )
             ? parsedSettings.upstream_model_update_ignored_models.join(',')
             : '';
+          data.schedule = parsedSettings.schedule
+            ? JSON.stringify(parsedSettings.schedule, null, 2)
+            : '';
         } catch (error) {
           console.error('解析其他设置失败:', error);
           data.azure_responses_version = '';
@@ -925,6 +939,7 @@ const EditChannelModal = (props) => {
           data.upstream_model_update_last_check_time = 0;
           data.upstream_model_update_last_detected_models = [];
           data.upstream_model_update_ignored_models = '';
+          data.schedule = '';
         }
       } else {
         // 兼容历史数据：老渠道没有 settings 时，默认按 json 展示
@@ -942,6 +957,7 @@ const EditChannelModal = (props) => {
         data.upstream_model_update_last_check_time = 0;
         data.upstream_model_update_last_detected_models = [];
         data.upstream_model_update_ignored_models = '';
+        data.schedule = '';
       }
 
       if (
@@ -973,6 +989,8 @@ const EditChannelModal = (props) => {
         pass_through_body_enabled: data.pass_through_body_enabled,
         system_prompt: data.system_prompt,
         system_prompt_override: data.system_prompt_override || false,
+        pii_redaction_mode: data.pii_redaction_mode || '',
+        pii_redaction_types: data.pii_redaction_types || [],
       });
       initialModelsRef.current = (data.models || [])
         .map((model) => (model || '').trim())
@@ -1015,7 +1033,8 @@ const EditChannelModal = (props) => {
         data.pass_through_body_enabled ||
         data.force_format ||
         data.claude_beta_query ||
-        data.system_prompt_override;
+        data.system_prompt_override ||
+        data.pii_redaction_mode;
       if (hasAdvancedValues) {
         setAdvancedSettingsOpen(true);
       }
@@ -1362,6 +1381,8 @@ const EditChannelModal = (props) => {
       pass_through_body_enabled: false,
       system_prompt: '',
       system_prompt_override: false,
+      pii_redaction_mode: '',
+      pii_redaction_types: [],
     });
     // 重置密钥模式状态
     setKeyMode('append');
@@ -1733,6 +1754,11 @@ const EditChannelModal = (props) => {
       system_prompt: localInputs.system_prompt || '',
       system_prompt_override: localInputs.system_prompt_override || false,
     };
+    if (localInputs.pii_redaction_mode) {
+      channelExtraSettings.pii_redaction_mode = localInputs.pii_redaction_mode;
+      channelExtraSettings.pii_redaction_types =
+        localInputs.pii_redaction_types || [];
+    }
     localInputs.setting = JSON.stringify(channelExtraSettings);
 
     // 处理 settings 字段（包括企业账户设置和字段透传控制）
@@ -1803,6 +1829,18 @@ const EditChannelModal = (props) => {
       settings.upstream_model_update_last_check_time = 0;
     }
 
+    // 可用时段：为空时移除，否则需为合法 JSON
+    if (String(localInputs.schedule || '').trim() === '') {
+      delete settings.schedule;
+    } else {
+      try {
+        settings.schedule = JSON.parse(localInputs.schedule);
+      } catch (error) {
+        showError(`${t('可用时段')}: ${t('JSON格式错误')}`);
+        return;
+      }
+    }
+
     localInputs.settings = JSON.stringify(settings);
 
     // 清理不需要发送到后端的字段
@@ -1812,6 +1850,8 @@ const EditChannelModal = (props) => {
     delete localInputs.pass_through_body_enabled;
     delete localInputs.system_prompt;
     delete localInputs.system_prompt_override;
+    delete localInputs.pii_redaction_mode;
+    delete localInputs.pii_redaction_types;
     delete localInputs.is_enterprise_account;
     // 顶层的 vertex_key_type 不应发送给后端
     delete localInputs.vertex_key_type;
@@ -1829,6 +1869,7 @@ const EditChannelModal = (props) => {
     delete localInputs.upstream_model_update_last_check_time;
     delete localInputs.upstream_model_update_last_detected_models;
     delete localInputs.upstream_model_update_ignored_models;
+    delete localInputs.schedule;
 
     let res;
     localInputs.auto_ban = localInputs.auto_ban ? 1 : 0;
@@ -2437,6 +2478,19 @@ const EditChannelModal = (props) => {
                     showClear
                     onChange={(value) => handleInputChange('remark', value)}
                   />
+                  <Form.TextArea
+                    field='schedule'
+                    label={t('可用时段')}
+                    placeholder={
+                      '{\n  "enabled": true,\n  "timezone": "Asia/Shanghai",\n  "windows": [\n    { "weekdays": [1, 2, 3, 4, 5], "start": "09:00", "end": "18:00" }\n  ]\n}'
+                    }
+                    autosize
+                    showClear
+                    onChange={(value) => handleInputChange('schedule', value)}
+                    extraText={t(
+                      '设置后渠道仅在时段内参与选择；weekdays 中 0 为周日，为空表示每天；end 不晚于 start 时表示跨越午夜',
+                    )}
+                  />
 
                   <Row gutter={12}>
                     <Col span={12}>
@@ -2505,6 +2559,35 @@ const EditChannelModal = (props) => {
 
                   <Form.TextArea field='system_prompt' label={t('系统提示词')} placeholder={t('输入系统提示词，用户的系统提示词将优先于此设置')} onChange={(value) => handleChannelSettingsChange('system_prompt', value)} autosize showClear extraText={t('用户优先：如果用户在请求中指定了系统提示词，将优先使用用户的设置')} />
                   <Form.Switch field='system_prompt_override' label={t('系统提示词拼接')} checkedText={t('开')} uncheckedText={t('关')} onChange={(value) => handleChannelSettingsChange('system_prompt_override', value)} extraText={t('如果用户请求中包含系统提示词，则使用此设置拼接到用户的系统提示词前面')} />
+
+                  <Form.Select
+                    field='pii_redaction_mode'
+                    label={t('个人信息脱敏')}
+                    optionList={[
+                      { label: t('关闭'), value: '' },
+                      { label: t('替换为类型标记'), value: 'mask' },
+                      { label: t('替换为占位符并在响应中还原'), value: 'restore' },
+                    ]}
+                    style={{ width: '100%' }}
+                    onChange={(value) => handleChannelSettingsChange('pii_redaction_mode', value)}
+                    extraText={t('转发前将请求中的邮箱、手机号、身份证号、银行卡号替换掉，原文不会发送到该渠道')}
+                  />
+                  {inputs.pii_redaction_mode && (
+                    <Form.Select
+                      field='pii_redaction_types'
+                      label={t('脱敏类型')}
+                      multiple
+                      placeholder={t('为空时处理全部类型')}
+                      optionList={[
+                        { label: t('邮箱'), value: 'email' },
+                        { label: t('手机号'), value: 'phone' },
+                        { label: t('身份证号'), value: 'id_card' },
+                        { label: t('银行卡号'), value: 'credit_card' },
+                      ]}
+                      style={{ width: '100%' }}
+                      onChange={(value) => handleChannelSettingsChange('pii_redaction_types', value)}
+                    />
+                  )}
                 </div>
               </div>
             );
@@ -3113,6 +3196,15 @@ const EditChannelModal = (props) => {
                           optionList={[
                             { label: t('随机'), value: 'random' },
                             { label: t('轮询'), value: 'polling' },
+                            {
+                              label: t('最久未使用'),
+                              value: 'least_recently_used',
+                            },
+                            {
+                              label: t('今日用量最少'),
+                              value: 'least_tokens_today',
+                            },
+                            { label: t('按权重随机'), value: 'weighted' },
                           ]}
                           style={{ width: '100%' }}
                           value={inputs.multi_key_mode || 'random'}
@@ -406,6 +406,29 @@ const MultiKeyManageModal = ({ visible, onCancel, channel, onRefresh }) => {
         );
       },
     },
+    {
+      title: t('权重'),
+      dataIndex: 'weight',
+      render: (weight) => weight || 1,
+    },
+    {
+      title: t('今日用量'),
+      dataIndex: 'usage',
+      render: (usage, record) => {
+        const tokens = usage?.tokens_today || 0;
+        const text = record.daily_token_budget
+          ? `${tokens} / ${record.daily_token_budget}`
+          : `${tokens}`;
+        return (
+          <Text
+            type={record.budget_exhausted ? 'danger' : undefined}
+            style={{ fontSize: '12px' }}
+          >
+            {text}
+          </Text>
+        );
+      },
+    },
     {
       title: t('操作'),
       key: 'action',
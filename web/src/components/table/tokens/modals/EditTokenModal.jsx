@@ -67,6 +67,7 @@ const EditTokenModal = (props) => {
   const formApiRef = useRef(null);
   const [models, setModels] = useState([]);
   const [groups, setGroups] = useState([]);
+  const [organizations, setOrganizations] = useState([]);
   const [showQuotaInput, setShowQuotaInput] = useState(false);
   const isEdit = props.editingToken.id !== undefined;
 
@@ -81,6 +82,13 @@ const EditTokenModal = (props) => {
     allow_ips: '',
     group: '',
     cross_group_retry: false,
+    tpm_limit: 0,
+    concurrency_limit: 0,
+    quota_period: '',
+    period_quota_limit: 0,
+    period_limit_amount: 0,
+    organization_id: 0,
+    response_cache_enabled: false,
     tokenCount: 1,
   });
 
@@ -133,6 +141,16 @@ const EditTokenModal = (props) => {
     }
   };
 
+  const loadOrganizations = async () => {
+    let res = await API.get(`/api/organization/self`);
+    const { success, data } = res.data;
+    if (success) {
+      setOrganizations(
+        (data || []).map((org) => ({ label: org.name, value: org.id })),
+      );
+    }
+  };
+
   const loadGroups = async () => {
     let res = await API.get(`/api/user/self/groups`);
     const { success, message, data } = res.data;
@@ -172,6 +190,9 @@ const EditTokenModal = (props) => {
       data.remain_amount = Number(
         quotaToDisplayAmount(data.remain_quota || 0).toFixed(6),
       );
+      data.period_limit_amount = Number(
+        quotaToDisplayAmount(data.period_quota_limit || 0).toFixed(6),
+      );
       if (formApiRef.current) {
         formApiRef.current.setValues({ ...getInitValues(), ...data });
       }
@@ -189,6 +210,7 @@ const EditTokenModal = (props) => {
     }
     loadModels();
     loadGroups();
+    loadOrganizations();
   }, [props.editingToken.id]);
 
   useEffect(() => {
@@ -222,6 +244,9 @@ const EditTokenModal = (props) => {
       localInputs.remain_quota = localInputs.unlimited_quota
         ? 0
         : displayAmountToQuota(localInputs.remain_amount);
+      localInputs.period_quota_limit = localInputs.quota_period
+        ? displayAmountToQuota(localInputs.period_limit_amount)
+        : 0;
       if (!localInputs.unlimited_quota && localInputs.remain_quota <= 0) {
         showError(t('请输入金额'));
         setLoading(false);
@@ -265,6 +290,9 @@ const EditTokenModal = (props) => {
         localInputs.remain_quota = localInputs.unlimited_quota
           ? 0
           : displayAmountToQuota(localInputs.remain_amount);
+        localInputs.period_quota_limit = localInputs.quota_period
+          ? displayAmountToQuota(localInputs.period_limit_amount)
+          : 0;
         if (!localInputs.unlimited_quota && localInputs.remain_quota <= 0) {
           showError(t('请输入金额'));
           setLoading(false);
@@ -410,6 +438,22 @@ const EditTokenModal = (props) => {
                       />
                     )}
                   </Col>
+                  {organizations.length > 0 && (
+                    <Col span={24}>
+                      <Form.Select
+                        field='organization_id'
+                        label={t('扣费钱包')}
+                        optionList={[
+                          { label: t('个人钱包'), value: 0 },
+                          ...organizations,
+                        ]}
+                        extraText={t(
+                          '绑定组织后，该令牌的请求将从组织共享钱包扣费',
+                        )}
+                        style={{ width: '100%' }}
+                      />
+                    </Col>
+                  )}
                   <Col
                     span={24}
                     style={{
@@ -425,6 +469,16 @@ const EditTokenModal = (props) => {
                       )}
                     />
                   </Col>
+                  <Col span={24}>
+                    <Form.Switch
+                      field='response_cache_enabled'
+                      label={t('响应缓存')}
+                      size='default'
+                      extraText={t(
+                        '开启后，相同的请求将直接返回缓存的历史响应',
+                      )}
+                    />
+                  </Col>
                   <Col xs={24} sm={24} md={24} lg={10} xl={10}>
                     <Form.DatePicker
                       field='expired_time'
@@ -588,6 +642,32 @@ const EditTokenModal = (props) => {
                       )}
                     />
                   </Col>
+                  <Col span={12}>
+                    <Form.Select
+                      field='quota_period'
+                      label={t('周期消费上限')}
+                      optionList={[
+                        { label: t('不限制'), value: '' },
+                        { label: t('每日'), value: 'daily' },
+                        { label: t('每周'), value: 'weekly' },
+                        { label: t('每月'), value: 'monthly' },
+                      ]}
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
+                  <Col span={12}>
+                    <Form.InputNumber
+                      field='period_limit_amount'
+                      label={t('周期上限金额')}
+                      prefix={getCurrencyConfig().symbol}
+                      precision={6}
+                      disabled={!values.quota_period}
+                      min={0}
+                      step={0.000001}
+                      extraText={t('周期按服务器时区计算，每周从周一开始')}
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
                 </Row>
               </Card>
 
@@ -640,6 +720,25 @@ const EditTokenModal = (props) => {
                       style={{ width: '100%' }}
                     />
                   </Col>
+                  <Col span={12}>
+                    <Form.InputNumber
+                      field='tpm_limit'
+                      label={t('TPM 限制')}
+                      min={0}
+                      step={1000}
+                      extraText={t('0 表示不限制')}
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
+                  <Col span={12}>
+                    <Form.InputNumber
+                      field='concurrency_limit'
+                      label={t('并发限制')}
+                      min={0}
+                      extraText={t('0 表示不限制')}
+                      style={{ width: '100%' }}
+                    />
+                  </Col>
                 </Row>
               </Card>
             </div>
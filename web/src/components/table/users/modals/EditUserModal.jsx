@@ -94,6 +94,8 @@ const EditUserModal = (props) => {
     quota_amount: 0,
     group: 'default',
     remark: '',
+    tpm_limit: 0,
+    concurrency_limit: 0,
   });
 
   const fetchGroups = async () => {
@@ -368,6 +370,27 @@ const EditUserModal = (props) => {
                         />
                       </Col>
 
+                      <Col span={12}>
+                        <Form.InputNumber
+                          field='tpm_limit'
+                          label={t('TPM 限制')}
+                          min={0}
+                          step={1000}
+                          extraText={t('0 表示使用分组配置')}
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+
+                      <Col span={12}>
+                        <Form.InputNumber
+                          field='concurrency_limit'
+                          label={t('并发限制')}
+                          min={0}
+                          extraText={t('0 表示使用分组配置')}
+                          style={{ width: '100%' }}
+                        />
+                      </Col>
+
                       <Col span={10}>
                         <Form.InputNumber
                           field='quota_amount'
@@ -34,7 +34,9 @@ export default function SettingsSensitiveWords(props) {
   const [inputs, setInputs] = useState({
     CheckSensitiveEnabled: false,
     CheckSensitiveOnPromptEnabled: false,
+    CheckSensitiveOnCompletionEnabled: false,
     SensitiveWords: '',
+    'output_sensitive_setting.group_policies': '',
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -125,6 +127,21 @@ export default function SettingsSensitiveWords(props) {
                   }
                 />
               </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.Switch
+                  field={'CheckSensitiveOnCompletionEnabled'}
+                  label={t('启用输出内容检查')}
+                  size='default'
+                  checkedText='｜'
+                  uncheckedText='〇'
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      CheckSensitiveOnCompletionEnabled: value,
+                    })
+                  }
+                />
+              </Col>
             </Row>
             <Row>
               <Col xs={24} sm={12} md={8} lg={8} xl={8}>
@@ -143,6 +160,24 @@ export default function SettingsSensitiveWords(props) {
                   autosize={{ minRows: 6, maxRows: 12 }}
                 />
               </Col>
+              <Col xs={24} sm={12} md={8} lg={8} xl={8}>
+                <Form.TextArea
+                  label={t('分组输出处理策略')}
+                  extraText={t(
+                    'JSON 格式，键为分组名，值为 mask（替换）、truncate（截断并停止）或 log（仅记录）',
+                  )}
+                  placeholder={'{"default": "mask", "vip": "log"}'}
+                  field={'output_sensitive_setting.group_policies'}
+                  onChange={(value) =>
+                    setInputs({
+                      ...inputs,
+                      'output_sensitive_setting.group_policies': value,
+                    })
+                  }
+                  style={{ fontFamily: 'JetBrains Mono, Consolas' }}
+                  autosize={{ minRows: 6, maxRows: 12 }}
+                />
+              </Col>
             </Row>
             <Row>
               <Button size='default' onClick={onSubmit}>
@@ -39,6 +39,8 @@ export default function RequestRateLimit(props) {
     ModelRequestRateLimitSuccessCount: 1000,
     ModelRequestRateLimitDurationMinutes: 1,
     ModelRequestRateLimitGroup: '',
+    ModelRequestUsageLimitGroup: '',
+    ModelRequestRateLimitModelRules: '',
   });
   const refForm = useRef();
   const [inputsRow, setInputsRow] = useState(inputs);
@@ -229,6 +231,99 @@ export default function RequestRateLimit(props) {
                 />
               </Col>
             </Row>
+            <Row>
+              <Col xs={24} sm={16}>
+                <Form.TextArea
+                  label={t('模型速率限制规则')}
+                  placeholder={t(
+                    '[\n  {"group": "default", "model": "text-embedding-", "match": "prefix", "total_count": 0, "success_count": 5000},\n  {"group": "*", "model": "^o[0-9]", "match": "regex", "total_count": 20, "success_count": 10}\n]',
+                  )}
+                  field={'ModelRequestRateLimitModelRules'}
+                  autosize={{ minRows: 5, maxRows: 15 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => verifyJSON(value),
+                      message: t('不是合法的 JSON 字符串'),
+                    },
+                  ]}
+                  extraText={
+                    <div>
+                      <p>{t('说明：')}</p>
+                      <ul>
+                        <li>
+                          {t(
+                            '使用 JSON 数组格式，按顺序匹配，命中的第一条规则生效；group 为空或 * 时匹配所有分组。',
+                          )}
+                        </li>
+                        <li>
+                          {t(
+                            'match 可选 prefix（前缀，默认）、regex（正则）、exact（精确）。',
+                          )}
+                        </li>
+                        <li>
+                          {t(
+                            '命中规则的请求使用规则独立的计数器，不计入分组速率限制；total_count、success_count 为 0 表示不限制。',
+                          )}
+                        </li>
+                      </ul>
+                    </div>
+                  }
+                  onChange={(value) => {
+                    setInputs({
+                      ...inputs,
+                      ModelRequestRateLimitModelRules: value,
+                    });
+                  }}
+                />
+              </Col>
+            </Row>
+            <Row>
+              <Col xs={24} sm={16}>
+                <Form.TextArea
+                  label={t('分组 TPM 与并发限制')}
+                  placeholder={t(
+                    '{\n  "default": {"tpm": 100000, "concurrency": 5},\n  "vip": {"tpm": 0, "concurrency": 20}\n}',
+                  )}
+                  field={'ModelRequestUsageLimitGroup'}
+                  autosize={{ minRows: 5, maxRows: 15 }}
+                  trigger='blur'
+                  stopValidateWithError
+                  rules={[
+                    {
+                      validator: (rule, value) => verifyJSON(value),
+                      message: t('不是合法的 JSON 字符串'),
+                    },
+                  ]}
+                  extraText={
+                    <div>
+                      <p>{t('说明：')}</p>
+                      <ul>
+                        <li>
+                          {t(
+                            '使用 JSON 对象格式，格式为：{"组名": {"tpm": 每分钟最多 token 数, "concurrency": 最多同时进行的请求数}}，0 表示不限制。',
+                          )}
+                        </li>
+                        <li>
+                          {t(
+                            '限制作用于分组内的每个用户；用户单独设置的 TPM 与并发限制优先于分组配置，令牌上设置的限制会同时生效。',
+                          )}
+                        </li>
+                        <li>
+                          {t(
+                            '此限制不受上方开关控制，超出限制时返回 429 及 Retry-After 响应头。',
+                          )}
+                        </li>
+                      </ul>
+                    </div>
+                  }
+                  onChange={(value) => {
+                    setInputs({ ...inputs, ModelRequestUsageLimitGroup: value });
+                  }}
+                />
+              </Col>
+            </Row>
             <Row>
               <Button size='default' onClick={onSubmit}>
                 {t('保存模型速率限制')}